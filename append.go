@@ -0,0 +1,67 @@
+package hybridbuffer
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+
+	"schneider.vip/hybridbuffer/storage"
+)
+
+// Appender is an optional interface for storage backends that can continue an
+// existing object instead of replacing it
+// Buffers created with AttachStorage use it to append writes to the attached data.
+type Appender interface {
+	Append() (io.WriteCloser, error)
+}
+
+// AttachStorage creates a buffer in storage mode on an existing storage object
+// holding size logical bytes, e.g. to resume processing across process boundaries
+// The object is read through the configured middlewares, so it must have been
+// written with the same ones. Writes are appended through the backend's Appender;
+// backends without it get the data copied into a new object first.
+//
+// Appending starts a new middleware stream after the existing one, so every
+// middleware must be able to read concatenated streams. Framing formats such as
+// gzip (multi-member streams) work; formats with a trailer or a final-chunk marker,
+// such as the built-in encryption, do not.
+//
+// Like every buffer, Reset and Close remove the object. Use a backend whose
+// Remove is a no-op to keep it beyond the buffer's lifetime.
+func AttachStorage(provider func() storage.Backend, size int64, opts ...Option) Buffer {
+	b := newBuffer(bytes.Buffer{}, append(opts[:len(opts):len(opts)], WithStorage(provider))).requireKey()
+	b.setStorageBackend(b.storageProvider())
+	b.usingStorage = true
+	b.attached = true
+	b.size = int(size)
+	return b
+}
+
+// reopenWriteStream continues writing after the write stream was finalized
+// Attached storage is appended to if the backend supports it; otherwise the
+// stored data is copied into a new object, which works with all middlewares.
+func (b *hybridBuffer) reopenWriteStream() error {
+	appender, ok := b.storageBackend.(Appender)
+	if !b.attached || !ok {
+		return b.rewriteStorage(b.size)
+	}
+
+	// Reading resumes on a fresh stream that includes the appended data
+	if b.readStream != nil {
+		b.readStream.Close()
+		b.readStream = nil
+	}
+
+	writeStream, err := appender.Append()
+	if err != nil {
+		return fmt.Errorf("failed to open storage append stream: %w", err)
+	}
+	if b.ctx != nil {
+		writeStream = &contextWriter{ctx: b.ctx, WriteCloser: writeStream}
+	}
+	b.writeStream = b.wrapWriteStream(writeStream)
+	if name := storageFileName(writeStream); name != "" {
+		b.storageFile = name
+	}
+	return nil
+}
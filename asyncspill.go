@@ -0,0 +1,104 @@
+package hybridbuffer
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"sync"
+)
+
+// asyncSpillQueue is the number of writes that may be pending before Write blocks
+const asyncSpillQueue = 16
+
+// asyncWriter writes to a storage stream in a background goroutine, so that
+// spilling and encoding by middlewares do not stall the caller
+type asyncWriter struct {
+	dst    io.WriteCloser
+	queue  chan []byte   // Pending writes in stream order
+	idle   chan struct{} // Signalled when the goroutine reaches a wait marker
+	exited chan struct{} // Closed when the goroutine stopped
+	mu     sync.Mutex
+	err    error // First error of the goroutine
+	closed bool
+}
+
+// newAsyncWriter starts writing to dst in the background, beginning with first
+// The writer takes ownership of first.
+func newAsyncWriter(dst io.WriteCloser, first []byte) *asyncWriter {
+	w := &asyncWriter{
+		dst:    dst,
+		queue:  make(chan []byte, asyncSpillQueue),
+		idle:   make(chan struct{}),
+		exited: make(chan struct{}),
+	}
+	if len(first) > 0 {
+		w.queue <- first
+	}
+
+	go w.drain()
+	return w
+}
+
+// drain writes the queued data until the queue is closed
+// After an error the remaining data is discarded.
+func (w *asyncWriter) drain() {
+	defer close(w.exited)
+
+	for p := range w.queue {
+		if p == nil {
+			w.idle <- struct{}{}
+			continue
+		}
+		if w.failed() != nil {
+			continue
+		}
+		if _, err := w.dst.Write(p); err != nil {
+			w.mu.Lock()
+			w.err = err
+			w.mu.Unlock()
+		}
+	}
+}
+
+// failed returns the first error of the goroutine
+func (w *asyncWriter) failed() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.err
+}
+
+// Write queues a copy of p, blocking only while the queue is full
+// Errors of earlier background writes are returned here.
+func (w *asyncWriter) Write(p []byte) (int, error) {
+	if w.closed {
+		return 0, errors.New("hybridbuffer: write to closed spill stream")
+	}
+	if err := w.failed(); err != nil {
+		return 0, err
+	}
+	if len(p) > 0 {
+		w.queue <- bytes.Clone(p)
+	}
+	return len(p), nil
+}
+
+// wait blocks until all data queued so far is written
+func (w *asyncWriter) wait() error {
+	if !w.closed {
+		w.queue <- nil // Wait marker, Write never queues nil
+		<-w.idle
+	}
+	return w.failed()
+}
+
+// Close waits until all queued data is written and closes the storage stream
+func (w *asyncWriter) Close() error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+
+	close(w.queue)
+	<-w.exited
+	return errors.Join(w.failed(), w.dst.Close())
+}
@@ -2,8 +2,18 @@ package hybridbuffer
 
 import (
 	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"hash"
 	"io"
+	"io/fs"
+	"os"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"syscall"
 	"unicode/utf8"
 
 	"schneider.vip/hybridbuffer/middleware"
@@ -11,15 +21,56 @@ import (
 	"schneider.vip/hybridbuffer/storage/filesystem"
 )
 
+// ErrClosed is returned when a buffer is used after Close
+var ErrClosed = errors.New("hybridbuffer: buffer closed")
+
+// ErrMaxSizeExceeded is returned when a write would grow the buffer beyond its maximum size
+var ErrMaxSizeExceeded = errors.New("hybridbuffer: maximum size exceeded")
+
+// ErrThresholdExceeded is returned by buffers created with WithMemoryOnly when
+// a write would grow the buffer beyond its threshold
+var ErrThresholdExceeded = errors.New("hybridbuffer: memory threshold exceeded")
+
+// ErrInvalidOption is returned by NewWithError for invalid configuration
+var ErrInvalidOption = errors.New("hybridbuffer: invalid option")
+
+// errInvalidKey marks an invalid WithEncryptionKey, which New does not ignore
+var errInvalidKey = errors.New("invalid encryption key")
+
+// ErrInvalidMark is returned by Rollback for a mark that does not belong to the
+// buffer's current contents, e.g. after Reset
+var ErrInvalidMark = errors.New("hybridbuffer: invalid mark")
+
+// ErrStorageFull is returned when spilling fails because the storage has no space
+// left, e.g. a full spill directory (ENOSPC). It wraps the original error.
+var ErrStorageFull = errors.New("hybridbuffer: storage full")
+
+// ErrReadOnly is returned by write methods of buffers created with WithReadOnly
+var ErrReadOnly = errors.New("hybridbuffer: buffer is read-only")
+
+// ErrBufferDirty is returned by AddMiddleware once data has been written
+var ErrBufferDirty = errors.New("hybridbuffer: buffer already holds data")
+
+// ErrStale is returned by readers from NewReader and NewReadSeeker once the buffer
+// they were created from has been reset, truncated, compacted or closed
+var ErrStale = errors.New("hybridbuffer: reader is stale")
+
 // Buffer defines the interface for hybrid memory/disk buffers
 type Buffer interface {
 	io.ReadWriter
+	io.WriterAt
 	io.ReaderFrom
 	io.WriterTo
 	io.ByteReader
 	io.ByteWriter
 	io.StringWriter
 
+	// Reads exactly len(p) bytes like io.ReadFull
+	ReadFull(p []byte) (int, error)
+
+	// Bounded ReadFrom, ErrMaxSizeExceeded if r has more than max bytes
+	ReadFromN(r io.Reader, max int64) (int64, error)
+
 	// bytes.Buffer compatible methods
 	ReadBytes(delim byte) ([]byte, error)
 	ReadString(delim byte) (string, error)
@@ -27,45 +78,212 @@ type Buffer interface {
 	WriteRune(r rune) (n int, err error)
 	Next(n int) []byte
 
+	// Non-consuming copy of the unread contents
+	CopyTo(w io.Writer) (int64, error)
+
+	// Copying with progress reporting after each chunk
+	WriteToWithProgress(w io.Writer, progress func(written int64)) (int64, error)
+	ReadFromWithProgress(r io.Reader, progress func(read int64)) (int64, error)
+
+	// Convenience writers, Append and AppendString panic on error
+	WriteStrings(ss ...string) (int, error)
+	Writef(format string, args ...any) (int, error)
+	Append(p []byte) Buffer
+	AppendString(s string) Buffer
+
 	// Data access (WARNING: Unlike bytes.Buffer, these consume the buffer content!)
 	Bytes() []byte
 	String() string
+	BytesNoCopy() []byte
+
+	// Non-consuming state summary when printed with fmt, e.g. with %v or %#v
+	fmt.GoStringer
+	fmt.Formatter
+
+	// Independent, non-consuming access
+	NewReader() (io.ReadCloser, error)
+	NewReadSeeker() (io.ReadSeekCloser, error)
+	AsFile(name string) fs.File
+
+	// JSON encoding of the unread contents as base64 (non-consuming)
+	json.Marshaler
+	json.Unmarshaler
+
+	// Comparison of the unread contents (non-consuming)
+	Equal(other Buffer) (bool, error)
+
+	// MIME type of the unread contents (non-consuming)
+	DetectContentType() (string, error)
+
+	// Bytes stored by the backend after middlewares, for Sizer and file-based backends
+	StorageSize() (int64, error)
+
+	// Path of the file holding spilled data, for PathProvider and file-based backends
+	StoragePath() (string, bool)
+
+	// Commit written data to durable storage, requires a Syncer write stream
+	Sync() error
+
+	// Digest of all written data, requires WithHash
+	Sum() []byte
+
+	// Middleware names in the order data passes them on write
+	Middlewares() []string
+
+	// Append middlewares before any data is written
+	AddMiddleware(m ...middleware.Middleware) error
+
+	// Identifier set by WithID, "" by default
+	Name() string
 
 	// Size and capacity
 	Len() int
 	Cap() int
 	Available() int
 	Size() int64
+	MemoryBytes() int
+	SpilledBytes() int64
 
 	// Buffer management
 	Reset()
+	ResetKeep()
 	Truncate(n int)
+	TruncateFront(n int)
+	Checkpoint() Mark
+	Rollback(m Mark) error
+	Compact()
 	Grow(n int)
 	Close() error
 }
 
+// Sizer is an optional interface for storage backends that know the size of
+// the stored object, e.g. through a file's Stat or an object store's HEAD request
+// The size is the number of bytes after middlewares, which may differ from the
+// logical size of the buffer.
+type Sizer interface {
+	Size() (int64, error)
+}
+
+// PathProvider is an optional interface for storage backends that keep the data
+// in a local file, e.g. the filesystem backend
+// Path returns the absolute path of the file once Create has run, and "" before.
+type PathProvider interface {
+	Path() string
+}
+
+// Preallocator is an optional interface for storage backends that can reserve
+// space in advance, e.g. to avoid file fragmentation
+// Grow calls Preallocate with the expected total size of the stored data as a hint.
+// Middlewares may change the stored size, so implementations must not change the
+// observable contents or size of the object.
+type Preallocator interface {
+	Preallocate(size int64) error
+}
+
 // hybridBuffer implements Buffer interface
+// All exported methods are safe for concurrent use.
 type hybridBuffer struct {
-	threshold       int
-	size            int
-	offset          int
-	memoryBuffer    bytes.Buffer
-	storageBackend  storage.Backend
-	storageProvider func() storage.Backend
-	writeStream     io.WriteCloser
-	readStream      io.ReadCloser
-	middlewares     []middleware.Middleware
-	usingStorage    bool
-	preAllocSize    int // Size to pre-allocate in memory buffer
+	mu         sync.Mutex
+	cond       *sync.Cond // Signals changes of Len() to blocked writers
+	closeOnce  sync.Once
+	hooks      []func()                  // Callbacks to run once the lock is released
+	generation atomic.Uint64             // Incremented when contents are discarded, invalidating readers
+	readCache  atomic.Pointer[readCache] // Decoded spilled contents, set by readers with WithReadCache
+
+	threshold          int
+	maxSize            int64 // Hard cap on the total size, 0 means unlimited
+	maxRetained        int   // Ring-buffer window size, 0 means disabled
+	maxInFlight        int   // Backpressure limit for unread bytes, 0 means disabled
+	readAhead          int   // Bytes to read ahead from storage, 0 means disabled
+	readCacheSize      int   // Largest contents to keep decoded for NewReader, 0 means disabled
+	asyncSpill         bool  // Write to storage in a background goroutine
+	memoryOnly         bool  // Fail writes beyond the threshold instead of spilling
+	readOnly           bool  // Reject writes once constructed
+	zeroOnReset        bool  // Zero the memory buffer on Reset and Close
+	formatHeader       bool  // Write and validate a header in front of stored data
+	attached           bool  // Storage was attached by AttachStorage, append to it
+	closed             bool
+	size               int
+	offset             int
+	spilled            int64  // Bytes written to storage since creation or Reset
+	compacted          int64  // Bytes dropped from the front by compaction since Reset
+	epoch              uint64 // Incremented by Reset and Close, invalidating marks
+	memoryBuffer       bytes.Buffer
+	storageBackend     storage.Backend
+	storageProvider    func() storage.Backend
+	writeStream        io.WriteCloser
+	readStream         io.ReadCloser
+	middlewares        []middleware.Middleware // Effective pipeline, including gzip and encryption
+	configured         []middleware.Middleware // Added by WithMiddleware, WithPipeline and AddMiddleware
+	pipelined          bool                    // WithPipeline was used, the built-in middlewares join its stages
+	pipelineStart      int                     // Range of the last WithPipeline in configured
+	pipelineEnd        int
+	gzip               middleware.Middleware // Set by WithGzip, runs after middlewares
+	encryption         middleware.Middleware // Set by WithEncryptionKey, WithEncryptionKeyring or WithKeyProvider, runs last
+	deterministicNonce bool                  // Encrypt identical data to identical ciphertext
+	usingStorage       bool
+	preAllocSize       int             // Size to pre-allocate in memory buffer
+	thresholdFunc      func() int      // Replaces threshold for spill decisions, set by WithThresholdFunc
+	ctx                context.Context // Cancels storage operations, nil means none
+	hash               hash.Hash       // Running hash of all written data, set by WithHash
+	logger             func(event string, fields map[string]any)
+	id                 string          // Set by WithID, tags logged events
+	tracer             Tracer          // Traces storage operations, nil means none
+	spanCtx            context.Context // Context of the span in progress, parent of nested spans
+	leakGuard          *leakGuard      // Removes storage if the buffer is leaked without Close
+	storageFile        string          // Name of the *os.File created by the backend, "" if not a file
+	limiter            *MemoryLimiter  // Set by WithMemoryLimiter, nil means the global limiter
+	inMemory           int64           // Bytes registered with the limiter
+
+	storageFallback bool        // Stay in memory if storage fails
+	storageDisabled bool        // Storage failed, remain in memory until Reset
+	onStorageError  func(error) // Called when falling back to memory
+	onError         func(error) // Called for cleanup errors that cannot be returned
+	onSpill         func(size int)
+	onRemove        func()
+
+	optionErrs []error // Invalid options, reported by NewWithError
 }
 
 // New creates a new hybrid buffer with the given options
+// Invalid option values are ignored in favour of the defaults; use NewWithError
+// to detect them. Only an invalid WithEncryptionKey panics, since ignoring it
+// would store spilled data unencrypted.
 func New(opts ...Option) Buffer {
+	return newBuffer(bytes.Buffer{}, opts).requireKey()
+}
+
+// NewWithError creates a new hybrid buffer like New, but returns an error wrapping
+// ErrInvalidOption instead of ignoring invalid options, e.g. a nil WithStorage
+// provider, a negative size, a WithMaxSize below the threshold or an encryption
+// key of the wrong length. All problems found are reported, joined with errors.Join.
+func NewWithError(opts ...Option) (Buffer, error) {
+	buf := newBuffer(bytes.Buffer{}, opts)
+	if err := errors.Join(buf.optionErrs...); err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
+
+// requireKey panics if WithEncryptionKey was given an invalid key
+func (b *hybridBuffer) requireKey() *hybridBuffer {
+	for _, err := range b.optionErrs {
+		if errors.Is(err, errInvalidKey) {
+			panic(err)
+		}
+	}
+	return b
+}
+
+// newBuffer creates a buffer using mem as memory buffer, keeping its capacity
+func newBuffer(mem bytes.Buffer, opts []Option) *hybridBuffer {
 	buf := &hybridBuffer{
-		threshold: 2 << 20, // 2MB default
+		memoryBuffer: mem,
+		threshold:    2 << 20, // 2MB default
 		// Will be set by default WithFilesystemStorage() option below
 		middlewares: []middleware.Middleware{}, // No middlewares by default
 	}
+	buf.cond = sync.NewCond(&buf.mu)
 
 	// Apply default filesystem storage if none specified
 	WithStorage(filesystem.New())(buf)
@@ -74,6 +292,35 @@ func New(opts ...Option) Buffer {
 	for _, opt := range opts {
 		opt(buf)
 	}
+	if buf.maxSize > 0 && buf.maxSize < int64(buf.threshold) {
+		buf.invalidOption("max size %d is below the threshold %d", buf.maxSize, buf.threshold)
+	}
+
+	if buf.deterministicNonce {
+		switch aead := buf.encryption.(type) {
+		case *aesgcmMiddleware:
+			buf.encryption = aead.withDeterministicNonce()
+		case *keyringMiddleware:
+			buf.encryption = aead.withDeterministicNonce()
+		}
+	}
+	if envelope, ok := buf.encryption.(*envelopeMiddleware); ok {
+		ctx := buf.ctx
+		if ctx == nil {
+			ctx = context.Background()
+		}
+		buf.encryption = &envelopeMiddleware{provider: envelope.provider, ctx: ctx, deterministic: buf.deterministicNonce}
+	}
+	buf.configured = buf.middlewares
+	buf.middlewares = buf.withBuiltins(buf.configured)
+
+	// The retained window and the in-flight data always live in memory
+	if buf.maxRetained > buf.threshold {
+		buf.maxRetained = buf.threshold
+	}
+	if buf.maxInFlight > buf.threshold {
+		buf.maxInFlight = buf.threshold
+	}
 
 	// Set default pre-allocation size if not specified
 	if buf.preAllocSize == 0 {
@@ -88,8 +335,11 @@ func New(opts ...Option) Buffer {
 
 // NewFromBytes creates a buffer with initial data
 func NewFromBytes(data []byte, opts ...Option) Buffer {
-	buf := New(opts...)
-	buf.Write(data)
+	buf := newBuffer(bytes.Buffer{}, opts).requireKey()
+	buf.fill(func() error {
+		_, err := buf.Write(data)
+		return err
+	})
 	return buf
 }
 
@@ -98,48 +348,246 @@ func NewFromString(s string, opts ...Option) Buffer {
 	return NewFromBytes([]byte(s), opts...)
 }
 
+// NewFromReader creates a buffer filled with everything read from r until EOF
+// Large sources spill to storage as usual. On error the buffer is closed and
+// the error is returned. The caller still owns r and is responsible for closing it.
+func NewFromReader(r io.Reader, opts ...Option) (Buffer, error) {
+	buf := newBuffer(bytes.Buffer{}, opts).requireKey()
+	err := buf.fill(func() error {
+		_, err := buf.ReadFrom(r)
+		return err
+	})
+	if err != nil {
+		buf.Close()
+		return nil, err
+	}
+	return buf, nil
+}
+
+// fill writes the initial contents of a new buffer, before WithReadOnly takes effect
+func (b *hybridBuffer) fill(write func() error) error {
+	readOnly := b.readOnly
+	b.readOnly = false
+	defer func() { b.readOnly = readOnly }()
+	return write()
+}
+
+// NewFromFile creates a buffer filled with the contents of the file at path
+// Files larger than the threshold spill to storage, so this loads large files
+// with a bounded memory footprint. On error the buffer is closed, removing any storage.
+func NewFromFile(path string, opts ...Option) (Buffer, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file: %w", err)
+	}
+	defer file.Close()
+
+	buf, err := NewFromReader(file, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+	return buf, nil
+}
+
 // Write implements io.Writer
+// With backpressure enabled, Write blocks until concurrent reads make room.
+// In storage mode, a Write after a Read usually has to copy all stored data into a
+// new storage object, because reading finalized the write stream; interleaving
+// writes and reads then costs O(n²). Raw storage on an *os.File, as written by the
+// filesystem backend without middlewares or read-ahead, stays open for reading,
+// so writes continue on the same stream.
 func (b *hybridBuffer) Write(data []byte) (n int, err error) {
+	b.mu.Lock()
+	defer b.unlock()
+
+	if err := b.checkWritable(); err != nil {
+		return 0, err
+	}
+	return b.writeLimited(data)
+}
+
+// checkWritable returns the error a write fails with in the current state, or nil
+// The caller must hold the lock.
+func (b *hybridBuffer) checkWritable() error {
+	if b.closed {
+		return ErrClosed
+	}
+	if b.readOnly {
+		return ErrReadOnly
+	}
+	return nil
+}
+
+// writeLimited writes data, blocking for backpressure if enabled
+func (b *hybridBuffer) writeLimited(data []byte) (n int, err error) {
+	if b.maxInFlight > 0 {
+		return b.writeBlocking(data)
+	}
+	return b.write(data)
+}
+
+// writeBlocking writes data in chunks that fit into the backpressure limit,
+// waiting for reads to drain the buffer in between
+func (b *hybridBuffer) writeBlocking(data []byte) (n int, err error) {
+	for len(data) > 0 {
+		for !b.closed && b.unread() >= b.maxInFlight {
+			b.cond.Wait()
+		}
+		if b.closed {
+			return n, ErrClosed
+		}
+
+		chunk := data
+		if space := b.maxInFlight - b.unread(); len(chunk) > space {
+			chunk = chunk[:space]
+		}
+
+		// Reclaim consumed memory instead of spilling to storage
+		if b.memoryBuffer.Len()+len(chunk) > b.threshold {
+			b.compactMemory()
+		}
+
+		m, err := b.write(chunk)
+		n += m
+		if err != nil {
+			return n, err
+		}
+		data = data[m:]
+	}
+	return n, nil
+}
+
+// write appends data to memory or storage
+func (b *hybridBuffer) write(data []byte) (n int, err error) {
 	if len(data) == 0 {
 		return 0, nil
 	}
 
+	// Enforce the hard size cap, writing up to the limit
+	var limitErr error
+	if b.maxSize > 0 && int64(b.size)+int64(len(data)) > b.maxSize {
+		allowed := b.maxSize - int64(b.size)
+		if allowed <= 0 {
+			return 0, ErrMaxSizeExceeded
+		}
+		data = data[:allowed]
+		limitErr = ErrMaxSizeExceeded
+	}
+
+	if b.maxRetained > 0 {
+		return b.writeRetained(data), limitErr
+	}
+
+	// Never spill, write up to the threshold
+	if b.memoryOnly && b.memoryBuffer.Len()+len(data) > b.threshold {
+		b.compactMemory()
+		allowed := b.threshold - b.memoryBuffer.Len()
+		if allowed <= 0 {
+			return 0, ErrThresholdExceeded
+		}
+		if allowed < len(data) {
+			data = data[:allowed]
+			limitErr = ErrThresholdExceeded
+		}
+	}
+
 	// Check if we need to switch to storage
-	if !b.usingStorage && b.memoryBuffer.Len()+len(data) > b.threshold {
+	if !b.usingStorage && !b.storageDisabled && !b.memoryOnly &&
+		(b.memoryBuffer.Len()+len(data) > b.spillThreshold() || b.memoryLimiter().exceeded(len(data))) {
 		if err = b.flushToStorage(); err != nil {
-			return 0, fmt.Errorf("failed to flush to storage: %w", err)
+			if !b.storageFallback {
+				return 0, fmt.Errorf("failed to flush to storage: %w", err)
+			}
+			b.fallbackToMemory(err)
 		}
 	}
 
 	if b.usingStorage {
 		// Write to storage
 		if b.writeStream == nil {
-			if err = b.openWriteStream(); err != nil {
-				return 0, fmt.Errorf("failed to open write stream: %w", err)
+			// The stream was finalized for reading or the storage was attached
+			if err = b.reopenWriteStream(); err != nil {
+				return 0, fmt.Errorf("failed to reopen write stream: %w", err)
 			}
 		}
 		n, err = b.writeStream.Write(data)
+		b.spilled += int64(n)
+		if err != nil {
+			err = storageError(err)
+		}
 	} else {
 		// Write to memory
 		n, err = b.memoryBuffer.Write(data)
 	}
 
+	if b.hash != nil {
+		b.hash.Write(data[:n])
+	}
 	if err == nil {
 		b.size += n
+		err = limitErr
 	}
 	return n, err
 }
 
+// spillThreshold returns the memory size beyond which writes spill to storage
+func (b *hybridBuffer) spillThreshold() int {
+	if b.thresholdFunc != nil {
+		return b.thresholdFunc()
+	}
+	return b.threshold
+}
+
+// writeRetained appends data in ring-buffer mode, dropping the oldest
+// unread bytes so that at most maxRetained bytes remain
+func (b *hybridBuffer) writeRetained(data []byte) int {
+	n := len(data)
+	if b.hash != nil {
+		b.hash.Write(data)
+	}
+	if len(data) > b.maxRetained {
+		data = data[len(data)-b.maxRetained:]
+	}
+
+	if excess := b.unread() + len(data) - b.maxRetained; excess > 0 {
+		b.offset += excess
+	}
+
+	// Reclaim the dropped prefix instead of growing beyond the threshold
+	if b.memoryBuffer.Len()+len(data) > b.threshold {
+		b.compactMemory()
+	}
+
+	b.memoryBuffer.Write(data)
+	b.size += len(data)
+	return n
+}
+
 // Read implements io.Reader
+// Memory and storage mode follow the same contract as bytes.Buffer: the final bytes
+// are returned with a nil error and the next call returns 0, io.EOF.
+// In storage mode, the first Read finalizes the write stream so that middlewares
+// flush their data; see Write for the cost of writing afterwards.
 func (b *hybridBuffer) Read(data []byte) (n int, err error) {
+	b.mu.Lock()
+	defer b.unlock()
+
+	if b.closed {
+		return 0, ErrClosed
+	}
+
+	return b.read(data)
+}
+
+// read reads from the current offset of memory or storage
+func (b *hybridBuffer) read(data []byte) (n int, err error) {
 	if b.offset >= b.size {
 		return 0, io.EOF
 	}
 
-	// Ensure write stream is closed before reading (critical for encryption)
-	if b.writeStream != nil {
-		b.writeStream.Close()
-		b.writeStream = nil
+	// Ensure written data is readable (critical for encryption)
+	if err = b.settleWriteStream(); err != nil {
+		return 0, err
 	}
 
 	// Read from current offset
@@ -157,6 +605,10 @@ func (b *hybridBuffer) Read(data []byte) (n int, err error) {
 			}
 		}
 		n, err = b.readStream.Read(data[:bytesToRead])
+		if n > 0 && err == io.EOF {
+			// Storage streams may return EOF with the last chunk, report it on the next call
+			err = nil
+		}
 	} else {
 		// Read from memory buffer
 		memData := b.memoryBuffer.Bytes()
@@ -170,15 +622,61 @@ func (b *hybridBuffer) Read(data []byte) (n int, err error) {
 	}
 
 	b.offset += n
+	if n > 0 && b.maxInFlight > 0 {
+		b.cond.Broadcast()
+	}
+	return n, err
+}
+
+// ReadFull reads exactly len(p) bytes, looping over short reads from storage
+// It follows io.ReadFull: the error is io.EOF only if no bytes were read, and
+// io.ErrUnexpectedEOF if the buffer ran out after a partial fill.
+func (b *hybridBuffer) ReadFull(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.unlock()
+
+	if b.closed {
+		return 0, ErrClosed
+	}
+
+	n, err := b.readFull(p)
+	switch {
+	case n == len(p):
+		err = nil
+	case n > 0 && err == io.EOF:
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
+// readFull reads until data is full, since storage streams may return short reads
+func (b *hybridBuffer) readFull(data []byte) (n int, err error) {
+	for n < len(data) && err == nil {
+		var m int
+		m, err = b.read(data[n:])
+		n += m
+	}
 	return n, err
 }
 
 // WriteTo implements io.WriterTo
+// In storage mode the read stream is copied to w directly in large chunks.
 func (b *hybridBuffer) WriteTo(w io.Writer) (int64, error) {
+	b.mu.Lock()
+	defer b.unlock()
+
+	if b.closed {
+		return 0, ErrClosed
+	}
+
+	if b.usingStorage {
+		return b.writeStorageTo(w)
+	}
+
 	var n int64
 	data := make([]byte, 512)
 	for {
-		rN, rErr := b.Read(data)
+		rN, rErr := b.read(data)
 		if rErr != nil && rErr != io.EOF {
 			return n, rErr
 		}
@@ -197,8 +695,95 @@ func (b *hybridBuffer) WriteTo(w io.Writer) (int64, error) {
 	}
 }
 
+// writeStorageTo streams the unread storage data to w, consuming it
+func (b *hybridBuffer) writeStorageTo(w io.Writer) (int64, error) {
+	remaining := int64(b.unread())
+	if remaining == 0 {
+		return 0, nil
+	}
+
+	// Ensure written data is readable (critical for encryption)
+	if err := b.settleWriteStream(); err != nil {
+		return 0, err
+	}
+	b.useRawFile()
+	if err := b.openReadStream(); err != nil {
+		return 0, fmt.Errorf("failed to open read stream: %w", err)
+	}
+
+	// A raw *os.File lets io.Copy use sendfile, splice or copy_file_range
+	n, err := io.Copy(w, io.LimitReader(b.readStream, remaining))
+	b.offset += int(n)
+	if n > 0 && b.maxInFlight > 0 {
+		b.cond.Broadcast()
+	}
+	if err == nil && n < remaining {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
+// useRawFile makes the stored file, positioned at the read offset, the read stream
+// so copies to files and sockets can move the data within the kernel
+// It only applies to raw storage on backends whose Open returns an *os.File, such
+// as the filesystem backend, and not with WithContext, which needs to check for
+// cancellation between reads. Failures leave the read stream as it is.
+func (b *hybridBuffer) useRawFile() {
+	if _, ok := b.readStream.(*os.File); ok || !b.rawStorage() || b.ctx != nil {
+		return
+	}
+
+	raw, err := b.storageBackend.Open()
+	if err != nil {
+		return
+	}
+	f, ok := raw.(*os.File)
+	if !ok {
+		raw.Close()
+		return
+	}
+	if _, err := f.Seek(int64(b.offset), io.SeekStart); err != nil {
+		f.Close()
+		return
+	}
+
+	if b.readStream != nil {
+		b.readStream.Close()
+	}
+	b.readStream = f
+}
+
+// CopyTo writes the unread contents to w without consuming them
+// It is the non-consuming sibling of WriteTo: the read offset is preserved, so the
+// same contents can be sent to several destinations. In storage mode the data is
+// streamed from an independent read stream without loading it into memory.
+// The buffer is not locked while writing to w.
+func (b *hybridBuffer) CopyTo(w io.Writer) (int64, error) {
+	r, unread, err := b.unreadReader()
+	if err != nil {
+		return 0, err
+	}
+	defer r.Close()
+
+	n, err := io.Copy(w, r)
+	if err == nil && n < int64(unread) {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
 // ReadFrom implements io.ReaderFrom
+// Sources implementing io.WriterTo write directly into the buffer in large chunks.
 func (b *hybridBuffer) ReadFrom(r io.Reader) (int64, error) {
+	if err := b.writable(); err != nil {
+		return 0, err
+	}
+
+	if wt, ok := r.(io.WriterTo); ok {
+		// Hide our own ReadFrom so the source cannot call back into it
+		return wt.WriteTo(writerOnly{b})
+	}
+
 	var n int64
 	data := make([]byte, 512)
 	for {
@@ -221,12 +806,76 @@ func (b *hybridBuffer) ReadFrom(r io.Reader) (int64, error) {
 	}
 }
 
+// ReadFromN reads from r until EOF like ReadFrom, but at most max bytes
+// If r has more than max bytes, the first max bytes are kept and ErrMaxSizeExceeded
+// is returned; one byte beyond the limit has been consumed from r to detect this.
+// Unlike WithMaxSize, the limit applies to this call only.
+func (b *hybridBuffer) ReadFromN(r io.Reader, max int64) (int64, error) {
+	n, err := b.ReadFrom(io.LimitReader(r, max))
+	if err != nil || n < max {
+		return n, err
+	}
+
+	var probe [1]byte
+	if m, _ := io.ReadFull(r, probe[:]); m > 0 {
+		return n, ErrMaxSizeExceeded
+	}
+	return n, nil
+}
+
+// writable returns ErrClosed or ErrReadOnly if the buffer rejects writes
+func (b *hybridBuffer) writable() error {
+	b.mu.Lock()
+	defer b.unlock()
+
+	return b.checkWritable()
+}
+
 // WriteByte implements io.ByteWriter
 func (b *hybridBuffer) WriteByte(c byte) error {
 	_, err := b.Write([]byte{c})
 	return err
 }
 
+// WriteStrings writes the strings in order
+// It stops at the first error and returns the number of bytes written so far.
+func (b *hybridBuffer) WriteStrings(ss ...string) (n int, err error) {
+	for _, s := range ss {
+		m, err := b.WriteString(s)
+		n += m
+		if err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// Writef formats according to a format specifier and writes the result
+// It formats through fmt.Fprintf, which avoids the intermediate string of
+// WriteString(fmt.Sprintf(...)), and spills like any other write.
+func (b *hybridBuffer) Writef(format string, args ...any) (int, error) {
+	return fmt.Fprintf(b, format, args...)
+}
+
+// Append writes p and returns the buffer for chaining
+// It panics if the write fails, e.g. with ErrMaxSizeExceeded or a storage error.
+// Use Write to handle errors instead.
+func (b *hybridBuffer) Append(p []byte) Buffer {
+	if _, err := b.Write(p); err != nil {
+		panic(fmt.Errorf("hybridbuffer: append failed: %w", err))
+	}
+	return b
+}
+
+// AppendString writes s and returns the buffer for chaining
+// It panics if the write fails, like Append.
+func (b *hybridBuffer) AppendString(s string) Buffer {
+	if _, err := b.WriteString(s); err != nil {
+		panic(fmt.Errorf("hybridbuffer: append failed: %w", err))
+	}
+	return b
+}
+
 // WriteRune writes a rune (compatible with bytes.Buffer)
 func (b *hybridBuffer) WriteRune(r rune) (n int, err error) {
 	var buf [utf8.UTFMax]byte
@@ -235,14 +884,60 @@ func (b *hybridBuffer) WriteRune(r rune) (n int, err error) {
 }
 
 // WriteString implements io.StringWriter
+// Plain writes take a path that avoids converting s to a byte slice.
 func (b *hybridBuffer) WriteString(s string) (n int, err error) {
-	return b.Write([]byte(s))
+	b.mu.Lock()
+	defer b.unlock()
+
+	if b.closed {
+		return 0, ErrClosed
+	}
+	if b.readOnly {
+		return 0, ErrReadOnly
+	}
+
+	// Size limits, ring buffer and backpressure need the full write path
+	if b.maxSize > 0 || b.maxRetained > 0 || b.maxInFlight > 0 {
+		return b.writeLimited([]byte(s))
+	}
+
+	switch {
+	case !b.usingStorage && b.memoryBuffer.Len()+len(s) <= b.spillThreshold() && !b.memoryLimiter().exceeded(len(s)):
+		n, err = b.memoryBuffer.WriteString(s)
+	case b.usingStorage && b.writeStream != nil:
+		n, err = io.WriteString(b.writeStream, s)
+		b.spilled += int64(n)
+		if err != nil {
+			err = storageError(err)
+		}
+	default:
+		// Spilling or reopening storage
+		return b.write([]byte(s))
+	}
+
+	if b.hash != nil {
+		io.WriteString(b.hash, s[:n])
+	}
+	b.size += n
+	return n, err
 }
 
 // ReadByte implements io.ByteReader
 func (b *hybridBuffer) ReadByte() (byte, error) {
+	b.mu.Lock()
+	defer b.unlock()
+
+	if b.closed {
+		return 0, ErrClosed
+	}
+
+	return b.readByte()
+}
+
+// readByte reads a single byte from the current offset
+func (b *hybridBuffer) readByte() (byte, error) {
 	var buf [1]byte
-	n, err := b.Read(buf[:])
+	n, err := b.read(buf[:])
 	if err != nil {
 		return 0, err
 	}
@@ -254,9 +949,16 @@ func (b *hybridBuffer) ReadByte() (byte, error) {
 
 // ReadBytes reads until delimiter (compatible with bytes.Buffer)
 func (b *hybridBuffer) ReadBytes(delim byte) ([]byte, error) {
+	b.mu.Lock()
+	defer b.unlock()
+
+	if b.closed {
+		return nil, ErrClosed
+	}
+
 	var result []byte
 	for {
-		c, err := b.ReadByte()
+		c, err := b.readByte()
 		if err != nil {
 			return result, err
 		}
@@ -276,40 +978,88 @@ func (b *hybridBuffer) ReadString(delim byte) (string, error) {
 
 // ReadRune reads a rune (compatible with bytes.Buffer)
 func (b *hybridBuffer) ReadRune() (r rune, size int, err error) {
+	b.mu.Lock()
+	defer b.unlock()
+
+	if b.closed {
+		return 0, 0, ErrClosed
+	}
+
 	var buf [utf8.UTFMax]byte
 	var n int
 
 	for n < utf8.UTFMax {
-		c, err := b.ReadByte()
+		c, err := b.readByte()
 		if err != nil {
 			if n == 0 {
 				return 0, 0, err
 			}
-			break
+			break // Incomplete rune at the end of the data
 		}
 
 		buf[n] = c
 		n++
 
 		if utf8.FullRune(buf[:n]) {
-			r, size = utf8.DecodeRune(buf[:n])
-			return r, size, nil
+			break
 		}
 	}
 
-	// If we get here, we have an incomplete rune
+	// Invalid encodings consume a single byte like bytes.Buffer, give back the rest
 	r, size = utf8.DecodeRune(buf[:n])
+	if size < n {
+		b.rewind(buf[size:n])
+	}
 	return r, size, nil
 }
 
+// rewind gives back the bytes p just read, moving the read position back
+// Storage streams cannot move backwards, so the bytes are pushed back onto the
+// read stream instead of reopening it and discarding everything before them.
+func (b *hybridBuffer) rewind(p []byte) {
+	b.offset -= len(p)
+	if b.readStream == nil {
+		return
+	}
+
+	pr, ok := b.readStream.(*pushbackReader)
+	if !ok {
+		pr = &pushbackReader{ReadCloser: b.readStream}
+		b.readStream = pr
+	}
+	pr.pending = append(append([]byte(nil), p...), pr.pending...)
+}
+
+// pushbackReader returns bytes given back by rewind before reading on from the stream
+type pushbackReader struct {
+	io.ReadCloser
+	pending []byte
+}
+
+func (r *pushbackReader) Read(p []byte) (int, error) {
+	if len(r.pending) > 0 {
+		n := copy(p, r.pending)
+		r.pending = r.pending[n:]
+		return n, nil
+	}
+	return r.ReadCloser.Read(p)
+}
+
 // Next returns the next n bytes (compatible with bytes.Buffer)
+// Like bytes.Buffer.Next, in memory mode the returned slice aliases the buffer's
+// internal memory without copying. It is only valid until the next modification
+// of the buffer (Write, Reset, Truncate, ...) and must not be modified.
+// In storage mode the data is read into a new slice.
 func (b *hybridBuffer) Next(n int) []byte {
+	b.mu.Lock()
+	defer b.unlock()
+
 	if n <= 0 {
 		return nil
 	}
 
 	// Read up to n bytes from current position
-	available := b.Len()
+	available := b.unread()
 	if n > available {
 		n = available
 	}
@@ -318,8 +1068,17 @@ func (b *hybridBuffer) Next(n int) []byte {
 		return nil
 	}
 
+	if !b.usingStorage {
+		view := b.memoryBuffer.Bytes()[b.offset : b.offset+n : b.offset+n]
+		b.offset += n
+		if b.maxInFlight > 0 {
+			b.cond.Broadcast()
+		}
+		return view
+	}
+
 	buf := make([]byte, n)
-	readBytes, err := b.Read(buf)
+	readBytes, err := b.readFull(buf)
 	if err != nil && err != io.EOF {
 		panic(err) // bytes.Buffer.Next() panics on error
 	}
@@ -329,29 +1088,127 @@ func (b *hybridBuffer) Next(n int) []byte {
 
 // Len returns the number of unread bytes (compatible with bytes.Buffer)
 func (b *hybridBuffer) Len() int {
+	b.mu.Lock()
+	defer b.unlock()
+
+	return b.unread()
+}
+
+// unread returns the number of unread bytes
+func (b *hybridBuffer) unread() int {
 	return b.size - b.offset
 }
 
-// Cap returns the capacity (equal to Len for compatibility)
+// Cap returns the capacity of the memory buffer (compatible with bytes.Buffer)
+// In storage mode capacity is effectively unbounded, so Cap returns Len.
 func (b *hybridBuffer) Cap() int {
-	return b.Len()
-}
+	b.mu.Lock()
+	defer b.unlock()
 
-// Available returns available capacity in the buffer (compatible with bytes.Buffer)
-func (b *hybridBuffer) Available() int {
 	if b.usingStorage {
-		return 0
+		return b.unread()
 	}
-	return b.threshold - b.memoryBuffer.Len()
+	return b.memoryBuffer.Cap()
 }
 
-// Size returns the total size of data written
+// Available returns the number of bytes that can be written before the buffer
+// spills to storage. It is never negative and always 0 once in storage mode.
+func (b *hybridBuffer) Available() int {
+	b.mu.Lock()
+	defer b.unlock()
+
+	if b.closed {
+		return 0
+	}
+
+	if b.usingStorage {
+		return 0
+	}
+	if available := b.spillThreshold() - b.memoryBuffer.Len(); available > 0 {
+		return available
+	}
+	return 0
+}
+
+// Size returns the total size of data written
+// Data released by Compact still counts, so Size does not shrink while the
+// buffer is drained.
 func (b *hybridBuffer) Size() int64 {
-	return int64(b.size)
+	b.mu.Lock()
+	defer b.unlock()
+
+	return b.compacted + int64(b.size)
+}
+
+// MemoryBytes returns the number of bytes currently held in memory
+// This includes read data not yet reclaimed, and is 0 once the buffer spilled.
+func (b *hybridBuffer) MemoryBytes() int {
+	b.mu.Lock()
+	defer b.unlock()
+
+	if b.usingStorage {
+		return 0
+	}
+	return b.memoryBuffer.Len()
+}
+
+// SpilledBytes returns the number of bytes written to storage since creation or
+// the last Reset, counted before middlewares
+// It includes the memory contents moved to storage when spilling and is not
+// reduced by reading, so together with WithThreshold it shows the real spill volume.
+func (b *hybridBuffer) SpilledBytes() int64 {
+	b.mu.Lock()
+	defer b.unlock()
+
+	return b.spilled
 }
 
 // Reset resets the buffer to initial state (compatible with bytes.Buffer)
+// Like bytes.Buffer it keeps the memory buffer's capacity, and restores at least
+// the pre-allocated capacity if spilling or compaction released it, so reusing a
+// buffer within that size does not allocate.
+// Failures to remove the storage are reported to the WithErrorHandler callback.
 func (b *hybridBuffer) Reset() {
+	b.mu.Lock()
+	defer b.unlock()
+
+	if b.closed {
+		return
+	}
+
+	b.reset()
+	b.memoryBuffer.Grow(b.preAllocSize)
+}
+
+// ResetKeep resets the buffer for reuse, e.g. before putting it back into a sync.Pool
+// Like Reset, it removes any storage and keeps the configuration, including the
+// storage provider. In addition, it zeroes the memory previously holding data, so
+// nothing leaks into the next use, and keeps at least the pre-allocated capacity,
+// so the recycled buffer does not allocate again.
+func (b *hybridBuffer) ResetKeep() {
+	b.mu.Lock()
+	defer b.unlock()
+
+	if b.closed {
+		return
+	}
+
+	if !b.zeroOnReset { // Otherwise reset zeroes the memory
+		b.zeroMemory()
+	}
+	b.reset()
+	b.memoryBuffer.Grow(b.preAllocSize)
+}
+
+// zeroMemory overwrites the memory buffer's whole backing array, including stale
+// data beyond its length left by spilling, truncation or compaction
+func (b *hybridBuffer) zeroMemory() {
+	mem := b.memoryBuffer.Bytes()
+	clear(mem[:cap(mem)])
+}
+
+// reset closes streams, removes storage and clears all state
+func (b *hybridBuffer) reset() {
 	// Close streams
 	if b.writeStream != nil {
 		b.writeStream.Close()
@@ -364,44 +1221,104 @@ func (b *hybridBuffer) Reset() {
 
 	// Remove storage
 	if b.storageBackend != nil {
-		b.storageBackend.Remove()
-		b.storageBackend = nil
+		b.removeStorage(b.storageBackend)
+		b.setStorageBackend(nil)
 	}
 
 	// Reset state
+	if b.zeroOnReset {
+		b.zeroMemory()
+	}
+	b.generation.Add(1)
+	b.readCache.Store(nil)
+	b.epoch++
+	b.compacted = 0
 	b.memoryBuffer.Reset()
 	b.size = 0
 	b.offset = 0
+	b.spilled = 0
 	b.usingStorage = false
+	b.storageDisabled = false
+	if b.hash != nil {
+		b.hash.Reset()
+	}
+	b.cond.Broadcast()
 }
 
 // Close closes the buffer and cleans up resources
+// Failures of closing the streams and removing the storage are all reported,
+// combined with errors.Join. After Close all operations fail with ErrClosed or
+// behave like on an empty buffer. Close is idempotent; subsequent calls return nil.
+//
+// A spilled buffer that is garbage collected without Close has its storage removed
+// by a finalizer. This is a last resort against leaked temp files and objects that
+// may run late or not at all; always Close buffers.
 func (b *hybridBuffer) Close() error {
-	var lastErr error
+	var err error
+	b.closeOnce.Do(func() {
+		b.mu.Lock()
+		defer b.unlock()
+
+		err = b.close()
+	})
+	return err
+}
+
+// close releases all resources and marks the buffer as closed
+func (b *hybridBuffer) close() error {
+	// Wake up blocked writers
+	b.closed = true
+	b.cond.Broadcast()
+
+	var errs []error
 
 	// Close streams
 	if b.writeStream != nil {
 		if err := b.writeStream.Close(); err != nil {
-			lastErr = err
+			errs = append(errs, err)
 		}
 		b.writeStream = nil
 	}
 	if b.readStream != nil {
 		if err := b.readStream.Close(); err != nil {
-			lastErr = err
+			errs = append(errs, err)
 		}
 		b.readStream = nil
 	}
 
 	// Remove storage
 	if b.storageBackend != nil {
-		if err := b.storageBackend.Remove(); err != nil {
-			lastErr = err
+		if err := b.deleteStorage(b.storageBackend); err != nil {
+			errs = append(errs, err)
+		} else {
+			b.removed()
 		}
-		b.storageBackend = nil
+		b.setStorageBackend(nil)
+	}
+
+	// Drop contents
+	if b.zeroOnReset {
+		b.zeroMemory()
+	}
+	b.generation.Add(1)
+	b.epoch++
+	b.memoryBuffer = bytes.Buffer{}
+	b.compacted = 0
+	b.size = 0
+	b.offset = 0
+	b.usingStorage = false
+
+	// Nothing left for the finalizer to clean up
+	if b.leakGuard != nil {
+		runtime.SetFinalizer(b.leakGuard, nil)
+		b.leakGuard = nil
 	}
 
-	return lastErr
+	err := errors.Join(errs...)
+	if err != nil {
+		b.log("close_error", map[string]any{"error": err})
+	}
+	return err
 }
 
 // Bytes returns the contents as a byte slice
@@ -413,20 +1330,27 @@ func (b *hybridBuffer) Close() error {
 //
 // WARNING: This loads ALL remaining data into memory! Use with caution for large buffers.
 func (b *hybridBuffer) Bytes() []byte {
-	// Ensure write stream is closed before reading
-	if b.writeStream != nil {
-		b.writeStream.Close()
-		b.writeStream = nil
+	b.mu.Lock()
+	defer b.unlock()
+
+	return b.bytes()
+}
+
+// bytes reads all remaining data into a new slice
+func (b *hybridBuffer) bytes() []byte {
+	// Ensure written data is readable
+	if err := b.settleWriteStream(); err != nil {
+		return nil
 	}
 
 	// Read all remaining data from current position
-	remaining := b.Len()
+	remaining := b.unread()
 	if remaining == 0 {
 		return nil
 	}
 
 	result := make([]byte, remaining)
-	n, err := b.Read(result)
+	n, err := b.readFull(result)
 	if err != nil && err != io.EOF {
 		// If read fails, return what we got
 		return result[:n]
@@ -444,121 +1368,775 @@ func (b *hybridBuffer) Bytes() []byte {
 //
 // WARNING: This loads ALL remaining data into memory! Use with caution for large buffers.
 func (b *hybridBuffer) String() string {
-	return string(b.Bytes())
+	b.mu.Lock()
+	defer b.unlock()
+
+	// Converting the view copies the data once
+	if !b.usingStorage {
+		return string(b.consumeMemory())
+	}
+	return string(b.bytes())
+}
+
+// GoString returns a summary of the buffer's state for %#v without consuming it
+// e.g. hybridbuffer{size:1234, inMemory:false, offset:100}
+func (b *hybridBuffer) GoString() string {
+	b.mu.Lock()
+	defer b.unlock()
+
+	return fmt.Sprintf("hybridbuffer{size:%d, inMemory:%t, offset:%d, closed:%t}", b.size, !b.usingStorage, b.offset, b.closed)
+}
+
+// Format implements fmt.Formatter
+// Any verb, including %v and %s, prints the summary of GoString, so logging a buffer
+// or inspecting it in a debugger does not consume the contents through String. Use
+// CopyTo or NewReader to get the contents without consuming them.
+func (b *hybridBuffer) Format(f fmt.State, verb rune) {
+	io.WriteString(f, b.GoString())
+}
+
+// BytesNoCopy returns the remaining contents like Bytes, but avoids the copy while in memory
+// The returned slice aliases the buffer's internal memory. It is only valid until the
+// next modification of the buffer (Write, Reset, Truncate, ...) and must not be modified.
+// In storage mode the data is read into a new slice, just like Bytes.
+func (b *hybridBuffer) BytesNoCopy() []byte {
+	b.mu.Lock()
+	defer b.unlock()
+
+	if !b.usingStorage {
+		return b.consumeMemory()
+	}
+	return b.bytes()
+}
+
+// consumeMemory returns a view of the unread memory data and marks it as read
+func (b *hybridBuffer) consumeMemory() []byte {
+	if b.offset >= b.size {
+		return nil
+	}
+
+	view := b.memoryBuffer.Bytes()[b.offset:b.size:b.size]
+	b.offset = b.size
+	if b.maxInFlight > 0 {
+		b.cond.Broadcast()
+	}
+	return view
+}
+
+// NewReader returns a reader over the full contents of the buffer
+// It starts at offset 0 and is independent of the buffer's read position,
+// so the same buffer can be read many times, also concurrently. In memory mode
+// the reader reads a copy of the memory data taken when it is created; in storage
+// mode it is backed by a fresh storage stream. Closing the reader does not remove the storage.
+// Once the buffer is reset, truncated or closed, the reader fails with ErrStale.
+func (b *hybridBuffer) NewReader() (io.ReadCloser, error) {
+	b.mu.Lock()
+	defer b.unlock()
+
+	if b.closed {
+		return nil, ErrClosed
+	}
+
+	if !b.usingStorage {
+		data := b.memorySnapshot(0)
+		return &staleReader{ReadCloser: io.NopCloser(bytes.NewReader(data)), staleGuard: b.staleGuard()}, nil
+	}
+
+	if r := b.cachedReader(); r != nil {
+		return &staleReader{ReadCloser: r, staleGuard: b.staleGuard()}, nil
+	}
+
+	if err := b.finalizeWriteStream(); err != nil {
+		return nil, err
+	}
+	r, err := b.newReadStream()
+	if err != nil {
+		return nil, err
+	}
+	return &staleReader{ReadCloser: b.cacheReads(r), staleGuard: b.staleGuard()}, nil
+}
+
+// NewReadSeeker returns a seekable reader over the full contents of the buffer
+// Like NewReader it is independent of the buffer's read position, which makes
+// it suitable for http.ServeContent. In storage mode without middleware, a raw
+// stream that is already seekable (such as the *os.File of the filesystem
+// backend) is returned directly. Otherwise seeking reopens the storage stream
+// and discards data up to the target position, so nothing is loaded into memory
+// but backward seeks cost a re-read. The caller must close the reader.
+// Like NewReader, the reader fails with ErrStale once the buffer is reset.
+func (b *hybridBuffer) NewReadSeeker() (io.ReadSeekCloser, error) {
+	b.mu.Lock()
+	defer b.unlock()
+
+	if b.closed {
+		return nil, ErrClosed
+	}
+
+	rs, err := b.newReadSeeker()
+	if err != nil {
+		return nil, err
+	}
+	return &staleReadSeeker{ReadSeekCloser: rs, staleGuard: b.staleGuard()}, nil
+}
+
+// newReadSeeker returns a seekable reader over the full contents
+func (b *hybridBuffer) newReadSeeker() (io.ReadSeekCloser, error) {
+	if !b.usingStorage {
+		data := b.memorySnapshot(0)
+		return nopSeekCloser{bytes.NewReader(data)}, nil
+	}
+
+	if err := b.finalizeWriteStream(); err != nil {
+		return nil, err
+	}
+
+	if b.rawStorage() {
+		raw, err := b.storageBackend.Open()
+		if err != nil {
+			return nil, fmt.Errorf("failed to open storage read stream: %w", err)
+		}
+		if rsc, ok := raw.(io.ReadSeekCloser); ok {
+			return rsc, nil
+		}
+		raw.Close()
+	}
+
+	return &streamSeeker{open: b.newReadStreamAt, size: int64(b.size)}, nil
+}
+
+// snapshotReader returns a reader over the unread contents without consuming them
+// The caller must hold the lock while using the reader.
+func (b *hybridBuffer) snapshotReader() (io.ReadCloser, error) {
+	if !b.usingStorage {
+		data := b.memoryBuffer.Bytes()[b.offset:b.size:b.size]
+		return io.NopCloser(bytes.NewReader(data)), nil
+	}
+
+	if err := b.settleWriteStream(); err != nil {
+		return nil, err
+	}
+	return b.newReadStreamAt(int64(b.offset))
+}
+
+// unreadReader returns a reader over the unread contents and their length
+// Unlike snapshotReader it is used without holding the lock; like NewReader it
+// fails with ErrStale once the contents are discarded.
+func (b *hybridBuffer) unreadReader() (io.ReadCloser, int, error) {
+	b.mu.Lock()
+	defer b.unlock()
+
+	if b.closed {
+		return nil, 0, ErrClosed
+	}
+
+	if !b.usingStorage {
+		data := b.memorySnapshot(b.offset)
+		return &staleReader{ReadCloser: io.NopCloser(bytes.NewReader(data)), staleGuard: b.staleGuard()}, len(data), nil
+	}
+
+	r, err := b.snapshotReader()
+	if err != nil {
+		return nil, 0, err
+	}
+	return &staleReader{ReadCloser: r, staleGuard: b.staleGuard()}, b.unread(), nil
+}
+
+// finalizeWriteStream closes the write stream so all written data becomes readable
+func (b *hybridBuffer) finalizeWriteStream() error {
+	if b.writeStream == nil {
+		return nil
+	}
+	err := b.writeStream.Close()
+	b.writeStream = nil
+	if err != nil {
+		return fmt.Errorf("failed to close write stream: %w", err)
+	}
+	return nil
+}
+
+// settleWriteStream makes all written data readable by read streams
+// Raw storage on an *os.File is readable while it is being written, so the write
+// stream stays open and later writes continue on it; read-ahead is excluded because
+// it stops at the current end of the file. Otherwise the write stream is finalized.
+func (b *hybridBuffer) settleWriteStream() error {
+	if sw, ok := b.writeStream.(*syncWriter); ok && b.rawStorage() && b.readAhead == 0 && storageFileName(sw) != "" {
+		return nil
+	}
+	return b.finalizeWriteStream()
+}
+
+// StorageSize returns the number of bytes stored by the storage backend after middlewares
+// Backends implementing Sizer report the size themselves; for backends whose Create
+// returns an *os.File, such as the filesystem backend, the file is stat'ed. It returns
+// 0 in memory mode and errors.ErrUnsupported for other backends. Data still buffered
+// by an open write stream may not be included.
+func (b *hybridBuffer) StorageSize() (int64, error) {
+	b.mu.Lock()
+	defer b.unlock()
+
+	if b.closed {
+		return 0, ErrClosed
+	}
+	if !b.usingStorage {
+		return 0, nil
+	}
+
+	if sizer, ok := b.storageBackend.(Sizer); ok {
+		return sizer.Size()
+	}
+	if b.storageFile == "" {
+		return 0, errors.ErrUnsupported
+	}
+	info, err := os.Stat(b.storageFile)
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
+
+// StoragePath returns the path of the local file holding the spilled data, e.g. to
+// hand it to an external process
+// Backends implementing PathProvider report the path themselves; for other backends
+// it is the name of the *os.File returned by Create, as with the filesystem backend.
+// It returns false in memory mode and if the storage is not a local file.
+// The write stream is closed first, so the file contains all data written so far;
+// the file holds the data after middlewares. Writing afterwards continues in a new
+// file with a different path. The file is removed by Reset, Truncate and Close, so
+// it must only be used before then.
+func (b *hybridBuffer) StoragePath() (string, bool) {
+	b.mu.Lock()
+	defer b.unlock()
+
+	if b.closed || !b.usingStorage {
+		return "", false
+	}
+	provider, ok := b.storageBackend.(PathProvider)
+	if !ok && b.storageFile == "" {
+		return "", false
+	}
+	if err := b.finalizeWriteStream(); err != nil {
+		return "", false
+	}
+
+	path := b.storageFile
+	if ok {
+		path = provider.Path()
+	}
+	return path, path != ""
+}
+
+// Sum returns the digest of all data written since creation or the last Reset
+// The hash is fed before middlewares are applied, so it covers the logical data
+// in memory and storage mode alike. Truncating or reading data does not change it.
+// Sum returns nil unless the buffer was created with WithHash.
+func (b *hybridBuffer) Sum() []byte {
+	b.mu.Lock()
+	defer b.unlock()
+
+	if b.hash == nil {
+		return nil
+	}
+	return b.hash.Sum(nil)
 }
 
 // Grow grows the buffer's capacity (compatible with bytes.Buffer)
+// A request exceeding the memory threshold is taken as a hint that the data will
+// spill, so the buffer switches to storage right away instead of growing memory.
+// Backends implementing Preallocator then reserve space for the expected size.
+// For other backends whose Create returns an *os.File, such as the filesystem
+// backend, the space is reserved with fallocate on Linux, keeping the file size
+// unchanged; on other systems nothing is reserved.
 func (b *hybridBuffer) Grow(n int) {
-	// Only grow if we're still in memory phase
-	if !b.usingStorage {
+	b.mu.Lock()
+	defer b.unlock()
+
+	if b.closed || n <= 0 {
+		return
+	}
+
+	// Modes that never spill only grow memory
+	if b.maxRetained > 0 || b.maxInFlight > 0 || b.storageDisabled || b.memoryOnly {
 		b.memoryBuffer.Grow(n)
+		return
+	}
+
+	if !b.usingStorage {
+		if b.memoryBuffer.Len()+n <= b.spillThreshold() {
+			b.memoryBuffer.Grow(n)
+			return
+		}
+
+		// Spill early, a failure surfaces again on the next Write
+		if err := b.flushToStorage(); err != nil {
+			if b.storageFallback {
+				b.fallbackToMemory(err)
+				b.memoryBuffer.Grow(n)
+			}
+			return
+		}
+	}
+
+	b.preallocate(int64(b.size) + int64(n))
+}
+
+// preallocate asks the storage backend to reserve space for size bytes
+// Without Preallocator, the *os.File below the write stream is preallocated.
+func (b *hybridBuffer) preallocate(size int64) {
+	var err error
+	if p, ok := b.storageBackend.(Preallocator); ok {
+		err = p.Preallocate(size)
+	} else if f := storageOSFile(b.writeStream); f != nil {
+		err = allocateFile(f, size+b.formatHeaderLen())
+	}
+	if err != nil && b.onError != nil {
+		err = fmt.Errorf("failed to preallocate storage: %w", err)
+		b.queueHook(func() { b.onError(err) })
 	}
 }
 
 // Truncate truncates the buffer (compatible with bytes.Buffer)
 func (b *hybridBuffer) Truncate(n int) {
+	b.mu.Lock()
+	defer b.unlock()
+
 	if n < 0 || n > b.size {
 		panic("hybridbuffer: truncation out of range")
 	}
+	if b.readOnly {
+		panic(ErrReadOnly)
+	}
 
 	if n == 0 {
-		b.Reset()
+		b.reset()
 		return
 	}
 
-	// For simplicity, if we're truncating, we reset and re-write the first n bytes
-	// Save current data up to n bytes
+	if err := b.truncate(n); err != nil {
+		panic(fmt.Errorf("hybridbuffer: truncation failed: %w", err))
+	}
+}
+
+// truncate discards everything after the first n bytes, keeping the read position
+func (b *hybridBuffer) truncate(n int) error {
 	oldOffset := b.offset
-	b.offset = 0
+	b.generation.Add(1)
+
+	if b.usingStorage {
+		if err := b.rewriteStorage(n); err != nil {
+			return err
+		}
+	} else {
+		b.memoryBuffer.Truncate(n)
+		b.size = n
+	}
+
+	// Keep the read position, clamped to the new size
+	b.offset = oldOffset
+	if b.offset > n {
+		b.offset = n
+	}
+	b.cond.Broadcast()
+	return nil
+}
+
+// TruncateFront discards the first n unread bytes, the opposite of Truncate
+// The next Read starts after the discarded bytes and Len drops by n.
+func (b *hybridBuffer) TruncateFront(n int) {
+	b.mu.Lock()
+	defer b.unlock()
+
+	if n < 0 || n > b.unread() {
+		panic("hybridbuffer: truncation out of range")
+	}
 
-	// Reset read stream to start from beginning
+	// An open read stream has to skip the bytes, otherwise they are skipped when it is opened
+	if b.usingStorage && b.readStream != nil {
+		if _, err := io.CopyN(io.Discard, b.readStream, int64(n)); err != nil {
+			panic(fmt.Errorf("hybridbuffer: truncation failed: %w", err))
+		}
+	}
+	b.offset += n
+	b.cond.Broadcast()
+}
+
+// rewriteStorage streams the first n decoded bytes into a new storage object
+// and swaps it in, leaving the write stream open so writes can continue
+func (b *hybridBuffer) rewriteStorage(n int) error {
+	// Ensure all written data is visible and reading starts from the beginning
+	if b.writeStream != nil {
+		if err := b.writeStream.Close(); err != nil {
+			return err
+		}
+		b.writeStream = nil
+	}
 	if b.readStream != nil {
 		b.readStream.Close()
 		b.readStream = nil
 	}
 
-	data := make([]byte, n)
-	actualRead, _ := b.Read(data)
+	src, err := b.newReadStream()
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	backend := b.storageProvider()
+	dst, err := b.newWriteStream(backend)
+	if err != nil {
+		b.removeStorage(backend)
+		return err
+	}
+	if _, err = io.CopyN(dst, src, int64(n)); err != nil {
+		dst.Close()
+		b.removeStorage(backend)
+		return fmt.Errorf("failed to copy truncated data: %w", err)
+	}
+
+	// Readers of the old object are stale once it is removed
+	b.generation.Add(1)
+	b.removeStorage(b.storageBackend)
+	b.setStorageBackend(backend)
+	b.writeStream = dst
+	b.storageFile = storageFileName(dst)
+	b.size = n
+	return nil
+}
+
+// Compact releases the memory of data already read
+// In memory mode the unread data is copied into a new memory buffer of just the
+// needed size, so the backing array holding the consumed prefix can be garbage
+// collected. Len, Size and subsequent reads are unchanged, but independent
+// readers (NewReader, NewReadSeeker, AsFile) no longer include the released data.
+// This gives long-lived, slowly drained buffers explicit control over their
+// footprint. In storage mode there is no consumed data in memory and Compact does
+// nothing.
+func (b *hybridBuffer) Compact() {
+	b.mu.Lock()
+	defer b.unlock()
+
+	if b.closed || b.usingStorage || b.offset == 0 {
+		return
+	}
+
+	// Independent readers see the memory from offset 0, which is about to move
+	b.generation.Add(1)
 
-	// Reset and write back
-	b.Reset()
-	b.Write(data[:actualRead])
+	var mem bytes.Buffer
+	mem.Write(b.memoryBuffer.Bytes()[b.offset:b.size])
+	b.memoryBuffer = mem
+	b.compacted += int64(b.offset)
+	b.size -= b.offset
+	b.offset = 0
+}
 
-	// Restore offset if it was within the truncated range
-	if oldOffset < actualRead {
-		b.offset = oldOffset
+// compactMemory moves the unread memory data to the front of the memory buffer,
+// releasing the consumed prefix without reallocating
+func (b *hybridBuffer) compactMemory() {
+	if b.usingStorage || b.offset == 0 {
+		return
 	}
+
+	// Independent readers see the memory from offset 0, which is about to move
+	b.generation.Add(1)
+
+	mem := b.memoryBuffer.Bytes()
+	n := copy(mem, mem[b.offset:])
+	b.memoryBuffer.Truncate(n)
+	b.compacted += int64(b.offset)
+	b.size -= b.offset
+	b.offset = 0
 }
 
 // flushToStorage moves all memory data to storage
-func (b *hybridBuffer) flushToStorage() error {
+func (b *hybridBuffer) flushToStorage() (err error) {
 	if b.usingStorage {
 		return nil // Already using storage
 	}
 
 	// Create storage backend
-	b.storageBackend = b.storageProvider()
+	b.setStorageBackend(b.storageProvider())
+	if b.tracer != nil {
+		end := b.startSpan(spanSpill, b.storageBackend, int64(b.memoryBuffer.Len()))
+		defer func() { end(err) }()
+	}
 
 	// Open write stream
 	if err := b.openWriteStream(); err != nil {
-		return err
+		b.abortSpill()
+		return storageError(err)
 	}
 
 	// Write memory buffer to storage
 	memData := b.memoryBuffer.Bytes()
-	if len(memData) > 0 {
+	if b.asyncSpill {
+		// The background writer takes over the memory buffer's backing array
+		b.writeStream = newAsyncWriter(b.writeStream, memData)
+		b.memoryBuffer = bytes.Buffer{}
+	} else if len(memData) > 0 {
 		if _, err := b.writeStream.Write(memData); err != nil {
-			return fmt.Errorf("failed to write memory data to storage: %w", err)
+			b.abortSpill()
+			return fmt.Errorf("failed to write memory data to storage: %w", storageError(err))
 		}
 	}
 
-	// Switch to storage mode
+	// Switch to storage mode, the memory data now lives in storage
 	b.usingStorage = true
+	b.spilled += int64(len(memData))
+	b.memoryBuffer.Reset()
+	b.log("spill", map[string]any{"size": len(memData), "threshold": b.threshold})
+	if b.onSpill != nil {
+		spilled := len(memData)
+		b.queueHook(func() { b.onSpill(spilled) })
+	}
 	return nil
 }
 
+// abortSpill discards the storage of a failed spill right away, so that a partially
+// written object, e.g. on a full disk, is not left behind until Close
+// The data stays in memory, so the next write retries with a fresh backend.
+func (b *hybridBuffer) abortSpill() {
+	if b.writeStream != nil {
+		b.writeStream.Close()
+		b.writeStream = nil
+		b.removeStorage(b.storageBackend)
+	}
+	b.setStorageBackend(nil)
+}
+
+// storageError marks errors caused by storage running out of space with ErrStorageFull
+func storageError(err error) error {
+	if errors.Is(err, syscall.ENOSPC) {
+		return fmt.Errorf("%w: %w", ErrStorageFull, err)
+	}
+	return err
+}
+
+// removeStorage removes a storage backend that is no longer needed
+// Failures are reported to the error handler since callers have no way to return them.
+func (b *hybridBuffer) removeStorage(backend storage.Backend) {
+	if err := b.deleteStorage(backend); err != nil {
+		if b.onError != nil {
+			err = fmt.Errorf("failed to remove storage: %w", err)
+			b.queueHook(func() { b.onError(err) })
+		}
+		b.log("remove_error", map[string]any{"error": err})
+		return
+	}
+	b.removed()
+}
+
+// removed notifies the remove hook about a removed storage object
+func (b *hybridBuffer) removed() {
+	if b.onRemove != nil {
+		b.queueHook(b.onRemove)
+	}
+	b.log("storage_removed", nil)
+}
+
+// setStorageBackend replaces the storage backend, keeping the leak guard in sync
+func (b *hybridBuffer) setStorageBackend(backend storage.Backend) {
+	b.storageBackend = backend
+	b.storageFile = ""
+	if backend != nil {
+		b.guard().backend = backend
+	} else if b.leakGuard != nil {
+		b.leakGuard.backend = nil
+	}
+}
+
+// guard returns the leak guard, creating it on first use
+func (b *hybridBuffer) guard() *leakGuard {
+	if b.leakGuard == nil {
+		b.leakGuard = &leakGuard{}
+		runtime.SetFinalizer(b.leakGuard, (*leakGuard).cleanup)
+	}
+	return b.leakGuard
+}
+
+// leakGuard releases the resources of a buffer that was garbage collected without Close:
+// it removes the storage object and unregisters the memory from the limiter
+// It is a separate object because the buffer references itself (e.g. through its
+// sync.Cond), and cyclic structures with finalizers are never collected. For the same
+// reason it must not reference the buffer or any of the user's callbacks.
+type leakGuard struct {
+	backend  storage.Backend
+	limiter  *MemoryLimiter // Set once memory is registered
+	inMemory int64
+}
+
+// cleanup is the finalizer of leakGuard
+func (g *leakGuard) cleanup() {
+	if g.backend != nil {
+		g.backend.Remove()
+	}
+	if g.limiter != nil {
+		g.limiter.used.Add(-g.inMemory)
+	}
+}
+
+// log reports an event to the logger once the lock is released
+func (b *hybridBuffer) log(event string, fields map[string]any) {
+	if b.logger == nil {
+		return
+	}
+	if b.id != "" {
+		if fields == nil {
+			fields = make(map[string]any, 1)
+		}
+		fields["id"] = b.id
+	}
+	b.queueHook(func() { b.logger(event, fields) })
+}
+
+// Name returns the identifier set by WithID, "" if none was set
+func (b *hybridBuffer) Name() string {
+	return b.id
+}
+
+// queueHook schedules a user callback to run once the lock is released,
+// so callbacks may safely call back into the buffer
+func (b *hybridBuffer) queueHook(hook func()) {
+	b.hooks = append(b.hooks, hook)
+}
+
+// unlock releases the lock and runs the callbacks queued while it was held
+func (b *hybridBuffer) unlock() {
+	b.trackMemory()
+
+	hooks := b.hooks
+	b.hooks = nil
+	b.mu.Unlock()
+
+	for _, hook := range hooks {
+		hook()
+	}
+}
+
+// fallbackToMemory keeps the buffer in memory mode after a failed spill
+// The failed storage backend was already discarded by flushToStorage.
+func (b *hybridBuffer) fallbackToMemory(cause error) {
+	b.storageDisabled = true
+	if b.onStorageError != nil {
+		b.queueHook(func() { b.onStorageError(cause) })
+	}
+}
+
 // openWriteStream opens a write stream for storage
 func (b *hybridBuffer) openWriteStream() error {
 	if b.writeStream != nil {
 		return nil // Already open
 	}
 
-	writeStream, err := b.storageBackend.Create()
+	writeStream, err := b.newWriteStream(b.storageBackend)
 	if err != nil {
-		return fmt.Errorf("failed to create storage write stream: %w", err)
+		return err
+	}
+
+	b.writeStream = writeStream
+	b.storageFile = storageFileName(writeStream)
+	return nil
+}
+
+// storageFileName returns the name of the file below a write stream created by
+// newWriteStream, or "" if the backend does not write to an *os.File
+func storageFileName(w io.Writer) string {
+	if f := storageOSFile(w); f != nil {
+		return f.Name()
+	}
+	return ""
+}
+
+// storageOSFile returns the *os.File below a write stream, or nil
+func storageOSFile(w io.Writer) *os.File {
+	if async, ok := w.(*asyncWriter); ok {
+		w = async.dst
+	}
+	if sw, ok := w.(*syncWriter); ok {
+		w = sw.storage
 	}
+	if cw, ok := w.(*contextWriter); ok {
+		w = cw.WriteCloser
+	}
+	f, _ := w.(*os.File)
+	return f
+}
+
+// newWriteStream creates a write stream on the given backend with the middleware pipeline applied
+func (b *hybridBuffer) newWriteStream(backend storage.Backend) (io.WriteCloser, error) {
+	writeStream, err := b.createStorage(backend)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create storage write stream: %w", err)
+	}
+	b.log("storage_created", nil)
 
-	// Apply middleware pipeline in forward order (first middleware first)
+	if b.formatHeader {
+		if _, err := writeStream.Write(b.formatHeaderBytes()); err != nil {
+			writeStream.Close()
+			return nil, fmt.Errorf("failed to write format header: %w", err)
+		}
+	}
+	return b.wrapWriteStream(writeStream), nil
+}
+
+// wrapWriteStream applies the middleware pipeline to a storage write stream
+func (b *hybridBuffer) wrapWriteStream(writeStream io.WriteCloser) io.WriteCloser {
+	// Apply middleware pipeline so data passes the first middleware first,
+	// which means the last middleware wraps the storage stream
 	writer := io.Writer(writeStream)
-	for _, middleware := range b.middlewares {
-		writer = middleware.Writer(writer)
+	layers := make([]io.Writer, len(b.middlewares))
+	for i := len(b.middlewares) - 1; i >= 0; i-- {
+		writer = b.middlewares[i].Writer(writer)
+		layers[i] = writer
 	}
 
 	// Convert back to WriteCloser
-	if wc, ok := writer.(io.WriteCloser); ok {
-		b.writeStream = wc
-	} else {
-		b.writeStream = &writeCloserWrapper{
+	wc, ok := writer.(io.WriteCloser)
+	if !ok {
+		wc = &writeCloserWrapper{
 			Writer:     writer,
 			underlying: writeStream,
 		}
 	}
-
-	return nil
+	return &syncWriter{WriteCloser: wc, layers: layers, storage: writeStream}
 }
 
-// openReadStream opens a read stream for storage
+// openReadStream opens a read stream for storage positioned at the current offset
 func (b *hybridBuffer) openReadStream() error {
 	if b.readStream != nil {
 		return nil // Already open
 	}
 
-	readStream, err := b.storageBackend.Open()
+	// Skip data that has already been consumed
+	readStream, err := b.newReadStreamAt(int64(b.offset))
+	if err != nil {
+		return err
+	}
+
+	if b.readAhead > 0 {
+		readStream = newReadAhead(readStream, b.readAhead)
+	}
+
+	b.readStream = readStream
+	return nil
+}
+
+// newReadStream opens a read stream from the start of storage with the middleware pipeline applied
+func (b *hybridBuffer) newReadStream() (io.ReadCloser, error) {
+	readStream, err := b.openStorage()
 	if err != nil {
-		return fmt.Errorf("failed to open storage read stream: %w", err)
+		return nil, fmt.Errorf("failed to open storage read stream: %w", err)
+	}
+	b.log("read_stream_opened", map[string]any{"size": b.size})
+
+	if b.formatHeader {
+		if err := b.checkFormatHeader(readStream); err != nil {
+			readStream.Close()
+			return nil, err
+		}
 	}
 
-	// Apply middleware pipeline in reverse order (last middleware first)
+	// Apply middleware pipeline so data passes the last middleware first,
+	// undoing the write pipeline
 	reader := io.Reader(readStream)
 	for i := len(b.middlewares) - 1; i >= 0; i-- {
 		reader = b.middlewares[i].Reader(reader)
@@ -566,15 +2144,17 @@ func (b *hybridBuffer) openReadStream() error {
 
 	// Convert back to ReadCloser
 	if rc, ok := reader.(io.ReadCloser); ok {
-		b.readStream = rc
-	} else {
-		b.readStream = &readCloserWrapper{
-			Reader:     reader,
-			underlying: readStream,
-		}
+		return rc, nil
 	}
+	return &readCloserWrapper{
+		Reader:     reader,
+		underlying: readStream,
+	}, nil
+}
 
-	return nil
+// writerOnly hides all methods but Write of the wrapped writer
+type writerOnly struct {
+	io.Writer
 }
 
 // Wrapper types for middleware pipeline
@@ -2,9 +2,28 @@ package hybridbuffer
 
 import (
 	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
 	"fmt"
 	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"syscall"
 	"testing"
+	"testing/iotest"
+	"time"
 
 	"schneider.vip/hybridbuffer/storage"
 	"schneider.vip/hybridbuffer/storage/filesystem"
@@ -154,6 +173,42 @@ func TestHybridBuffer_Next(t *testing.T) {
 	}
 }
 
+func TestHybridBuffer_Writef(t *testing.T) {
+	backend := &mockStorageBackend{}
+	buf := New(WithThreshold(64), WithStorage(func() storage.Backend { return backend }))
+	defer buf.Close()
+
+	n, err := buf.Writef("%s=%d;", "id", 42)
+	if n != 6 || err != nil {
+		t.Fatalf("Expected 6 bytes and no error, got %d, %v", n, err)
+	}
+
+	// Large formatted output spills
+	large := strings.Repeat("x", 100)
+	if _, err := buf.Writef("payload=%s", large); err != nil {
+		t.Fatalf("Writef failed: %v", err)
+	}
+	if !backend.createCalled {
+		t.Fatal("Expected large formatted output to spill")
+	}
+	if got := buf.String(); got != "id=42;payload="+large {
+		t.Fatalf("Unexpected contents %q", got)
+	}
+}
+
+func TestHybridBuffer_NextNoCopy(t *testing.T) {
+	buf := New()
+	defer buf.Close()
+
+	buf.Write(make([]byte, 4096))
+	allocs := testing.AllocsPerRun(100, func() {
+		buf.Next(8)
+	})
+	if allocs != 0 {
+		t.Fatalf("Expected Next to return a view in memory mode, got %v allocations", allocs)
+	}
+}
+
 func TestHybridBuffer_String(t *testing.T) {
 	buf := New()
 	defer buf.Close()
@@ -217,6 +272,34 @@ func TestHybridBuffer_Reset(t *testing.T) {
 	}
 }
 
+func TestHybridBuffer_ResetKeepsCapacity(t *testing.T) {
+	buf := New(WithThreshold(8192), WithPreAlloc(4096))
+	defer buf.Close()
+
+	data := make([]byte, 4096)
+	buf.Write(data)
+	capBefore := buf.Cap()
+
+	allocs := testing.AllocsPerRun(100, func() {
+		buf.Reset()
+		buf.Write(data)
+	})
+	if allocs != 0 {
+		t.Fatalf("Expected Reset and Write within the pre-allocated size not to allocate, got %v allocations", allocs)
+	}
+	if buf.Cap() != capBefore {
+		t.Fatalf("Expected capacity %d to be kept, got %d", capBefore, buf.Cap())
+	}
+
+	// Compaction shrinks the memory buffer, Reset restores the pre-allocation
+	buf.Next(4000)
+	buf.Compact()
+	buf.Reset()
+	if buf.Cap() < 4096 {
+		t.Fatalf("Expected at least the pre-allocated capacity after Reset, got %d", buf.Cap())
+	}
+}
+
 func TestHybridBuffer_WriteTo(t *testing.T) {
 	buf := New()
 	defer buf.Close()
@@ -469,6 +552,50 @@ func TestHybridBuffer_NewFromString(t *testing.T) {
 	}
 }
 
+func TestHybridBuffer_NewFromReader(t *testing.T) {
+	data := bytes.Repeat([]byte("0123456789"), 100)
+
+	buf, err := NewFromReader(bytes.NewReader(data), WithThreshold(100))
+	if err != nil {
+		t.Fatalf("NewFromReader failed: %v", err)
+	}
+	defer buf.Close()
+
+	if buf.Size() != int64(len(data)) {
+		t.Fatalf("Expected size %d, got %d", len(data), buf.Size())
+	}
+	if !bytes.Equal(buf.Bytes(), data) {
+		t.Fatal("Data mismatch after NewFromReader")
+	}
+
+	// Read errors are returned
+	if _, err := NewFromReader(&failingReader{}); err == nil {
+		t.Fatal("Expected error from failing reader")
+	}
+}
+
+func TestHybridBuffer_NewFromFile(t *testing.T) {
+	data := bytes.Repeat([]byte("0123456789"), 100)
+	path := filepath.Join(t.TempDir(), "input.bin")
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+
+	buf, err := NewFromFile(path, WithThreshold(100))
+	if err != nil {
+		t.Fatalf("NewFromFile failed: %v", err)
+	}
+	defer buf.Close()
+
+	if !bytes.Equal(buf.Bytes(), data) {
+		t.Fatal("Data mismatch after NewFromFile")
+	}
+
+	if _, err := NewFromFile(filepath.Join(t.TempDir(), "missing.bin")); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("Expected wrapped os.ErrNotExist, got %v", err)
+	}
+}
+
 func TestHybridBuffer_Grow(t *testing.T) {
 	buf := New(WithThreshold(100))
 	defer buf.Close()
@@ -746,10 +873,60 @@ func TestHybridBuffer_CloseErrors(t *testing.T) {
 		t.Logf("Close error (expected): %v", err)
 	}
 
-	// Second close should not panic
+	// Second close should not panic and always succeeds
 	err2 := buf.Close()
 	if err2 != nil {
-		t.Logf("Second close error (expected): %v", err2)
+		t.Fatalf("Second close should return nil, got %v", err2)
+	}
+}
+
+func TestHybridBuffer_WriteAfterClose(t *testing.T) {
+	buf := New(WithThreshold(5))
+	buf.WriteString("data exceeding threshold")
+	buf.Close()
+
+	if _, err := buf.Write([]byte("x")); err != ErrClosed {
+		t.Fatalf("Write: expected ErrClosed, got %v", err)
+	}
+	if _, err := buf.WriteString("x"); err != ErrClosed {
+		t.Fatalf("WriteString: expected ErrClosed, got %v", err)
+	}
+	if err := buf.WriteByte('x'); err != ErrClosed {
+		t.Fatalf("WriteByte: expected ErrClosed, got %v", err)
+	}
+	if _, err := buf.ReadFrom(strings.NewReader("x")); err != ErrClosed {
+		t.Fatalf("ReadFrom: expected ErrClosed, got %v", err)
+	}
+	if buf.Size() != 0 || buf.Available() != 0 {
+		t.Fatalf("Expected empty buffer after close, got size=%d available=%d", buf.Size(), buf.Available())
+	}
+}
+
+func TestHybridBuffer_ReadAfterClose(t *testing.T) {
+	buf := New(WithThreshold(5))
+	buf.WriteString("data exceeding threshold")
+	buf.Close()
+
+	if _, err := buf.Read(make([]byte, 4)); err != ErrClosed {
+		t.Fatalf("Read: expected ErrClosed, got %v", err)
+	}
+	if _, err := buf.ReadByte(); err != ErrClosed {
+		t.Fatalf("ReadByte: expected ErrClosed, got %v", err)
+	}
+	if _, err := buf.ReadString('\n'); err != ErrClosed {
+		t.Fatalf("ReadString: expected ErrClosed, got %v", err)
+	}
+	if _, _, err := buf.ReadRune(); err != ErrClosed {
+		t.Fatalf("ReadRune: expected ErrClosed, got %v", err)
+	}
+	if _, err := buf.WriteTo(io.Discard); err != ErrClosed {
+		t.Fatalf("WriteTo: expected ErrClosed, got %v", err)
+	}
+	if _, err := buf.NewReader(); err != ErrClosed {
+		t.Fatalf("NewReader: expected ErrClosed, got %v", err)
+	}
+	if buf.Len() != 0 || buf.Bytes() != nil || buf.Next(1) != nil {
+		t.Fatal("Expected no data after close")
 	}
 }
 
@@ -1038,41 +1215,3917 @@ func TestHybridBuffer_ReadStreamAlreadyOpen(t *testing.T) {
 	}
 }
 
-// Benchmark tests
-func BenchmarkHybridBuffer_Write(b *testing.B) {
-	buf := New()
+func TestHybridBuffer_StorageFallback(t *testing.T) {
+	createErr := fmt.Errorf("storage unavailable")
+	var reported []error
+
+	buf := New(
+		WithThreshold(10),
+		WithStorage(func() storage.Backend { return &failingStorageBackend{createErr: createErr} }),
+		WithStorageFallback(func(err error) { reported = append(reported, err) }),
+	)
 	defer buf.Close()
 
-	data := make([]byte, 1024)
-	for i := range data {
-		data[i] = byte(i % 256)
+	data := []byte("data exceeding the threshold")
+	n, err := buf.Write(data)
+	if err != nil {
+		t.Fatalf("Write should fall back to memory, got error: %v", err)
+	}
+	if n != len(data) {
+		t.Fatalf("Expected to write %d bytes, got %d", len(data), n)
 	}
 
-	b.ResetTimer()
-	for i := 0; i < b.N; i++ {
-		buf.Write(data)
+	// Further writes stay in memory without retrying storage
+	buf.Write([]byte(" and more"))
+	if len(reported) != 1 {
+		t.Fatalf("Expected error hook to be called once, got %d calls", len(reported))
+	}
+	if reported[0] == nil {
+		t.Fatal("Expected storage error to be reported")
+	}
+
+	if result := buf.String(); result != "data exceeding the threshold and more" {
+		t.Fatalf("Unexpected content after fallback: %q", result)
 	}
 }
 
-func BenchmarkHybridBuffer_Read(b *testing.B) {
+func TestHybridBuffer_StorageWithoutFallback(t *testing.T) {
+	buf := New(
+		WithThreshold(10),
+		WithStorage(func() storage.Backend {
+			return &failingStorageBackend{createErr: fmt.Errorf("storage unavailable")}
+		}),
+	)
+	defer buf.Close()
+
+	if _, err := buf.Write([]byte("data exceeding the threshold")); err == nil {
+		t.Fatal("Expected write error without storage fallback")
+	}
+}
+
+// failingStorageBackend fails to create a write stream
+type failingStorageBackend struct {
+	createErr error
+}
+
+func (f *failingStorageBackend) Create() (io.WriteCloser, error) {
+	return nil, f.createErr
+}
+
+func (f *failingStorageBackend) Open() (io.ReadCloser, error) {
+	return nil, fmt.Errorf("nothing stored")
+}
+
+func (f *failingStorageBackend) Remove() error {
+	return nil
+}
+
+// fullDiskBackend accepts space bytes, then fails writes with ENOSPC
+type fullDiskBackend struct {
+	mockStorageBackend
+	space int
+}
+
+func (f *fullDiskBackend) Create() (io.WriteCloser, error) {
+	f.createCalled = true
+	return &fullDiskWriter{backend: f}, nil
+}
+
+type fullDiskWriter struct {
+	backend *fullDiskBackend
+}
+
+func (w *fullDiskWriter) Write(p []byte) (int, error) {
+	n := min(len(p), w.backend.space-len(w.backend.data))
+	w.backend.data = append(w.backend.data, p[:n]...)
+	if n < len(p) {
+		return n, &os.PathError{Op: "write", Path: "spill", Err: syscall.ENOSPC}
+	}
+	return n, nil
+}
+
+func (w *fullDiskWriter) Close() error { return nil }
+
+func TestHybridBuffer_StorageFull(t *testing.T) {
+	var backends []*fullDiskBackend
+	buf := New(WithThreshold(10), WithStorage(func() storage.Backend {
+		backends = append(backends, &fullDiskBackend{space: 8})
+		return backends[len(backends)-1]
+	}))
+	defer buf.Close()
+
+	buf.WriteString("in memory")
+	_, err := buf.WriteString(" and spilled")
+	if !errors.Is(err, ErrStorageFull) || !errors.Is(err, syscall.ENOSPC) {
+		t.Fatalf("Expected ErrStorageFull wrapping ENOSPC, got %v", err)
+	}
+
+	// The partially written object is removed right away, the data stays in memory
+	if !backends[0].removeCalled {
+		t.Fatal("Expected the partial storage object to be removed")
+	}
+	if got := buf.String(); got != "in memory" {
+		t.Fatalf("Expected the memory data to survive, got %q", got)
+	}
+
+	// With a fallback the buffer keeps writing to memory
+	fallback := New(WithThreshold(10), WithStorageFallback(nil), WithStorage(func() storage.Backend {
+		return &fullDiskBackend{space: 8}
+	}))
+	defer fallback.Close()
+	fallback.WriteString("in memory")
+	if _, err := fallback.WriteString(" and more"); err != nil {
+		t.Fatalf("Expected the fallback to memory, got %v", err)
+	}
+	if got := fallback.String(); got != "in memory and more" {
+		t.Fatalf("Unexpected content after fallback: %q", got)
+	}
+}
+
+func TestHybridBuffer_MaxSize(t *testing.T) {
+	tests := []struct {
+		name      string
+		threshold int
+	}{
+		{"memory", 1024},
+		{"storage", 4},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf := New(WithThreshold(tt.threshold), WithMaxSize(10))
+			defer buf.Close()
+
+			n, err := buf.Write([]byte("012345"))
+			if err != nil || n != 6 {
+				t.Fatalf("First write: expected 6 bytes and no error, got %d, %v", n, err)
+			}
+
+			// Straddles the limit: only the first 4 bytes fit
+			n, err = buf.Write([]byte("6789abc"))
+			if err != ErrMaxSizeExceeded {
+				t.Fatalf("Expected ErrMaxSizeExceeded, got %v", err)
+			}
+			if n != 4 {
+				t.Fatalf("Expected short write of 4 bytes, got %d", n)
+			}
+
+			// Already at the limit: nothing is written
+			n, err = buf.WriteString("x")
+			if err != ErrMaxSizeExceeded || n != 0 {
+				t.Fatalf("Expected 0 bytes and ErrMaxSizeExceeded, got %d, %v", n, err)
+			}
+
+			if buf.Size() != 10 {
+				t.Fatalf("Expected size 10, got %d", buf.Size())
+			}
+			if result := buf.String(); result != "0123456789" {
+				t.Fatalf("Expected %q, got %q", "0123456789", result)
+			}
+		})
+	}
+}
+
+func TestHybridBuffer_MaxSizeReadFrom(t *testing.T) {
+	buf := New(WithThreshold(100), WithMaxSize(1000))
+	defer buf.Close()
+
+	n, err := buf.ReadFrom(bytes.NewReader(make([]byte, 2000)))
+	if err != ErrMaxSizeExceeded {
+		t.Fatalf("Expected ErrMaxSizeExceeded, got %v", err)
+	}
+	if n != 1000 || buf.Size() != 1000 {
+		t.Fatalf("Expected 1000 bytes, got n=%d size=%d", n, buf.Size())
+	}
+}
+
+func TestHybridBuffer_AvailableAtThreshold(t *testing.T) {
+	threshold := 100
+
+	buf := New(WithThreshold(threshold))
+	defer buf.Close()
+
+	buf.Write(make([]byte, threshold))
+	if available := buf.Available(); available != 0 {
+		t.Fatalf("Expected available 0 after writing exactly threshold bytes, got %d", available)
+	}
+
+	buf2 := New(WithThreshold(threshold))
+	defer buf2.Close()
+
+	buf2.Write(make([]byte, threshold-1))
+	if available := buf2.Available(); available != 1 {
+		t.Fatalf("Expected available 1, got %d", available)
+	}
+	buf2.Write(make([]byte, 2))
+	if available := buf2.Available(); available != 0 {
+		t.Fatalf("Expected available 0 after crossing threshold, got %d", available)
+	}
+}
+
+func TestHybridBuffer_AvailableNeverNegative(t *testing.T) {
+	// With storage fallback the memory buffer can grow beyond the threshold
+	buf := New(
+		WithThreshold(10),
+		WithStorage(func() storage.Backend {
+			return &failingStorageBackend{createErr: fmt.Errorf("storage unavailable")}
+		}),
+		WithStorageFallback(nil),
+	)
+	defer buf.Close()
+
+	buf.Write(make([]byte, 50))
+	if available := buf.Available(); available != 0 {
+		t.Fatalf("Expected available 0 beyond threshold, got %d", available)
+	}
+}
+
+func TestHybridBuffer_TruncateStorage(t *testing.T) {
+	mockBackends := []*mockStorageBackend{}
+	buf := New(
+		WithThreshold(5),
+		WithStorage(func() storage.Backend {
+			backend := &mockStorageBackend{}
+			mockBackends = append(mockBackends, backend)
+			return backend
+		}),
+	)
+	defer buf.Close()
+
+	buf.Write([]byte("0123456789"))
+	buf.Truncate(7)
+
+	if buf.Size() != 7 {
+		t.Fatalf("Expected size 7 after truncate, got %d", buf.Size())
+	}
+	if len(mockBackends) != 2 {
+		t.Fatalf("Expected truncation to create a new storage object, got %d backends", len(mockBackends))
+	}
+	if !mockBackends[0].removeCalled {
+		t.Fatal("Expected old storage object to be removed")
+	}
+
+	// Writing continues after the truncated data
+	buf.Write([]byte("xyz"))
+	if result := buf.String(); result != "0123456xyz" {
+		t.Fatalf("Expected %q, got %q", "0123456xyz", result)
+	}
+}
+
+func TestHybridBuffer_TruncateStorageKeepsOffset(t *testing.T) {
+	buf := New(WithThreshold(5))
+	defer buf.Close()
+
+	buf.Write([]byte("0123456789"))
+
+	head := make([]byte, 3)
+	buf.Read(head)
+
+	buf.Truncate(8)
+	if buf.Len() != 5 {
+		t.Fatalf("Expected Len() 5 after truncate, got %d", buf.Len())
+	}
+	if result := buf.String(); result != "34567" {
+		t.Fatalf("Expected %q, got %q", "34567", result)
+	}
+}
+
+func TestHybridBuffer_ReadAcrossSpill(t *testing.T) {
+	buf := New(WithThreshold(10))
+	defer buf.Close()
+
+	buf.Write([]byte("01234"))
+
+	head := make([]byte, 3)
+	buf.Read(head)
+
+	// Spill after data has been consumed from memory
+	buf.Write([]byte("56789abcdef"))
+	if result := buf.String(); result != "3456789abcdef" {
+		t.Fatalf("Expected %q, got %q", "3456789abcdef", result)
+	}
+}
+
+func TestHybridBuffer_TruncateOffsetRestoration(t *testing.T) {
+	tests := []struct {
+		name      string
+		threshold int
+		consume   int
+		truncate  int
+		expected  string
+	}{
+		{"memory inside range", 1024, 3, 6, "345"},
+		{"memory at boundary", 1024, 5, 5, ""},
+		{"memory past boundary", 1024, 8, 5, ""},
+		{"storage inside range", 4, 3, 6, "345"},
+		{"storage at boundary", 4, 5, 5, ""},
+		{"storage past boundary", 4, 8, 5, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf := New(WithThreshold(tt.threshold))
+			defer buf.Close()
+
+			buf.Write([]byte("0123456789"))
+			buf.Read(make([]byte, tt.consume))
+
+			buf.Truncate(tt.truncate)
+			if buf.Len() != len(tt.expected) {
+				t.Fatalf("Expected Len() %d, got %d", len(tt.expected), buf.Len())
+			}
+
+			data := make([]byte, 10)
+			n, err := buf.Read(data)
+			if tt.expected == "" {
+				if err != io.EOF || n != 0 {
+					t.Fatalf("Expected EOF, got %d bytes, err=%v", n, err)
+				}
+				return
+			}
+			if err != nil && err != io.EOF {
+				t.Fatalf("Read failed: %v", err)
+			}
+			if string(data[:n]) != tt.expected {
+				t.Fatalf("Expected %q, got %q", tt.expected, string(data[:n]))
+			}
+		})
+	}
+}
+
+func TestHybridBuffer_TruncateFront(t *testing.T) {
+	tests := []struct {
+		name      string
+		threshold int
+	}{
+		{"memory", 1024},
+		{"storage", 4},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf := New(WithThreshold(tt.threshold))
+			defer buf.Close()
+
+			buf.Write([]byte("0123456789"))
+
+			buf.TruncateFront(2)
+			if buf.Len() != 8 {
+				t.Fatalf("Expected Len() 8, got %d", buf.Len())
+			}
+
+			// Discard again after the read stream has been opened
+			c, _ := buf.ReadByte()
+			if c != '2' {
+				t.Fatalf("Expected '2', got %q", c)
+			}
+			buf.TruncateFront(3)
+
+			if result := buf.String(); result != "6789" {
+				t.Fatalf("Expected %q, got %q", "6789", result)
+			}
+		})
+	}
+}
+
+func TestHybridBuffer_TruncateFrontOutOfRange(t *testing.T) {
 	buf := New()
 	defer buf.Close()
 
-	// Prepare data
-	data := make([]byte, 1024*1024) // 1MB
+	buf.Write([]byte("0123456789"))
+	buf.Read(make([]byte, 5))
+
+	defer func() {
+		if r := recover(); r == nil {
+			t.Fatal("Expected panic for truncating more than Len()")
+		}
+	}()
+	buf.TruncateFront(6)
+}
+
+func TestHybridBuffer_MaxRetained(t *testing.T) {
+	mockBackend := &mockStorageBackend{}
+	buf := New(
+		WithThreshold(16),
+		WithMaxRetained(4),
+		WithStorage(func() storage.Backend { return mockBackend }),
+	)
+	defer buf.Close()
+
+	for i := 0; i < 100; i++ {
+		buf.WriteString(fmt.Sprintf("%d", i%10))
+		if buf.Len() > 4 {
+			t.Fatalf("Len() exceeded retained window: %d", buf.Len())
+		}
+	}
+	if mockBackend.createCalled {
+		t.Fatal("Ring buffer should never spill to storage")
+	}
+	if result := buf.String(); result != "6789" {
+		t.Fatalf("Expected %q, got %q", "6789", result)
+	}
+
+	// A single write larger than the window keeps only its tail
+	n, err := buf.WriteString("abcdefgh")
+	if err != nil || n != 8 {
+		t.Fatalf("Expected 8 bytes written, got %d, %v", n, err)
+	}
+	if result := buf.String(); result != "efgh" {
+		t.Fatalf("Expected %q, got %q", "efgh", result)
+	}
+}
+
+func TestHybridBuffer_MaxRetainedCappedToThreshold(t *testing.T) {
+	buf := New(WithThreshold(8), WithMaxRetained(100))
+	defer buf.Close()
+
+	buf.WriteString("0123456789abcdef")
+	if buf.Len() != 8 {
+		t.Fatalf("Expected window capped to threshold 8, got %d", buf.Len())
+	}
+	if result := buf.String(); result != "89abcdef" {
+		t.Fatalf("Expected %q, got %q", "89abcdef", result)
+	}
+}
+
+func TestHybridBuffer_Backpressure(t *testing.T) {
+	const maxInFlight = 64
+
+	mockBackend := &mockStorageBackend{}
+	buf := New(
+		WithThreshold(128),
+		WithBackpressure(maxInFlight),
+		WithStorage(func() storage.Backend { return mockBackend }),
+	)
+	defer buf.Close()
+
+	data := make([]byte, 10000)
 	for i := range data {
-		data[i] = byte(i % 256)
+		data[i] = byte(i % 251)
 	}
-	buf.Write(data)
 
-	readData := make([]byte, 1024)
-	b.ResetTimer()
+	// Producer writes much more than the limit
+	errCh := make(chan error, 1)
+	go func() {
+		for i := 0; i < len(data); i += 100 {
+			if _, err := buf.Write(data[i : i+100]); err != nil {
+				errCh <- err
+				return
+			}
+		}
+		errCh <- nil
+	}()
 
-	for i := 0; i < b.N; i++ {
-		if i%1000 == 0 { // Reset periodically
-			buf.Reset()
-			buf.Write(data)
+	// Slow consumer
+	var received []byte
+	chunk := make([]byte, 30)
+	for len(received) < len(data) {
+		if l := buf.Len(); l > maxInFlight {
+			t.Fatalf("Len() %d exceeded backpressure limit %d", l, maxInFlight)
 		}
-		buf.Read(readData)
+		n, err := buf.Read(chunk)
+		if err != nil && err != io.EOF {
+			t.Fatalf("Read failed: %v", err)
+		}
+		received = append(received, chunk[:n]...)
+		if n == 0 {
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	if err := <-errCh; err != nil {
+		t.Fatalf("Producer failed: %v", err)
+	}
+	if !bytes.Equal(received, data) {
+		t.Fatal("Data mismatch through backpressure buffer")
+	}
+	if mockBackend.createCalled {
+		t.Fatal("Backpressure buffer should stay in memory")
+	}
+}
+
+func TestHybridBuffer_BackpressureCloseUnblocksWriter(t *testing.T) {
+	buf := New(WithBackpressure(4))
+
+	errCh := make(chan error, 1)
+	go func() {
+		_, err := buf.Write([]byte("more than four bytes"))
+		errCh <- err
+	}()
+
+	time.Sleep(10 * time.Millisecond)
+	buf.Close()
+
+	select {
+	case err := <-errCh:
+		if err != ErrClosed {
+			t.Fatalf("Expected ErrClosed, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Close did not unblock the writer")
+	}
+}
+
+func TestHybridBuffer_NewReader(t *testing.T) {
+	tests := []struct {
+		name      string
+		threshold int
+	}{
+		{"memory", 1024},
+		{"storage", 4},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf := New(WithThreshold(tt.threshold))
+			defer buf.Close()
+
+			buf.WriteString("0123456789")
+			buf.Read(make([]byte, 3))
+
+			r1, err := buf.NewReader()
+			if err != nil {
+				t.Fatalf("NewReader failed: %v", err)
+			}
+			r2, err := buf.NewReader()
+			if err != nil {
+				t.Fatalf("NewReader failed: %v", err)
+			}
+
+			// Readers are independent of each other and of the buffer
+			head := make([]byte, 4)
+			io.ReadFull(r1, head)
+			if string(head) != "0123" {
+				t.Fatalf("Expected %q, got %q", "0123", string(head))
+			}
+			all, _ := io.ReadAll(r2)
+			if string(all) != "0123456789" {
+				t.Fatalf("Expected %q, got %q", "0123456789", string(all))
+			}
+			r1.Close()
+			r2.Close()
+
+			// Closing the readers keeps the data and the buffer's position
+			if result := buf.String(); result != "3456789" {
+				t.Fatalf("Expected %q, got %q", "3456789", result)
+			}
+		})
+	}
+}
+
+func TestHybridBuffer_NewReaderMemoryIsolated(t *testing.T) {
+	buf := New()
+	defer buf.Close()
+	buf.WriteString("hello world")
+
+	r, err := buf.NewReader()
+	if err != nil {
+		t.Fatalf("NewReader failed: %v", err)
+	}
+	defer r.Close()
+
+	// Patching the buffer while the reader is used must neither race nor show through
+	done := make(chan []byte)
+	go func() {
+		data, _ := io.ReadAll(iotest.OneByteReader(r))
+		done <- data
+	}()
+	for i := 0; i < 100; i++ {
+		buf.WriteAt([]byte("HELLO"), 0)
+	}
+	if data := <-done; string(data) != "hello world" {
+		t.Fatalf("Expected the contents at creation, got %q", data)
+	}
+}
+
+func TestHybridBuffer_WriteAfterNewReader(t *testing.T) {
+	buf := New(WithThreshold(4))
+	defer buf.Close()
+
+	buf.WriteString("01234")
+	r, _ := buf.NewReader()
+	io.ReadAll(r)
+	r.Close()
+
+	// Writing continues after the stream was finalized for reading
+	buf.WriteString("56789")
+
+	r, err := buf.NewReader()
+	if err != nil {
+		t.Fatalf("NewReader failed: %v", err)
+	}
+	defer r.Close()
+
+	all, _ := io.ReadAll(r)
+	if string(all) != "0123456789" {
+		t.Fatalf("Expected %q, got %q", "0123456789", string(all))
+	}
+}
+
+func TestHybridBuffer_WriteAfterNewReaderInvalidates(t *testing.T) {
+	buf := New(WithThreshold(4), WithMiddleware(xorMiddleware{}))
+	defer buf.Close()
+
+	buf.WriteString("01234")
+	r, err := buf.NewReader()
+	if err != nil {
+		t.Fatalf("NewReader failed: %v", err)
+	}
+	defer r.Close()
+
+	// Writing again copies the data into a new storage object and removes the old one
+	buf.WriteString("56789")
+
+	if _, err := r.Read(make([]byte, 5)); err != ErrStale {
+		t.Fatalf("Expected ErrStale after the storage was rewritten, got %v", err)
+	}
+}
+
+func TestHybridBuffer_StaleReader(t *testing.T) {
+	tests := []struct {
+		name      string
+		threshold int
+	}{
+		{"memory", 1024},
+		{"storage", 4},
+	}
+
+	invalidate := map[string]func(Buffer){
+		"reset":    func(buf Buffer) { buf.Reset() },
+		"truncate": func(buf Buffer) { buf.Truncate(2) },
+		"close":    func(buf Buffer) { buf.Close() },
+	}
+
+	for _, tt := range tests {
+		for name, fn := range invalidate {
+			t.Run(tt.name+"/"+name, func(t *testing.T) {
+				buf := New(WithThreshold(tt.threshold))
+				defer buf.Close()
+
+				buf.WriteString("0123456789")
+				r, err := buf.NewReader()
+				if err != nil {
+					t.Fatalf("NewReader failed: %v", err)
+				}
+				defer r.Close()
+				rs, err := buf.NewReadSeeker()
+				if err != nil {
+					t.Fatalf("NewReadSeeker failed: %v", err)
+				}
+				defer rs.Close()
+
+				head := make([]byte, 2)
+				if _, err := io.ReadFull(r, head); err != nil {
+					t.Fatalf("Read before invalidation failed: %v", err)
+				}
+
+				fn(buf)
+				buf.WriteString("new data")
+
+				if _, err := r.Read(head); err != ErrStale {
+					t.Fatalf("Expected ErrStale from reader, got %v", err)
+				}
+				if _, err := rs.Read(head); err != ErrStale {
+					t.Fatalf("Expected ErrStale from read seeker, got %v", err)
+				}
+				if _, err := rs.Seek(0, io.SeekStart); err != ErrStale {
+					t.Fatalf("Expected ErrStale from Seek, got %v", err)
+				}
+			})
+		}
+	}
+}
+
+func TestHybridBuffer_NewReadSeeker(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []Option
+	}{
+		{"memory", nil},
+		{"storage", []Option{WithThreshold(4)}},
+		{"storage with middleware", []Option{WithThreshold(4), WithMiddleware(xorMiddleware{})}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf := New(tt.opts...)
+			defer buf.Close()
+
+			buf.WriteString("0123456789")
+			buf.Read(make([]byte, 2))
+
+			rs, err := buf.NewReadSeeker()
+			if err != nil {
+				t.Fatalf("NewReadSeeker failed: %v", err)
+			}
+			defer rs.Close()
+
+			if pos, _ := rs.Seek(-4, io.SeekEnd); pos != 6 {
+				t.Fatalf("Expected position 6, got %d", pos)
+			}
+			data, _ := io.ReadAll(rs)
+			if string(data) != "6789" {
+				t.Fatalf("Expected %q, got %q", "6789", string(data))
+			}
+
+			// Seek backwards
+			rs.Seek(1, io.SeekStart)
+			part := make([]byte, 3)
+			io.ReadFull(rs, part)
+			if string(part) != "123" {
+				t.Fatalf("Expected %q, got %q", "123", string(part))
+			}
+
+			// The buffer's own read position is untouched
+			if result := buf.String(); result != "23456789" {
+				t.Fatalf("Expected %q, got %q", "23456789", result)
+			}
+		})
+	}
+}
+
+func TestHybridBuffer_NewReadSeekerServeContent(t *testing.T) {
+	buf := New(WithThreshold(4), WithMiddleware(xorMiddleware{}))
+	defer buf.Close()
+	buf.WriteString("0123456789")
+
+	rs, err := buf.NewReadSeeker()
+	if err != nil {
+		t.Fatalf("NewReadSeeker failed: %v", err)
+	}
+	defer rs.Close()
+
+	req := httptest.NewRequest(http.MethodGet, "/data.txt", nil)
+	req.Header.Set("Range", "bytes=3-5")
+	rec := httptest.NewRecorder()
+	http.ServeContent(rec, req, "data.txt", time.Time{}, rs)
+
+	if rec.Code != http.StatusPartialContent {
+		t.Fatalf("Expected status 206, got %d", rec.Code)
+	}
+	if body := rec.Body.String(); body != "345" {
+		t.Fatalf("Expected %q, got %q", "345", body)
+	}
+}
+
+// xorMiddleware flips all bits, making stored data differ from the logical data
+type xorMiddleware struct{}
+
+func (xorMiddleware) Writer(w io.Writer) io.Writer {
+	return xorWriter{w}
+}
+
+func (xorMiddleware) Reader(r io.Reader) io.Reader {
+	return xorReader{r}
+}
+
+type xorWriter struct {
+	w io.Writer
+}
+
+func (x xorWriter) Write(p []byte) (int, error) {
+	flipped := make([]byte, len(p))
+	for i, c := range p {
+		flipped[i] = ^c
+	}
+	return x.w.Write(flipped)
+}
+
+type xorReader struct {
+	r io.Reader
+}
+
+func (x xorReader) Read(p []byte) (int, error) {
+	n, err := x.r.Read(p)
+	for i := range p[:n] {
+		p[i] = ^p[i]
+	}
+	return n, err
+}
+
+func TestHybridBuffer_ReadFromWriterTo(t *testing.T) {
+	data := bytes.Repeat([]byte("0123456789"), 1000)
+
+	tests := []struct {
+		name      string
+		threshold int
+	}{
+		{"memory", 1 << 20},
+		{"storage", 100},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf := New(WithThreshold(tt.threshold))
+			defer buf.Close()
+
+			src := &writerToSource{r: bytes.NewReader(data)}
+			n, err := buf.ReadFrom(src)
+			if err != nil {
+				t.Fatalf("ReadFrom failed: %v", err)
+			}
+			if !src.used {
+				t.Fatal("Expected WriteTo fast path to be used")
+			}
+			if n != int64(len(data)) || buf.Size() != int64(len(data)) {
+				t.Fatalf("Expected %d bytes, got n=%d size=%d", len(data), n, buf.Size())
+			}
+			if !bytes.Equal(buf.Bytes(), data) {
+				t.Fatal("Data mismatch after ReadFrom")
+			}
+		})
+	}
+}
+
+func TestHybridBuffer_ReadFromWriterToMaxSize(t *testing.T) {
+	buf := New(WithMaxSize(100))
+	defer buf.Close()
+
+	n, err := buf.ReadFrom(strings.NewReader(strings.Repeat("x", 200)))
+	if err != ErrMaxSizeExceeded {
+		t.Fatalf("Expected ErrMaxSizeExceeded, got %v", err)
+	}
+	if n != 100 || buf.Size() != 100 {
+		t.Fatalf("Expected 100 bytes, got n=%d size=%d", n, buf.Size())
+	}
+}
+
+// writerToSource records whether its WriteTo was used
+type writerToSource struct {
+	r    *bytes.Reader
+	used bool
+}
+
+func (s *writerToSource) Read(p []byte) (int, error) {
+	return s.r.Read(p)
+}
+
+func (s *writerToSource) WriteTo(w io.Writer) (int64, error) {
+	s.used = true
+	return s.r.WriteTo(w)
+}
+
+func TestHybridBuffer_WriteToStorage(t *testing.T) {
+	data := bytes.Repeat([]byte("0123456789"), 1000)
+
+	buf := New(WithThreshold(100), WithMiddleware(xorMiddleware{}))
+	defer buf.Close()
+	buf.Write(data)
+
+	// Partially consume through the regular read path first
+	head := make([]byte, 10)
+	buf.Read(head)
+
+	counter := &countingWriter{}
+	n, err := buf.WriteTo(counter)
+	if err != nil {
+		t.Fatalf("WriteTo failed: %v", err)
+	}
+	if n != int64(len(data)-10) {
+		t.Fatalf("Expected %d bytes, got %d", len(data)-10, n)
+	}
+	if !bytes.Equal(counter.data.Bytes(), data[10:]) {
+		t.Fatal("Data mismatch after WriteTo")
+	}
+	if counter.writes >= len(data)/512 {
+		t.Fatalf("Expected large chunks, got %d writes", counter.writes)
+	}
+
+	// The buffer is consumed
+	if buf.Len() != 0 {
+		t.Fatalf("Expected Len() 0 after WriteTo, got %d", buf.Len())
+	}
+	if _, err := buf.Read(head); err != io.EOF {
+		t.Fatalf("Expected EOF after WriteTo, got %v", err)
+	}
+}
+
+// countingWriter records written data and the number of Write calls
+type countingWriter struct {
+	data   bytes.Buffer
+	writes int
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	c.writes++
+	return c.data.Write(p)
+}
+
+// eofMiddleware returns io.EOF together with the final bytes on read
+type eofMiddleware struct{}
+
+func (eofMiddleware) Writer(w io.Writer) io.Writer { return w }
+func (eofMiddleware) Reader(r io.Reader) io.Reader { return iotest.DataErrReader(r) }
+
+func TestHybridBuffer_ReadEOFContract(t *testing.T) {
+	data := []byte("0123456789")
+
+	type result struct {
+		n   int
+		err error
+	}
+	reads := func(r io.Reader) []result {
+		var results []result
+		p := make([]byte, 4)
+		for i := 0; i < 5; i++ {
+			n, err := r.Read(p)
+			results = append(results, result{n, err})
+		}
+		return results
+	}
+	want := reads(bytes.NewBuffer(data))
+
+	modes := []struct {
+		name string
+		opts []Option
+	}{
+		{"memory", nil},
+		{"storage", []Option{WithThreshold(4)}},
+		{"storage with EOF on the last chunk", []Option{WithThreshold(4), WithMiddleware(eofMiddleware{})}},
+	}
+	for _, mode := range modes {
+		buf := New(mode.opts...)
+		defer buf.Close()
+		buf.Write(data)
+
+		if got := reads(buf); !slices.Equal(got, want) {
+			t.Errorf("%s: expected reads %v like bytes.Buffer, got %v", mode.name, want, got)
+		}
+	}
+
+	// ReadByte no longer drops the last byte when it arrives with io.EOF
+	buf := New(WithThreshold(4), WithMiddleware(eofMiddleware{}))
+	defer buf.Close()
+	buf.Write(data)
+	var got []byte
+	for {
+		c, err := buf.ReadByte()
+		if err != nil {
+			break
+		}
+		got = append(got, c)
+	}
+	if !bytes.Equal(got, data) {
+		t.Fatalf("Expected %q from ReadByte, got %q", data, got)
+	}
+}
+
+// countingMiddleware counts the readers it creates
+type countingMiddleware struct {
+	readers *atomic.Int32
+}
+
+func (m countingMiddleware) Writer(w io.Writer) io.Writer { return w }
+func (m countingMiddleware) Reader(r io.Reader) io.Reader {
+	m.readers.Add(1)
+	return r
+}
+
+func TestWithReadCache(t *testing.T) {
+	data := bytes.Repeat([]byte("cached "), 1000)
+	readers := &atomic.Int32{}
+	buf := New(WithThreshold(16), WithReadCache(1<<20), WithMiddleware(countingMiddleware{readers}))
+	defer buf.Close()
+	buf.Write(data)
+
+	readAll := func() []byte {
+		t.Helper()
+		r, err := buf.NewReader()
+		if err != nil {
+			t.Fatalf("NewReader failed: %v", err)
+		}
+		defer r.Close()
+		got, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatalf("ReadAll failed: %v", err)
+		}
+		return got
+	}
+
+	for i := 0; i < 3; i++ {
+		if got := readAll(); !bytes.Equal(got, data) {
+			t.Fatalf("Read %d: data mismatch", i)
+		}
+	}
+	if n := readers.Load(); n != 1 {
+		t.Fatalf("Expected the middleware reader once, got %d", n)
+	}
+
+	// Writes make the cache stale
+	buf.Write([]byte("more"))
+	if got := readAll(); !bytes.Equal(got, append(data, "more"...)) {
+		t.Fatal("Data mismatch after write")
+	}
+	before := readers.Load()
+	readAll()
+	if n := readers.Load(); n != before {
+		t.Fatalf("Expected the refilled cache to serve the next read, got %d more readers", n-before)
+	}
+
+	// Contents beyond the cache size are streamed every time
+	readers.Store(0)
+	small := New(WithThreshold(16), WithReadCache(100), WithMiddleware(countingMiddleware{readers}))
+	defer small.Close()
+	small.Write(data)
+	for i := 0; i < 2; i++ {
+		r, _ := small.NewReader()
+		io.Copy(io.Discard, r)
+		r.Close()
+	}
+	if n := readers.Load(); n != 2 {
+		t.Fatalf("Expected the middleware reader for every read beyond the cache size, got %d", n)
+	}
+}
+
+func TestHybridBuffer_ReadFull(t *testing.T) {
+	data := bytes.Repeat([]byte("0123456789"), 1000)
+
+	for _, threshold := range []int{1 << 20, 100} {
+		// Gzip returns short reads from storage
+		buf := New(WithThreshold(threshold), WithGzip(gzip.BestSpeed))
+		defer buf.Close()
+		buf.Write(data)
+
+		p := make([]byte, 6000)
+		n, err := buf.ReadFull(p)
+		if err != nil || n != len(p) || !bytes.Equal(p, data[:6000]) {
+			t.Fatalf("Threshold %d: expected a full read, got %d bytes, %v", threshold, n, err)
+		}
+
+		// Only 4000 bytes are left
+		n, err = buf.ReadFull(p)
+		if err != io.ErrUnexpectedEOF || n != 4000 || !bytes.Equal(p[:n], data[6000:]) {
+			t.Fatalf("Threshold %d: expected io.ErrUnexpectedEOF after 4000 bytes, got %d bytes, %v", threshold, n, err)
+		}
+
+		n, err = buf.ReadFull(p)
+		if err != io.EOF || n != 0 {
+			t.Fatalf("Threshold %d: expected io.EOF, got %d bytes, %v", threshold, n, err)
+		}
+	}
+
+	// Reads across the memory/storage boundary while data is still being written
+	buf := New(WithThreshold(8))
+	defer buf.Close()
+	buf.Write([]byte("0123"))
+	p := make([]byte, 4)
+	if n, err := buf.ReadFull(p); err != nil || string(p[:n]) != "0123" {
+		t.Fatalf("Expected \"0123\", got %q, %v", p[:n], err)
+	}
+	buf.Write(data[:20])
+	p = make([]byte, 20)
+	if n, err := buf.ReadFull(p); err != nil || !bytes.Equal(p[:n], data[:20]) {
+		t.Fatalf("Expected %q, got %q, %v", data[:20], p[:n], err)
+	}
+
+	buf.Close()
+	if _, err := buf.ReadFull(p); err != ErrClosed {
+		t.Fatalf("Expected ErrClosed, got %v", err)
+	}
+}
+
+func TestHybridBuffer_ReadFromN(t *testing.T) {
+	data := bytes.Repeat([]byte("0123456789"), 100)
+
+	tests := []struct {
+		name    string
+		max     int64
+		wantN   int64
+		wantErr error
+	}{
+		{"shorter than max", 2000, 1000, nil},
+		{"exactly max", 1000, 1000, nil},
+		{"longer than max", 500, 500, ErrMaxSizeExceeded},
+		{"zero max", 0, 0, ErrMaxSizeExceeded},
+	}
+	for _, threshold := range []int{1 << 20, 100} {
+		for _, tt := range tests {
+			buf := New(WithThreshold(threshold))
+			defer buf.Close()
+
+			// smallChunkReader hides io.WriterTo to exercise the read loop too
+			for _, r := range []io.Reader{bytes.NewReader(data), smallChunkReader{bytes.NewReader(data)}} {
+				buf.Reset()
+				n, err := buf.ReadFromN(r, tt.max)
+				if n != tt.wantN || err != tt.wantErr {
+					t.Fatalf("Threshold %d, %s: expected %d, %v, got %d, %v", threshold, tt.name, tt.wantN, tt.wantErr, n, err)
+				}
+				if got := buf.Bytes(); !bytes.Equal(got, data[:tt.wantN]) {
+					t.Fatalf("Threshold %d, %s: expected the first %d bytes, got %d", threshold, tt.name, tt.wantN, len(got))
+				}
+			}
+		}
+	}
+}
+
+func TestHybridBuffer_GoString(t *testing.T) {
+	buf := New(WithThreshold(16))
+	defer buf.Close()
+	buf.Write([]byte("0123456789"))
+	buf.Read(make([]byte, 4))
+
+	want := "hybridbuffer{size:10, inMemory:true, offset:4, closed:false}"
+	for _, format := range []string{"%v", "%s", "%#v", "%+v", "%q"} {
+		if got := fmt.Sprintf(format, buf); got != want {
+			t.Errorf("%s: expected %q, got %q", format, want, got)
+		}
+	}
+	if buf.Len() != 6 {
+		t.Fatalf("Printing consumed the buffer, Len() is %d", buf.Len())
+	}
+
+	buf.Write(bytes.Repeat([]byte("x"), 20))
+	want = "hybridbuffer{size:30, inMemory:false, offset:4, closed:false}"
+	if got := buf.GoString(); got != want {
+		t.Fatalf("Expected %q, got %q", want, got)
+	}
+}
+
+// seekBackend opens its data as a seekable stream recording the seek targets
+type seekBackend struct {
+	mockStorageBackend
+	seeks *[]int64
+}
+
+func (s *seekBackend) Open() (io.ReadCloser, error) {
+	return &seekRecorder{Reader: bytes.NewReader(s.data), seeks: s.seeks}, nil
+}
+
+type seekRecorder struct {
+	*bytes.Reader
+	seeks *[]int64
+}
+
+func (s *seekRecorder) Seek(off int64, whence int) (int64, error) {
+	*s.seeks = append(*s.seeks, off)
+	return s.Reader.Seek(off, whence)
+}
+
+func (s *seekRecorder) Close() error { return nil }
+
+func TestHybridBuffer_SeekableStorage(t *testing.T) {
+	data := []byte("0123456789abcdefghij")
+	var seeks []int64
+	buf := New(WithThreshold(4), WithStorage(func() storage.Backend { return &seekBackend{seeks: &seeks} }))
+	defer buf.Close()
+	buf.Write(data)
+
+	// Resuming after a write, copying and seeking seek the stream instead of discarding
+	p := make([]byte, 5)
+	buf.Read(p)
+	buf.Write([]byte("!"))
+	buf.Read(p)
+	if string(p) != "56789" {
+		t.Fatalf("Expected 56789, got %q", p)
+	}
+
+	var out bytes.Buffer
+	buf.CopyTo(&out)
+	if out.String() != "abcdefghij!" {
+		t.Fatalf("Expected abcdefghij!, got %q", out.String())
+	}
+
+	rs, _ := buf.NewReadSeeker()
+	defer rs.Close()
+	rs.Seek(15, io.SeekStart)
+	got, _ := io.ReadAll(rs)
+	if string(got) != "fghij!" {
+		t.Fatalf("Expected fghij!, got %q", got)
+	}
+
+	if want := []int64{5, 10, 15}; !slices.Equal(seeks, want) {
+		t.Fatalf("Expected seeks to %v, got %v", want, seeks)
+	}
+}
+
+// offsetBackend records the offsets its data is opened at
+type offsetBackend struct {
+	mockStorageBackend
+	offsets *[]int64
+}
+
+func (o *offsetBackend) OpenAt(off int64) (io.ReadCloser, error) {
+	*o.offsets = append(*o.offsets, off)
+	return io.NopCloser(bytes.NewReader(o.data[off:])), nil
+}
+
+func TestHybridBuffer_OffsetOpener(t *testing.T) {
+	data := []byte("0123456789abcdefghij")
+	var offsets []int64
+	provider := func() storage.Backend { return &offsetBackend{offsets: &offsets} }
+	buf := New(WithThreshold(4), WithStorage(provider))
+	defer buf.Close()
+	buf.Write(data)
+
+	// A write after reading closes the read stream, which resumes at the offset
+	p := make([]byte, 5)
+	buf.Read(p)
+	buf.Write([]byte("!"))
+	buf.Read(p)
+	if string(p) != "56789" {
+		t.Fatalf("Expected 56789, got %q", p)
+	}
+
+	// Non-consuming copies start at the read position
+	var out bytes.Buffer
+	buf.CopyTo(&out)
+	if out.String() != "abcdefghij!" {
+		t.Fatalf("Expected abcdefghij!, got %q", out.String())
+	}
+
+	// Seeks open the stream at the target
+	rs, _ := buf.NewReadSeeker()
+	defer rs.Close()
+	rs.Seek(15, io.SeekStart)
+	got, _ := io.ReadAll(rs)
+	if string(got) != "fghij!" {
+		t.Fatalf("Expected fghij!, got %q", got)
+	}
+
+	if want := []int64{5, 10, 15}; !slices.Equal(offsets, want) {
+		t.Fatalf("Expected OpenAt at %v, got %v", want, offsets)
+	}
+
+	// Middlewares change the stored bytes, so the stream is read from the start
+	offsets = nil
+	buf = New(WithThreshold(4), WithMiddleware(xorMiddleware{}), WithStorage(provider))
+	defer buf.Close()
+	buf.Write(data)
+	buf.Read(p)
+	out.Reset()
+	if _, err := buf.CopyTo(&out); err != nil || out.String() != "56789abcdefghij" {
+		t.Fatalf("Expected 56789abcdefghij, got %q, %v", out.String(), err)
+	}
+	if len(offsets) != 0 {
+		t.Fatalf("Expected no OpenAt with middleware, got %v", offsets)
+	}
+}
+
+func TestHybridBuffer_CopyTo(t *testing.T) {
+	data := bytes.Repeat([]byte("0123456789"), 1000)
+
+	for _, threshold := range []int{1 << 20, 100} {
+		buf := New(WithThreshold(threshold), WithMiddleware(xorMiddleware{}))
+		defer buf.Close()
+		buf.Write(data)
+
+		head := make([]byte, 10)
+		buf.Read(head)
+
+		// The same contents fan out to several destinations
+		for i := 0; i < 3; i++ {
+			var out bytes.Buffer
+			n, err := buf.CopyTo(&out)
+			if err != nil {
+				t.Fatalf("Threshold %d: CopyTo failed: %v", threshold, err)
+			}
+			if n != int64(len(data)-10) || !bytes.Equal(out.Bytes(), data[10:]) {
+				t.Fatalf("Threshold %d: data mismatch after CopyTo, got %d bytes", threshold, n)
+			}
+		}
+
+		// The read offset is preserved
+		if buf.Len() != len(data)-10 {
+			t.Fatalf("Threshold %d: expected Len() %d after CopyTo, got %d", threshold, len(data)-10, buf.Len())
+		}
+		buf.Read(head)
+		if !bytes.Equal(head, data[10:20]) {
+			t.Fatalf("Threshold %d: expected to continue reading at offset 10, got %q", threshold, head)
+		}
+	}
+
+	buf := New()
+	buf.Close()
+	if _, err := buf.CopyTo(io.Discard); err != ErrClosed {
+		t.Fatalf("Expected ErrClosed, got %v", err)
+	}
+}
+
+func TestHybridBuffer_CloseJoinsErrors(t *testing.T) {
+	errFinalize := fmt.Errorf("finalize failed")
+	errRemove := fmt.Errorf("remove failed")
+
+	backend := &closeErrorBackend{closeErr: errFinalize, removeErr: errRemove}
+	buf := New(WithThreshold(4), WithStorage(func() storage.Backend { return backend }))
+	buf.WriteString("data exceeding threshold")
+
+	err := buf.Close()
+	if !errors.Is(err, errFinalize) {
+		t.Fatalf("Expected write stream close error to be reported, got %v", err)
+	}
+	if !errors.Is(err, errRemove) {
+		t.Fatalf("Expected remove error to be reported, got %v", err)
+	}
+}
+
+// closeErrorBackend fails to finalize its write stream and to remove its data
+type closeErrorBackend struct {
+	closeErr  error
+	removeErr error
+}
+
+func (c *closeErrorBackend) Create() (io.WriteCloser, error) {
+	return &failingCloser{Writer: io.Discard, err: c.closeErr}, nil
+}
+
+func (c *closeErrorBackend) Open() (io.ReadCloser, error) {
+	return io.NopCloser(strings.NewReader("")), nil
+}
+
+func (c *closeErrorBackend) Remove() error {
+	return c.removeErr
+}
+
+type failingCloser struct {
+	io.Writer
+	err error
+}
+
+func (f *failingCloser) Close() error {
+	return f.err
+}
+
+func TestHybridBuffer_ResetReportsRemoveError(t *testing.T) {
+	errRemove := fmt.Errorf("remove failed")
+	var reported []error
+
+	buf := New(
+		WithThreshold(4),
+		WithStorage(func() storage.Backend { return &closeErrorBackend{removeErr: errRemove} }),
+		WithErrorHandler(func(err error) { reported = append(reported, err) }),
+	)
+	defer buf.Close()
+
+	buf.WriteString("data exceeding threshold")
+	buf.Reset()
+
+	if len(reported) != 1 {
+		t.Fatalf("Expected one reported error, got %d", len(reported))
+	}
+	if !errors.Is(reported[0], errRemove) {
+		t.Fatalf("Expected remove error, got %v", reported[0])
+	}
+}
+
+func TestHybridBuffer_LifecycleHooks(t *testing.T) {
+	var spills []int
+	removes := 0
+
+	var buf Buffer
+	buf = New(
+		WithThreshold(10),
+		WithOnSpill(func(size int) {
+			spills = append(spills, size)
+			// Hooks run without the lock held, so calling back is safe
+			_ = buf.Len()
+		}),
+		WithOnRemove(func() {
+			removes++
+			_ = buf.Size()
+		}),
+	)
+
+	buf.WriteString("12345678")
+	if len(spills) != 0 {
+		t.Fatal("No spill expected below threshold")
+	}
+
+	buf.WriteString("9abc")
+	buf.WriteString("more data")
+	if len(spills) != 1 || spills[0] != 8 {
+		t.Fatalf("Expected one spill of 8 bytes, got %v", spills)
+	}
+
+	buf.Reset()
+	if removes != 1 {
+		t.Fatalf("Expected one remove after Reset, got %d", removes)
+	}
+
+	buf.WriteString("spill again after reset")
+	buf.Close()
+	buf.Close()
+	if len(spills) != 2 || spills[1] != 0 {
+		t.Fatalf("Expected second spill of 0 bytes, got %v", spills)
+	}
+	if removes != 2 {
+		t.Fatalf("Expected two removes after Close, got %d", removes)
+	}
+}
+
+// contextBackend records the contexts passed to its context-aware methods
+type contextBackend struct {
+	mockStorageBackend
+	createCtx context.Context
+	openCtx   context.Context
+	removeCtx context.Context
+}
+
+func (c *contextBackend) CreateContext(ctx context.Context) (io.WriteCloser, error) {
+	c.createCtx = ctx
+	return c.Create()
+}
+
+func (c *contextBackend) OpenContext(ctx context.Context) (io.ReadCloser, error) {
+	c.openCtx = ctx
+	return c.Open()
+}
+
+func (c *contextBackend) RemoveContext(ctx context.Context) error {
+	c.removeCtx = ctx
+	return c.Remove()
+}
+
+func TestHybridBuffer_WithContext(t *testing.T) {
+	type ctxKey struct{}
+	ctx, cancel := context.WithCancel(context.WithValue(context.Background(), ctxKey{}, "value"))
+	defer cancel()
+
+	backend := &contextBackend{}
+	buf := New(
+		WithThreshold(4),
+		WithContext(ctx),
+		WithStorage(func() storage.Backend { return backend }),
+	)
+
+	buf.WriteString("spilled data")
+	if backend.createCtx != ctx {
+		t.Fatal("CreateContext did not receive the buffer's context")
+	}
+
+	if b, _ := buf.ReadByte(); b != 's' {
+		t.Fatalf("Expected 's', got %q", b)
+	}
+	if backend.openCtx != ctx {
+		t.Fatal("OpenContext did not receive the buffer's context")
+	}
+
+	cancel()
+
+	if _, err := buf.Read(make([]byte, 4)); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected context.Canceled from Read, got %v", err)
+	}
+	if _, err := buf.WriteString("more"); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected context.Canceled from Write, got %v", err)
+	}
+
+	// Cleanup still happens, keeping context values
+	if err := buf.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if !backend.removeCalled {
+		t.Fatal("Storage was not removed after cancellation")
+	}
+	if backend.removeCtx.Err() != nil || backend.removeCtx.Value(ctxKey{}) != "value" {
+		t.Fatal("RemoveContext should receive an uncancelled context with the original values")
+	}
+}
+
+func TestHybridBuffer_WithContextCancelledBeforeSpill(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// Plain backends work too, the context is checked by the buffer
+	buf := New(WithThreshold(4), WithContext(ctx), WithStorage(func() storage.Backend { return &mockStorageBackend{} }))
+	defer buf.Close()
+
+	if _, err := buf.WriteString("abc"); err != nil {
+		t.Fatalf("Memory writes should not depend on the context: %v", err)
+	}
+	if _, err := buf.WriteString("defgh"); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected context.Canceled when spilling, got %v", err)
+	}
+	if got := buf.String(); got != "abc" {
+		t.Fatalf("Expected memory data to stay readable, got %q", got)
+	}
+}
+
+func TestHybridBuffer_WithGzipAndEncryptionKey(t *testing.T) {
+	key := bytes.Repeat([]byte{0x42}, 32)
+	payload := bytes.Repeat([]byte("compressible payload "), 20000)
+
+	// Option order must not matter
+	for name, opts := range map[string][]Option{
+		"gzip first":       {WithGzip(6), WithEncryptionKey(key)},
+		"encryption first": {WithEncryptionKey(key), WithGzip(6)},
+	} {
+		t.Run(name, func(t *testing.T) {
+			backend := &mockStorageBackend{}
+			buf := New(append(opts, WithThreshold(1024), WithStorage(func() storage.Backend { return backend }))...)
+			defer buf.Close()
+
+			if _, err := buf.Write(payload); err != nil {
+				t.Fatalf("Write failed: %v", err)
+			}
+			if !bytes.Equal(buf.Bytes(), payload) {
+				t.Fatal("Data mismatch after round trip")
+			}
+
+			// Compressed before encryption, so the stored object is small and opaque
+			if len(backend.data) >= len(payload)/10 {
+				t.Fatalf("Expected compressed storage, got %d bytes for %d bytes payload", len(backend.data), len(payload))
+			}
+			if bytes.Contains(backend.data, []byte("compressible")) {
+				t.Fatal("Stored data contains plaintext")
+			}
+			if bytes.HasPrefix(backend.data, []byte{0x1f, 0x8b}) {
+				t.Fatal("Stored data is unencrypted gzip")
+			}
+		})
+	}
+}
+
+func TestHybridBuffer_WithGzip(t *testing.T) {
+	backend := &mockStorageBackend{}
+	buf := New(WithThreshold(16), WithGzip(100), WithStorage(func() storage.Backend { return backend }))
+	defer buf.Close()
+
+	data := strings.Repeat("gzip ", 100)
+	buf.WriteString(data)
+	if got := buf.String(); got != data {
+		t.Fatalf("Expected %q, got %q", data, got)
+	}
+	if !bytes.HasPrefix(backend.data, []byte{0x1f, 0x8b}) {
+		t.Fatal("Expected gzip data in storage")
+	}
+}
+
+func TestHybridBuffer_WithEncryptionKey(t *testing.T) {
+	backend := &mockStorageBackend{}
+	buf := New(WithThreshold(16), WithEncryptionKey(make([]byte, 16)), WithStorage(func() storage.Backend { return backend }))
+	defer buf.Close()
+
+	// Several chunks plus a partial one
+	data := bytes.Repeat([]byte("0123456789abcdef"), 10000)
+	buf.Write(data)
+	reader, err := buf.NewReader()
+	if err != nil {
+		t.Fatalf("NewReader failed: %v", err)
+	}
+	got, err := io.ReadAll(reader)
+	reader.Close()
+	if err != nil || !bytes.Equal(got, data) {
+		t.Fatalf("Round trip failed: %v", err)
+	}
+
+	// Truncated ciphertext must not be accepted as complete data
+	backend.data = backend.data[:len(backend.data)/2]
+	reader, err = buf.NewReader()
+	if err != nil {
+		t.Fatalf("NewReader failed: %v", err)
+	}
+	defer reader.Close()
+	if _, err = io.ReadAll(reader); err == nil {
+		t.Fatal("Expected error reading truncated ciphertext")
+	}
+}
+
+func TestWithEncryptionKeyring_Rotation(t *testing.T) {
+	keyA := bytes.Repeat([]byte{'a'}, 32)
+	keyB := bytes.Repeat([]byte{'b'}, 16)
+	data := bytes.Repeat([]byte("written under key A "), 5000)
+
+	// Write under key A
+	old := &mockStorageBackend{}
+	buf := New(
+		WithThreshold(16),
+		WithEncryptionKeyring(1, map[byte][]byte{1: keyA}),
+		WithStorage(func() storage.Backend { return old }),
+	)
+	buf.Write(data)
+	reader, _ := buf.NewReader()
+	io.ReadAll(reader)
+	reader.Close()
+	if old.data[0] != 1 {
+		t.Fatalf("Expected key ID 1, got %d", old.data[0])
+	}
+
+	// Rotate to key B and read the old data back
+	rotated := WithEncryptionKeyring(2, map[byte][]byte{1: keyA, 2: keyB})
+	attached := AttachStorage(func() storage.Backend { return old }, int64(len(data)), rotated)
+	if got := attached.Bytes(); !bytes.Equal(got, data) {
+		t.Fatal("Failed to read data written under the old key")
+	}
+
+	// New writes use key B
+	current := &mockStorageBackend{}
+	buf = New(WithThreshold(16), rotated, WithStorage(func() storage.Backend { return current }))
+	defer buf.Close()
+	buf.Write(data)
+	if got := buf.Bytes(); !bytes.Equal(got, data) {
+		t.Fatal("Round trip under the new key failed")
+	}
+	if current.data[0] != 2 {
+		t.Fatalf("Expected key ID 2, got %d", current.data[0])
+	}
+
+	// Data under a retired key cannot be read
+	retired := AttachStorage(func() storage.Backend { return current }, int64(len(data)),
+		WithEncryptionKeyring(1, map[byte][]byte{1: keyA}))
+	if _, err := retired.ReadByte(); !errors.Is(err, errUnknownKeyID) {
+		t.Fatalf("Expected errUnknownKeyID, got %v", err)
+	}
+}
+
+func TestWithEncryptionKeyring_Invalid(t *testing.T) {
+	for name, opt := range map[string]Option{
+		"missing current": WithEncryptionKeyring(2, map[byte][]byte{1: make([]byte, 16)}),
+		"invalid key":     WithEncryptionKeyring(1, map[byte][]byte{1: make([]byte, 16), 2: []byte("short")}),
+	} {
+		if _, err := NewWithError(opt); !errors.Is(err, ErrInvalidOption) {
+			t.Fatalf("%s: expected ErrInvalidOption, got %v", name, err)
+		}
+	}
+}
+
+// xorKeyProvider wraps random data keys by XOR with a master key, like a KMS would encrypt them
+type xorKeyProvider struct {
+	master   []byte
+	ctx      context.Context
+	dataKeys int
+	fail     error
+}
+
+func (p *xorKeyProvider) xor(key []byte) []byte {
+	out := make([]byte, len(key))
+	for i := range key {
+		out[i] = key[i] ^ p.master[i]
+	}
+	return out
+}
+
+func (p *xorKeyProvider) DataKey(ctx context.Context) ([]byte, []byte, error) {
+	p.ctx = ctx
+	p.dataKeys++
+	key := make([]byte, len(p.master))
+	rand.Read(key)
+	return key, p.xor(key), nil
+}
+
+func (p *xorKeyProvider) Unwrap(ctx context.Context, wrapped []byte) ([]byte, error) {
+	p.ctx = ctx
+	if p.fail != nil {
+		return nil, p.fail
+	}
+	return p.xor(wrapped), nil
+}
+
+func TestWithKeyProvider(t *testing.T) {
+	type ctxKey struct{}
+	ctx := context.WithValue(context.Background(), ctxKey{}, "request")
+	provider := &xorKeyProvider{master: bytes.Repeat([]byte{0x5a}, 32)}
+	backend := &mockStorageBackend{}
+	buf := New(WithThreshold(16), WithKeyProvider(provider), WithContext(ctx), WithStorage(func() storage.Backend { return backend }))
+	defer buf.Close()
+
+	data := bytes.Repeat([]byte("envelope encrypted "), 5000)
+	buf.Write(data)
+	if got := buf.Bytes(); !bytes.Equal(got, data) {
+		t.Fatal("Round trip failed")
+	}
+	if provider.ctx != ctx {
+		t.Fatal("Provider did not receive the buffer's context")
+	}
+
+	// The wrapped key is stored in the header, the data key is not
+	if binary.BigEndian.Uint16(backend.data) != 32 {
+		t.Fatalf("Expected a 32 byte wrapped key, got %d", binary.BigEndian.Uint16(backend.data))
+	}
+	if bytes.Contains(backend.data, []byte("envelope encrypted")) {
+		t.Fatal("Stored data contains plaintext")
+	}
+
+	// Every spill gets a fresh data key
+	buf.Reset()
+	buf.Write(data)
+	buf.Bytes()
+	if provider.dataKeys != 2 {
+		t.Fatalf("Expected 2 data keys, got %d", provider.dataKeys)
+	}
+
+	provider.fail = errors.New("kms unavailable")
+	reader, _ := buf.NewReader()
+	defer reader.Close()
+	if _, err := io.ReadAll(reader); !errors.Is(err, provider.fail) {
+		t.Fatalf("Expected the unwrap error, got %v", err)
+	}
+}
+
+func TestStaticKeyProvider(t *testing.T) {
+	backend := &mockStorageBackend{}
+	buf := New(WithThreshold(16), WithKeyProvider(StaticKeyProvider(make([]byte, 16))), WithStorage(func() storage.Backend { return backend }))
+	defer buf.Close()
+
+	data := bytes.Repeat([]byte("static key "), 1000)
+	buf.Write(data)
+	if got := buf.Bytes(); !bytes.Equal(got, data) {
+		t.Fatal("Round trip failed")
+	}
+
+	if _, err := NewWithError(WithKeyProvider(nil)); !errors.Is(err, ErrInvalidOption) {
+		t.Fatalf("Expected ErrInvalidOption, got %v", err)
+	}
+}
+
+func TestWithDeterministicNonce(t *testing.T) {
+	key := make([]byte, 32)
+	data := bytes.Repeat([]byte("identical plaintext "), 10000) // Several chunks
+
+	spill := func(data []byte, opts ...Option) []byte {
+		t.Helper()
+		backend := &mockStorageBackend{}
+		opts = append(opts, WithThreshold(16), WithEncryptionKey(key), WithStorage(func() storage.Backend { return backend }))
+		buf := New(opts...)
+		defer buf.Close()
+
+		buf.Write(data)
+		if got := buf.Bytes(); !bytes.Equal(got, data) {
+			t.Fatal("Round trip failed")
+		}
+		return slices.Clone(backend.data)
+	}
+
+	first := spill(data, WithDeterministicNonce())
+	second := spill(data, WithDeterministicNonce())
+	if !bytes.Equal(first, second) {
+		t.Fatal("Expected identical ciphertext for identical plaintext")
+	}
+	if bytes.Contains(first, []byte("identical plaintext")) {
+		t.Fatal("Stored data contains plaintext")
+	}
+
+	other := spill(append(slices.Clone(data), '!'), WithDeterministicNonce())
+	if !bytes.Equal(first[:len(first)/2], other[:len(first)/2]) {
+		t.Fatal("Expected identical leading chunks for a common prefix")
+	}
+	if bytes.Equal(first, other) {
+		t.Fatal("Expected different ciphertext for different plaintext")
+	}
+
+	if bytes.Equal(spill(data), spill(data)) {
+		t.Fatal("Expected random nonces without WithDeterministicNonce")
+	}
+}
+
+func TestWithDeterministicNonce_DetectsTampering(t *testing.T) {
+	backend := &mockStorageBackend{}
+	buf := New(
+		WithThreshold(16),
+		WithEncryptionKey(make([]byte, 16)),
+		WithDeterministicNonce(),
+		WithStorage(func() storage.Backend { return backend }),
+	)
+	defer buf.Close()
+
+	buf.Write(bytes.Repeat([]byte("x"), 3*aesgcmChunkSize))
+	reader, _ := buf.NewReader()
+	io.ReadAll(reader)
+	reader.Close()
+
+	// Identical chunks have identical ciphertext apart from their position, so
+	// dropping one must still be detected
+	chunk := 4 + 12 + aesgcmChunkSize + 16
+	intact := slices.Clone(backend.data)
+	backend.data = append(slices.Clone(intact[:chunk]), intact[2*chunk:]...)
+
+	reader, _ = buf.NewReader()
+	defer reader.Close()
+	if _, err := io.ReadAll(reader); err == nil {
+		t.Fatal("Expected an error reading a stream with a dropped chunk")
+	}
+}
+
+func TestWithEncryptionKey_InvalidKey(t *testing.T) {
+	if _, err := NewWithError(WithEncryptionKey([]byte("short"))); !errors.Is(err, ErrInvalidOption) {
+		t.Fatalf("Expected ErrInvalidOption, got %v", err)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Fatal("Expected panic for invalid key length")
+		}
+	}()
+	New(WithEncryptionKey([]byte("short")))
+}
+
+func TestNewWithError(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []Option
+	}{
+		{"nil storage provider", []Option{WithStorage(nil)}},
+		{"zero threshold", []Option{WithThreshold(0)}},
+		{"negative max size", []Option{WithMaxSize(-1)}},
+		{"max size below threshold", []Option{WithThreshold(1024), WithMaxSize(100)}},
+		{"negative pre-allocation", []Option{WithPreAlloc(-1)}},
+		{"negative read-ahead", []Option{WithReadAhead(-1)}},
+		{"invalid gzip level", []Option{WithGzip(42)}},
+		{"nil hash", []Option{WithHash(nil)}},
+		{"nil memory limiter", []Option{WithMemoryLimiter(nil)}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf, err := NewWithError(tt.opts...)
+			if !errors.Is(err, ErrInvalidOption) {
+				t.Fatalf("Expected ErrInvalidOption, got %v", err)
+			}
+			if buf != nil {
+				t.Fatal("Expected no buffer for invalid options")
+			}
+
+			// New falls back to the defaults instead
+			buf = New(tt.opts...)
+			defer buf.Close()
+			buf.WriteString("still works")
+			if got := buf.String(); got != "still works" {
+				t.Fatalf("Expected %q, got %q", "still works", got)
+			}
+		})
+	}
+}
+
+func TestNewWithError_Valid(t *testing.T) {
+	buf, err := NewWithError(WithThreshold(64), WithMaxSize(1024), WithEncryptionKey(make([]byte, 32)))
+	if err != nil {
+		t.Fatalf("NewWithError failed: %v", err)
+	}
+	defer buf.Close()
+
+	data := strings.Repeat("x", 512)
+	buf.WriteString(data)
+	if got := buf.String(); got != data {
+		t.Fatal("Data mismatch")
+	}
+}
+
+func TestNewWithError_JoinsErrors(t *testing.T) {
+	_, err := NewWithError(WithStorage(nil), WithThreshold(-1))
+	if err == nil || !strings.Contains(err.Error(), "storage provider") || !strings.Contains(err.Error(), "threshold") {
+		t.Fatalf("Expected both problems to be reported, got %v", err)
+	}
+}
+
+// namedMiddleware is a pass-through middleware with a configurable name and stage
+type namedMiddleware struct {
+	name  string
+	stage Stage
+}
+
+func (n namedMiddleware) Name() string                 { return n.name }
+func (n namedMiddleware) Stage() Stage                 { return n.stage }
+func (n namedMiddleware) Writer(w io.Writer) io.Writer { return w }
+func (n namedMiddleware) Reader(r io.Reader) io.Reader { return r }
+
+// tagMiddleware prefixes every write with its tag, to observe the write order
+type tagMiddleware string
+
+func (m tagMiddleware) Writer(w io.Writer) io.Writer {
+	return writerFunc(func(p []byte) (int, error) {
+		if _, err := w.Write(append([]byte(m), p...)); err != nil {
+			return 0, err
+		}
+		return len(p), nil
+	})
+}
+
+func (m tagMiddleware) Reader(r io.Reader) io.Reader { return r }
+
+type writerFunc func(p []byte) (int, error)
+
+func (f writerFunc) Write(p []byte) (int, error) { return f(p) }
+
+func TestWithMiddleware_WriteOrder(t *testing.T) {
+	backend := &mockStorageBackend{}
+	buf := New(
+		WithThreshold(4),
+		WithStorage(func() storage.Backend { return backend }),
+		WithMiddleware(tagMiddleware("first:"), tagMiddleware("second:")),
+	)
+	defer buf.Close()
+
+	buf.WriteString("hello")
+
+	// The first middleware sees the data first, the last one writes to storage
+	if got, want := string(backend.data), "second:first:hello"; got != want {
+		t.Fatalf("Expected stored %q, got %q", want, got)
+	}
+}
+
+func TestHybridBuffer_Middlewares(t *testing.T) {
+	buf := New(
+		WithEncryptionKey(make([]byte, 32)),
+		WithMiddleware(namedMiddleware{name: "first"}, xorMiddleware{}),
+		WithGzip(1),
+	)
+	defer buf.Close()
+
+	got := buf.Middlewares()
+	want := []string{"first", "hybridbuffer.xorMiddleware", "gzip", "aes-gcm"}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("Expected %v, got %v", want, got)
+	}
+}
+
+func TestWithPipeline_OrdersStages(t *testing.T) {
+	buf := New(WithPipeline(
+		namedMiddleware{name: "encode", stage: StageEncoding},
+		namedMiddleware{name: "encrypt", stage: StageEncryption},
+		namedMiddleware{name: "pad", stage: StagePadding},
+		namedMiddleware{name: "compress", stage: StageCompression},
+		namedMiddleware{name: "transform-a"},
+		namedMiddleware{name: "transform-b"},
+	))
+	defer buf.Close()
+
+	got := buf.Middlewares()
+	want := []string{"transform-a", "transform-b", "compress", "pad", "encrypt", "encode"}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("Expected %v, got %v", want, got)
+	}
+}
+
+func TestWithPipeline_BuiltinsJoinStages(t *testing.T) {
+	buf := New(
+		WithGzip(1),
+		WithEncryptionKey(make([]byte, 16)),
+		WithPipeline(
+			namedMiddleware{name: "encode", stage: StageEncoding},
+			namedMiddleware{name: "pad", stage: StagePadding},
+			namedMiddleware{name: "compress", stage: StageCompression},
+		),
+		WithMiddleware(namedMiddleware{name: "after"}),
+	)
+	defer buf.Close()
+
+	// Padding sees compressed data and the encoding sees ciphertext
+	got := buf.Middlewares()
+	want := []string{"compress", "gzip", "pad", "aes-gcm", "encode", "after"}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("Expected %v, got %v", want, got)
+	}
+
+	// Added middlewares go last, like WithMiddleware
+	if err := buf.AddMiddleware(namedMiddleware{name: "added"}); err != nil {
+		t.Fatalf("AddMiddleware failed: %v", err)
+	}
+	got = buf.Middlewares()
+	want = append(want, "added")
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("Expected %v, got %v", want, got)
+	}
+}
+
+// base64Middleware stores data as base64 text, declaring its stage as an int
+// like the middleware modules
+type base64Middleware struct{}
+
+func (base64Middleware) Stage() int { return int(StageEncoding) }
+
+func (base64Middleware) Writer(w io.Writer) io.Writer {
+	return &base64Writer{WriteCloser: base64.NewEncoder(base64.StdEncoding, w), underlying: w}
+}
+
+func (base64Middleware) Reader(r io.Reader) io.Reader {
+	return base64.NewDecoder(base64.StdEncoding, r)
+}
+
+type base64Writer struct {
+	io.WriteCloser
+	underlying io.Writer
+}
+
+func (w *base64Writer) Close() error {
+	err := w.WriteCloser.Close()
+	if closer, ok := w.underlying.(io.Closer); ok {
+		err = errors.Join(err, closer.Close())
+	}
+	return err
+}
+
+func TestWithPipeline_EncodingIsOutermost(t *testing.T) {
+	backend := &mockStorageBackend{}
+	buf := New(
+		WithThreshold(16),
+		WithGzip(9),
+		WithEncryptionKey(make([]byte, 16)),
+		WithPipeline(base64Middleware{}),
+		WithStorage(func() storage.Backend { return backend }),
+	)
+	defer buf.Close()
+
+	got := buf.Middlewares()
+	want := []string{"gzip", "aes-gcm", "hybridbuffer.base64Middleware"}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("Expected %v, got %v", want, got)
+	}
+
+	data := strings.Repeat("stored as text ", 100)
+	buf.WriteString(data)
+	if got := buf.String(); got != data {
+		t.Fatal("Data mismatch after round trip")
+	}
+	for _, c := range backend.data {
+		if c < 0x20 || c > 0x7e {
+			t.Fatalf("Expected ASCII storage, found byte %#x", c)
+		}
+	}
+}
+
+func TestAtStage(t *testing.T) {
+	buf := New(WithPipeline(
+		AtStage(StageEncryption, namedMiddleware{name: "encrypt"}),
+		namedMiddleware{name: "transform"},
+		AtStage(StageCompression, xorMiddleware{}),
+	))
+	defer buf.Close()
+
+	got := buf.Middlewares()
+	want := []string{"transform", "hybridbuffer.xorMiddleware", "encrypt"}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("Expected %v, got %v", want, got)
+	}
+}
+
+func TestWithPipeline_RoundTrip(t *testing.T) {
+	backend := &mockStorageBackend{}
+	aead, _ := newAESGCMMiddleware(make([]byte, 16))
+	buf := New(
+		WithThreshold(64),
+		WithPipeline(aead, gzipMiddleware{level: 9}),
+		WithStorage(func() storage.Backend { return backend }),
+	)
+	defer buf.Close()
+
+	data := strings.Repeat("pipeline ", 1000)
+	buf.WriteString(data)
+	if got := buf.String(); got != data {
+		t.Fatal("Data mismatch after round trip")
+	}
+	if len(backend.data) >= len(data)/10 {
+		t.Fatalf("Expected compression before encryption, stored %d bytes", len(backend.data))
+	}
+}
+
+func TestHybridBuffer_AddMiddleware(t *testing.T) {
+	buf := New(WithMiddleware(namedMiddleware{name: "first"}), WithGzip(1))
+	defer buf.Close()
+
+	if err := buf.AddMiddleware(xorMiddleware{}); err != nil {
+		t.Fatalf("AddMiddleware before writing failed: %v", err)
+	}
+	got := buf.Middlewares()
+	want := []string{"first", "hybridbuffer.xorMiddleware", "gzip"}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("Expected %v, got %v", want, got)
+	}
+
+	backend := &mockStorageBackend{}
+	spilling := New(WithThreshold(16), WithStorage(func() storage.Backend { return backend }))
+	defer spilling.Close()
+
+	if err := spilling.AddMiddleware(xorMiddleware{}); err != nil {
+		t.Fatalf("AddMiddleware before writing failed: %v", err)
+	}
+	data := strings.Repeat("added ", 100)
+	spilling.WriteString(data)
+	if bytes.Contains(backend.data, []byte("added")) {
+		t.Fatal("Expected the added middleware to transform stored data")
+	}
+	if got := spilling.String(); got != data {
+		t.Fatal("Data mismatch after round trip")
+	}
+}
+
+func TestHybridBuffer_AddMiddlewareAfterWrite(t *testing.T) {
+	buf := New()
+	defer buf.Close()
+
+	buf.WriteString("data")
+	if err := buf.AddMiddleware(xorMiddleware{}); !errors.Is(err, ErrBufferDirty) {
+		t.Fatalf("Expected ErrBufferDirty, got %v", err)
+	}
+	if got := buf.Middlewares(); len(got) != 0 {
+		t.Fatalf("Expected the pipeline to stay unchanged, got %v", got)
+	}
+
+	buf.Reset()
+	if err := buf.AddMiddleware(xorMiddleware{}); err != nil {
+		t.Fatalf("AddMiddleware after Reset failed: %v", err)
+	}
+}
+
+// preallocBackend records Preallocate calls
+type preallocBackend struct {
+	mockStorageBackend
+	preallocated []int64
+}
+
+func (p *preallocBackend) Preallocate(size int64) error {
+	p.preallocated = append(p.preallocated, size)
+	return nil
+}
+
+func TestWithThresholdFunc(t *testing.T) {
+	backend := &mockStorageBackend{}
+	threshold := 100
+	calls := 0
+	buf := New(
+		WithThreshold(1000),
+		WithThresholdFunc(func() int {
+			calls++
+			threshold -= 30 // Growing memory pressure
+			return threshold
+		}),
+		WithStorage(func() storage.Backend { return backend }),
+	)
+	defer buf.Close()
+
+	// 10 bytes fit within 70, 20 bytes within 40
+	buf.Write(make([]byte, 10))
+	buf.WriteString(strings.Repeat("x", 10))
+	if backend.createCalled {
+		t.Fatal("Expected the writes to stay in memory")
+	}
+
+	// 30 bytes exceed 10, far below the static threshold
+	buf.Write(make([]byte, 10))
+	if !backend.createCalled {
+		t.Fatal("Expected the shrinking threshold to spill")
+	}
+	if calls != 3 {
+		t.Fatalf("Expected the function to be consulted on each write, got %d calls", calls)
+	}
+
+	// Once spilled the function is no longer needed
+	buf.Write(make([]byte, 10))
+	if calls != 3 {
+		t.Fatalf("Expected no calls in storage mode, got %d", calls)
+	}
+	if buf.Len() != 40 {
+		t.Fatalf("Expected 40 bytes, got %d", buf.Len())
+	}
+}
+
+func TestHybridBuffer_GrowSpillsEarly(t *testing.T) {
+	backend := &preallocBackend{}
+	spills := 0
+	buf := New(
+		WithThreshold(100),
+		WithStorage(func() storage.Backend { return backend }),
+		WithOnSpill(func(int) { spills++ }),
+	)
+	defer buf.Close()
+
+	buf.WriteString("0123456789")
+
+	// Within the threshold only memory grows
+	buf.Grow(50)
+	if spills != 0 || backend.createCalled {
+		t.Fatal("Grow within the threshold should not spill")
+	}
+
+	// Exceeding the threshold spills right away and preallocates the expected size
+	buf.Grow(1000)
+	if spills != 1 {
+		t.Fatalf("Expected Grow to spill, got %d spills", spills)
+	}
+	if fmt.Sprint(backend.preallocated) != "[1010]" {
+		t.Fatalf("Expected preallocation of 1010 bytes, got %v", backend.preallocated)
+	}
+
+	// In storage mode Grow still preallocates
+	buf.WriteString("abc")
+	buf.Grow(500)
+	if fmt.Sprint(backend.preallocated) != "[1010 513]" {
+		t.Fatalf("Expected second preallocation of 513 bytes, got %v", backend.preallocated)
+	}
+
+	if got := buf.String(); got != "0123456789abc" {
+		t.Fatalf("Expected data to be preserved, got %q", got)
+	}
+}
+
+func TestHybridBuffer_GrowWithoutPreallocator(t *testing.T) {
+	backend := &mockStorageBackend{}
+	buf := New(WithThreshold(10), WithStorage(func() storage.Backend { return backend }))
+	defer buf.Close()
+
+	buf.WriteString("abc")
+	buf.Grow(100)
+	if !backend.createCalled {
+		t.Fatal("Expected Grow beyond the threshold to spill")
+	}
+	buf.WriteString("def")
+	if got := buf.String(); got != "abcdef" {
+		t.Fatalf("Expected %q, got %q", "abcdef", got)
+	}
+}
+
+func TestHybridBuffer_Cap(t *testing.T) {
+	buf := New(WithThreshold(1024), WithPreAlloc(512))
+	defer buf.Close()
+
+	// Pre-allocated capacity is reported in memory mode
+	if buf.Cap() < 512 {
+		t.Fatalf("Expected Cap >= 512, got %d", buf.Cap())
+	}
+
+	buf.WriteString("hello")
+	if buf.Cap()-buf.Len() <= 0 {
+		t.Fatalf("Expected headroom in memory mode, got Cap=%d Len=%d", buf.Cap(), buf.Len())
+	}
+
+	// Storage mode reports Len
+	buf.Write(make([]byte, 2048))
+	if buf.Cap() != buf.Len() {
+		t.Fatalf("Expected Cap == Len in storage mode, got Cap=%d Len=%d", buf.Cap(), buf.Len())
+	}
+}
+
+func TestHybridBuffer_BytesNoCopy(t *testing.T) {
+	buf := New(WithThreshold(64))
+	defer buf.Close()
+
+	buf.WriteString("hello world")
+	buf.Next(6)
+
+	got := buf.BytesNoCopy()
+	if string(got) != "world" {
+		t.Fatalf("Expected %q, got %q", "world", got)
+	}
+	if buf.Len() != 0 {
+		t.Fatalf("Expected BytesNoCopy to consume the data, Len=%d", buf.Len())
+	}
+	if buf.BytesNoCopy() != nil {
+		t.Fatal("Expected nil for an empty buffer")
+	}
+
+	// Appending to the view must not overwrite buffered data
+	buf.WriteString("abc")
+	view := buf.BytesNoCopy()
+	_ = append(view, 'X')
+	buf.WriteString("def")
+	if got := buf.String(); got != "def" {
+		t.Fatalf("Expected %q, got %q", "def", got)
+	}
+
+	// Storage mode falls back to copying
+	data := strings.Repeat("s", 100)
+	buf.WriteString(data)
+	if got := buf.BytesNoCopy(); string(got) != data {
+		t.Fatalf("Expected storage data, got %q", got)
+	}
+}
+
+func TestHybridBuffer_WriteStringPaths(t *testing.T) {
+	buf := New(WithThreshold(8), WithStorage(func() storage.Backend { return &mockStorageBackend{} }))
+	defer buf.Close()
+
+	buf.WriteString("mem")    // Memory
+	buf.WriteString("spill!") // Spills
+	buf.WriteString("stored") // Storage
+	buf.ReadByte()            // Finalizes the write stream
+	buf.WriteString("reopen") // Reopens storage
+
+	if got := buf.String(); got != "emspill!storedreopen" {
+		t.Fatalf("Unexpected contents %q", got)
+	}
+
+	limited := New(WithMaxSize(4))
+	defer limited.Close()
+	if n, err := limited.WriteString("toolong"); n != 4 || !errors.Is(err, ErrMaxSizeExceeded) {
+		t.Fatalf("Expected 4 bytes and ErrMaxSizeExceeded, got %d, %v", n, err)
+	}
+
+	limited.Close()
+	if _, err := limited.WriteString("x"); !errors.Is(err, ErrClosed) {
+		t.Fatalf("Expected ErrClosed, got %v", err)
+	}
+}
+
+func TestHybridBuffer_ReadRuneInvalidUTF8(t *testing.T) {
+	inputs := [][]byte{
+		{0xC0},                                   // Lone invalid byte
+		{0xE2, 0x28, 0xA1},                       // Invalid continuation
+		{'a', 0xE2, 0x82},                        // Incomplete rune at EOF
+		{0xF0, 0x9F, 0x98, 'x', 'y'},             // Truncated 4-byte rune
+		{0xFF, 0xFE, 'o', 'k', 0xE2, 0x82, 0xAC}, // Mixed with a valid euro sign
+	}
+
+	for _, threshold := range []int{1024, 1} {
+		for _, input := range inputs {
+			std := bytes.NewBuffer(input)
+			buf := NewFromBytes(input, WithThreshold(threshold))
+
+			for {
+				wantR, wantSize, wantErr := std.ReadRune()
+				gotR, gotSize, gotErr := buf.ReadRune()
+				if gotR != wantR || gotSize != wantSize || gotErr != wantErr {
+					t.Fatalf("Threshold %d, input %x: expected (%q, %d, %v), got (%q, %d, %v)",
+						threshold, input, wantR, wantSize, wantErr, gotR, gotSize, gotErr)
+				}
+				if wantErr != nil {
+					break
+				}
+			}
+			buf.Close()
+		}
+	}
+}
+
+func TestHybridBuffer_ReadRuneStorageKeepsStream(t *testing.T) {
+	data := bytes.Repeat([]byte{0xF0, 0x9F, 'x', 0xE2, 0x82, 0xAC, 0xFF}, 1000)
+	readers := &atomic.Int32{}
+	buf := NewFromBytes(data, WithThreshold(16), WithMiddleware(countingMiddleware{readers}))
+	defer buf.Close()
+
+	std := bytes.NewBuffer(data)
+	for {
+		wantR, wantSize, wantErr := std.ReadRune()
+		gotR, gotSize, gotErr := buf.ReadRune()
+		if gotR != wantR || gotSize != wantSize || gotErr != wantErr {
+			t.Fatalf("Expected (%q, %d, %v), got (%q, %d, %v)", wantR, wantSize, wantErr, gotR, gotSize, gotErr)
+		}
+		if wantErr != nil {
+			break
+		}
+	}
+
+	// Invalid sequences push their tail back instead of reopening the stream
+	if n := readers.Load(); n != 1 {
+		t.Fatalf("Expected a single read stream, got %d", n)
+	}
+}
+
+func TestHybridBuffer_WithHash(t *testing.T) {
+	data := bytes.Repeat([]byte("hash me "), 1000)
+	want := sha256.Sum256(data)
+
+	for _, threshold := range []int{1 << 20, 64} {
+		buf := New(WithThreshold(threshold), WithHash(sha256.New), WithGzip(1))
+
+		buf.Write(data[:100])
+		buf.WriteString(string(data[100:3000]))
+		buf.ReadFrom(bytes.NewReader(data[3000:]))
+
+		// Reading does not affect the digest
+		buf.Next(10)
+		if got := buf.Sum(); !bytes.Equal(got, want[:]) {
+			t.Fatalf("Threshold %d: expected %x, got %x", threshold, want, got)
+		}
+		if got := buf.Sum(); !bytes.Equal(got, want[:]) {
+			t.Fatal("Sum must not change the hash state")
+		}
+
+		// Reset starts over
+		buf.Reset()
+		buf.WriteString("new")
+		if got, want := buf.Sum(), sha256Of("new"); !bytes.Equal(got, want) {
+			t.Fatalf("Expected digest of new data after Reset, got %x", got)
+		}
+		buf.Close()
+	}
+
+	// MD5 for ETag comparisons
+	buf := New(WithHash(md5.New))
+	defer buf.Close()
+	buf.Write(data)
+	if got, want := buf.Sum(), md5.Sum(data); !bytes.Equal(got, want[:]) {
+		t.Fatalf("Expected MD5 %x, got %x", want, got)
+	}
+
+	plain := New()
+	defer plain.Close()
+	if plain.Sum() != nil {
+		t.Fatal("Expected nil Sum without WithHash")
+	}
+}
+
+func sha256Of(s string) []byte {
+	sum := sha256.Sum256([]byte(s))
+	return sum[:]
+}
+
+func TestHybridBuffer_WriteStrings(t *testing.T) {
+	buf := New(WithThreshold(8))
+	defer buf.Close()
+
+	n, err := buf.WriteStrings("GET ", "/index.html", " HTTP/1.1")
+	if err != nil || n != 24 {
+		t.Fatalf("Expected 24 bytes, got %d, %v", n, err)
+	}
+	if got := buf.String(); got != "GET /index.html HTTP/1.1" {
+		t.Fatalf("Unexpected contents %q", got)
+	}
+
+	limited := New(WithMaxSize(6))
+	defer limited.Close()
+	n, err = limited.WriteStrings("abc", "def", "ghi")
+	if n != 6 || !errors.Is(err, ErrMaxSizeExceeded) {
+		t.Fatalf("Expected 6 bytes and ErrMaxSizeExceeded, got %d, %v", n, err)
+	}
+}
+
+func TestHybridBuffer_Append(t *testing.T) {
+	buf := New(WithThreshold(8))
+	defer buf.Close()
+
+	// Spills while chaining
+	got := buf.AppendString("hello").Append([]byte(", ")).AppendString("world").String()
+	if got != "hello, world" {
+		t.Fatalf("Expected %q, got %q", "hello, world", got)
+	}
+
+	defer func() {
+		r := recover()
+		err, ok := r.(error)
+		if !ok || !errors.Is(err, ErrClosed) {
+			t.Fatalf("Expected panic with ErrClosed, got %v", r)
+		}
+	}()
+	buf.Close()
+	buf.AppendString("boom")
+}
+
+func TestHybridBuffer_WithLogger(t *testing.T) {
+	var events []string
+	var spillFields map[string]any
+
+	var buf Buffer
+	buf = New(
+		WithThreshold(8),
+		WithStorage(func() storage.Backend { return &closeErrorBackend{removeErr: errors.New("remove failed")} }),
+		WithLogger(func(event string, fields map[string]any) {
+			events = append(events, event)
+			if event == "spill" {
+				spillFields = fields
+			}
+			_ = buf.Len() // Runs outside the lock
+		}),
+	)
+
+	buf.WriteString("12345")
+	if len(events) != 0 {
+		t.Fatalf("Expected no events in memory mode, got %v", events)
+	}
+
+	buf.WriteString("6789")
+	_ = buf.String()
+	buf.Close()
+
+	want := []string{"storage_created", "spill", "read_stream_opened", "close_error"}
+	if fmt.Sprint(events) != fmt.Sprint(want) {
+		t.Fatalf("Expected events %v, got %v", want, events)
+	}
+	if spillFields["size"] != 5 || spillFields["threshold"] != 8 {
+		t.Fatalf("Unexpected spill fields %v", spillFields)
+	}
+}
+
+func TestWithID(t *testing.T) {
+	var events []string
+	var ids []any
+	buf := New(
+		WithThreshold(4),
+		WithID("request-42"),
+		WithLogger(func(event string, fields map[string]any) {
+			events = append(events, event)
+			ids = append(ids, fields["id"])
+		}),
+	)
+	defer buf.Close()
+
+	if buf.Name() != "request-42" {
+		t.Fatalf("Expected name request-42, got %q", buf.Name())
+	}
+
+	buf.WriteString("spill to storage")
+	_ = buf.String()
+	if len(events) == 0 {
+		t.Fatal("Expected logged events")
+	}
+	for i, id := range ids {
+		if id != "request-42" {
+			t.Fatalf("Expected id request-42 on event %s, got %v", events[i], id)
+		}
+	}
+
+	if name := New().Name(); name != "" {
+		t.Fatalf("Expected no name by default, got %q", name)
+	}
+}
+
+// leakBackend reports Remove calls, which may come from the finalizer goroutine
+type leakBackend struct {
+	mockStorageBackend
+	removed *atomic.Bool
+}
+
+func (l *leakBackend) Remove() error {
+	l.removed.Store(true)
+	return nil
+}
+
+func TestHybridBuffer_FinalizerRemovesLeakedStorage(t *testing.T) {
+	removed := &atomic.Bool{}
+
+	func() {
+		buf := New(WithThreshold(4), WithStorage(func() storage.Backend {
+			return &leakBackend{removed: removed}
+		}))
+		buf.WriteString("spilled and leaked")
+		// No Close
+	}()
+
+	for i := 0; i < 20 && !removed.Load(); i++ {
+		runtime.GC()
+		time.Sleep(10 * time.Millisecond)
+	}
+	if !removed.Load() {
+		t.Fatal("Expected the finalizer to remove the storage of a leaked buffer")
+	}
+}
+
+func TestHybridBuffer_CloseClearsFinalizer(t *testing.T) {
+	removes := &atomic.Int32{}
+	backend := &countingRemoveBackend{removes: removes}
+
+	func() {
+		buf := New(WithThreshold(4), WithStorage(func() storage.Backend { return backend }))
+		buf.WriteString("spilled data")
+		buf.Close()
+	}()
+
+	for i := 0; i < 5; i++ {
+		runtime.GC()
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := removes.Load(); n != 1 {
+		t.Fatalf("Expected exactly one Remove, got %d", n)
+	}
+}
+
+// countingRemoveBackend counts Remove calls
+type countingRemoveBackend struct {
+	mockStorageBackend
+	removes *atomic.Int32
+}
+
+func (c *countingRemoveBackend) Remove() error {
+	c.removes.Add(1)
+	return nil
+}
+
+func TestMemoryLimiter_ManyBuffers(t *testing.T) {
+	limiter := NewMemoryLimiter(1000)
+	newBuf := func() Buffer {
+		return New(
+			WithThreshold(500),
+			WithMemoryLimiter(limiter),
+			WithStorage(func() storage.Backend { return &mockStorageBackend{} }),
+		)
+	}
+
+	data := bytes.Repeat([]byte("m"), 200)
+	var buffers []Buffer
+	spilled := 0
+	for i := 0; i < 20; i++ {
+		buf := newBuf()
+		buf.Write(data)
+		buf.Write(data)
+		if buf.Available() == 0 {
+			spilled++
+		}
+		if used := limiter.Used(); used > limiter.Limit() {
+			t.Fatalf("Global memory %d exceeds limit %d", used, limiter.Limit())
+		}
+		buffers = append(buffers, buf)
+	}
+
+	// Individually every buffer stays below its threshold, together they spill
+	if spilled == 0 || spilled == len(buffers) {
+		t.Fatalf("Expected some but not all buffers to spill, got %d of %d", spilled, len(buffers))
+	}
+
+	for _, buf := range buffers {
+		if got := buf.String(); got != string(data)+string(data) {
+			t.Fatal("Data mismatch")
+		}
+		buf.Close()
+	}
+	if used := limiter.Used(); used != 0 {
+		t.Fatalf("Expected all memory to be released, got %d", used)
+	}
+}
+
+func TestMemoryLimiter_ReleasesOnResetAndSpill(t *testing.T) {
+	limiter := NewMemoryLimiter(0) // Unlimited, only counting
+	buf := New(WithThreshold(100), WithMemoryLimiter(limiter), WithStorage(func() storage.Backend { return &mockStorageBackend{} }))
+	defer buf.Close()
+
+	buf.WriteString("hello")
+	if used := limiter.Used(); used != 5 {
+		t.Fatalf("Expected 5 bytes in use, got %d", used)
+	}
+
+	buf.Reset()
+	if used := limiter.Used(); used != 0 {
+		t.Fatalf("Expected Reset to release memory, got %d", used)
+	}
+
+	buf.Write(make([]byte, 150))
+	if used := limiter.Used(); used != 0 {
+		t.Fatalf("Expected spilled data not to count, got %d", used)
+	}
+}
+
+func TestSetGlobalMemoryLimit(t *testing.T) {
+	SetGlobalMemoryLimit(100)
+	defer SetGlobalMemoryLimit(0)
+
+	base := GlobalMemoryLimiter().Used()
+	buf := New(WithThreshold(1<<20), WithStorage(func() storage.Backend { return &mockStorageBackend{} }))
+	defer buf.Close()
+
+	buf.Write(make([]byte, 50))
+	if buf.Available() == 0 && base == 0 {
+		t.Fatal("Expected buffer to stay in memory within the global limit")
+	}
+	buf.Write(make([]byte, 100))
+	if buf.Available() != 0 {
+		t.Fatal("Expected buffer to spill once the global limit is exceeded")
+	}
+}
+
+func TestMemoryLimiter_NoneSkipsTracking(t *testing.T) {
+	base := GlobalMemoryLimiter().Used()
+	buf := New(WithThreshold(1024))
+	defer buf.Close()
+
+	buf.WriteString("hello world")
+	if used := GlobalMemoryLimiter().Used(); used != base {
+		t.Fatalf("Expected no accounting without a limit, used changed from %d to %d", base, used)
+	}
+	if buf.(*hybridBuffer).leakGuard != nil {
+		t.Fatal("Expected no leak guard for an in-memory buffer without a limiter")
+	}
+
+	// Setting a global limit registers the memory on the next operation
+	SetGlobalMemoryLimit(1 << 20)
+	buf.WriteString("!")
+	SetGlobalMemoryLimit(0)
+	if used := GlobalMemoryLimiter().Used(); used != base+12 {
+		t.Fatalf("Expected %d bytes registered, got %d", base+12, used)
+	}
+
+	// Registered memory is released even after the limit was removed
+	buf.Reset()
+	if used := GlobalMemoryLimiter().Used(); used != base {
+		t.Fatalf("Expected memory to be released, used %d, want %d", used, base)
+	}
+}
+
+func TestHybridBuffer_ResetKeep(t *testing.T) {
+	buf := New(WithThreshold(64), WithPreAlloc(32), WithStorage(func() storage.Backend { return &mockStorageBackend{} }))
+	defer buf.Close()
+
+	buf.WriteString("secret")
+	view := buf.BytesNoCopy()
+	buf.WriteString("more")
+	capBefore := buf.Cap()
+
+	buf.ResetKeep()
+	if buf.Len() != 0 || buf.Size() != 0 {
+		t.Fatalf("Expected empty buffer, got Len=%d Size=%d", buf.Len(), buf.Size())
+	}
+	if buf.Cap() != capBefore {
+		t.Fatalf("Expected capacity %d to be kept, got %d", capBefore, buf.Cap())
+	}
+	if !bytes.Equal(view, make([]byte, len(view))) {
+		t.Fatalf("Expected old data to be zeroed, got %q", view)
+	}
+
+	// Spilled buffers lose their storage but keep working
+	buf.Write(make([]byte, 100))
+	buf.ResetKeep()
+	buf.WriteString("reused")
+	if got := buf.String(); got != "reused" {
+		t.Fatalf("Expected %q, got %q", "reused", got)
+	}
+	if buf.Cap() < 32 {
+		t.Fatalf("Expected at least the pre-allocated capacity, got %d", buf.Cap())
+	}
+}
+
+func TestWithZeroOnReset(t *testing.T) {
+	backend := &mockStorageBackend{}
+	buf := New(WithThreshold(64), WithPreAlloc(64), WithZeroOnReset(), WithStorage(func() storage.Backend { return backend }))
+	defer buf.Close()
+
+	buf.WriteString("password=hunter2")
+	view := buf.BytesNoCopy()
+	buf.WriteString("token=abc")
+	buf.Reset()
+	if !bytes.Equal(view[:cap(view)], make([]byte, cap(view))) {
+		t.Fatalf("Expected the backing array to be zeroed, got %q", view[:cap(view)])
+	}
+
+	// Spilled data leaves stale memory behind, and storage is removed
+	buf.WriteString("api-key=secret")
+	view = buf.BytesNoCopy()
+	buf.Write(make([]byte, 100))
+	buf.Reset()
+	if !backend.removeCalled {
+		t.Fatal("Expected the storage object to be removed")
+	}
+	if !bytes.Equal(view[:cap(view)], make([]byte, cap(view))) {
+		t.Fatalf("Expected the backing array to be zeroed after spilling, got %q", view[:cap(view)])
+	}
+
+	// Close zeroes as well
+	buf.WriteString("session=42")
+	view = buf.BytesNoCopy()
+	buf.Close()
+	if !bytes.Equal(view, make([]byte, len(view))) {
+		t.Fatalf("Expected Close to zero the data, got %q", view)
+	}
+
+	// Without the option Reset keeps it cheap and leaves the array alone
+	plain := New()
+	defer plain.Close()
+	plain.WriteString("not cleared")
+	view = plain.BytesNoCopy()
+	plain.Reset()
+	if string(view) != "not cleared" {
+		t.Fatalf("Expected Reset without the option not to zero, got %q", view)
+	}
+}
+
+func TestGetPutBuffer(t *testing.T) {
+	backend := &mockStorageBackend{}
+	buf := GetBuffer(WithThreshold(64), WithStorage(func() storage.Backend { return backend }))
+	buf.WriteString("secret data")
+	view := buf.BytesNoCopy()
+	buf.Write(make([]byte, 100)) // Spill
+
+	PutBuffer(buf)
+	if !backend.removeCalled {
+		t.Fatal("Expected PutBuffer to remove storage")
+	}
+	if !bytes.Equal(view, make([]byte, len(view))) {
+		t.Fatalf("Expected pooled memory to be zeroed, got %q", view)
+	}
+	if _, err := buf.WriteString("x"); !errors.Is(err, ErrClosed) {
+		t.Fatalf("Expected ErrClosed after PutBuffer, got %v", err)
+	}
+	if err := buf.Close(); err != nil {
+		t.Fatalf("Expected Close after PutBuffer to be a no-op, got %v", err)
+	}
+
+	// Reused buffers are empty and use the new options
+	for i := 0; i < 3; i++ {
+		reused := GetBuffer(WithThreshold(8), WithStorage(func() storage.Backend { return &mockStorageBackend{} }))
+		if reused.Len() != 0 {
+			t.Fatalf("Expected empty buffer, got Len=%d", reused.Len())
+		}
+		reused.WriteString("0123456789")
+		if reused.Available() != 0 {
+			t.Fatal("Expected new threshold to apply")
+		}
+		if got := reused.String(); got != "0123456789" {
+			t.Fatalf("Unexpected contents %q", got)
+		}
+		PutBuffer(reused)
+	}
+}
+
+func TestHybridBuffer_Progress(t *testing.T) {
+	data := bytes.Repeat([]byte("progress"), 20000) // 160000 bytes, several chunks
+
+	for _, threshold := range []int{1 << 20, 1024} {
+		buf := New(WithThreshold(threshold), WithStorage(func() storage.Backend { return &mockStorageBackend{} }))
+
+		var reads []int64
+		n, err := buf.ReadFromWithProgress(smallChunkReader{bytes.NewReader(data)}, func(read int64) {
+			reads = append(reads, read)
+			_ = buf.Len() // Not locked
+		})
+		if err != nil || n != int64(len(data)) {
+			t.Fatalf("ReadFromWithProgress: %d, %v", n, err)
+		}
+		if len(reads) < 2 || reads[len(reads)-1] != int64(len(data)) {
+			t.Fatalf("Expected several cumulative callbacks ending at %d, got %v", len(data), reads)
+		}
+
+		var out bytes.Buffer
+		var writes []int64
+		n, err = buf.WriteToWithProgress(&out, func(written int64) {
+			writes = append(writes, written)
+			_ = buf.Len()
+		})
+		if err != nil || n != int64(len(data)) || !bytes.Equal(out.Bytes(), data) {
+			t.Fatalf("WriteToWithProgress: %d, %v", n, err)
+		}
+		for i := 1; i < len(writes); i++ {
+			if writes[i] <= writes[i-1] {
+				t.Fatalf("Expected increasing progress, got %v", writes)
+			}
+		}
+		if len(writes) < 2 || writes[len(writes)-1] != int64(len(data)) {
+			t.Fatalf("Expected several cumulative callbacks ending at %d, got %v", len(data), writes)
+		}
+		buf.Close()
+	}
+}
+
+// smallChunkReader hides io.WriterTo and returns at most 4KB per Read
+type smallChunkReader struct {
+	r io.Reader
+}
+
+func (o smallChunkReader) Read(p []byte) (int, error) {
+	if len(p) > 4096 {
+		p = p[:4096]
+	}
+	return o.r.Read(p)
+}
+
+// slowMiddleware delays every read, simulating expensive decoding
+type slowMiddleware struct {
+	delay time.Duration
+}
+
+func (s slowMiddleware) Writer(w io.Writer) io.Writer { return w }
+func (s slowMiddleware) Reader(r io.Reader) io.Reader { return slowReader{r, s.delay} }
+
+type slowReader struct {
+	r     io.Reader
+	delay time.Duration
+}
+
+func (s slowReader) Read(p []byte) (int, error) {
+	time.Sleep(s.delay)
+	return s.r.Read(p)
+}
+
+// gateMiddleware blocks writes to storage until its gate is closed
+type gateMiddleware struct {
+	gate chan struct{}
+}
+
+func (g gateMiddleware) Writer(w io.Writer) io.Writer { return gateWriter{w, g.gate} }
+func (g gateMiddleware) Reader(r io.Reader) io.Reader { return r }
+
+type gateWriter struct {
+	w    io.Writer
+	gate chan struct{}
+}
+
+func (g gateWriter) Write(p []byte) (int, error) {
+	<-g.gate
+	return g.w.Write(p)
+}
+
+func TestWithAsyncSpill_WriteBurstThenRead(t *testing.T) {
+	gate := make(chan struct{})
+	backend := &mockStorageBackend{}
+	buf := New(
+		WithThreshold(64),
+		WithAsyncSpill(),
+		WithMiddleware(gateMiddleware{gate: gate}),
+		WithStorage(func() storage.Backend { return backend }),
+	)
+	defer buf.Close()
+
+	// The burst completes although storage does not accept any data yet
+	var want bytes.Buffer
+	chunk := make([]byte, 100)
+	for i := 0; i < 10; i++ {
+		for j := range chunk {
+			chunk[j] = byte(i)
+		}
+		if _, err := buf.Write(chunk); err != nil {
+			t.Fatalf("Write %d failed: %v", i, err)
+		}
+		want.Write(chunk)
+	}
+	if len(backend.data) != 0 {
+		t.Fatal("Expected no data in storage while the gate is closed")
+	}
+
+	// Reading waits for the background writes
+	time.AfterFunc(20*time.Millisecond, func() { close(gate) })
+	got, err := io.ReadAll(buf)
+	if err != nil {
+		t.Fatalf("ReadAll failed: %v", err)
+	}
+	if !bytes.Equal(got, want.Bytes()) {
+		t.Fatal("Data mismatch after async spill")
+	}
+}
+
+var errWriteFailed = errors.New("write failed")
+
+// errWriteBackend creates write streams that fail every write
+type errWriteBackend struct {
+	mockStorageBackend
+}
+
+func (e *errWriteBackend) Create() (io.WriteCloser, error) {
+	return errWriteCloser{}, nil
+}
+
+type errWriteCloser struct{}
+
+func (errWriteCloser) Write(p []byte) (int, error) { return 0, errWriteFailed }
+func (errWriteCloser) Close() error                { return nil }
+
+func TestWithAsyncSpill_WriteError(t *testing.T) {
+	buf := New(
+		WithThreshold(8),
+		WithAsyncSpill(),
+		WithStorage(func() storage.Backend { return &errWriteBackend{} }),
+	)
+	defer buf.Close()
+
+	// The spill itself succeeds, the background error surfaces on a later write
+	if _, err := buf.WriteString("0123456789"); err != nil {
+		t.Fatalf("Expected the spill to be queued, got %v", err)
+	}
+	var err error
+	for i := 0; i < 100 && err == nil; i++ {
+		_, err = buf.WriteString("more")
+		time.Sleep(time.Millisecond)
+	}
+	if !errors.Is(err, errWriteFailed) {
+		t.Fatalf("Expected the background write error, got %v", err)
+	}
+}
+
+// errAfterBackend fails reads after a number of bytes
+type errAfterBackend struct {
+	mockStorageBackend
+	after int
+	err   error
+}
+
+func (e *errAfterBackend) Open() (io.ReadCloser, error) {
+	rc, _ := e.mockStorageBackend.Open()
+	return io.NopCloser(io.MultiReader(io.LimitReader(rc, int64(e.after)), brokenReader{e.err})), nil
+}
+
+type brokenReader struct{ err error }
+
+func (e brokenReader) Read([]byte) (int, error) { return 0, e.err }
+
+func TestHybridBuffer_WithReadAhead(t *testing.T) {
+	data := make([]byte, 300000)
+	for i := range data {
+		data[i] = byte(i % 251)
+	}
+
+	buf := New(WithThreshold(1024), WithReadAhead(64<<10), WithStorage(func() storage.Backend { return &mockStorageBackend{} }))
+	defer buf.Close()
+	buf.Write(data)
+
+	// Mixed small reads, byte reads and a partial Next
+	got := make([]byte, 0, len(data))
+	small := make([]byte, 7)
+	for len(got) < 1000 {
+		n, err := buf.Read(small)
+		if err != nil {
+			t.Fatalf("Read failed: %v", err)
+		}
+		got = append(got, small[:n]...)
+	}
+	c, _ := buf.ReadByte()
+	got = append(got, c)
+	got = append(got, buf.Next(5000)...)
+	rest, err := io.ReadAll(buf)
+	if err != nil {
+		t.Fatalf("ReadAll failed: %v", err)
+	}
+	got = append(got, rest...)
+	if !bytes.Equal(got, data) {
+		t.Fatal("Data mismatch with read-ahead")
+	}
+}
+
+func TestHybridBuffer_WithReadAheadTeardown(t *testing.T) {
+	before := runtime.NumGoroutine()
+
+	for i := 0; i < 10; i++ {
+		buf := New(WithThreshold(16), WithReadAhead(1024), WithStorage(func() storage.Backend { return &mockStorageBackend{} }))
+		buf.Write(make([]byte, 100000))
+		buf.Read(make([]byte, 10))
+		if i%2 == 0 {
+			buf.Reset()
+		}
+		buf.Close()
+	}
+
+	time.Sleep(10 * time.Millisecond)
+	if after := runtime.NumGoroutine(); after > before {
+		t.Fatalf("Read-ahead goroutines leaked: %d before, %d after", before, after)
+	}
+}
+
+func TestHybridBuffer_WithReadAheadError(t *testing.T) {
+	errBroken := errors.New("broken storage")
+	buf := New(WithThreshold(16), WithReadAhead(1024), WithStorage(func() storage.Backend {
+		return &errAfterBackend{after: 100, err: errBroken}
+	}))
+	defer buf.Close()
+	buf.Write(make([]byte, 1000))
+
+	got, err := io.ReadAll(buf)
+	if !errors.Is(err, errBroken) {
+		t.Fatalf("Expected storage error, got %v", err)
+	}
+	if len(got) != 100 {
+		t.Fatalf("Expected 100 bytes before the error, got %d", len(got))
+	}
+}
+
+// sizedStorageBackend reports the stored size
+type sizedStorageBackend struct {
+	mockStorageBackend
+}
+
+func (s *sizedStorageBackend) Size() (int64, error) {
+	return int64(len(s.data)), nil
+}
+
+func TestHybridBuffer_StorageSize(t *testing.T) {
+	backend := &sizedStorageBackend{}
+	buf := New(WithThreshold(16), WithGzip(9), WithStorage(func() storage.Backend { return backend }))
+	defer buf.Close()
+
+	buf.WriteString("memory")
+	if size, err := buf.StorageSize(); err != nil || size != 0 {
+		t.Fatalf("Expected 0 in memory mode, got %d, %v", size, err)
+	}
+
+	data := strings.Repeat("compress me ", 1000)
+	buf.WriteString(data)
+	buf.ReadByte() // Finalizes the write stream
+
+	size, err := buf.StorageSize()
+	if err != nil {
+		t.Fatalf("StorageSize failed: %v", err)
+	}
+	if size != int64(len(backend.data)) || size >= int64(len(data)) {
+		t.Fatalf("Expected compressed stored size, got %d for %d logical bytes", size, buf.Size())
+	}
+
+	plain := New(WithThreshold(4), WithStorage(func() storage.Backend { return &mockStorageBackend{} }))
+	defer plain.Close()
+	plain.WriteString("spilled")
+	if _, err := plain.StorageSize(); !errors.Is(err, errors.ErrUnsupported) {
+		t.Fatalf("Expected ErrUnsupported, got %v", err)
+	}
+}
+
+func TestHybridBuffer_StorageSizeFilesystem(t *testing.T) {
+	buf := New(WithThreshold(16), WithGzip(9), WithStorage(filesystem.New(filesystem.WithTempDir(t.TempDir()))))
+	defer buf.Close()
+
+	data := strings.Repeat("compress me ", 1000)
+	buf.WriteString(data)
+	buf.ReadByte() // Finalizes the write stream
+
+	size, err := buf.StorageSize()
+	if err != nil {
+		t.Fatalf("StorageSize failed: %v", err)
+	}
+	path, _ := buf.StoragePath()
+	info, err := os.Stat(path)
+	if err != nil || size != info.Size() || size >= int64(len(data)) {
+		t.Fatalf("Expected the compressed file size, got %d for %d logical bytes", size, buf.Size())
+	}
+}
+
+func TestHybridBuffer_MemoryAndSpilledBytes(t *testing.T) {
+	buf := New(WithThreshold(10), WithStorage(func() storage.Backend { return &mockStorageBackend{} }))
+	defer buf.Close()
+
+	buf.WriteString("012345")
+	if buf.MemoryBytes() != 6 || buf.SpilledBytes() != 0 {
+		t.Fatalf("Expected 6 in memory and 0 spilled, got %d and %d", buf.MemoryBytes(), buf.SpilledBytes())
+	}
+
+	// Spilling moves the memory contents, then writes go to storage
+	buf.WriteString("6789ab")
+	buf.Write([]byte("cd"))
+	if buf.MemoryBytes() != 0 || buf.SpilledBytes() != 14 {
+		t.Fatalf("Expected 0 in memory and 14 spilled, got %d and %d", buf.MemoryBytes(), buf.SpilledBytes())
+	}
+
+	// Reading does not change the counters, writing after reading continues them
+	buf.Next(5)
+	buf.WriteString("ef")
+	if buf.SpilledBytes() != 16 {
+		t.Fatalf("Expected 16 spilled, got %d", buf.SpilledBytes())
+	}
+
+	buf.Reset()
+	if buf.MemoryBytes() != 0 || buf.SpilledBytes() != 0 {
+		t.Fatalf("Expected counters to be reset, got %d and %d", buf.MemoryBytes(), buf.SpilledBytes())
+	}
+}
+
+func TestHybridBuffer_Compact(t *testing.T) {
+	buf := New(WithThreshold(1 << 20))
+	defer buf.Close()
+
+	data := bytes.Repeat([]byte("0123456789"), 10_000)
+	buf.Write(data)
+	buf.Next(len(data) - 10)
+
+	buf.Compact()
+	if buf.Len() != 10 {
+		t.Fatalf("Expected Len 10, got %d", buf.Len())
+	}
+	if buf.MemoryBytes() != 10 || buf.Cap() >= len(data) {
+		t.Fatalf("Expected the consumed memory to be released, got %d bytes in memory, cap %d", buf.MemoryBytes(), buf.Cap())
+	}
+	if buf.Size() != int64(len(data)) {
+		t.Fatalf("Expected Size %d to include the released data, got %d", len(data), buf.Size())
+	}
+
+	// Independent readers only see the data that was kept
+	info, err := buf.AsFile("data").Stat()
+	if err != nil {
+		t.Fatalf("Stat failed: %v", err)
+	}
+	if info.Size() != 10 {
+		t.Fatalf("Expected file size 10, got %d", info.Size())
+	}
+
+	// Writing and reading continue normally
+	buf.WriteString("abc")
+	if got := buf.String(); got != "0123456789abc" {
+		t.Fatalf("Expected %q, got %q", "0123456789abc", got)
+	}
+}
+
+// appendBackend is a mockStorageBackend that can append to its data
+type appendBackend struct {
+	mockStorageBackend
+	appendCalled bool
+}
+
+func (a *appendBackend) Append() (io.WriteCloser, error) {
+	a.appendCalled = true
+	a.writePos = len(a.data)
+	return &mockWriteCloser{backend: &a.mockStorageBackend}, nil
+}
+
+func TestAttachStorage(t *testing.T) {
+	backend := &appendBackend{mockStorageBackend: mockStorageBackend{data: []byte("hello")}}
+	buf := AttachStorage(func() storage.Backend { return backend }, 5)
+	defer buf.Close()
+
+	if buf.Len() != 5 {
+		t.Fatalf("Expected Len 5, got %d", buf.Len())
+	}
+	head := make([]byte, 2)
+	buf.Read(head)
+
+	buf.WriteString(" world")
+	if got := buf.String(); got != "llo world" {
+		t.Fatalf("Expected %q, got %q", "llo world", got)
+	}
+	if !backend.appendCalled || backend.createCalled {
+		t.Fatal("Expected writes to be appended to the attached object")
+	}
+	if string(backend.data) != "hello world" {
+		t.Fatalf("Expected the object to hold %q, got %q", "hello world", backend.data)
+	}
+}
+
+func TestAttachStorage_Gzip(t *testing.T) {
+	// The existing object was written by an earlier buffer with the same middlewares
+	var stored bytes.Buffer
+	zw := gzip.NewWriter(&stored)
+	zw.Write([]byte("first phase, "))
+	zw.Close()
+
+	backend := &appendBackend{mockStorageBackend: mockStorageBackend{data: stored.Bytes()}}
+	buf := AttachStorage(func() storage.Backend { return backend }, 13, WithGzip(gzip.BestSpeed))
+	defer buf.Close()
+
+	buf.WriteString("second phase")
+	if got := buf.String(); got != "first phase, second phase" {
+		t.Fatalf("Expected both phases, got %q", got)
+	}
+}
+
+func TestAttachStorage_WithoutAppender(t *testing.T) {
+	first := &mockStorageBackend{data: []byte("hello")}
+	backends := []*mockStorageBackend{first, {}}
+	buf := AttachStorage(func() storage.Backend {
+		b := backends[0]
+		backends = backends[1:]
+		return b
+	}, 5)
+	defer buf.Close()
+
+	// The data is copied into a new object before writing
+	buf.WriteString(" world")
+	if got := buf.String(); got != "hello world" {
+		t.Fatalf("Expected %q, got %q", "hello world", got)
+	}
+	if !first.removeCalled {
+		t.Fatal("Expected the attached object to be replaced by the copy")
+	}
+}
+
+func TestHybridBuffer_CheckpointRollback(t *testing.T) {
+	tests := []struct {
+		name      string
+		threshold int
+	}{
+		{"memory", 1024},
+		{"storage", 4},
+		{"across spill", 12},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf := New(WithThreshold(tt.threshold), WithStorage(func() storage.Backend { return &mockStorageBackend{} }))
+			defer buf.Close()
+
+			buf.WriteString("header;")
+			header := buf.Checkpoint()
+			buf.WriteString("segment;")
+			segment := buf.Checkpoint()
+			buf.WriteString("partial")
+
+			// Nested rollbacks
+			if err := buf.Rollback(segment); err != nil {
+				t.Fatalf("Rollback failed: %v", err)
+			}
+			if err := buf.Rollback(header); err != nil {
+				t.Fatalf("Rollback failed: %v", err)
+			}
+			if err := buf.Rollback(segment); err != ErrInvalidMark {
+				t.Fatalf("Expected ErrInvalidMark beyond the end, got %v", err)
+			}
+
+			buf.WriteString("body")
+			if got := buf.String(); got != "header;body" {
+				t.Fatalf("Expected %q, got %q", "header;body", got)
+			}
+		})
+	}
+}
+
+func TestHybridBuffer_RollbackInvalidMark(t *testing.T) {
+	buf := New()
+	defer buf.Close()
+	other := New()
+	defer other.Close()
+
+	buf.WriteString("data")
+	mark := buf.Checkpoint()
+	if err := other.Rollback(mark); err != ErrInvalidMark {
+		t.Fatalf("Expected ErrInvalidMark for another buffer's mark, got %v", err)
+	}
+
+	buf.Reset()
+	buf.WriteString("more data")
+	if err := buf.Rollback(mark); err != ErrInvalidMark {
+		t.Fatalf("Expected ErrInvalidMark after Reset, got %v", err)
+	}
+}
+
+func TestWithReadOnly(t *testing.T) {
+	for _, threshold := range []int{1024, 8} {
+		buf := NewFromBytes([]byte("immutable contents"), WithThreshold(threshold), WithReadOnly())
+		defer buf.Close()
+
+		writes := map[string]func() error{
+			"Write":       func() error { _, err := buf.Write([]byte("x")); return err },
+			"WriteString": func() error { _, err := buf.WriteString("x"); return err },
+			"WriteByte":   func() error { return buf.WriteByte('x') },
+			"WriteRune":   func() error { _, err := buf.WriteRune('x'); return err },
+			"Writef":      func() error { _, err := buf.Writef("%d", 1); return err },
+			"ReadFrom":    func() error { _, err := buf.ReadFrom(strings.NewReader("x")); return err },
+			"ReadFromWithProgress": func() error {
+				_, err := buf.ReadFromWithProgress(strings.NewReader("x"), nil)
+				return err
+			},
+			"Rollback":      func() error { return buf.Rollback(buf.Checkpoint()) },
+			"UnmarshalJSON": func() error { return buf.UnmarshalJSON([]byte(`"eA=="`)) },
+		}
+		for name, write := range writes {
+			if err := write(); !errors.Is(err, ErrReadOnly) {
+				t.Fatalf("Threshold %d: expected ErrReadOnly from %s, got %v", threshold, name, err)
+			}
+		}
+
+		func() {
+			defer func() {
+				if r := recover(); r != ErrReadOnly {
+					t.Fatalf("Threshold %d: expected Truncate to panic with ErrReadOnly, got %v", threshold, r)
+				}
+			}()
+			buf.Truncate(1)
+		}()
+
+		// Reads keep working and see the original contents
+		if got, _ := io.ReadAll(buf); string(got) != "immutable contents" {
+			t.Fatalf("Threshold %d: expected the original contents, got %q", threshold, got)
+		}
+	}
+
+	fromReader, err := NewFromReader(strings.NewReader("from reader"), WithReadOnly())
+	if err != nil {
+		t.Fatalf("NewFromReader failed: %v", err)
+	}
+	defer fromReader.Close()
+	if _, err := fromReader.WriteString("x"); !errors.Is(err, ErrReadOnly) {
+		t.Fatalf("Expected ErrReadOnly, got %v", err)
+	}
+	if got := fromReader.String(); got != "from reader" {
+		t.Fatalf("Expected the contents read at construction, got %q", got)
+	}
+}
+
+func TestHybridBuffer_WriteAt(t *testing.T) {
+	buf := New()
+	defer buf.Close()
+
+	// Placeholder header, patched after the payload
+	buf.WriteString("0000:payload")
+	buf.Next(2)
+	if n, err := buf.WriteAt([]byte("0007"), 0); err != nil || n != 4 {
+		t.Fatalf("WriteAt failed: %d, %v", n, err)
+	}
+
+	// Overwriting across the end extends the contents
+	if n, err := buf.WriteAt([]byte("LOAD!"), 9); err != nil || n != 5 {
+		t.Fatalf("WriteAt failed: %d, %v", n, err)
+	}
+
+	// Writing beyond the end zero-fills the gap
+	if _, err := buf.WriteAt([]byte("end"), 16); err != nil {
+		t.Fatalf("WriteAt failed: %v", err)
+	}
+
+	// The read offset is unchanged
+	if got := buf.String(); got != "07:paylLOAD!\x00\x00end" {
+		t.Fatalf("Unexpected contents %q", got)
+	}
+
+	if _, err := buf.WriteAt([]byte("x"), -1); err == nil {
+		t.Fatal("Expected an error for a negative offset")
+	}
+}
+
+func TestHybridBuffer_WriteAtStorage(t *testing.T) {
+	dir := t.TempDir()
+	buf := New(WithThreshold(8), WithStorage(func() storage.Backend { return &tempFileBackend{dir: dir} }))
+	defer buf.Close()
+
+	buf.WriteString("0000:spilled payload")
+	if _, err := buf.WriteAt([]byte("0015"), 0); err != nil {
+		t.Fatalf("WriteAt on a file failed: %v", err)
+	}
+	if got := buf.String(); got != "0015:spilled payload" {
+		t.Fatalf("Unexpected contents %q", got)
+	}
+
+	// Middlewares transform the stored bytes, so patching is impossible
+	transformed := New(WithThreshold(8), WithMiddleware(xorMiddleware{}), WithStorage(func() storage.Backend { return &tempFileBackend{dir: dir} }))
+	defer transformed.Close()
+	transformed.WriteString("0000:spilled payload")
+	if _, err := transformed.WriteAt([]byte("0015"), 0); !errors.Is(err, errors.ErrUnsupported) {
+		t.Fatalf("Expected errors.ErrUnsupported, got %v", err)
+	}
+
+	// Extending spilled data works like Write
+	if _, err := transformed.WriteAt([]byte("!"), 20); err != nil {
+		t.Fatalf("Extending WriteAt failed: %v", err)
+	}
+	if got := transformed.String(); got != "0000:spilled payload!" {
+		t.Fatalf("Unexpected contents %q", got)
+	}
+}
+
+func TestWithMemoryOnly(t *testing.T) {
+	backend := &mockStorageBackend{}
+	buf := New(WithThreshold(10), WithMemoryOnly(), WithStorage(func() storage.Backend { return backend }))
+	defer buf.Close()
+
+	// Exactly filling the threshold is fine
+	if n, err := buf.WriteString("0123456789"); n != 10 || err != nil {
+		t.Fatalf("Expected 10 bytes and no error, got %d, %v", n, err)
+	}
+	if n, err := buf.Write([]byte("x")); n != 0 || err != ErrThresholdExceeded {
+		t.Fatalf("Expected ErrThresholdExceeded, got %d, %v", n, err)
+	}
+
+	// Consumed data is reclaimed before failing
+	buf.Next(4)
+	n, err := buf.WriteString("abcdefgh")
+	if n != 4 || err != ErrThresholdExceeded {
+		t.Fatalf("Expected a short write of 4 bytes, got %d, %v", n, err)
+	}
+	if got := buf.String(); got != "456789abcd" {
+		t.Fatalf("Expected %q, got %q", "456789abcd", got)
+	}
+
+	buf.Grow(100)
+	if backend.createCalled {
+		t.Fatal("Expected no storage in memory-only mode")
+	}
+}
+
+func TestWithMemoryOnly_Overshoot(t *testing.T) {
+	buf := New(WithThreshold(10), WithMemoryOnly())
+	defer buf.Close()
+
+	n, err := buf.Write([]byte("0123456789abc"))
+	if n != 10 || err != ErrThresholdExceeded {
+		t.Fatalf("Expected a short write of 10 bytes, got %d, %v", n, err)
+	}
+	if buf.Len() != 10 {
+		t.Fatalf("Expected Len 10, got %d", buf.Len())
+	}
+}
+
+// tempFileBackend stores data in a temp file and reports its path
+type tempFileBackend struct {
+	dir  string
+	path string
+}
+
+func (f *tempFileBackend) Create() (io.WriteCloser, error) {
+	file, err := os.CreateTemp(f.dir, "spill-*")
+	if err != nil {
+		return nil, err
+	}
+	f.path = file.Name()
+	return file, nil
+}
+
+func (f *tempFileBackend) Open() (io.ReadCloser, error) { return os.Open(f.path) }
+func (f *tempFileBackend) Remove() error                { return os.Remove(f.path) }
+func (f *tempFileBackend) Path() string                 { return f.path }
+
+func TestHybridBuffer_StoragePath(t *testing.T) {
+	dir := t.TempDir()
+	buf := New(WithThreshold(8), WithStorage(func() storage.Backend { return &tempFileBackend{dir: dir} }))
+
+	buf.WriteString("memory")
+	if _, ok := buf.StoragePath(); ok {
+		t.Fatal("Expected no path in memory mode")
+	}
+
+	buf.WriteString(" and storage")
+	path, ok := buf.StoragePath()
+	if !ok {
+		t.Fatal("Expected a path in storage mode")
+	}
+
+	// All written data is in the file
+	data, err := os.ReadFile(path)
+	if err != nil || string(data) != "memory and storage" {
+		t.Fatalf("Expected the written data in %s, got %q, %v", path, data, err)
+	}
+
+	buf.Close()
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("Expected the file to be removed by Close, got %v", err)
+	}
+
+	plain := New(WithThreshold(4), WithStorage(func() storage.Backend { return &mockStorageBackend{} }))
+	defer plain.Close()
+	plain.WriteString("spilled")
+	if _, ok := plain.StoragePath(); ok {
+		t.Fatal("Expected no path for a backend without Path")
+	}
+}
+
+func TestHybridBuffer_StoragePathFilesystem(t *testing.T) {
+	dir := t.TempDir()
+	buf := New(WithThreshold(8), WithStorage(filesystem.New(filesystem.WithTempDir(dir))))
+
+	buf.WriteString("memory and storage")
+	path, ok := buf.StoragePath()
+	if !ok || filepath.Dir(path) != dir {
+		t.Fatalf("Expected a path in %s, got %q", dir, path)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil || string(data) != "memory and storage" {
+		t.Fatalf("Expected the written data in %s, got %q, %v", path, data, err)
+	}
+
+	// Writing after the file was finalized continues in a new file
+	buf.WriteString(", continued")
+	next, ok := buf.StoragePath()
+	if !ok || next == path {
+		t.Fatalf("Expected a new path, got %q", next)
+	}
+	if data, _ := os.ReadFile(next); string(data) != "memory and storage, continued" {
+		t.Fatalf("Expected all data in %s, got %q", next, data)
+	}
+
+	buf.Close()
+	if _, err := os.Stat(next); !os.IsNotExist(err) {
+		t.Fatalf("Expected the file to be removed by Close, got %v", err)
+	}
+}
+
+func TestHybridBuffer_InterleavedFileStorage(t *testing.T) {
+	dir := t.TempDir()
+	backends := 0
+	buf := New(WithThreshold(4), WithStorage(func() storage.Backend {
+		backends++
+		return &tempFileBackend{dir: dir}
+	}))
+	defer buf.Close()
+
+	var got []byte
+	p := make([]byte, 3)
+	for i := 0; i < 50; i++ {
+		fmt.Fprintf(buf, "chunk %02d;", i)
+		n, err := buf.Read(p)
+		if err != nil {
+			t.Fatalf("Read %d failed: %v", i, err)
+		}
+		got = append(got, p[:n]...)
+	}
+	rest, err := io.ReadAll(buf)
+	if err != nil {
+		t.Fatalf("ReadAll failed: %v", err)
+	}
+	got = append(got, rest...)
+
+	var want strings.Builder
+	for i := 0; i < 50; i++ {
+		fmt.Fprintf(&want, "chunk %02d;", i)
+	}
+	if string(got) != want.String() {
+		t.Fatalf("Expected %q, got %q", want.String(), got)
+	}
+	if backends != 1 {
+		t.Fatalf("Expected writes to continue in the same file, got %d storage objects", backends)
+	}
+}
+
+func TestHybridBuffer_WriteToFile(t *testing.T) {
+	data := bytes.Repeat([]byte("0123456789"), 10000)
+
+	modes := []struct {
+		name string
+		opts []Option
+	}{
+		{"raw file", nil},
+		{"raw file after read-ahead", []Option{WithReadAhead(4096)}},
+		{"context", []Option{WithContext(context.Background())}},
+		{"middleware", []Option{WithMiddleware(xorMiddleware{})}},
+	}
+	for _, mode := range modes {
+		dir := t.TempDir()
+		provider := func() storage.Backend { return &tempFileBackend{dir: dir} }
+		opts := append([]Option{WithThreshold(1024), WithStorage(provider)}, mode.opts...)
+		buf := New(opts...)
+		defer buf.Close()
+		buf.Write(data)
+
+		head := make([]byte, 100)
+		buf.Read(head)
+
+		out, err := os.Create(filepath.Join(t.TempDir(), "out"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer out.Close()
+		n, err := buf.WriteTo(out)
+		if err != nil || n != int64(len(data)-100) {
+			t.Fatalf("%s: expected %d bytes, got %d, %v", mode.name, len(data)-100, n, err)
+		}
+		if got, _ := os.ReadFile(out.Name()); !bytes.Equal(got, data[100:]) {
+			t.Fatalf("%s: file contents mismatch", mode.name)
+		}
+		if buf.Len() != 0 {
+			t.Fatalf("%s: expected the buffer to be consumed, Len() is %d", mode.name, buf.Len())
+		}
+
+		// Reading continues after further writes
+		buf.Write([]byte("more"))
+		if got := buf.String(); got != "more" {
+			t.Fatalf("%s: expected more, got %q", mode.name, got)
+		}
+	}
+}
+
+func TestHybridBuffer_Sync(t *testing.T) {
+	dir := t.TempDir()
+	buf := New(WithThreshold(8), WithGzip(gzip.BestSpeed), WithStorage(filesystem.New(filesystem.WithTempDir(dir))))
+
+	if err := buf.Sync(); err != nil {
+		t.Fatalf("Sync in memory mode failed: %v", err)
+	}
+
+	data := "data that must be on disk"
+	buf.WriteString(data)
+	if err := buf.Sync(); err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+
+	// The flushed gzip stream on disk holds all data, even though it is not finished
+	files, _ := filepath.Glob(filepath.Join(dir, "*"))
+	if len(files) != 1 {
+		t.Fatalf("Expected one spill file, got %v", files)
+	}
+	file, err := os.Open(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	zr, err := gzip.NewReader(file)
+	if err != nil {
+		t.Fatalf("Failed to read gzip header: %v", err)
+	}
+	got, err := io.ReadAll(zr)
+	if string(got) != data || err != io.ErrUnexpectedEOF {
+		t.Fatalf("Expected %q before the end of the stream, got %q, %v", data, got, err)
+	}
+
+	// Writing continues after Sync
+	buf.WriteString(" and more")
+	if got := buf.String(); got != data+" and more" {
+		t.Fatalf("Expected all data, got %q", got)
+	}
+
+	buf.Close()
+	if err := buf.Sync(); !errors.Is(err, ErrClosed) {
+		t.Fatalf("Expected ErrClosed, got %v", err)
+	}
+}
+
+// syncingBackend records Sync calls on its write streams
+type syncingBackend struct {
+	mockStorageBackend
+	syncs int
+	// Data stored at the last Sync
+	synced []byte
+}
+
+type syncingWriteCloser struct {
+	*mockWriteCloser
+	backend *syncingBackend
+}
+
+func (s *syncingBackend) Create() (io.WriteCloser, error) {
+	w, _ := s.mockStorageBackend.Create()
+	return &syncingWriteCloser{mockWriteCloser: w.(*mockWriteCloser), backend: s}, nil
+}
+
+func (w *syncingWriteCloser) Sync() error {
+	w.backend.syncs++
+	w.backend.synced = slices.Clone(w.backend.data)
+	return nil
+}
+
+func TestHybridBuffer_SyncAsyncSpill(t *testing.T) {
+	backend := &syncingBackend{}
+	buf := New(WithThreshold(8), WithAsyncSpill(), WithStorage(func() storage.Backend { return backend }))
+	defer buf.Close()
+
+	data := bytes.Repeat([]byte("queued "), 100)
+	for i := 0; i < len(data); i += 7 {
+		buf.Write(data[i : i+7])
+	}
+	if err := buf.Sync(); err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	if backend.syncs != 1 || !bytes.Equal(backend.synced, data) {
+		t.Fatalf("Expected all queued data synced once, got %d syncs of %d bytes", backend.syncs, len(backend.synced))
+	}
+}
+
+// Benchmark tests
+func BenchmarkHybridBuffer_Write(b *testing.B) {
+	buf := New()
+	defer buf.Close()
+
+	data := make([]byte, 1024)
+	for i := range data {
+		data[i] = byte(i % 256)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		buf.Write(data)
+	}
+}
+
+func BenchmarkHybridBuffer_Read(b *testing.B) {
+	buf := New()
+	defer buf.Close()
+
+	// Prepare data
+	data := make([]byte, 1024*1024) // 1MB
+	for i := range data {
+		data[i] = byte(i % 256)
+	}
+	buf.Write(data)
+
+	readData := make([]byte, 1024)
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		if i%1000 == 0 { // Reset periodically
+			buf.Reset()
+			buf.Write(data)
+		}
+		buf.Read(readData)
+	}
+}
+
+func BenchmarkHybridBuffer_Bytes(b *testing.B) {
+	data := make([]byte, 4096)
+
+	b.Run("Bytes", func(b *testing.B) {
+		buf := New(WithThreshold(8192))
+		defer buf.Close()
+
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			buf.Reset()
+			buf.Write(data)
+			_ = buf.Bytes()
+		}
+	})
+
+	b.Run("BytesNoCopy", func(b *testing.B) {
+		buf := New(WithThreshold(8192))
+		defer buf.Close()
+
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			buf.Reset()
+			buf.Write(data)
+			_ = buf.BytesNoCopy()
+		}
+	})
+}
+
+func BenchmarkHybridBuffer_Next(b *testing.B) {
+	data := make([]byte, 64<<10)
+	buf := New(WithThreshold(len(data)))
+	defer buf.Close()
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if buf.Len() == 0 {
+			buf.Reset()
+			buf.Write(data)
+		}
+		_ = buf.Next(512)
+	}
+}
+
+func BenchmarkHybridBuffer_WriteString(b *testing.B) {
+	s := strings.Repeat("x", 256)
+
+	b.Run("Write", func(b *testing.B) {
+		buf := New(WithThreshold(1 << 20))
+		defer buf.Close()
+
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if i%1000 == 0 {
+				buf.Reset()
+			}
+			buf.Write([]byte(s))
+		}
+	})
+
+	b.Run("WriteString", func(b *testing.B) {
+		buf := New(WithThreshold(1 << 20))
+		defer buf.Close()
+
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if i%1000 == 0 {
+				buf.Reset()
+			}
+			buf.WriteString(s)
+		}
+	})
+}
+
+func BenchmarkHybridBuffer_Pool(b *testing.B) {
+	data := make([]byte, 1024)
+
+	b.Run("New", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			buf := New(WithThreshold(64 << 10))
+			buf.Write(data)
+			buf.Close()
+		}
+	})
+
+	b.Run("GetBuffer", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			buf := GetBuffer(WithThreshold(64 << 10))
+			buf.Write(data)
+			PutBuffer(buf)
+		}
+	})
+}
+
+func BenchmarkHybridBuffer_Reset(b *testing.B) {
+	buf := New(WithThreshold(64<<10), WithPreAlloc(32<<10))
+	defer buf.Close()
+
+	data := make([]byte, 32<<10)
+
+	b.ReportAllocs()
+	b.SetBytes(int64(len(data)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		buf.Reset()
+		buf.Write(data)
+	}
+}
+
+func BenchmarkHybridBuffer_ReadAhead(b *testing.B) {
+	data := make([]byte, 1<<20)
+	consume := func(p []byte) {
+		time.Sleep(200 * time.Microsecond) // Caller processing each chunk
+	}
+
+	for _, readAhead := range []int{0, 256 << 10} {
+		b.Run(fmt.Sprintf("readahead=%d", readAhead), func(b *testing.B) {
+			opts := []Option{WithThreshold(1024), WithMiddleware(slowMiddleware{delay: 200 * time.Microsecond})}
+			if readAhead > 0 {
+				opts = append(opts, WithReadAhead(readAhead))
+			}
+			chunk := make([]byte, 32<<10)
+
+			b.SetBytes(int64(len(data)))
+			for i := 0; i < b.N; i++ {
+				buf := New(opts...)
+				buf.Write(data)
+				for {
+					n, err := buf.Read(chunk)
+					if n > 0 {
+						consume(chunk[:n])
+					}
+					if err != nil {
+						break
+					}
+				}
+				buf.Close()
+			}
+		})
+	}
+}
+
+func BenchmarkHybridBuffer_WriteToFile(b *testing.B) {
+	data := make([]byte, 64<<20)
+
+	// A context makes the buffer copy through user space in chunks
+	for _, mode := range []struct {
+		name string
+		opts []Option
+	}{
+		{"raw file", nil},
+		{"chunked copy", []Option{WithContext(context.Background())}},
+	} {
+		b.Run(mode.name, func(b *testing.B) {
+			dir := b.TempDir()
+			opts := append([]Option{WithThreshold(1024), WithStorage(filesystem.New(filesystem.WithTempDir(dir)))}, mode.opts...)
+
+			b.SetBytes(int64(len(data)))
+			for i := 0; i < b.N; i++ {
+				b.StopTimer()
+				buf := New(opts...)
+				buf.Write(data)
+				out, err := os.Create(filepath.Join(dir, "out"))
+				if err != nil {
+					b.Fatal(err)
+				}
+				b.StartTimer()
+
+				if _, err := buf.WriteTo(out); err != nil {
+					b.Fatal(err)
+				}
+
+				b.StopTimer()
+				out.Close()
+				buf.Close()
+				b.StartTimer()
+			}
+		})
 	}
 }
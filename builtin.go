@@ -0,0 +1,456 @@
+package hybridbuffer
+
+import (
+	"compress/gzip"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// gzipMiddleware compresses spilled data with the standard library gzip implementation
+type gzipMiddleware struct {
+	level int
+}
+
+func (gzipMiddleware) Name() string { return "gzip" }
+func (gzipMiddleware) Stage() Stage { return StageCompression }
+
+func (m gzipMiddleware) Writer(w io.Writer) io.Writer {
+	zw, _ := gzip.NewWriterLevel(w, m.level) // Level validated by WithGzip
+	return &gzipWriter{Writer: zw, underlying: w}
+}
+
+func (m gzipMiddleware) Reader(r io.Reader) io.Reader {
+	return &gzipReader{underlying: r}
+}
+
+// gzipWriter flushes the gzip trailer and closes the underlying writer on Close
+type gzipWriter struct {
+	*gzip.Writer
+	underlying io.Writer
+}
+
+func (w *gzipWriter) Close() error {
+	err := w.Writer.Close()
+	if closer, ok := w.underlying.(io.Closer); ok {
+		err = errors.Join(err, closer.Close())
+	}
+	return err
+}
+
+// gzipReader defers reading the gzip header to the first Read
+type gzipReader struct {
+	underlying io.Reader
+	zr         *gzip.Reader
+	err        error
+}
+
+func (r *gzipReader) Read(p []byte) (int, error) {
+	if r.zr == nil && r.err == nil {
+		r.zr, r.err = gzip.NewReader(r.underlying)
+	}
+	if r.err != nil {
+		return 0, r.err
+	}
+	return r.zr.Read(p)
+}
+
+func (r *gzipReader) Close() error {
+	if closer, ok := r.underlying.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// aesgcmChunkSize is the amount of plaintext sealed per chunk
+const aesgcmChunkSize = 64 << 10
+
+// errCiphertextTruncated is returned when an encrypted stream ends before its final chunk
+var errCiphertextTruncated = errors.New("hybridbuffer: encrypted data truncated")
+
+// aesgcmMiddleware encrypts spilled data with AES-GCM
+// Each stream starts with a random nonce prefix followed by length-prefixed sealed
+// chunks. Chunk nonces are derived from the prefix and a counter, and the last chunk
+// is authenticated as such, so reordered, dropped or truncated chunks are detected.
+//
+// In deterministic mode there is no prefix. Each chunk's nonce is derived from a
+// keyed hash of its plaintext, counter and final flag (SIV-style) and stored before
+// the sealed chunk, and the counter is authenticated as additional data.
+type aesgcmMiddleware struct {
+	aead          cipher.AEAD
+	nonceKey      []byte // Key of the nonce hash in deterministic mode
+	deterministic bool
+}
+
+// newAESGCMMiddleware creates the middleware for a 16, 24 or 32 byte key
+func newAESGCMMiddleware(key []byte) (*aesgcmMiddleware, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	// Separate key for the nonce hash, so the encryption key is never used twice
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte("hybridbuffer aes-gcm deterministic nonce"))
+	return &aesgcmMiddleware{aead: aead, nonceKey: mac.Sum(nil)}, nil
+}
+
+// withDeterministicNonce returns a copy of the middleware in deterministic mode
+func (m *aesgcmMiddleware) withDeterministicNonce() *aesgcmMiddleware {
+	deterministic := *m
+	deterministic.deterministic = true
+	return &deterministic
+}
+
+func (*aesgcmMiddleware) Name() string { return "aes-gcm" }
+func (*aesgcmMiddleware) Stage() Stage { return StageEncryption }
+
+func (m *aesgcmMiddleware) Writer(w io.Writer) io.Writer {
+	return &aesgcmWriter{m: m, aead: m.aead, w: w}
+}
+
+func (m *aesgcmMiddleware) Reader(r io.Reader) io.Reader {
+	return &aesgcmReader{m: m, aead: m.aead, r: r}
+}
+
+// sivNonce derives the nonce of a chunk from its contents in deterministic mode
+func (m *aesgcmMiddleware) sivNonce(dst []byte, counter uint64, final bool, plain []byte) []byte {
+	mac := hmac.New(sha256.New, m.nonceKey)
+	mac.Write(sivAD(nil, counter, final))
+	mac.Write(plain)
+	return append(dst[:0], mac.Sum(nil)[:m.aead.NonceSize()]...)
+}
+
+// sivAD returns the additional data of a chunk in deterministic mode, binding
+// its position since the nonce no longer does
+func sivAD(dst []byte, counter uint64, final bool) []byte {
+	return binary.BigEndian.AppendUint64(append(dst[:0], chunkAD(final)...), counter)
+}
+
+// chunkNonce derives the nonce of chunk number counter from the stream's nonce prefix
+func chunkNonce(dst, prefix []byte, counter uint64) []byte {
+	dst = append(dst[:0], prefix...)
+	tail := dst[len(dst)-8:]
+	binary.BigEndian.PutUint64(tail, binary.BigEndian.Uint64(tail)^counter)
+	return dst
+}
+
+// chunkAD returns the additional data marking a chunk as final or not
+func chunkAD(final bool) []byte {
+	if final {
+		return []byte{1}
+	}
+	return []byte{0}
+}
+
+// aesgcmWriter collects plaintext into chunks and seals them
+type aesgcmWriter struct {
+	m       *aesgcmMiddleware
+	aead    cipher.AEAD
+	w       io.Writer
+	prefix  []byte
+	nonce   []byte
+	plain   []byte
+	sealed  []byte
+	counter uint64
+	err     error
+}
+
+func (w *aesgcmWriter) Write(p []byte) (n int, err error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+	if w.plain == nil {
+		w.plain = make([]byte, 0, aesgcmChunkSize)
+	}
+	for len(p) > 0 {
+		m := copy(w.plain[len(w.plain):aesgcmChunkSize], p)
+		w.plain = w.plain[:len(w.plain)+m]
+		n += m
+		p = p[m:]
+
+		if len(w.plain) == aesgcmChunkSize {
+			if err = w.seal(false); err != nil {
+				return n, err
+			}
+		}
+	}
+	return n, nil
+}
+
+// seal encrypts and writes the pending plaintext as one chunk
+func (w *aesgcmWriter) seal(final bool) error {
+	if w.m.deterministic {
+		return w.sealDeterministic(final)
+	}
+
+	if w.prefix == nil {
+		w.prefix = make([]byte, w.aead.NonceSize())
+		if _, err := rand.Read(w.prefix); err != nil {
+			w.err = err
+			return err
+		}
+		if _, err := w.w.Write(w.prefix); err != nil {
+			w.err = err
+			return err
+		}
+	}
+
+	w.nonce = chunkNonce(w.nonce, w.prefix, w.counter)
+	w.counter++
+
+	w.sealed = binary.BigEndian.AppendUint32(w.sealed[:0], uint32(len(w.plain)+w.aead.Overhead()))
+	w.sealed = w.aead.Seal(w.sealed, w.nonce, w.plain, chunkAD(final))
+	w.plain = w.plain[:0]
+
+	if _, err := w.w.Write(w.sealed); err != nil {
+		w.err = err
+		return err
+	}
+	return nil
+}
+
+// sealDeterministic encrypts and writes the pending plaintext as one chunk,
+// preceded by its nonce
+func (w *aesgcmWriter) sealDeterministic(final bool) error {
+	w.nonce = w.m.sivNonce(w.nonce, w.counter, final, w.plain)
+	ad := sivAD(nil, w.counter, final)
+	w.counter++
+
+	w.sealed = binary.BigEndian.AppendUint32(w.sealed[:0], uint32(len(w.plain)+w.aead.Overhead()))
+	w.sealed = append(w.sealed, w.nonce...)
+	w.sealed = w.aead.Seal(w.sealed, w.nonce, w.plain, ad)
+	w.plain = w.plain[:0]
+
+	if _, err := w.w.Write(w.sealed); err != nil {
+		w.err = err
+		return err
+	}
+	return nil
+}
+
+// Close writes the final chunk and closes the underlying writer
+func (w *aesgcmWriter) Close() error {
+	err := w.err
+	if err == nil {
+		err = w.seal(true)
+		w.err = errors.New("hybridbuffer: write to closed encryption stream")
+	}
+	if closer, ok := w.w.(io.Closer); ok {
+		err = errors.Join(err, closer.Close())
+	}
+	return err
+}
+
+// aesgcmReader opens sealed chunks and serves their plaintext
+type aesgcmReader struct {
+	m       *aesgcmMiddleware
+	aead    cipher.AEAD
+	r       io.Reader
+	prefix  []byte
+	nonce   []byte
+	sealed  []byte
+	opened  []byte
+	plain   []byte
+	counter uint64
+	final   bool
+	err     error
+}
+
+func (r *aesgcmReader) Read(p []byte) (int, error) {
+	for len(r.plain) == 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
+		if r.final {
+			return 0, io.EOF
+		}
+		r.err = r.open()
+	}
+
+	n := copy(p, r.plain)
+	r.plain = r.plain[n:]
+	return n, nil
+}
+
+// open reads and decrypts the next chunk
+func (r *aesgcmReader) open() error {
+	if r.prefix == nil && !r.m.deterministic {
+		r.prefix = make([]byte, r.aead.NonceSize())
+		if _, err := io.ReadFull(r.r, r.prefix); err != nil {
+			return truncated(err)
+		}
+	}
+
+	var header [4]byte
+	if _, err := io.ReadFull(r.r, header[:]); err != nil {
+		return truncated(err)
+	}
+	size := binary.BigEndian.Uint32(header[:])
+	if size < uint32(r.aead.Overhead()) || size > aesgcmChunkSize+uint32(r.aead.Overhead()) {
+		return errors.New("hybridbuffer: invalid encrypted chunk size")
+	}
+
+	if r.m.deterministic {
+		size += uint32(r.aead.NonceSize())
+	}
+	if cap(r.sealed) < int(size) {
+		r.sealed = make([]byte, size)
+	}
+	r.sealed = r.sealed[:size]
+	if _, err := io.ReadFull(r.r, r.sealed); err != nil {
+		return truncated(err)
+	}
+
+	sealed := r.sealed
+	adRegular, adFinal := chunkAD(false), chunkAD(true)
+	if r.m.deterministic {
+		r.nonce = append(r.nonce[:0], sealed[:r.aead.NonceSize()]...)
+		sealed = sealed[r.aead.NonceSize():]
+		adRegular, adFinal = sivAD(nil, r.counter, false), sivAD(nil, r.counter, true)
+	} else {
+		r.nonce = chunkNonce(r.nonce, r.prefix, r.counter)
+	}
+	r.counter++
+
+	// A chunk authenticates either as a regular or as the final chunk
+	plain, err := r.aead.Open(r.opened[:0], r.nonce, sealed, adRegular)
+	if err != nil {
+		plain, err = r.aead.Open(r.opened[:0], r.nonce, sealed, adFinal)
+		if err != nil {
+			return errors.New("hybridbuffer: decryption failed")
+		}
+		r.final = true
+	}
+	r.opened = plain
+	r.plain = plain
+	return nil
+}
+
+// truncated maps an unexpected end of the ciphertext to errCiphertextTruncated
+func truncated(err error) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return errCiphertextTruncated
+	}
+	return err
+}
+
+func (r *aesgcmReader) Close() error {
+	if closer, ok := r.r.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// errUnknownKeyID is returned when encrypted data names a key missing from the keyring
+var errUnknownKeyID = errors.New("hybridbuffer: unknown encryption key ID")
+
+// keyringMiddleware encrypts spilled data with AES-GCM under the current key of
+// a keyring, and decrypts it with whichever key it was written under
+// Each stream starts with the ID of its key, followed by the AES-GCM stream.
+type keyringMiddleware struct {
+	keys    map[byte]*aesgcmMiddleware
+	current byte
+}
+
+// newKeyringMiddleware creates the middleware for keys of 16, 24 or 32 bytes
+func newKeyringMiddleware(current byte, keys map[byte][]byte) (*keyringMiddleware, error) {
+	if _, ok := keys[current]; !ok {
+		return nil, fmt.Errorf("current key ID %d not in keyring", current)
+	}
+	m := &keyringMiddleware{keys: make(map[byte]*aesgcmMiddleware, len(keys)), current: current}
+	for id, key := range keys {
+		aead, err := newAESGCMMiddleware(key)
+		if err != nil {
+			return nil, fmt.Errorf("key ID %d: %w", id, err)
+		}
+		m.keys[id] = aead
+	}
+	return m, nil
+}
+
+// withDeterministicNonce returns a copy of the middleware in deterministic mode
+func (m *keyringMiddleware) withDeterministicNonce() *keyringMiddleware {
+	deterministic := &keyringMiddleware{keys: make(map[byte]*aesgcmMiddleware, len(m.keys)), current: m.current}
+	for id, aead := range m.keys {
+		deterministic.keys[id] = aead.withDeterministicNonce()
+	}
+	return deterministic
+}
+
+func (*keyringMiddleware) Name() string { return "aes-gcm-keyring" }
+func (*keyringMiddleware) Stage() Stage { return StageEncryption }
+
+func (m *keyringMiddleware) Writer(w io.Writer) io.Writer {
+	return m.keys[m.current].Writer(&keyIDWriter{w: w, id: m.current})
+}
+
+func (m *keyringMiddleware) Reader(r io.Reader) io.Reader {
+	return &keyringReader{m: m, underlying: r}
+}
+
+// keyIDWriter writes the key ID before the first data
+type keyIDWriter struct {
+	w       io.Writer
+	id      byte
+	written bool
+}
+
+func (w *keyIDWriter) Write(p []byte) (int, error) {
+	if !w.written {
+		if _, err := w.w.Write([]byte{w.id}); err != nil {
+			return 0, err
+		}
+		w.written = true
+	}
+	return w.w.Write(p)
+}
+
+func (w *keyIDWriter) Close() error {
+	if closer, ok := w.w.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// keyringReader defers reading the key ID to the first Read
+type keyringReader struct {
+	m          *keyringMiddleware
+	underlying io.Reader
+	r          io.Reader
+	err        error
+}
+
+func (r *keyringReader) Read(p []byte) (int, error) {
+	if r.r == nil && r.err == nil {
+		var id [1]byte
+		if _, err := io.ReadFull(r.underlying, id[:]); err != nil {
+			r.err = truncated(err)
+		} else if aead, ok := r.m.keys[id[0]]; !ok {
+			r.err = fmt.Errorf("%w %d", errUnknownKeyID, id[0])
+		} else {
+			r.r = aead.Reader(r.underlying)
+		}
+	}
+	if r.err != nil {
+		return 0, r.err
+	}
+	return r.r.Read(p)
+}
+
+func (r *keyringReader) Close() error {
+	if closer, ok := r.underlying.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
@@ -0,0 +1,42 @@
+package hybridbuffer
+
+// Mark is a position in the written data returned by Checkpoint
+type Mark struct {
+	buf   *hybridBuffer
+	epoch uint64
+	size  int64 // Total bytes written, including bytes dropped by compaction
+}
+
+// Checkpoint returns a mark of the data written so far, for Rollback
+func (b *hybridBuffer) Checkpoint() Mark {
+	b.mu.Lock()
+	defer b.unlock()
+
+	return Mark{buf: b, epoch: b.epoch, size: b.compacted + int64(b.size)}
+}
+
+// Rollback discards everything written since m was created by Checkpoint
+// The read position is kept, clamped to the new end. In memory mode this is a
+// cheap length reset; in storage mode the kept data is copied into a new storage
+// object, like Truncate does. Marks stay valid across spills and nested
+// rollbacks, but not across Reset or Close, or once compaction dropped data
+// before the mark; Rollback returns ErrInvalidMark then.
+func (b *hybridBuffer) Rollback(m Mark) error {
+	b.mu.Lock()
+	defer b.unlock()
+
+	if b.closed {
+		return ErrClosed
+	}
+	if b.readOnly {
+		return ErrReadOnly
+	}
+	n := m.size - b.compacted
+	if m.buf != b || m.epoch != b.epoch || n < 0 || n > int64(b.size) {
+		return ErrInvalidMark
+	}
+	if n == int64(b.size) {
+		return nil
+	}
+	return b.truncate(int(n))
+}
@@ -0,0 +1,68 @@
+package hybridbuffer
+
+import (
+	"bytes"
+	"io"
+)
+
+// compareChunkSize is the number of bytes compared at a time by Equal
+const compareChunkSize = 32 << 10
+
+// Equal reports whether the unread contents of b and other are equal
+// Neither buffer is consumed. Both are streamed and compared chunk by chunk, so
+// spilled buffers are not loaded into memory, and comparison stops at the first
+// difference; buffers of different length are not read at all.
+func (b *hybridBuffer) Equal(other Buffer) (bool, error) {
+	r1, n1, err := b.unreadReader()
+	if err != nil {
+		return false, err
+	}
+	defer r1.Close()
+
+	r2, n2, err := unreadReaderOf(other)
+	if err != nil {
+		return false, err
+	}
+	defer r2.Close()
+
+	if n1 != n2 {
+		return false, nil
+	}
+
+	chunk1 := make([]byte, min(n1, compareChunkSize))
+	chunk2 := make([]byte, len(chunk1))
+	for left := n1; left > 0; {
+		n := min(left, len(chunk1))
+		if _, err := io.ReadFull(r1, chunk1[:n]); err != nil {
+			return false, err
+		}
+		if _, err := io.ReadFull(r2, chunk2[:n]); err != nil {
+			return false, err
+		}
+		if !bytes.Equal(chunk1[:n], chunk2[:n]) {
+			return false, nil
+		}
+		left -= n
+	}
+	return true, nil
+}
+
+// unreadReaderOf returns a reader over the unread contents of any Buffer
+// Implementations other than this package's, e.g. types embedding a Buffer, are
+// read through NewReadSeeker, positioned at the last Len() bytes.
+func unreadReaderOf(buf Buffer) (io.ReadCloser, int, error) {
+	if b, ok := buf.(*hybridBuffer); ok {
+		return b.unreadReader()
+	}
+
+	r, err := buf.NewReadSeeker()
+	if err != nil {
+		return nil, 0, err
+	}
+	unread := buf.Len()
+	if _, err := r.Seek(-int64(unread), io.SeekEnd); err != nil {
+		r.Close()
+		return nil, 0, err
+	}
+	return r, unread, nil
+}
@@ -0,0 +1,107 @@
+package hybridbuffer
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+func TestEqual(t *testing.T) {
+	data := bytes.Repeat([]byte("0123456789"), 10000) // Several compare chunks
+	different := bytes.Clone(data)
+	different[len(different)-1] = 'x'
+
+	modes := []struct {
+		name      string
+		threshold int
+	}{
+		{"memory", 1 << 20},
+		{"storage", 16},
+	}
+
+	for _, m1 := range modes {
+		for _, m2 := range modes {
+			t.Run(m1.name+"/"+m2.name, func(t *testing.T) {
+				tests := []struct {
+					name  string
+					other []byte
+					want  bool
+				}{
+					{"equal", data, true},
+					{"different length", data[:len(data)-1], false},
+					{"different content", different, false},
+				}
+
+				for _, tt := range tests {
+					b1 := NewFromBytes(data, WithThreshold(m1.threshold))
+					b2 := NewFromBytes(tt.other, WithThreshold(m2.threshold))
+
+					got, err := b1.Equal(b2)
+					if err != nil {
+						t.Fatalf("%s: Equal failed: %v", tt.name, err)
+					}
+					if got != tt.want {
+						t.Fatalf("%s: expected %v, got %v", tt.name, tt.want, got)
+					}
+
+					// Neither buffer is consumed
+					if b1.Len() != len(data) || b2.Len() != len(tt.other) {
+						t.Fatalf("%s: Equal consumed a buffer", tt.name)
+					}
+					b1.Close()
+					b2.Close()
+				}
+			})
+		}
+	}
+}
+
+func TestEqual_ComparesUnreadContents(t *testing.T) {
+	for _, threshold := range []int{1024, 4} {
+		b1 := NewFromBytes([]byte("prefix-payload"), WithThreshold(threshold))
+		defer b1.Close()
+		b2 := NewFromBytes([]byte("payload"), WithThreshold(threshold))
+		defer b2.Close()
+
+		b1.Next(len("prefix-"))
+		if equal, err := b1.Equal(b2); err != nil || !equal {
+			t.Fatalf("Threshold %d: expected equal unread contents, got %v, %v", threshold, equal, err)
+		}
+
+		// The read offset is unchanged
+		if got, _ := io.ReadAll(b1); string(got) != "payload" {
+			t.Fatalf("Threshold %d: expected the rest after Equal, got %q", threshold, got)
+		}
+	}
+}
+
+// embeddedBuffer is a Buffer implementation outside of this package's type
+type embeddedBuffer struct {
+	Buffer
+}
+
+func TestEqual_OtherImplementation(t *testing.T) {
+	b1 := NewFromBytes([]byte("payload"))
+	defer b1.Close()
+	b2 := embeddedBuffer{NewFromBytes([]byte("xxpayload"), WithThreshold(4))}
+	defer b2.Close()
+
+	b2.Next(2)
+	if equal, err := b1.Equal(b2); err != nil || !equal {
+		t.Fatalf("Expected equal contents, got %v, %v", equal, err)
+	}
+}
+
+func TestEqual_Closed(t *testing.T) {
+	b1 := New()
+	b2 := New()
+	b2.Close()
+
+	if _, err := b1.Equal(b2); err != ErrClosed {
+		t.Fatalf("Expected ErrClosed, got %v", err)
+	}
+	b1.Close()
+	if _, err := b1.Equal(New()); err != ErrClosed {
+		t.Fatalf("Expected ErrClosed, got %v", err)
+	}
+}
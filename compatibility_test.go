@@ -285,9 +285,10 @@ func TestCompatibility_LenAndCap(t *testing.T) {
 			t.Fatalf("Len mismatch for size %d: std=%d, hybrid=%d", size, stdBuf.Len(), hybridBuf.Len())
 		}
 
-		// Compare Cap (HybridBuffer returns Len for compatibility)
-		if stdBuf.Cap() < hybridBuf.Cap() { // std might have higher cap
-			// This is ok - HybridBuffer returns Len, std Buffer might have allocated more
+		// Cap never reports less than Len, like bytes.Buffer
+		if stdBuf.Cap() < stdBuf.Len() || hybridBuf.Cap() < hybridBuf.Len() {
+			t.Fatalf("Cap below Len for size %d: std=%d/%d, hybrid=%d/%d",
+				size, stdBuf.Cap(), stdBuf.Len(), hybridBuf.Cap(), hybridBuf.Len())
 		}
 
 		// Read some data and compare again
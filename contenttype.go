@@ -0,0 +1,32 @@
+package hybridbuffer
+
+import (
+	"io"
+	"net/http"
+)
+
+// sniffLen is the number of bytes http.DetectContentType considers
+const sniffLen = 512
+
+// DetectContentType returns the MIME type of the unread contents as determined
+// by http.DetectContentType, e.g. to set the Content-Type of a response
+// Only the first 512 unread bytes are examined, and the buffer is not consumed,
+// so the whole body can still be served. An empty buffer is reported as
+// "application/octet-stream".
+func (b *hybridBuffer) DetectContentType() (string, error) {
+	r, _, err := b.unreadReader()
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+
+	head := make([]byte, sniffLen)
+	n, err := io.ReadFull(r, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return "", err
+	}
+	if n == 0 {
+		return "application/octet-stream", nil
+	}
+	return http.DetectContentType(head[:n]), nil
+}
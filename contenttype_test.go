@@ -0,0 +1,57 @@
+package hybridbuffer
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io"
+	"testing"
+)
+
+// onePixelPNG is a minimal 1x1 PNG image
+const onePixelPNG = "iVBORw0KGgoAAAANSUhEUgAAAAEAAAABCAYAAAAfFcSJAAAADUlEQVR42mNk+M9QDwADhgGAWjR9awAAAABJRU5ErkJggg=="
+
+func TestDetectContentType(t *testing.T) {
+	png, _ := base64.StdEncoding.DecodeString(onePixelPNG)
+
+	tests := []struct {
+		name string
+		data []byte
+		want string
+	}{
+		{"html", []byte("<!DOCTYPE html><html><body>hello</body></html>"), "text/html; charset=utf-8"},
+		{"png", png, "image/png"},
+		{"text", []byte("just some plain text"), "text/plain; charset=utf-8"},
+		{"large text", bytes.Repeat([]byte("text "), 1000), "text/plain; charset=utf-8"},
+		{"empty", nil, "application/octet-stream"},
+	}
+
+	for _, tt := range tests {
+		for _, threshold := range []int{1 << 20, 16} {
+			buf := NewFromBytes(tt.data, WithThreshold(threshold))
+
+			got, err := buf.DetectContentType()
+			if err != nil {
+				t.Fatalf("%s, threshold %d: DetectContentType failed: %v", tt.name, threshold, err)
+			}
+			if got != tt.want {
+				t.Fatalf("%s, threshold %d: expected %q, got %q", tt.name, threshold, tt.want, got)
+			}
+
+			// The whole body can still be served
+			if body, _ := io.ReadAll(buf); !bytes.Equal(body, tt.data) {
+				t.Fatalf("%s, threshold %d: DetectContentType consumed the buffer", tt.name, threshold)
+			}
+			buf.Close()
+		}
+	}
+}
+
+func TestDetectContentType_UnreadContents(t *testing.T) {
+	buf := NewFromString("plain prefix <html><body>page</body></html>", WithThreshold(8))
+	defer buf.Close()
+
+	buf.Next(len("plain prefix "))
+	if got, _ := buf.DetectContentType(); got != "text/html; charset=utf-8" {
+		t.Fatalf("Expected the unread contents to be sniffed, got %q", got)
+	}
+}
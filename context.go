@@ -0,0 +1,121 @@
+package hybridbuffer
+
+import (
+	"context"
+	"io"
+
+	"schneider.vip/hybridbuffer/storage"
+)
+
+// ContextBackend is an optional interface for storage backends that support cancellation
+// Backends talking to remote services should implement it, so that a buffer created
+// with WithContext can abort a hanging Create, Open or Remove. Backends without it
+// keep working through the context-free storage.Backend methods.
+type ContextBackend interface {
+	storage.Backend
+
+	CreateContext(ctx context.Context) (io.WriteCloser, error)
+	OpenContext(ctx context.Context) (io.ReadCloser, error)
+	RemoveContext(ctx context.Context) error
+}
+
+// createStorage creates a write stream on backend, honouring the buffer's context
+func (b *hybridBuffer) createStorage(backend storage.Backend) (_ io.WriteCloser, err error) {
+	if b.tracer != nil {
+		end := b.startSpan(spanCreate, backend, -1)
+		defer func() { end(err) }()
+	}
+	if b.ctx == nil {
+		return backend.Create()
+	}
+	if err := b.ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	var writeStream io.WriteCloser
+	if cb, ok := backend.(ContextBackend); ok {
+		writeStream, err = cb.CreateContext(b.spanContext())
+	} else {
+		writeStream, err = backend.Create()
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &contextWriter{ctx: b.ctx, WriteCloser: writeStream}, nil
+}
+
+// openStorage opens a read stream on the current backend, honouring the buffer's context
+func (b *hybridBuffer) openStorage() (_ io.ReadCloser, err error) {
+	if b.tracer != nil {
+		end := b.startSpan(spanOpen, b.storageBackend, int64(b.size))
+		defer func() { end(err) }()
+	}
+	if b.ctx == nil {
+		return b.storageBackend.Open()
+	}
+	if err := b.ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	var readStream io.ReadCloser
+	if cb, ok := b.storageBackend.(ContextBackend); ok {
+		readStream, err = cb.OpenContext(b.spanContext())
+	} else {
+		readStream, err = b.storageBackend.Open()
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &contextReader{ctx: b.ctx, ReadCloser: readStream}, nil
+}
+
+// deleteStorage removes backend's storage object
+// Cleanup must not be skipped just because the context was cancelled, so the
+// backend receives a context that keeps the values but not the cancellation.
+func (b *hybridBuffer) deleteStorage(backend storage.Backend) (err error) {
+	if b.tracer != nil {
+		end := b.startSpan(spanRemove, backend, -1)
+		defer func() { end(err) }()
+	}
+	if cb, ok := backend.(ContextBackend); ok && b.ctx != nil {
+		return cb.RemoveContext(context.WithoutCancel(b.spanContext()))
+	}
+	return backend.Remove()
+}
+
+// contextWriter fails writes once its context is done
+type contextWriter struct {
+	ctx context.Context
+	io.WriteCloser
+}
+
+func (w *contextWriter) Write(p []byte) (int, error) {
+	if err := w.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return w.WriteCloser.Write(p)
+}
+
+// Sync forwards to the storage stream if it implements Syncer
+func (w *contextWriter) Sync() error {
+	if err := w.ctx.Err(); err != nil {
+		return err
+	}
+	if syncer, ok := w.WriteCloser.(Syncer); ok {
+		return syncer.Sync()
+	}
+	return nil
+}
+
+// contextReader fails reads once its context is done
+type contextReader struct {
+	ctx context.Context
+	io.ReadCloser
+}
+
+func (r *contextReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.ReadCloser.Read(p)
+}
@@ -0,0 +1,172 @@
+package hybridbuffer
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// KeyProvider supplies data keys for envelope encryption, e.g. backed by a KMS
+// DataKey returns a fresh 16, 24 or 32 byte data key along with its wrapped
+// (encrypted) form, which is stored with the data. Unwrap recovers the data key
+// from its wrapped form when the data is read back.
+type KeyProvider interface {
+	DataKey(ctx context.Context) (plaintext, wrapped []byte, err error)
+	Unwrap(ctx context.Context, wrapped []byte) (plaintext []byte, err error)
+}
+
+// StaticKeyProvider returns a KeyProvider that always uses key and stores no
+// wrapped key, e.g. for tests
+func StaticKeyProvider(key []byte) KeyProvider {
+	return staticKeyProvider(key)
+}
+
+type staticKeyProvider []byte
+
+func (p staticKeyProvider) DataKey(context.Context) ([]byte, []byte, error) {
+	return p, nil, nil
+}
+
+func (p staticKeyProvider) Unwrap(context.Context, []byte) ([]byte, error) {
+	return p, nil
+}
+
+// maxWrappedKeySize is the largest wrapped key a stream header can hold
+const maxWrappedKeySize = 1<<16 - 1
+
+// envelopeMiddleware encrypts each spilled stream with AES-GCM under its own data key
+// Each stream starts with the length of the wrapped data key and the wrapped key
+// itself, followed by the AES-GCM stream.
+type envelopeMiddleware struct {
+	provider      KeyProvider
+	ctx           context.Context
+	deterministic bool
+}
+
+func (*envelopeMiddleware) Name() string { return "aes-gcm-envelope" }
+func (*envelopeMiddleware) Stage() Stage { return StageEncryption }
+
+// aead creates the AES-GCM middleware for a data key
+func (m *envelopeMiddleware) aead(key []byte) (*aesgcmMiddleware, error) {
+	aead, err := newAESGCMMiddleware(key)
+	if err != nil {
+		return nil, fmt.Errorf("hybridbuffer: invalid data key: %w", err)
+	}
+	if m.deterministic {
+		aead = aead.withDeterministicNonce()
+	}
+	return aead, nil
+}
+
+func (m *envelopeMiddleware) Writer(w io.Writer) io.Writer {
+	return &envelopeWriter{m: m, underlying: w}
+}
+
+func (m *envelopeMiddleware) Reader(r io.Reader) io.Reader {
+	return &envelopeReader{m: m, underlying: r}
+}
+
+// envelopeWriter defers fetching the data key to the first Write
+type envelopeWriter struct {
+	m          *envelopeMiddleware
+	underlying io.Writer
+	w          io.Writer
+	err        error
+}
+
+// init fetches a data key and writes the stream header
+func (w *envelopeWriter) init() error {
+	key, wrapped, err := w.m.provider.DataKey(w.m.ctx)
+	if err != nil {
+		return fmt.Errorf("hybridbuffer: failed to get data key: %w", err)
+	}
+	if len(wrapped) > maxWrappedKeySize {
+		return fmt.Errorf("hybridbuffer: wrapped data key too large: %d bytes", len(wrapped))
+	}
+	aead, err := w.m.aead(key)
+	if err != nil {
+		return err
+	}
+
+	header := binary.BigEndian.AppendUint16(nil, uint16(len(wrapped)))
+	if _, err := w.underlying.Write(append(header, wrapped...)); err != nil {
+		return err
+	}
+	w.w = aead.Writer(w.underlying)
+	return nil
+}
+
+func (w *envelopeWriter) Write(p []byte) (int, error) {
+	if w.w == nil && w.err == nil {
+		w.err = w.init()
+	}
+	if w.err != nil {
+		return 0, w.err
+	}
+	return w.w.Write(p)
+}
+
+// Close finishes the encrypted stream and closes the underlying writer
+// An empty stream still gets a header and a final chunk.
+func (w *envelopeWriter) Close() error {
+	if w.w == nil && w.err == nil {
+		w.err = w.init()
+	}
+	if w.err != nil {
+		if closer, ok := w.underlying.(io.Closer); ok {
+			return errors.Join(w.err, closer.Close())
+		}
+		return w.err
+	}
+	return w.w.(io.Closer).Close()
+}
+
+// envelopeReader defers unwrapping the data key to the first Read
+type envelopeReader struct {
+	m          *envelopeMiddleware
+	underlying io.Reader
+	r          io.Reader
+	err        error
+}
+
+// init reads the stream header and unwraps the data key
+func (r *envelopeReader) init() error {
+	var header [2]byte
+	if _, err := io.ReadFull(r.underlying, header[:]); err != nil {
+		return truncated(err)
+	}
+	wrapped := make([]byte, binary.BigEndian.Uint16(header[:]))
+	if _, err := io.ReadFull(r.underlying, wrapped); err != nil {
+		return truncated(err)
+	}
+
+	key, err := r.m.provider.Unwrap(r.m.ctx, wrapped)
+	if err != nil {
+		return fmt.Errorf("hybridbuffer: failed to unwrap data key: %w", err)
+	}
+	aead, err := r.m.aead(key)
+	if err != nil {
+		return err
+	}
+	r.r = aead.Reader(r.underlying)
+	return nil
+}
+
+func (r *envelopeReader) Read(p []byte) (int, error) {
+	if r.r == nil && r.err == nil {
+		r.err = r.init()
+	}
+	if r.err != nil {
+		return 0, r.err
+	}
+	return r.r.Read(p)
+}
+
+func (r *envelopeReader) Close() error {
+	if closer, ok := r.underlying.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
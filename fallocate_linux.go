@@ -0,0 +1,32 @@
+//go:build linux
+
+package hybridbuffer
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// fallocKeepSize is FALLOC_FL_KEEP_SIZE: allocate blocks without changing the file size
+const fallocKeepSize = 0x1
+
+// allocateFile reserves disk space for size bytes of f without changing its size
+// Filesystems that cannot preallocate are not an error, the space is then
+// allocated by the writes as usual.
+func allocateFile(f *os.File, size int64) error {
+	conn, err := f.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var allocErr error
+	if err := conn.Control(func(fd uintptr) {
+		allocErr = syscall.Fallocate(int(fd), fallocKeepSize, 0, size)
+	}); err != nil {
+		return err
+	}
+	if errors.Is(allocErr, syscall.EOPNOTSUPP) || errors.Is(allocErr, syscall.ENOSYS) {
+		return nil
+	}
+	return allocErr
+}
@@ -0,0 +1,33 @@
+package hybridbuffer
+
+import (
+	"os"
+	"syscall"
+	"testing"
+
+	"schneider.vip/hybridbuffer/storage/filesystem"
+)
+
+func TestHybridBuffer_GrowAllocatesFile(t *testing.T) {
+	dir := t.TempDir()
+	buf := New(WithThreshold(8), WithStorage(filesystem.New(filesystem.WithTempDir(dir))))
+	defer buf.Close()
+
+	buf.WriteString("data")
+	buf.Grow(1 << 20)
+
+	path, ok := buf.StoragePath()
+	if !ok {
+		t.Fatal("Expected Grow to spill to a file")
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Stat failed: %v", err)
+	}
+	if fi.Size() != 4 {
+		t.Fatalf("Expected the file size to stay 4, got %d", fi.Size())
+	}
+	if blocks := fi.Sys().(*syscall.Stat_t).Blocks; blocks*512 < 1<<20 {
+		t.Fatalf("Expected at least 1 MiB allocated, got %d bytes", blocks*512)
+	}
+}
@@ -0,0 +1,12 @@
+//go:build !linux
+
+package hybridbuffer
+
+import "os"
+
+// allocateFile reserves disk space for size bytes of f without changing its size
+// Preallocation is only implemented on Linux; elsewhere the space is allocated
+// by the writes as usual.
+func allocateFile(f *os.File, size int64) error {
+	return nil
+}
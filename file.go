@@ -0,0 +1,98 @@
+package hybridbuffer
+
+import (
+	"io"
+	"io/fs"
+	"time"
+)
+
+// AsFile exposes the full contents of the buffer as an fs.File named name
+// The file reads through an independent reader (see NewReadSeeker), so it does not
+// consume the buffer, and Stat reports the full contents rather than the unread
+// remainder. Data released by Compact is not part of the file.
+// The file also implements io.Seeker, so http.FileServer can serve it through
+// http.FS. This allows buffers to back entries of an fs.FS while large contents
+// stay spilled. After Close, Read and Seek fail with fs.ErrClosed.
+func (b *hybridBuffer) AsFile(name string) fs.File {
+	return &bufferFile{buf: b, name: name, modTime: time.Now()}
+}
+
+// bufferFile implements fs.File and io.Seeker over a hybrid buffer
+type bufferFile struct {
+	buf     *hybridBuffer
+	name    string
+	modTime time.Time
+	reader  io.ReadSeekCloser // Opened on first use
+	closed  bool
+}
+
+// Stat implements fs.File
+// The size is that of the file's contents, which excludes data released by Compact.
+func (f *bufferFile) Stat() (fs.FileInfo, error) {
+	f.buf.mu.Lock()
+	size := int64(f.buf.size)
+	f.buf.unlock()
+	return &bufferFileInfo{name: f.name, size: size, modTime: f.modTime}, nil
+}
+
+// open returns the file's reader, opening it on first use
+func (f *bufferFile) open(op string) (io.ReadSeekCloser, error) {
+	if f.closed {
+		return nil, &fs.PathError{Op: op, Path: f.name, Err: fs.ErrClosed}
+	}
+	if f.reader == nil {
+		reader, err := f.buf.NewReadSeeker()
+		if err != nil {
+			return nil, &fs.PathError{Op: op, Path: f.name, Err: err}
+		}
+		f.reader = reader
+	}
+	return f.reader, nil
+}
+
+// Read implements fs.File
+func (f *bufferFile) Read(p []byte) (int, error) {
+	reader, err := f.open("read")
+	if err != nil {
+		return 0, err
+	}
+	return reader.Read(p)
+}
+
+// Seek implements io.Seeker
+func (f *bufferFile) Seek(offset int64, whence int) (int64, error) {
+	reader, err := f.open("seek")
+	if err != nil {
+		return 0, err
+	}
+	return reader.Seek(offset, whence)
+}
+
+// Close implements fs.File
+// It only closes the file's reader, the buffer itself stays untouched.
+func (f *bufferFile) Close() error {
+	if f.closed {
+		return &fs.PathError{Op: "close", Path: f.name, Err: fs.ErrClosed}
+	}
+	f.closed = true
+	if f.reader == nil {
+		return nil
+	}
+	err := f.reader.Close()
+	f.reader = nil
+	return err
+}
+
+// bufferFileInfo implements fs.FileInfo for a bufferFile
+type bufferFileInfo struct {
+	name    string
+	size    int64
+	modTime time.Time
+}
+
+func (fi *bufferFileInfo) Name() string       { return fi.name }
+func (fi *bufferFileInfo) Size() int64        { return fi.size }
+func (fi *bufferFileInfo) Mode() fs.FileMode  { return 0o444 }
+func (fi *bufferFileInfo) ModTime() time.Time { return fi.modTime }
+func (fi *bufferFileInfo) IsDir() bool        { return false }
+func (fi *bufferFileInfo) Sys() any           { return nil }
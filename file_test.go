@@ -0,0 +1,116 @@
+package hybridbuffer
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// bufferFS serves buffers as files of an fs.FS
+type bufferFS map[string]Buffer
+
+func (m bufferFS) Open(name string) (fs.File, error) {
+	buf, ok := m[name]
+	if !ok {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	return buf.AsFile(name), nil
+}
+
+func TestAsFile(t *testing.T) {
+	tests := []struct {
+		name      string
+		threshold int
+	}{
+		{"memory", 1024},
+		{"storage", 4},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf := NewFromString("<html>template</html>", WithThreshold(tt.threshold))
+			defer buf.Close()
+
+			// Consumed data is still part of the file
+			buf.Read(make([]byte, 6))
+
+			fsys := bufferFS{"index.html": buf}
+			info, err := fs.Stat(fsys, "index.html")
+			if err != nil {
+				t.Fatalf("Stat failed: %v", err)
+			}
+			if info.Size() != 21 || info.Name() != "index.html" || info.IsDir() {
+				t.Fatalf("Unexpected file info: name=%q size=%d dir=%v", info.Name(), info.Size(), info.IsDir())
+			}
+
+			for i := 0; i < 2; i++ {
+				data, err := fs.ReadFile(fsys, "index.html")
+				if err != nil {
+					t.Fatalf("ReadFile failed: %v", err)
+				}
+				if string(data) != "<html>template</html>" {
+					t.Fatalf("Expected full contents, got %q", string(data))
+				}
+			}
+
+			// Reading the file does not consume the buffer
+			if buf.Len() != 15 {
+				t.Fatalf("Expected Len() 15, got %d", buf.Len())
+			}
+		})
+	}
+}
+
+func TestAsFile_ReadAfterClose(t *testing.T) {
+	buf := NewFromString("hello world", WithThreshold(4))
+	defer buf.Close()
+
+	file := buf.AsFile("hello.txt")
+	if _, err := io.ReadAll(file); err != nil {
+		t.Fatalf("ReadAll failed: %v", err)
+	}
+	if err := file.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	n, err := file.Read(make([]byte, 5))
+	if n != 0 || !errors.Is(err, fs.ErrClosed) {
+		t.Fatalf("Expected 0, fs.ErrClosed after Close, got %d, %v", n, err)
+	}
+	if _, err := file.(io.Seeker).Seek(0, io.SeekStart); !errors.Is(err, fs.ErrClosed) {
+		t.Fatalf("Expected fs.ErrClosed from Seek after Close, got %v", err)
+	}
+	if err := file.Close(); !errors.Is(err, fs.ErrClosed) {
+		t.Fatalf("Expected fs.ErrClosed from second Close, got %v", err)
+	}
+}
+
+func TestAsFile_FileServer(t *testing.T) {
+	buf := NewFromString("<html>template</html>", WithThreshold(4))
+	defer buf.Close()
+
+	server := httptest.NewServer(http.FileServer(http.FS(bufferFS{"template.html": buf})))
+	defer server.Close()
+
+	req, err := http.NewRequest(http.MethodGet, server.URL+"/template.html", nil)
+	if err != nil {
+		t.Fatalf("NewRequest failed: %v", err)
+	}
+	req.Header.Set("Range", "bytes=6-13")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("Reading body failed: %v", err)
+	}
+	if resp.StatusCode != http.StatusPartialContent || string(body) != "template" {
+		t.Fatalf("Expected 206 with %q, got %d with %q", "template", resp.StatusCode, string(body))
+	}
+}
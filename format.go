@@ -0,0 +1,72 @@
+package hybridbuffer
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// ErrFormatMismatch is returned when stored data written with WithFormatHeader
+// does not match the buffer's configuration, or has no valid header
+var ErrFormatMismatch = errors.New("hybridbuffer: stored data format mismatch")
+
+// formatMagic starts the header of stored data written with WithFormatHeader
+const formatMagic = "HBUF"
+
+// formatVersion is the version of the header layout
+const formatVersion = 1
+
+// formatHeaderBytes returns the header written in front of stored data
+// Layout: magic (4) | version (1) | descriptor length (2, big-endian) | descriptor,
+// where the descriptor lists the middleware names in write order, comma-separated.
+func (b *hybridBuffer) formatHeaderBytes() []byte {
+	names := make([]string, len(b.middlewares))
+	for i, m := range b.middlewares {
+		names[i] = middlewareName(m)
+	}
+	descriptor := strings.Join(names, ",")
+
+	header := append([]byte(formatMagic), formatVersion)
+	header = binary.BigEndian.AppendUint16(header, uint16(len(descriptor)))
+	return append(header, descriptor...)
+}
+
+// checkFormatHeader reads the header from a raw storage stream and validates it
+// against the buffer's configuration
+func (b *hybridBuffer) checkFormatHeader(r io.Reader) error {
+	var fixed [len(formatMagic) + 3]byte
+	if _, err := io.ReadFull(r, fixed[:]); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return fmt.Errorf("%w: missing header", ErrFormatMismatch)
+		}
+		return err
+	}
+	if string(fixed[:len(formatMagic)]) != formatMagic {
+		return fmt.Errorf("%w: missing header", ErrFormatMismatch)
+	}
+	if version := fixed[len(formatMagic)]; version != formatVersion {
+		return fmt.Errorf("%w: unsupported version %d", ErrFormatMismatch, version)
+	}
+
+	descriptor := make([]byte, binary.BigEndian.Uint16(fixed[len(formatMagic)+1:]))
+	if _, err := io.ReadFull(r, descriptor); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return fmt.Errorf("%w: truncated header", ErrFormatMismatch)
+		}
+		return err
+	}
+	if want := b.formatHeaderBytes()[len(fixed):]; string(descriptor) != string(want) {
+		return fmt.Errorf("%w: written with middlewares %q, configured %q", ErrFormatMismatch, descriptor, want)
+	}
+	return nil
+}
+
+// formatHeaderLen returns the number of bytes in front of the stored data
+func (b *hybridBuffer) formatHeaderLen() int64 {
+	if !b.formatHeader {
+		return 0
+	}
+	return int64(len(b.formatHeaderBytes()))
+}
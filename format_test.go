@@ -0,0 +1,74 @@
+package hybridbuffer
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+
+	"schneider.vip/hybridbuffer/storage"
+)
+
+func TestWithFormatHeader(t *testing.T) {
+	data := bytes.Repeat([]byte("framed "), 1000)
+
+	backend := &mockStorageBackend{}
+	buf := New(
+		WithThreshold(16),
+		WithFormatHeader(),
+		WithMiddleware(xorMiddleware{}),
+		WithStorage(func() storage.Backend { return backend }),
+	)
+	buf.Write(data)
+	if got := buf.Bytes(); !bytes.Equal(got, data) {
+		t.Fatal("Round trip with format header failed")
+	}
+	if !bytes.HasPrefix(backend.data, []byte(formatMagic)) {
+		t.Fatalf("Expected stored data to start with %q, got %q", formatMagic, backend.data[:8])
+	}
+
+	// Same configuration reads the stored data
+	same := AttachStorage(func() storage.Backend { return backend }, int64(len(data)),
+		WithFormatHeader(), WithMiddleware(xorMiddleware{}))
+	if got := same.Bytes(); !bytes.Equal(got, data) {
+		t.Fatal("Failed to read stored data with the same configuration")
+	}
+
+	// A different middleware configuration is rejected
+	other := AttachStorage(func() storage.Backend { return backend }, int64(len(data)), WithFormatHeader())
+	if _, err := other.NewReader(); !errors.Is(err, ErrFormatMismatch) {
+		t.Fatalf("Expected ErrFormatMismatch, got %v", err)
+	}
+}
+
+func TestWithFormatHeader_MissingHeader(t *testing.T) {
+	backend := &mockStorageBackend{data: []byte("raw data without a header")}
+	buf := AttachStorage(func() storage.Backend { return backend }, int64(len(backend.data)), WithFormatHeader())
+
+	if _, err := buf.ReadByte(); !errors.Is(err, ErrFormatMismatch) {
+		t.Fatalf("Expected ErrFormatMismatch, got %v", err)
+	}
+}
+
+func TestWithFormatHeader_ReadSeekerAndWriteAt(t *testing.T) {
+	data := []byte("0123456789abcdefghij")
+	backend := &tempFileBackend{dir: t.TempDir()}
+	buf := New(WithThreshold(4), WithFormatHeader(), WithStorage(func() storage.Backend { return backend }))
+	defer buf.Close()
+
+	buf.Write(data)
+	if _, err := buf.WriteAt([]byte("XY"), 2); err != nil {
+		t.Fatalf("WriteAt failed: %v", err)
+	}
+
+	rs, err := buf.NewReadSeeker()
+	if err != nil {
+		t.Fatalf("NewReadSeeker failed: %v", err)
+	}
+	defer rs.Close()
+	rs.Seek(1, io.SeekStart)
+	got, _ := io.ReadAll(rs)
+	if want := "1XY456789abcdefghij"; string(got) != want {
+		t.Fatalf("Expected %q, got %q", want, got)
+	}
+}
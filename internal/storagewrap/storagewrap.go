@@ -0,0 +1,71 @@
+// Package storagewrap holds helpers shared by the storage backends that wrap
+// other backends, such as the retry, tiered and mirror backends
+package storagewrap
+
+import (
+	"errors"
+	"io"
+	"os"
+
+	"schneider.vip/hybridbuffer/storage"
+)
+
+// OpenAt opens the object of backend at off, through its OpenAt method if it has
+// one, otherwise by seeking the stream or discarding the data before off
+func OpenAt(backend storage.Backend, off int64) (io.ReadCloser, error) {
+	if opener, ok := backend.(interface {
+		OpenAt(off int64) (io.ReadCloser, error)
+	}); ok {
+		return opener.OpenAt(off)
+	}
+
+	r, err := backend.Open()
+	if err != nil || off == 0 {
+		return r, err
+	}
+	if seeker, ok := r.(io.Seeker); ok {
+		_, err = seeker.Seek(off, io.SeekStart)
+	} else {
+		_, err = io.CopyN(io.Discard, r, off)
+	}
+	if err != nil {
+		r.Close()
+		return nil, err
+	}
+	return r, nil
+}
+
+// FileName returns the name of w if it is an *os.File, as returned by the Create
+// method of the filesystem backend, or ""
+func FileName(w io.Writer) string {
+	if f, ok := w.(*os.File); ok {
+		return f.Name()
+	}
+	return ""
+}
+
+// Size returns the stored size of backend through its Size method if it has one,
+// otherwise by stating file, the name of the file the object was written to
+// It returns errors.ErrUnsupported if neither is available.
+func Size(backend storage.Backend, file string) (int64, error) {
+	if sizer, ok := backend.(interface{ Size() (int64, error) }); ok {
+		return sizer.Size()
+	}
+	if file == "" {
+		return 0, errors.ErrUnsupported
+	}
+	info, err := os.Stat(file)
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
+
+// Path returns the file path of backend through its Path method if it has one,
+// otherwise file, the name of the file the object was written to, which may be ""
+func Path(backend storage.Backend, file string) string {
+	if provider, ok := backend.(interface{ Path() string }); ok {
+		return provider.Path()
+	}
+	return file
+}
@@ -0,0 +1,61 @@
+package storagewrap_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"schneider.vip/hybridbuffer/internal/storagewrap"
+)
+
+// memoryBackend keeps data in memory and has no optional methods
+type memoryBackend struct {
+	data []byte
+}
+
+func (m *memoryBackend) Create() (io.WriteCloser, error) { return nil, errors.ErrUnsupported }
+func (m *memoryBackend) Open() (io.ReadCloser, error) {
+	return io.NopCloser(bytes.NewReader(m.data)), nil
+}
+func (m *memoryBackend) Remove() error { return nil }
+
+func TestOpenAtSkips(t *testing.T) {
+	r, err := storagewrap.OpenAt(&memoryBackend{data: []byte("0123456789")}, 4)
+	if err != nil {
+		t.Fatalf("OpenAt failed: %v", err)
+	}
+	defer r.Close()
+
+	data, _ := io.ReadAll(r)
+	if string(data) != "456789" {
+		t.Fatalf("Expected %q, got %q", "456789", data)
+	}
+}
+
+func TestSizeAndPathOfFile(t *testing.T) {
+	backend := &memoryBackend{}
+	if _, err := storagewrap.Size(backend, ""); !errors.Is(err, errors.ErrUnsupported) {
+		t.Fatalf("Expected errors.ErrUnsupported without a file, got %v", err)
+	}
+	if path := storagewrap.Path(backend, ""); path != "" {
+		t.Fatalf("Expected no path without a file, got %q", path)
+	}
+
+	f, err := os.Create(filepath.Join(t.TempDir(), "spill"))
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	defer f.Close()
+	f.WriteString("hello")
+
+	file := storagewrap.FileName(f)
+	if size, err := storagewrap.Size(backend, file); err != nil || size != 5 {
+		t.Fatalf("Expected size 5, got %d, %v", size, err)
+	}
+	if path := storagewrap.Path(backend, file); path != f.Name() {
+		t.Fatalf("Expected %q, got %q", f.Name(), path)
+	}
+}
@@ -0,0 +1,71 @@
+package hybridbuffer
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"strings"
+)
+
+// MarshalJSON implements json.Marshaler
+// The unread contents are encoded as a base64 JSON string without consuming them.
+// Data is streamed through the encoder, but the resulting JSON document is held
+// in memory, so marshaling a huge spilled buffer is memory-heavy.
+func (b *hybridBuffer) MarshalJSON() ([]byte, error) {
+	b.mu.Lock()
+	defer b.unlock()
+
+	if b.closed {
+		return nil, ErrClosed
+	}
+
+	r, err := b.snapshotReader()
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	var out bytes.Buffer
+	out.Grow(base64.StdEncoding.EncodedLen(b.unread()) + 2)
+	out.WriteByte('"')
+	enc := base64.NewEncoder(base64.StdEncoding, &out)
+	if _, err = io.Copy(enc, r); err != nil {
+		return nil, err
+	}
+	if err = enc.Close(); err != nil {
+		return nil, err
+	}
+	out.WriteByte('"')
+
+	return out.Bytes(), nil
+}
+
+// UnmarshalJSON implements json.Unmarshaler
+// The buffer is reset and filled with the decoded contents of a base64 JSON string.
+// Large contents spill to storage as usual. A JSON null leaves the buffer unchanged.
+func (b *hybridBuffer) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		return nil
+	}
+
+	var encoded string
+	if err := json.Unmarshal(data, &encoded); err != nil {
+		return err
+	}
+
+	b.mu.Lock()
+	if b.closed {
+		b.unlock()
+		return ErrClosed
+	}
+	if b.readOnly {
+		b.unlock()
+		return ErrReadOnly
+	}
+	b.reset()
+	b.unlock()
+
+	_, err := b.ReadFrom(base64.NewDecoder(base64.StdEncoding, strings.NewReader(encoded)))
+	return err
+}
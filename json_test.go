@@ -0,0 +1,78 @@
+package hybridbuffer
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+func TestJSON_RoundTrip(t *testing.T) {
+	tests := []struct {
+		name      string
+		threshold int
+	}{
+		{"memory", 1024},
+		{"storage", 16},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := bytes.Repeat([]byte{0, 1, 2, 0xff, 'a'}, 20)
+
+			buf := NewFromBytes(data, WithThreshold(tt.threshold))
+			defer buf.Close()
+
+			// Only unread contents are marshaled
+			buf.Read(make([]byte, 5))
+
+			doc := struct {
+				Body Buffer `json:"body"`
+			}{Body: buf}
+			encoded, err := json.Marshal(doc)
+			if err != nil {
+				t.Fatalf("Marshal failed: %v", err)
+			}
+
+			// Marshaling does not consume the buffer
+			if buf.Len() != len(data)-5 {
+				t.Fatalf("Expected Len() %d after marshal, got %d", len(data)-5, buf.Len())
+			}
+
+			target := New(WithThreshold(tt.threshold))
+			defer target.Close()
+			decoded := struct {
+				Body Buffer `json:"body"`
+			}{Body: target}
+			if err := json.Unmarshal(encoded, &decoded); err != nil {
+				t.Fatalf("Unmarshal failed: %v", err)
+			}
+
+			if !bytes.Equal(target.Bytes(), data[5:]) {
+				t.Fatal("Data mismatch after JSON round trip")
+			}
+		})
+	}
+}
+
+func TestJSON_CompatibleWithByteSlice(t *testing.T) {
+	buf := NewFromString("hello")
+	defer buf.Close()
+
+	fromBuffer, _ := json.Marshal(buf)
+	fromSlice, _ := json.Marshal([]byte("hello"))
+	if !bytes.Equal(fromBuffer, fromSlice) {
+		t.Fatalf("Expected %s, got %s", fromSlice, fromBuffer)
+	}
+}
+
+func TestJSON_UnmarshalInvalid(t *testing.T) {
+	buf := New()
+	defer buf.Close()
+
+	if err := json.Unmarshal([]byte(`"not base64!"`), buf); err == nil {
+		t.Fatal("Expected error for invalid base64")
+	}
+	if err := json.Unmarshal([]byte(`42`), buf); err == nil {
+		t.Fatal("Expected error for non-string JSON")
+	}
+}
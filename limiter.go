@@ -0,0 +1,106 @@
+package hybridbuffer
+
+import "sync/atomic"
+
+// MemoryLimiter coordinates the in-memory bytes of many buffers
+// Buffers register the data they hold in memory with their limiter. Once a write
+// would push the total beyond the limit, the writing buffer spills to storage
+// early, even though it is still below its own threshold. The limit is soft:
+// concurrent writes may exceed it by the size of the writes in flight.
+// Buffers that never spill (WithMaxRetained, WithBackpressure, storage fallback)
+// are counted but not limited.
+type MemoryLimiter struct {
+	limit atomic.Int64
+	used  atomic.Int64
+}
+
+// globalLimiter is used by all buffers without WithMemoryLimiter while a global limit is set
+var globalLimiter = &MemoryLimiter{}
+
+// NewMemoryLimiter creates a limiter for limit bytes, 0 means unlimited
+func NewMemoryLimiter(limit int64) *MemoryLimiter {
+	l := &MemoryLimiter{}
+	l.SetLimit(limit)
+	return l
+}
+
+// SetGlobalMemoryLimit limits the in-memory bytes of all buffers that do not
+// use their own MemoryLimiter, 0 means unlimited
+// Buffers only register with the global limiter while a limit is set, so memory
+// that was already held when the limit is set is counted from the buffer's next
+// operation on. Without a limit, buffers skip the accounting entirely.
+// Default: unlimited
+func SetGlobalMemoryLimit(bytes int64) {
+	globalLimiter.SetLimit(bytes)
+}
+
+// GlobalMemoryLimiter returns the limiter shared by default by all buffers
+func GlobalMemoryLimiter() *MemoryLimiter {
+	return globalLimiter
+}
+
+// SetLimit changes the limit, 0 means unlimited
+// Buffers already above the limit spill on their next write.
+func (l *MemoryLimiter) SetLimit(limit int64) {
+	if limit < 0 {
+		limit = 0
+	}
+	l.limit.Store(limit)
+}
+
+// Limit returns the configured limit, 0 means unlimited
+func (l *MemoryLimiter) Limit() int64 {
+	return l.limit.Load()
+}
+
+// Used returns the number of bytes currently held in memory by all registered buffers
+func (l *MemoryLimiter) Used() int64 {
+	return l.used.Load()
+}
+
+// exceeded reports whether n more bytes would exceed the limit
+// A nil limiter is never exceeded.
+func (l *MemoryLimiter) exceeded(n int) bool {
+	if l == nil {
+		return false
+	}
+	limit := l.limit.Load()
+	return limit > 0 && l.used.Load()+int64(n) > limit
+}
+
+// memoryLimiter returns the limiter the buffer registers with, or nil if there is none
+// Without WithMemoryLimiter the buffer only uses the global limiter while a global
+// limit is set, or until the memory it registered there has been released.
+func (b *hybridBuffer) memoryLimiter() *MemoryLimiter {
+	if b.limiter != nil {
+		return b.limiter
+	}
+	if b.inMemory != 0 || globalLimiter.Limit() > 0 {
+		return globalLimiter
+	}
+	return nil
+}
+
+// trackMemory registers the buffer's current in-memory data with its limiter
+// Buffers without a limiter skip the accounting and the leak guard it needs.
+func (b *hybridBuffer) trackMemory() {
+	limiter := b.memoryLimiter()
+	if limiter == nil {
+		return
+	}
+	inMemory := int64(0)
+	if !b.usingStorage {
+		inMemory = int64(b.memoryBuffer.Len())
+	}
+	if inMemory != b.inMemory {
+		limiter.used.Add(inMemory - b.inMemory)
+		b.inMemory = inMemory
+
+		// Buffers are often dropped without Close while in memory
+		if b.leakGuard != nil || inMemory > 0 {
+			guard := b.guard()
+			guard.limiter = limiter
+			guard.inMemory = inMemory
+		}
+	}
+}
@@ -0,0 +1,288 @@
+// Package metrics provides a Prometheus collector for HybridBuffer
+//
+// The core package does not depend on Prometheus. Buffers report to a Collector
+// through their hooks, and storage operations are timed by wrapping the storage
+// provider, so only programs that opt in pull in the Prometheus client.
+package metrics
+
+import (
+	"io"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"schneider.vip/hybridbuffer/internal/storagewrap"
+	"schneider.vip/hybridbuffer/storage"
+)
+
+// Stats is the part of hybridbuffer.Buffer reporting where its data lives
+type Stats interface {
+	MemoryBytes() int
+	SpilledBytes() int64
+}
+
+// Collector collects metrics of the buffers reporting to it
+// It implements prometheus.Collector.
+type Collector struct {
+	spills     prometheus.Counter
+	spillSize  prometheus.Histogram
+	removals   prometheus.Counter
+	opDuration *prometheus.HistogramVec
+	opErrors   *prometheus.CounterVec
+
+	memoryBytes  *prometheus.Desc
+	storageBytes *prometheus.Desc
+
+	mu      sync.Mutex
+	tracked map[*tracked]struct{}
+}
+
+// tracked wraps a tracked buffer so the same buffer can be tracked twice
+type tracked struct {
+	stats Stats
+}
+
+// NewCollector creates a collector with metrics named hybridbuffer_*
+//
+// Example usage:
+//
+//	collector := metrics.NewCollector()
+//	prometheus.MustRegister(collector)
+//
+//	buf := hybridbuffer.New(
+//		hybridbuffer.WithOnSpill(collector.OnSpill),
+//		hybridbuffer.WithOnRemove(collector.OnRemove),
+//		hybridbuffer.WithStorage(collector.Storage(filesystem.New())),
+//	)
+func NewCollector() *Collector {
+	return &Collector{
+		spills: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "hybridbuffer_spills_total",
+			Help: "Number of buffers that moved their data from memory to storage.",
+		}),
+		spillSize: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "hybridbuffer_spill_size_bytes",
+			Help:    "Bytes moved from memory to storage when a buffer spilled.",
+			Buckets: prometheus.ExponentialBuckets(1024, 4, 11), // 1KB to 1GB
+		}),
+		removals: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "hybridbuffer_storage_removals_total",
+			Help: "Number of storage objects removed.",
+		}),
+		opDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "hybridbuffer_storage_operation_duration_seconds",
+			Help:    "Latency of storage operations: create, open and remove.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"operation"}),
+		opErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "hybridbuffer_storage_operation_errors_total",
+			Help: "Number of failed storage operations: create, open and remove.",
+		}, []string{"operation"}),
+		memoryBytes: prometheus.NewDesc(
+			"hybridbuffer_memory_bytes",
+			"Bytes held in memory by tracked buffers.",
+			nil, nil,
+		),
+		storageBytes: prometheus.NewDesc(
+			"hybridbuffer_storage_bytes",
+			"Bytes written to storage by tracked buffers since creation or Reset.",
+			nil, nil,
+		),
+		tracked: make(map[*tracked]struct{}),
+	}
+}
+
+// OnSpill counts a spill of size bytes, for use with hybridbuffer.WithOnSpill
+func (c *Collector) OnSpill(size int) {
+	c.spills.Inc()
+	c.spillSize.Observe(float64(size))
+}
+
+// OnRemove counts a removed storage object, for use with hybridbuffer.WithOnRemove
+func (c *Collector) OnRemove() {
+	c.removals.Inc()
+}
+
+// Track adds the buffer's memory and storage bytes to the gauges until the
+// returned function is called, which should happen before the buffer is closed
+//
+// Example usage:
+//
+//	defer collector.Track(buf)()
+func (c *Collector) Track(buf Stats) (untrack func()) {
+	t := &tracked{stats: buf}
+	c.mu.Lock()
+	c.tracked[t] = struct{}{}
+	c.mu.Unlock()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			c.mu.Lock()
+			delete(c.tracked, t)
+			c.mu.Unlock()
+		})
+	}
+}
+
+// Storage wraps a storage provider so the latency and errors of Create, Open and
+// Remove are recorded
+// Size, Path and OpenAt are passed through, falling back to the file written by
+// the wrapped backend and to skipping data like unwrapped backends. Preallocate
+// and Append are only offered if the wrapped backend has them.
+func (c *Collector) Storage(provider func() storage.Backend) func() storage.Backend {
+	return func() storage.Backend {
+		b := &Backend{backend: provider(), c: c}
+		_, preallocates := b.backend.(interface{ Preallocate(size int64) error })
+		_, appends := b.backend.(interface {
+			Append() (io.WriteCloser, error)
+		})
+		switch {
+		case preallocates && appends:
+			return preallocAppendBackend{b}
+		case preallocates:
+			return preallocBackend{b}
+		case appends:
+			return appendBackend{b}
+		}
+		return b
+	}
+}
+
+// observe records the duration and outcome of a storage operation
+func (c *Collector) observe(operation string, start time.Time, err error) {
+	c.opDuration.WithLabelValues(operation).Observe(time.Since(start).Seconds())
+	if err != nil {
+		c.opErrors.WithLabelValues(operation).Inc()
+	}
+}
+
+// Describe implements prometheus.Collector
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	c.spills.Describe(ch)
+	c.spillSize.Describe(ch)
+	c.removals.Describe(ch)
+	c.opDuration.Describe(ch)
+	c.opErrors.Describe(ch)
+	ch <- c.memoryBytes
+	ch <- c.storageBytes
+}
+
+// Collect implements prometheus.Collector
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	c.spills.Collect(ch)
+	c.spillSize.Collect(ch)
+	c.removals.Collect(ch)
+	c.opDuration.Collect(ch)
+	c.opErrors.Collect(ch)
+
+	c.mu.Lock()
+	buffers := make([]Stats, 0, len(c.tracked))
+	for t := range c.tracked {
+		buffers = append(buffers, t.stats)
+	}
+	c.mu.Unlock()
+
+	// Buffers lock themselves, so they are queried without holding c.mu
+	var memory, stored float64
+	for _, buf := range buffers {
+		memory += float64(buf.MemoryBytes())
+		stored += float64(buf.SpilledBytes())
+	}
+	ch <- prometheus.MustNewConstMetric(c.memoryBytes, prometheus.GaugeValue, memory)
+	ch <- prometheus.MustNewConstMetric(c.storageBytes, prometheus.GaugeValue, stored)
+}
+
+// Backend times the operations of a wrapped storage backend
+type Backend struct {
+	backend storage.Backend
+	c       *Collector
+	file    string // Name of the file written by the wrapped backend, if any
+}
+
+// Create implements storage.Backend
+func (b *Backend) Create() (io.WriteCloser, error) {
+	start := time.Now()
+	w, err := b.backend.Create()
+	b.c.observe("create", start, err)
+	b.file = storagewrap.FileName(w)
+	return w, err
+}
+
+// Open implements storage.Backend
+func (b *Backend) Open() (io.ReadCloser, error) {
+	start := time.Now()
+	r, err := b.backend.Open()
+	b.c.observe("open", start, err)
+	return r, err
+}
+
+// Remove implements storage.Backend
+func (b *Backend) Remove() error {
+	start := time.Now()
+	err := b.backend.Remove()
+	b.c.observe("remove", start, err)
+	return err
+}
+
+// OpenAt opens the stored object at off, through the wrapped backend's OpenAt if
+// it has one, otherwise by seeking or skipping the data before off
+func (b *Backend) OpenAt(off int64) (io.ReadCloser, error) {
+	start := time.Now()
+	r, err := storagewrap.OpenAt(b.backend, off)
+	b.c.observe("open", start, err)
+	return r, err
+}
+
+// Size returns the stored size if the wrapped backend can report it, or if it
+// wrote to a local file, such as the filesystem backend
+// It returns errors.ErrUnsupported otherwise.
+func (b *Backend) Size() (int64, error) {
+	return storagewrap.Size(b.backend, b.file)
+}
+
+// Path returns the file path if the wrapped backend keeps the data in a local file
+// It returns "" if the wrapped backend has no Path method and did not write to an
+// *os.File.
+func (b *Backend) Path() string {
+	return storagewrap.Path(b.backend, b.file)
+}
+
+// preallocate forwards Preallocate to the wrapped backend
+func (b *Backend) preallocate(size int64) error {
+	start := time.Now()
+	err := b.backend.(interface{ Preallocate(size int64) error }).Preallocate(size)
+	b.c.observe("preallocate", start, err)
+	return err
+}
+
+// append forwards Append to the wrapped backend
+func (b *Backend) append() (io.WriteCloser, error) {
+	start := time.Now()
+	w, err := b.backend.(interface {
+		Append() (io.WriteCloser, error)
+	}).Append()
+	b.c.observe("append", start, err)
+	return w, err
+}
+
+// preallocBackend is a Backend whose wrapped backend can preallocate
+type preallocBackend struct{ *Backend }
+
+// Preallocate reserves space through the wrapped backend
+func (b preallocBackend) Preallocate(size int64) error { return b.preallocate(size) }
+
+// appendBackend is a Backend whose wrapped backend can append
+type appendBackend struct{ *Backend }
+
+// Append continues the stored object through the wrapped backend
+func (b appendBackend) Append() (io.WriteCloser, error) { return b.append() }
+
+// preallocAppendBackend is a Backend whose wrapped backend can preallocate and append
+type preallocAppendBackend struct{ *Backend }
+
+// Preallocate reserves space through the wrapped backend
+func (b preallocAppendBackend) Preallocate(size int64) error { return b.preallocate(size) }
+
+// Append continues the stored object through the wrapped backend
+func (b preallocAppendBackend) Append() (io.WriteCloser, error) { return b.append() }
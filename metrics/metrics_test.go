@@ -0,0 +1,210 @@
+package metrics
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"schneider.vip/hybridbuffer/storage"
+)
+
+var _ prometheus.Collector = (*Collector)(nil)
+
+// memoryBackend keeps the data in memory
+type memoryBackend struct {
+	data      bytes.Buffer
+	removeErr error
+}
+
+func (m *memoryBackend) Create() (io.WriteCloser, error) {
+	m.data.Reset()
+	return nopWriteCloser{&m.data}, nil
+}
+
+func (m *memoryBackend) Open() (io.ReadCloser, error) {
+	return io.NopCloser(bytes.NewReader(m.data.Bytes())), nil
+}
+
+func (m *memoryBackend) Remove() error { return m.removeErr }
+func (m *memoryBackend) Size() (int64, error) {
+	return int64(m.data.Len()), nil
+}
+
+type nopWriteCloser struct{ io.Writer }
+
+func (nopWriteCloser) Close() error { return nil }
+
+// fakeBuffer reports fixed stats
+type fakeBuffer struct {
+	memory  int
+	spilled int64
+}
+
+func (f fakeBuffer) MemoryBytes() int    { return f.memory }
+func (f fakeBuffer) SpilledBytes() int64 { return f.spilled }
+
+func TestSpillCounters(t *testing.T) {
+	c := NewCollector()
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(c)
+
+	c.OnSpill(4096)
+	c.OnSpill(100)
+	c.OnRemove()
+
+	if n := testutil.ToFloat64(c.spills); n != 2 {
+		t.Fatalf("Expected 2 spills, got %v", n)
+	}
+	if n := testutil.ToFloat64(c.removals); n != 1 {
+		t.Fatalf("Expected 1 removal, got %v", n)
+	}
+	if n := testutil.CollectAndCount(registry, "hybridbuffer_spill_size_bytes"); n != 1 {
+		t.Fatalf("Expected the spill size histogram, got %d metrics", n)
+	}
+}
+
+func TestTrack(t *testing.T) {
+	c := NewCollector()
+	untrackA := c.Track(fakeBuffer{memory: 100})
+	untrackB := c.Track(fakeBuffer{memory: 20, spilled: 5000})
+
+	expect := func(memory, stored int) {
+		t.Helper()
+		want := fmt.Sprintf(`# HELP hybridbuffer_memory_bytes Bytes held in memory by tracked buffers.
+# TYPE hybridbuffer_memory_bytes gauge
+hybridbuffer_memory_bytes %d
+# HELP hybridbuffer_storage_bytes Bytes written to storage by tracked buffers since creation or Reset.
+# TYPE hybridbuffer_storage_bytes gauge
+hybridbuffer_storage_bytes %d
+`, memory, stored)
+		if err := testutil.CollectAndCompare(c, strings.NewReader(want), "hybridbuffer_memory_bytes", "hybridbuffer_storage_bytes"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	expect(120, 5000)
+	untrackB()
+	untrackB() // Idempotent
+	expect(100, 0)
+	untrackA()
+	expect(0, 0)
+}
+
+func TestStorage(t *testing.T) {
+	c := NewCollector()
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(c)
+
+	inner := &memoryBackend{removeErr: errors.New("remove failed")}
+	backend := c.Storage(func() storage.Backend { return inner })()
+
+	w, err := backend.Create()
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	w.Write([]byte("data"))
+	w.Close()
+	r, err := backend.Open()
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	if got, _ := io.ReadAll(r); string(got) != "data" {
+		t.Fatalf("Expected data, got %q", got)
+	}
+	if err := backend.Remove(); err == nil {
+		t.Fatal("Expected the remove error to be passed through")
+	}
+
+	if n := testutil.CollectAndCount(registry, "hybridbuffer_storage_operation_duration_seconds"); n != 3 {
+		t.Fatalf("Expected durations for 3 operations, got %d", n)
+	}
+	if n := testutil.ToFloat64(c.opErrors.WithLabelValues("remove")); n != 1 {
+		t.Fatalf("Expected 1 remove error, got %v", n)
+	}
+	if n := testutil.ToFloat64(c.opErrors.WithLabelValues("create")); n != 0 {
+		t.Fatalf("Expected no create errors, got %v", n)
+	}
+
+	sizer := backend.(interface{ Size() (int64, error) })
+	if size, err := sizer.Size(); err != nil || size != 4 {
+		t.Fatalf("Expected size 4, got %d, %v", size, err)
+	}
+	if path := backend.(interface{ Path() string }).Path(); path != "" {
+		t.Fatalf("Expected no path, got %q", path)
+	}
+}
+
+// fileBackend writes to a local file and can preallocate, but has no Size or Path method
+type fileBackend struct {
+	dir       string
+	name      string
+	allocated int64
+}
+
+func (f *fileBackend) Create() (io.WriteCloser, error) {
+	file, err := os.CreateTemp(f.dir, "spill-*")
+	if err != nil {
+		return nil, err
+	}
+	f.name = file.Name()
+	return file, nil
+}
+
+func (f *fileBackend) Open() (io.ReadCloser, error) { return os.Open(f.name) }
+func (f *fileBackend) Remove() error                { return os.Remove(f.name) }
+func (f *fileBackend) Preallocate(size int64) error { f.allocated = size; return nil }
+
+func TestStorageCapabilities(t *testing.T) {
+	c := NewCollector()
+
+	plain := c.Storage(func() storage.Backend { return &memoryBackend{} })()
+	if _, ok := plain.(interface{ Preallocate(int64) error }); ok {
+		t.Fatal("Expected no Preallocate for a backend without it")
+	}
+	if _, ok := plain.(interface {
+		Append() (io.WriteCloser, error)
+	}); ok {
+		t.Fatal("Expected no Append for a backend without it")
+	}
+
+	inner := &fileBackend{dir: t.TempDir()}
+	backend := c.Storage(func() storage.Backend { return inner })()
+	w, err := backend.Create()
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	w.Write([]byte("0123456789"))
+	w.Close()
+
+	if err := backend.(interface{ Preallocate(int64) error }).Preallocate(64); err != nil || inner.allocated != 64 {
+		t.Fatalf("Expected Preallocate to be forwarded, got %d, %v", inner.allocated, err)
+	}
+	if _, ok := backend.(interface {
+		Append() (io.WriteCloser, error)
+	}); ok {
+		t.Fatal("Expected no Append for a backend without it")
+	}
+	if size, err := backend.(interface{ Size() (int64, error) }).Size(); err != nil || size != 10 {
+		t.Fatalf("Expected size 10 from the file, got %d, %v", size, err)
+	}
+	if path := backend.(interface{ Path() string }).Path(); path != inner.name {
+		t.Fatalf("Expected %q, got %q", inner.name, path)
+	}
+
+	r, err := backend.(interface {
+		OpenAt(off int64) (io.ReadCloser, error)
+	}).OpenAt(4)
+	if err != nil {
+		t.Fatalf("OpenAt failed: %v", err)
+	}
+	defer r.Close()
+	if got, _ := io.ReadAll(r); string(got) != "456789" {
+		t.Fatalf("Expected %q, got %q", "456789", got)
+	}
+}
@@ -0,0 +1,87 @@
+// Package brotli provides a Brotli compression middleware for HybridBuffer
+//
+// Brotli compresses text such as HTML and JSON considerably better than gzip,
+// at the cost of slower compression at high quality levels. Spilling payloads
+// that are later served with Content-Encoding: br saves compressing them again.
+package brotli
+
+import (
+	"errors"
+	"io"
+
+	"github.com/andybalholm/brotli"
+)
+
+// Middleware compresses data as a Brotli stream (RFC 7932)
+type Middleware struct {
+	quality int
+}
+
+// Option configures the brotli middleware
+type Option func(*Middleware)
+
+// WithQuality sets the compression quality, from brotli.BestSpeed (0) to brotli.BestCompression (11)
+// Invalid qualities are ignored.
+// Default: brotli.DefaultCompression (6)
+func WithQuality(quality int) Option {
+	return func(m *Middleware) {
+		if quality >= brotli.BestSpeed && quality <= brotli.BestCompression {
+			m.quality = quality
+		}
+	}
+}
+
+// New creates a Brotli middleware
+func New(opts ...Option) *Middleware {
+	m := &Middleware{quality: brotli.DefaultCompression}
+	for _, opt := range opts {
+		opt(m)
+	}
+	return m
+}
+
+// Stage returns 1, the value of hybridbuffer.StageCompression, so that
+// hybridbuffer.WithPipeline orders the middleware into the compression stage
+func (m *Middleware) Stage() int {
+	return 1
+}
+
+// Writer wraps w with a Brotli compressor
+func (m *Middleware) Writer(w io.Writer) io.Writer {
+	return &writer{Writer: brotli.NewWriterLevel(w, m.quality), underlying: w}
+}
+
+// Reader wraps r with a Brotli decompressor
+// A stream that ends before its final block fails with io.ErrUnexpectedEOF.
+func (m *Middleware) Reader(r io.Reader) io.Reader {
+	return &reader{Reader: brotli.NewReader(r), underlying: r}
+}
+
+// writer writes the final block on Close, without it the stream is invalid
+type writer struct {
+	*brotli.Writer
+	underlying io.Writer
+}
+
+// Close flushes the final block and closes the underlying writer if it implements io.Closer
+func (w *writer) Close() error {
+	err := w.Writer.Close()
+	if closer, ok := w.underlying.(io.Closer); ok {
+		err = errors.Join(err, closer.Close())
+	}
+	return err
+}
+
+// reader closes the underlying reader
+type reader struct {
+	*brotli.Reader
+	underlying io.Reader
+}
+
+// Close closes the underlying reader if it implements io.Closer
+func (r *reader) Close() error {
+	if closer, ok := r.underlying.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
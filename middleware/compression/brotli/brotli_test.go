@@ -0,0 +1,176 @@
+package brotli
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+	"time"
+
+	"schneider.vip/hybridbuffer/middleware"
+)
+
+var _ middleware.Middleware = (*Middleware)(nil)
+var _ interface{ Stage() int } = (*Middleware)(nil)
+
+// closeRecorder records whether Close was called
+type closeRecorder struct {
+	bytes.Buffer
+	closed bool
+}
+
+func (c *closeRecorder) Close() error {
+	c.closed = true
+	return nil
+}
+
+func compress(t *testing.T, m *Middleware, data []byte) *closeRecorder {
+	t.Helper()
+
+	out := &closeRecorder{}
+	w := m.Writer(out)
+	if _, err := w.Write(data); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	if err := w.(io.Closer).Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if !out.closed {
+		t.Fatal("Close was not propagated to the underlying writer")
+	}
+	return out
+}
+
+// payloads returns representative HTML and JSON documents
+func payloads() map[string][]byte {
+	var html, json bytes.Buffer
+	html.WriteString("<!DOCTYPE html><html><head><title>Catalog</title></head><body><ul>\n")
+	json.WriteString(`{"items":[`)
+	for i := 0; i < 2000; i++ {
+		fmt.Fprintf(&html, "<li class=\"item\"><a href=\"/products/%d\">Product %d</a><span class=\"price\">%d.99</span></li>\n", i, i, i%500)
+		if i > 0 {
+			json.WriteByte(',')
+		}
+		fmt.Fprintf(&json, `{"id":%d,"name":"Product %d","price":%d.99,"tags":["sale","new"],"stock":%d}`, i, i, i%500, i*7%100)
+	}
+	html.WriteString("</ul></body></html>\n")
+	json.WriteString("]}")
+	return map[string][]byte{"html": html.Bytes(), "json": json.Bytes()}
+}
+
+func TestRoundTrip(t *testing.T) {
+	for name, data := range payloads() {
+		for _, quality := range []int{0, 6, 11} {
+			m := New(WithQuality(quality))
+			compressed := compress(t, m, data)
+			if compressed.Len() >= len(data)/4 {
+				t.Fatalf("%s quality %d: expected compression, got %d of %d bytes", name, quality, compressed.Len(), len(data))
+			}
+
+			got, err := io.ReadAll(m.Reader(bytes.NewReader(compressed.Bytes())))
+			if err != nil {
+				t.Fatalf("%s quality %d: read failed: %v", name, quality, err)
+			}
+			if !bytes.Equal(got, data) {
+				t.Fatalf("%s quality %d: data mismatch", name, quality)
+			}
+		}
+	}
+}
+
+func TestInvalidQualityIgnored(t *testing.T) {
+	if m := New(WithQuality(12)); m.quality != 6 {
+		t.Fatalf("Expected the default quality, got %d", m.quality)
+	}
+}
+
+func TestCloseFlushesFinalBlock(t *testing.T) {
+	m := New()
+	out := &closeRecorder{}
+	w := m.Writer(out)
+	w.Write([]byte("pending data"))
+
+	// Without Close the stream is incomplete
+	if _, err := io.ReadAll(m.Reader(bytes.NewReader(out.Bytes()))); err == nil {
+		t.Fatal("Expected an error reading an unterminated stream")
+	}
+
+	w.(io.Closer).Close()
+	got, err := io.ReadAll(m.Reader(bytes.NewReader(out.Bytes())))
+	if err != nil || string(got) != "pending data" {
+		t.Fatalf("Expected data after Close, got %q, %v", got, err)
+	}
+}
+
+func TestTruncatedInput(t *testing.T) {
+	m := New()
+	compressed := compress(t, m, payloads()["json"]).Bytes()
+
+	for _, n := range []int{0, 1, len(compressed) / 2, len(compressed) - 1} {
+		done := make(chan error, 1)
+		go func() {
+			_, err := io.ReadAll(m.Reader(bytes.NewReader(compressed[:n])))
+			done <- err
+		}()
+
+		select {
+		case err := <-done:
+			if !errors.Is(err, io.ErrUnexpectedEOF) {
+				t.Fatalf("Truncated to %d bytes: expected io.ErrUnexpectedEOF, got %v", n, err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Truncated to %d bytes: read did not return", n)
+		}
+	}
+}
+
+func TestReaderClosePropagates(t *testing.T) {
+	m := New()
+	compressed := compress(t, m, []byte("data"))
+
+	underlying := &closeRecorder{Buffer: *bytes.NewBuffer(compressed.Bytes())}
+	if err := m.Reader(underlying).(io.Closer).Close(); err != nil || !underlying.closed {
+		t.Fatal("Close was not propagated to the underlying reader")
+	}
+}
+
+// countingWriter counts the bytes written
+type countingWriter struct{ n int }
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	c.n += len(p)
+	return len(p), nil
+}
+
+func BenchmarkCompression(b *testing.B) {
+	for name, data := range payloads() {
+		for _, quality := range []int{1, 6, 11} {
+			b.Run(fmt.Sprintf("%s/brotli-%d", name, quality), func(b *testing.B) {
+				m := New(WithQuality(quality))
+				var out countingWriter
+				b.SetBytes(int64(len(data)))
+				for i := 0; i < b.N; i++ {
+					out.n = 0
+					w := m.Writer(&out)
+					w.Write(data)
+					w.(io.Closer).Close()
+				}
+				b.ReportMetric(float64(out.n)/float64(len(data)), "ratio")
+			})
+		}
+
+		b.Run(name+"/gzip", func(b *testing.B) {
+			var out countingWriter
+			b.SetBytes(int64(len(data)))
+			for i := 0; i < b.N; i++ {
+				out.n = 0
+				w := gzip.NewWriter(&out)
+				w.Write(data)
+				w.Close()
+			}
+			b.ReportMetric(float64(out.n)/float64(len(data)), "ratio")
+		})
+	}
+}
@@ -0,0 +1,10 @@
+module schneider.vip/hybridbuffer/middleware/compression/brotli
+
+go 1.23.0
+
+toolchain go1.24.0
+
+require (
+	github.com/andybalholm/brotli v1.2.0
+	schneider.vip/hybridbuffer/middleware v1.0.6
+)
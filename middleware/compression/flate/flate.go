@@ -0,0 +1,86 @@
+// Package flate provides a raw DEFLATE compression middleware for HybridBuffer
+//
+// Unlike gzip, raw DEFLATE streams carry no header or checksum, which is what
+// some systems expect. The formats are not interchangeable.
+package flate
+
+import (
+	"compress/flate"
+	"errors"
+	"io"
+)
+
+// Middleware compresses data as a raw DEFLATE stream (RFC 1951)
+type Middleware struct {
+	level int
+}
+
+// Option configures the flate middleware
+type Option func(*Middleware)
+
+// WithLevel sets the compression level, from flate.HuffmanOnly (-2) to flate.BestCompression (9)
+// Invalid levels are ignored.
+// Default: flate.DefaultCompression
+func WithLevel(level int) Option {
+	return func(m *Middleware) {
+		if level >= flate.HuffmanOnly && level <= flate.BestCompression {
+			m.level = level
+		}
+	}
+}
+
+// New creates a raw DEFLATE middleware
+func New(opts ...Option) *Middleware {
+	m := &Middleware{level: flate.DefaultCompression}
+	for _, opt := range opts {
+		opt(m)
+	}
+	return m
+}
+
+// Stage returns 1, the value of hybridbuffer.StageCompression, so that
+// hybridbuffer.WithPipeline orders the middleware into the compression stage
+func (m *Middleware) Stage() int {
+	return 1
+}
+
+// Writer wraps w with a DEFLATE compressor
+func (m *Middleware) Writer(w io.Writer) io.Writer {
+	fw, _ := flate.NewWriter(w, m.level) // Level validated by WithLevel
+	return &writer{Writer: fw, underlying: w}
+}
+
+// Reader wraps r with a DEFLATE decompressor
+func (m *Middleware) Reader(r io.Reader) io.Reader {
+	return &reader{ReadCloser: flate.NewReader(r), underlying: r}
+}
+
+// writer writes the final block on Close, without it the stream is invalid
+type writer struct {
+	*flate.Writer
+	underlying io.Writer
+}
+
+// Close flushes the final block and closes the underlying writer if it implements io.Closer
+func (w *writer) Close() error {
+	err := w.Writer.Close()
+	if closer, ok := w.underlying.(io.Closer); ok {
+		err = errors.Join(err, closer.Close())
+	}
+	return err
+}
+
+// reader closes the underlying reader along with the decompressor
+type reader struct {
+	io.ReadCloser
+	underlying io.Reader
+}
+
+// Close closes the decompressor and the underlying reader if it implements io.Closer
+func (r *reader) Close() error {
+	err := r.ReadCloser.Close()
+	if closer, ok := r.underlying.(io.Closer); ok {
+		err = errors.Join(err, closer.Close())
+	}
+	return err
+}
@@ -0,0 +1,97 @@
+package flate
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"testing"
+
+	"schneider.vip/hybridbuffer/middleware"
+)
+
+var _ middleware.Middleware = (*Middleware)(nil)
+var _ interface{ Stage() int } = (*Middleware)(nil)
+
+// closeRecorder records whether Close was called
+type closeRecorder struct {
+	bytes.Buffer
+	closed bool
+}
+
+func (c *closeRecorder) Close() error {
+	c.closed = true
+	return nil
+}
+
+func compress(t *testing.T, m *Middleware, data []byte) *closeRecorder {
+	t.Helper()
+
+	out := &closeRecorder{}
+	w := m.Writer(out)
+	if _, err := w.Write(data); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	if err := w.(io.Closer).Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if !out.closed {
+		t.Fatal("Close was not propagated to the underlying writer")
+	}
+	return out
+}
+
+func TestRoundTrip(t *testing.T) {
+	data := bytes.Repeat([]byte("raw deflate stream "), 1000)
+
+	for _, level := range []int{-2, 1, 9} {
+		m := New(WithLevel(level))
+		compressed := compress(t, m, data)
+		if compressed.Len() >= len(data) {
+			t.Fatalf("Level %d: expected compression, got %d bytes", level, compressed.Len())
+		}
+
+		got, err := io.ReadAll(m.Reader(bytes.NewReader(compressed.Bytes())))
+		if err != nil {
+			t.Fatalf("Level %d: read failed: %v", level, err)
+		}
+		if !bytes.Equal(got, data) {
+			t.Fatalf("Level %d: data mismatch", level)
+		}
+	}
+}
+
+func TestCloseFlushesFinalBlock(t *testing.T) {
+	m := New()
+	out := &closeRecorder{}
+	w := m.Writer(out)
+	w.Write([]byte("pending data"))
+
+	// Without Close the stream is incomplete
+	if _, err := io.ReadAll(m.Reader(bytes.NewReader(out.Bytes()))); err == nil {
+		t.Fatal("Expected an error reading an unterminated stream")
+	}
+
+	w.(io.Closer).Close()
+	got, err := io.ReadAll(m.Reader(bytes.NewReader(out.Bytes())))
+	if err != nil || string(got) != "pending data" {
+		t.Fatalf("Expected data after Close, got %q, %v", got, err)
+	}
+}
+
+func TestReaderClosePropagates(t *testing.T) {
+	m := New()
+	compressed := compress(t, m, []byte("data"))
+
+	underlying := &closeRecorder{Buffer: *bytes.NewBuffer(compressed.Bytes())}
+	if err := m.Reader(underlying).(io.Closer).Close(); err != nil || !underlying.closed {
+		t.Fatal("Close was not propagated to the underlying reader")
+	}
+}
+
+func TestGzipCannotReadFlate(t *testing.T) {
+	compressed := compress(t, New(), []byte("not a gzip stream"))
+
+	if _, err := gzip.NewReader(bytes.NewReader(compressed.Bytes())); err == nil {
+		t.Fatal("Expected gzip to reject a raw DEFLATE stream")
+	}
+}
@@ -0,0 +1,173 @@
+// Package gate provides a middleware for HybridBuffer that only compresses data
+// of a minimum size
+//
+// Compressing tiny spills wastes CPU and can even grow them, since every format
+// adds a header. The gate wraps any compression middleware and stores streams
+// below the minimum size as they are. A one-byte flag in front of the stream
+// tells the reader whether to decompress.
+package gate
+
+import (
+	"errors"
+	"io"
+
+	"schneider.vip/hybridbuffer/middleware"
+)
+
+// Stream flags written in front of the data
+const (
+	flagStored     byte = 0
+	flagCompressed byte = 1
+)
+
+// ErrUnknownFlag is returned when a stream does not start with a known flag,
+// e.g. because it was not written through the gate
+var ErrUnknownFlag = errors.New("gate: unknown stream flag")
+
+// Middleware applies a compression middleware to streams of at least minSize bytes
+type Middleware struct {
+	compression middleware.Middleware
+	minSize     int
+}
+
+// New creates a gate compressing streams of at least minSize bytes with compression
+// Smaller streams are stored uncompressed.
+//
+// Example usage:
+//
+//	gate.New(flate.New(), 4096)
+func New(compression middleware.Middleware, minSize int) *Middleware {
+	return &Middleware{compression: compression, minSize: minSize}
+}
+
+// Stage returns 1, the value of hybridbuffer.StageCompression, so that
+// hybridbuffer.WithPipeline orders the middleware into the compression stage
+func (m *Middleware) Stage() int {
+	return 1
+}
+
+// Writer holds data back until minSize bytes were written, then compresses
+// everything; streams closed before that are stored as they are
+func (m *Middleware) Writer(w io.Writer) io.Writer {
+	return &writer{m: m, underlying: w}
+}
+
+// Reader decompresses the stream if it was written compressed
+func (m *Middleware) Reader(r io.Reader) io.Reader {
+	return &reader{m: m, underlying: r}
+}
+
+// writer decides between storing and compressing once enough data was written
+type writer struct {
+	m          *Middleware
+	underlying io.Writer
+	pending    []byte    // Data held back until the decision
+	compressor io.Writer // Set once compressing
+	err        error
+}
+
+// Write implements io.Writer
+func (w *writer) Write(p []byte) (int, error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+	if w.compressor != nil {
+		return w.compressor.Write(p)
+	}
+
+	w.pending = append(w.pending, p...)
+	if len(w.pending) >= w.m.minSize {
+		w.err = w.start(flagCompressed)
+		if w.err != nil {
+			return 0, w.err
+		}
+	}
+	return len(p), nil
+}
+
+// start writes the flag and the pending data
+func (w *writer) start(flag byte) error {
+	if _, err := w.underlying.Write([]byte{flag}); err != nil {
+		return err
+	}
+
+	out := w.underlying
+	if flag == flagCompressed {
+		w.compressor = w.m.compression.Writer(w.underlying)
+		out = w.compressor
+	}
+	_, err := out.Write(w.pending)
+	w.pending = nil
+	return err
+}
+
+// Close stores data that never reached the minimum size, finishes a compressed
+// stream and closes the underlying writer if it implements io.Closer
+func (w *writer) Close() error {
+	err := w.err
+	if err == nil && w.compressor == nil {
+		err = w.start(flagStored)
+	}
+	w.err = errors.New("gate: write to closed writer")
+
+	// Compression middlewares close the underlying writer themselves
+	if closer, ok := w.compressor.(io.Closer); ok {
+		return errors.Join(err, closer.Close())
+	}
+	if closer, ok := w.underlying.(io.Closer); ok {
+		err = errors.Join(err, closer.Close())
+	}
+	return err
+}
+
+// reader defers reading the flag to the first Read
+type reader struct {
+	m          *Middleware
+	underlying io.Reader
+	r          io.Reader
+	err        error
+}
+
+// Read implements io.Reader
+func (r *reader) Read(p []byte) (int, error) {
+	if r.r == nil && r.err == nil {
+		r.err = r.init()
+	}
+	if r.err != nil {
+		return 0, r.err
+	}
+	return r.r.Read(p)
+}
+
+// init reads the flag and sets up decompression if needed
+func (r *reader) init() error {
+	var flag [1]byte
+	if _, err := io.ReadFull(r.underlying, flag[:]); err != nil {
+		if err == io.EOF {
+			return io.ErrUnexpectedEOF
+		}
+		return err
+	}
+
+	switch flag[0] {
+	case flagStored:
+		r.r = r.underlying
+	case flagCompressed:
+		r.r = r.m.compression.Reader(r.underlying)
+	default:
+		return ErrUnknownFlag
+	}
+	return nil
+}
+
+// Close closes the decompressor, which closes the underlying reader, or the
+// underlying reader directly
+func (r *reader) Close() error {
+	if closer, ok := r.r.(io.Closer); ok && r.r != r.underlying {
+		return closer.Close()
+	}
+	if closer, ok := r.underlying.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
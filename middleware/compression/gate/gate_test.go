@@ -0,0 +1,141 @@
+package gate
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"testing"
+
+	"schneider.vip/hybridbuffer/middleware"
+)
+
+var _ middleware.Middleware = (*Middleware)(nil)
+var _ interface{ Stage() int } = (*Middleware)(nil)
+
+// closeRecorder records whether Close was called
+type closeRecorder struct {
+	bytes.Buffer
+	closed bool
+}
+
+func (c *closeRecorder) Close() error {
+	c.closed = true
+	return nil
+}
+
+// gzipMiddleware is a minimal compression middleware propagating Close
+type gzipMiddleware struct{}
+
+type gzipWriter struct {
+	*gzip.Writer
+	underlying io.Writer
+}
+
+func (w *gzipWriter) Close() error {
+	err := w.Writer.Close()
+	if closer, ok := w.underlying.(io.Closer); ok {
+		err = errors.Join(err, closer.Close())
+	}
+	return err
+}
+
+func (gzipMiddleware) Writer(w io.Writer) io.Writer {
+	return &gzipWriter{Writer: gzip.NewWriter(w), underlying: w}
+}
+
+func (gzipMiddleware) Reader(r io.Reader) io.Reader {
+	zr, err := gzip.NewReader(r)
+	if err != nil {
+		return errReader{err}
+	}
+	return zr
+}
+
+type errReader struct{ err error }
+
+func (r errReader) Read([]byte) (int, error) { return 0, r.err }
+
+func write(t *testing.T, m *Middleware, chunks ...[]byte) *closeRecorder {
+	t.Helper()
+
+	out := &closeRecorder{}
+	w := m.Writer(out)
+	for _, chunk := range chunks {
+		if _, err := w.Write(chunk); err != nil {
+			t.Fatalf("Write failed: %v", err)
+		}
+	}
+	if err := w.(io.Closer).Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if !out.closed {
+		t.Fatal("Close was not propagated to the underlying writer")
+	}
+	return out
+}
+
+func TestBelowMinSizeIsStored(t *testing.T) {
+	m := New(gzipMiddleware{}, 100)
+	out := write(t, m, []byte("tiny"), []byte(" spill"))
+
+	if out.String() != "\x00tiny spill" {
+		t.Fatalf("Expected the stored flag and raw data, got %q", out.String())
+	}
+
+	got, err := io.ReadAll(m.Reader(bytes.NewReader(out.Bytes())))
+	if err != nil || string(got) != "tiny spill" {
+		t.Fatalf("Round trip failed: %q, %v", got, err)
+	}
+}
+
+func TestAboveMinSizeIsCompressed(t *testing.T) {
+	m := New(gzipMiddleware{}, 100)
+	data := bytes.Repeat([]byte("compressible "), 100)
+
+	// The decision is made once enough data arrived across writes
+	out := write(t, m, data[:60], data[60:])
+
+	if out.Bytes()[0] != flagCompressed {
+		t.Fatalf("Expected the compressed flag, got %d", out.Bytes()[0])
+	}
+	if out.Len() >= len(data) {
+		t.Fatalf("Expected compression, got %d bytes", out.Len())
+	}
+
+	got, err := io.ReadAll(m.Reader(bytes.NewReader(out.Bytes())))
+	if err != nil || !bytes.Equal(got, data) {
+		t.Fatalf("Round trip failed: %v", err)
+	}
+}
+
+func TestEmptyStream(t *testing.T) {
+	m := New(gzipMiddleware{}, 100)
+	out := write(t, m)
+
+	got, err := io.ReadAll(m.Reader(bytes.NewReader(out.Bytes())))
+	if err != nil || len(got) != 0 {
+		t.Fatalf("Expected an empty round trip, got %q, %v", got, err)
+	}
+}
+
+func TestInvalidStream(t *testing.T) {
+	m := New(gzipMiddleware{}, 100)
+
+	if _, err := io.ReadAll(m.Reader(bytes.NewReader([]byte{7, 'x'}))); !errors.Is(err, ErrUnknownFlag) {
+		t.Fatalf("Expected ErrUnknownFlag, got %v", err)
+	}
+	if _, err := io.ReadAll(m.Reader(bytes.NewReader(nil))); err != io.ErrUnexpectedEOF {
+		t.Fatalf("Expected io.ErrUnexpectedEOF for a stream without flag, got %v", err)
+	}
+}
+
+func TestReaderClosePropagates(t *testing.T) {
+	m := New(gzipMiddleware{}, 100)
+	out := write(t, m, []byte("data"))
+
+	underlying := &closeRecorder{Buffer: *bytes.NewBuffer(out.Bytes())}
+	if err := m.Reader(underlying).(io.Closer).Close(); err != nil || !underlying.closed {
+		t.Fatal("Close was not propagated to the underlying reader")
+	}
+}
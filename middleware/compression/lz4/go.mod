@@ -0,0 +1,10 @@
+module schneider.vip/hybridbuffer/middleware/compression/lz4
+
+go 1.23.0
+
+toolchain go1.24.0
+
+require (
+	github.com/pierrec/lz4/v4 v4.1.22
+	schneider.vip/hybridbuffer/middleware v1.0.6
+)
@@ -0,0 +1,185 @@
+package lz4
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/pierrec/lz4/v4"
+	"schneider.vip/hybridbuffer/middleware"
+)
+
+var _ middleware.Middleware = (*Middleware)(nil)
+var _ interface{ Stage() int } = (*Middleware)(nil)
+
+// frameMagic starts every LZ4 frame
+var frameMagic = []byte{0x04, 0x22, 0x4d, 0x18}
+
+// closeRecorder records whether Close was called
+type closeRecorder struct {
+	bytes.Buffer
+	closed bool
+}
+
+func (c *closeRecorder) Close() error {
+	c.closed = true
+	return nil
+}
+
+// logData returns log lines like those of a high-throughput service
+func logData(size int) []byte {
+	var buf bytes.Buffer
+	for i := 0; buf.Len() < size; i++ {
+		fmt.Fprintf(&buf, "2025-07-15T11:42:%02d.%03dZ level=info msg=\"request handled\" path=/api/v1/items/%d status=%d duration=%dms\n",
+			i%60, i%1000, i*31%10000, 200+i%3*100, i*7%250)
+	}
+	return buf.Bytes()[:size]
+}
+
+func TestRoundTripSpilled(t *testing.T) {
+	data := logData(1 << 20)
+	threshold := 64 << 10
+
+	for _, opts := range [][]Option{
+		nil,
+		{WithBlockSize(lz4.Block64Kb)},
+		{WithLevel(lz4.Level9)},
+	} {
+		m := New(opts...)
+
+		// Like a spilling buffer: the memory contents first, then every later write
+		out := &closeRecorder{}
+		w := m.Writer(out)
+		if _, err := w.Write(data[:threshold]); err != nil {
+			t.Fatalf("Write failed: %v", err)
+		}
+		for chunk := data[threshold:]; len(chunk) > 0; {
+			n := min(len(chunk), 3000)
+			if _, err := w.Write(chunk[:n]); err != nil {
+				t.Fatalf("Write failed: %v", err)
+			}
+			chunk = chunk[n:]
+		}
+		if err := w.(io.Closer).Close(); err != nil {
+			t.Fatalf("Close failed: %v", err)
+		}
+		if !out.closed {
+			t.Fatal("Close was not propagated to the underlying writer")
+		}
+		if out.Len() >= len(data)/2 {
+			t.Fatalf("Expected compression, got %d of %d bytes", out.Len(), len(data))
+		}
+
+		// The writes form a single frame, not one per Write
+		if !bytes.HasPrefix(out.Bytes(), frameMagic) || bytes.Count(out.Bytes(), frameMagic) != 1 {
+			t.Fatalf("Expected a single frame, found %d frame headers", bytes.Count(out.Bytes(), frameMagic))
+		}
+
+		// Read back with small reads
+		r := m.Reader(bytes.NewReader(out.Bytes()))
+		var got bytes.Buffer
+		small := make([]byte, 777)
+		for {
+			n, err := r.Read(small)
+			got.Write(small[:n])
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatalf("Read failed: %v", err)
+			}
+		}
+		if !bytes.Equal(got.Bytes(), data) {
+			t.Fatal("Data mismatch after round trip")
+		}
+	}
+}
+
+func TestInvalidOptionsIgnored(t *testing.T) {
+	m := New(WithBlockSize(12345), WithLevel(42))
+	if m.blockSize != lz4.Block4Mb || m.level != lz4.Fast {
+		t.Fatalf("Expected the defaults, got %v and %v", m.blockSize, m.level)
+	}
+}
+
+func TestCloseFinalizesFrame(t *testing.T) {
+	m := New()
+	out := &closeRecorder{}
+	w := m.Writer(out)
+	w.Write([]byte("pending data"))
+
+	// Without Close the block is still pending
+	if got, _ := io.ReadAll(m.Reader(bytes.NewReader(out.Bytes()))); len(got) != 0 {
+		t.Fatalf("Expected no data before Close, got %q", got)
+	}
+
+	w.(io.Closer).Close()
+	got, err := io.ReadAll(m.Reader(bytes.NewReader(out.Bytes())))
+	if err != nil || string(got) != "pending data" {
+		t.Fatalf("Expected data after Close, got %q, %v", got, err)
+	}
+}
+
+func TestReaderClosePropagates(t *testing.T) {
+	underlying := &closeRecorder{}
+	if err := New().Reader(underlying).(io.Closer).Close(); err != nil || !underlying.closed {
+		t.Fatal("Close was not propagated to the underlying reader")
+	}
+}
+
+func BenchmarkCompression(b *testing.B) {
+	data := logData(4 << 20)
+
+	b.Run("lz4", func(b *testing.B) {
+		m := New()
+		b.SetBytes(int64(len(data)))
+		for i := 0; i < b.N; i++ {
+			w := m.Writer(io.Discard)
+			w.Write(data)
+			w.(io.Closer).Close()
+		}
+	})
+
+	b.Run("gzip", func(b *testing.B) {
+		b.SetBytes(int64(len(data)))
+		for i := 0; i < b.N; i++ {
+			w := gzip.NewWriter(io.Discard)
+			w.Write(data)
+			w.Close()
+		}
+	})
+}
+
+func BenchmarkDecompression(b *testing.B) {
+	data := logData(4 << 20)
+
+	b.Run("lz4", func(b *testing.B) {
+		m := New()
+		var compressed bytes.Buffer
+		w := m.Writer(&compressed)
+		w.Write(data)
+		w.(io.Closer).Close()
+
+		b.SetBytes(int64(len(data)))
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			io.Copy(io.Discard, m.Reader(bytes.NewReader(compressed.Bytes())))
+		}
+	})
+
+	b.Run("gzip", func(b *testing.B) {
+		var compressed bytes.Buffer
+		w := gzip.NewWriter(&compressed)
+		w.Write(data)
+		w.Close()
+
+		b.SetBytes(int64(len(data)))
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			zr, _ := gzip.NewReader(bytes.NewReader(compressed.Bytes()))
+			io.Copy(io.Discard, zr)
+		}
+	})
+}
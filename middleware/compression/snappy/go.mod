@@ -0,0 +1,10 @@
+module schneider.vip/hybridbuffer/middleware/compression/snappy
+
+go 1.23.0
+
+toolchain go1.24.0
+
+require (
+	github.com/golang/snappy v1.0.0
+	schneider.vip/hybridbuffer/middleware v1.0.6
+)
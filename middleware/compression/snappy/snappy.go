@@ -0,0 +1,66 @@
+// Package snappy provides a Snappy compression middleware for HybridBuffer
+//
+// Snappy trades compression ratio for speed, which makes it a good fit for
+// high-throughput spilling of data that compresses poorly anyway.
+// Data is written in the Snappy framing format.
+package snappy
+
+import (
+	"errors"
+	"io"
+
+	"github.com/golang/snappy"
+)
+
+// Middleware compresses data with Snappy using the framing format
+type Middleware struct{}
+
+// New creates a Snappy middleware
+func New() *Middleware {
+	return &Middleware{}
+}
+
+// Stage returns 1, the value of hybridbuffer.StageCompression, so that
+// hybridbuffer.WithPipeline orders the middleware into the compression stage
+func (m *Middleware) Stage() int {
+	return 1
+}
+
+// Writer wraps w with a buffered Snappy compressor
+func (m *Middleware) Writer(w io.Writer) io.Writer {
+	return &writer{Writer: snappy.NewBufferedWriter(w), underlying: w}
+}
+
+// Reader wraps r with a Snappy decompressor
+func (m *Middleware) Reader(r io.Reader) io.Reader {
+	return &reader{Reader: snappy.NewReader(r), underlying: r}
+}
+
+// writer flushes the framing buffer on Close
+type writer struct {
+	*snappy.Writer
+	underlying io.Writer
+}
+
+// Close flushes buffered data and closes the underlying writer if it implements io.Closer
+func (w *writer) Close() error {
+	err := w.Writer.Close()
+	if closer, ok := w.underlying.(io.Closer); ok {
+		err = errors.Join(err, closer.Close())
+	}
+	return err
+}
+
+// reader closes the underlying reader
+type reader struct {
+	*snappy.Reader
+	underlying io.Reader
+}
+
+// Close closes the underlying reader if it implements io.Closer
+func (r *reader) Close() error {
+	if closer, ok := r.underlying.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
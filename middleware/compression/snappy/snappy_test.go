@@ -0,0 +1,123 @@
+package snappy
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"math/rand"
+	"testing"
+
+	"schneider.vip/hybridbuffer/middleware"
+)
+
+var _ middleware.Middleware = (*Middleware)(nil)
+var _ interface{ Stage() int } = (*Middleware)(nil)
+
+// closeRecorder records whether Close was called
+type closeRecorder struct {
+	bytes.Buffer
+	closed bool
+}
+
+func (c *closeRecorder) Close() error {
+	c.closed = true
+	return nil
+}
+
+// testData returns mostly incompressible binary data with some repetition
+func testData(size int) []byte {
+	rng := rand.New(rand.NewSource(1))
+	data := make([]byte, size)
+	rng.Read(data)
+	for i := 0; i < size; i += 4096 {
+		copy(data[i:], bytes.Repeat([]byte{0}, min(1024, size-i)))
+	}
+	return data
+}
+
+func TestRoundTripStreaming(t *testing.T) {
+	data := testData(1 << 20)
+	m := New()
+
+	// Write in small chunks like a spilling buffer does
+	out := &closeRecorder{}
+	w := m.Writer(out)
+	for chunk := data; len(chunk) > 0; {
+		n := min(len(chunk), 3000)
+		if _, err := w.Write(chunk[:n]); err != nil {
+			t.Fatalf("Write failed: %v", err)
+		}
+		chunk = chunk[n:]
+	}
+	if err := w.(io.Closer).Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if !out.closed {
+		t.Fatal("Close was not propagated to the underlying writer")
+	}
+
+	// Read back with small reads
+	r := m.Reader(bytes.NewReader(out.Bytes()))
+	var got bytes.Buffer
+	small := make([]byte, 777)
+	for {
+		n, err := r.Read(small)
+		got.Write(small[:n])
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Read failed: %v", err)
+		}
+	}
+	if !bytes.Equal(got.Bytes(), data) {
+		t.Fatal("Data mismatch after round trip")
+	}
+}
+
+func TestCloseFlushesBuffer(t *testing.T) {
+	m := New()
+	out := &closeRecorder{}
+	w := m.Writer(out)
+	w.Write([]byte("buffered"))
+
+	if out.Len() != 0 {
+		t.Fatal("Expected data to be buffered before Close")
+	}
+	w.(io.Closer).Close()
+
+	got, err := io.ReadAll(m.Reader(bytes.NewReader(out.Bytes())))
+	if err != nil || string(got) != "buffered" {
+		t.Fatalf("Expected data after Close, got %q, %v", got, err)
+	}
+}
+
+func TestReaderClosePropagates(t *testing.T) {
+	underlying := &closeRecorder{}
+	if err := New().Reader(underlying).(io.Closer).Close(); err != nil || !underlying.closed {
+		t.Fatal("Close was not propagated to the underlying reader")
+	}
+}
+
+func BenchmarkCompression(b *testing.B) {
+	data := testData(1 << 20)
+
+	b.Run("snappy", func(b *testing.B) {
+		m := New()
+		b.SetBytes(int64(len(data)))
+		for i := 0; i < b.N; i++ {
+			w := m.Writer(io.Discard)
+			w.Write(data)
+			w.(io.Closer).Close()
+		}
+	})
+
+	b.Run("gzip", func(b *testing.B) {
+		b.SetBytes(int64(len(data)))
+		for i := 0; i < b.N; i++ {
+			w := gzip.NewWriter(io.Discard)
+			w.Write(data)
+			w.Close()
+		}
+	})
+}
@@ -0,0 +1,396 @@
+// Package delta provides a middleware for HybridBuffer that stores data as a delta
+// against a base
+//
+// When near-identical large payloads are spilled repeatedly, e.g. successive
+// versions of a document, only the differences to a previous version need to be
+// stored. The writer finds blocks of the base in the written data with an
+// rsync-style rolling checksum and stores references to them instead of the data;
+// everything else is stored as literals. The reader rebuilds the data from the
+// base, so the base must not change while spilled data refers to it.
+package delta
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// ErrCorrupt is returned when a stream is not a valid delta encoding
+var ErrCorrupt = errors.New("delta: corrupt stream")
+
+// DefaultBlockSize is the size of the base blocks matched by default
+const DefaultBlockSize = 1024
+
+// maxLiteral is the amount of unmatched data the writer holds before storing it
+const maxLiteral = 64 << 10
+
+// Operations of the encoding
+// A literal is followed by its length and the data, a copy by the offset and
+// length of a range of the base; both numbers are unsigned varints.
+const (
+	opLiteral byte = 'L'
+	opCopy    byte = 'C'
+)
+
+// Middleware encodes streams as a delta against a base
+type Middleware struct {
+	base      io.ReaderAt
+	blockSize int
+
+	once  sync.Once
+	index map[uint32][]int64 // Rolling checksum to offsets of the base blocks
+	err   error
+}
+
+// Option configures the delta middleware
+type Option func(*Middleware)
+
+// WithBlockSize sets the size of the base blocks to match
+// Smaller blocks find shorter common runs but enlarge the index and the encoding.
+// Default: DefaultBlockSize
+func WithBlockSize(size int) Option {
+	return func(m *Middleware) {
+		if size > 0 {
+			m.blockSize = size
+		}
+	}
+}
+
+// New creates a delta middleware encoding against base
+// The base is indexed once, on the first write, by reading it to the end.
+//
+// Example usage:
+//
+//	delta.New(bytes.NewReader(previousVersion))
+func New(base io.ReaderAt, opts ...Option) *Middleware {
+	m := &Middleware{base: base, blockSize: DefaultBlockSize}
+	for _, opt := range opts {
+		opt(m)
+	}
+	return m
+}
+
+// Writer wraps w, encoding the written data as a delta
+func (m *Middleware) Writer(w io.Writer) io.Writer {
+	return &writer{m: m, underlying: w}
+}
+
+// Reader wraps r, rebuilding the data from the base
+func (m *Middleware) Reader(r io.Reader) io.Reader {
+	return &reader{m: m, underlying: r, r: bufio.NewReader(r)}
+}
+
+// buildIndex reads the base and records the checksum of every full block
+func (m *Middleware) buildIndex() {
+	m.index = make(map[uint32][]int64)
+	block := make([]byte, m.blockSize)
+	for off := int64(0); ; off += int64(m.blockSize) {
+		n, err := m.base.ReadAt(block, off)
+		if n == m.blockSize {
+			sum := newChecksum(block)
+			m.index[sum.value()] = append(m.index[sum.value()], off)
+		}
+		if err != nil && err != io.EOF {
+			m.err = fmt.Errorf("delta: failed to read base: %w", err)
+			return
+		}
+		if n < m.blockSize {
+			return
+		}
+	}
+}
+
+// match returns the offset of a base block equal to block
+func (m *Middleware) match(sum uint32, block, scratch []byte) (int64, bool, error) {
+	for _, off := range m.index[sum] {
+		if _, err := m.base.ReadAt(scratch, off); err != nil && err != io.EOF {
+			return 0, false, fmt.Errorf("delta: failed to read base: %w", err)
+		}
+		if bytes.Equal(scratch, block) {
+			return off, true, nil
+		}
+	}
+	return 0, false, nil
+}
+
+// checksum is the rsync rolling checksum of a block
+type checksum struct {
+	a, b uint32
+	n    uint32
+}
+
+func newChecksum(block []byte) checksum {
+	c := checksum{n: uint32(len(block))}
+	for i, x := range block {
+		c.a += uint32(x)
+		c.b += uint32(len(block)-i) * uint32(x)
+	}
+	return c
+}
+
+// roll moves the block one byte forward, dropping out and adding in
+func (c *checksum) roll(out, in byte) {
+	c.a += uint32(in) - uint32(out)
+	c.b += c.a - c.n*uint32(out)
+}
+
+func (c checksum) value() uint32 {
+	return c.a&0xffff | c.b<<16
+}
+
+// writer encodes the written data, holding back data that may still match a block
+type writer struct {
+	m          *Middleware
+	underlying io.Writer
+	buf        []byte   // Data not yet encoded
+	pos        int      // Start of the block checked next
+	sum        checksum // Checksum of buf[pos:pos+blockSize], valid if summed
+	summed     bool
+	copyOff    int64 // Pending copy, merged with adjacent matches
+	copyLen    int64
+	scratch    []byte
+	err        error
+	closed     bool
+}
+
+// Write implements io.Writer
+func (w *writer) Write(p []byte) (int, error) {
+	if w.closed {
+		return 0, errors.New("delta: write after close")
+	}
+	if w.err != nil {
+		return 0, w.err
+	}
+	w.m.once.Do(w.m.buildIndex)
+	if w.m.err != nil {
+		w.err = w.m.err
+		return 0, w.err
+	}
+
+	w.buf = append(w.buf, p...)
+	if w.err = w.encode(); w.err != nil {
+		return 0, w.err
+	}
+	return len(p), nil
+}
+
+// encode matches full blocks in the held back data and stores what was decided on
+func (w *writer) encode() error {
+	bs := w.m.blockSize
+	if w.scratch == nil {
+		w.scratch = make([]byte, bs)
+	}
+
+	for w.pos+bs <= len(w.buf) {
+		block := w.buf[w.pos : w.pos+bs]
+		if !w.summed {
+			w.sum = newChecksum(block)
+			w.summed = true
+		}
+
+		off, ok, err := w.m.match(w.sum.value(), block, w.scratch)
+		if err != nil {
+			return err
+		}
+		if ok {
+			if err := w.literal(w.buf[:w.pos]); err != nil {
+				return err
+			}
+			if err := w.copy(off, int64(bs)); err != nil {
+				return err
+			}
+			w.buf = w.buf[w.pos+bs:]
+			w.pos = 0
+			w.summed = false
+			continue
+		}
+
+		if w.pos+bs < len(w.buf) {
+			w.sum.roll(w.buf[w.pos], w.buf[w.pos+bs])
+		} else {
+			w.summed = false // The next byte has not arrived yet
+		}
+		w.pos++
+
+		// Store unmatched data early so the writer does not hold it all
+		if w.pos >= maxLiteral {
+			if err := w.literal(w.buf[:w.pos]); err != nil {
+				return err
+			}
+			w.buf = w.buf[w.pos:]
+			w.pos = 0
+		}
+	}
+
+	// Keep memory bounded by moving the held back data to the front
+	if len(w.buf) > 0 && cap(w.buf) > 2*maxLiteral && len(w.buf) < cap(w.buf)/4 {
+		w.buf = append([]byte(nil), w.buf...)
+	}
+	return nil
+}
+
+// copy records a reference to the base, merging it with the pending one if adjacent
+func (w *writer) copy(off, n int64) error {
+	if w.copyLen > 0 && w.copyOff+w.copyLen == off {
+		w.copyLen += n
+		return nil
+	}
+	if err := w.flushCopy(); err != nil {
+		return err
+	}
+	w.copyOff, w.copyLen = off, n
+	return nil
+}
+
+// flushCopy stores the pending copy
+func (w *writer) flushCopy() error {
+	if w.copyLen == 0 {
+		return nil
+	}
+	op := binary.AppendUvarint([]byte{opCopy}, uint64(w.copyOff))
+	op = binary.AppendUvarint(op, uint64(w.copyLen))
+	w.copyLen = 0
+	_, err := w.underlying.Write(op)
+	return err
+}
+
+// literal stores data as it is, after the pending copy
+func (w *writer) literal(data []byte) error {
+	if len(data) == 0 {
+		return nil
+	}
+	if err := w.flushCopy(); err != nil {
+		return err
+	}
+	op := binary.AppendUvarint([]byte{opLiteral}, uint64(len(data)))
+	if _, err := w.underlying.Write(op); err != nil {
+		return err
+	}
+	_, err := w.underlying.Write(data)
+	return err
+}
+
+// Close stores the held back data and closes the underlying writer if it
+// implements io.Closer
+func (w *writer) Close() error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+
+	err := w.err
+	if err == nil {
+		err = w.literal(w.buf)
+	}
+	if err == nil {
+		err = w.flushCopy()
+	}
+	w.buf = nil
+	if closer, ok := w.underlying.(io.Closer); ok {
+		err = errors.Join(err, closer.Close())
+	}
+	return err
+}
+
+// reader decodes the operations one at a time
+type reader struct {
+	m          *Middleware
+	underlying io.Reader
+	r          *bufio.Reader
+	op         byte
+	off        int64 // Next base offset of a copy
+	remaining  int64 // Bytes left in the current operation
+	err        error
+}
+
+// Read implements io.Reader
+func (r *reader) Read(p []byte) (int, error) {
+	if r.err != nil {
+		return 0, r.err
+	}
+	for r.remaining == 0 {
+		if r.err = r.next(); r.err != nil {
+			return 0, r.err
+		}
+	}
+
+	if int64(len(p)) > r.remaining {
+		p = p[:r.remaining]
+	}
+	var n int
+	var err error
+	if r.op == opLiteral {
+		n, err = r.r.Read(p)
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+	} else {
+		n, err = r.m.base.ReadAt(p, r.off)
+		r.off += int64(n)
+		if n == len(p) {
+			err = nil
+		} else if err == nil || err == io.EOF {
+			err = fmt.Errorf("%w: copy beyond the end of the base", ErrCorrupt)
+		}
+	}
+	r.remaining -= int64(n)
+	if err != nil {
+		r.err = err
+	}
+	return n, err
+}
+
+// next reads the next operation
+func (r *reader) next() error {
+	op, err := r.r.ReadByte()
+	if err != nil {
+		return err // io.EOF ends the stream cleanly
+	}
+
+	switch op {
+	case opLiteral:
+		n, err := r.uvarint()
+		if err != nil {
+			return err
+		}
+		r.remaining = int64(n)
+	case opCopy:
+		off, err := r.uvarint()
+		if err != nil {
+			return err
+		}
+		n, err := r.uvarint()
+		if err != nil {
+			return err
+		}
+		r.off, r.remaining = int64(off), int64(n)
+	default:
+		return fmt.Errorf("%w: unknown operation %q", ErrCorrupt, op)
+	}
+	r.op = op
+	return nil
+}
+
+// uvarint reads a number of an operation
+func (r *reader) uvarint() (uint64, error) {
+	n, err := binary.ReadUvarint(r.r)
+	if err == io.EOF {
+		return 0, io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return 0, fmt.Errorf("%w: %v", ErrCorrupt, err)
+	}
+	return n, nil
+}
+
+// Close closes the underlying reader if it implements io.Closer
+func (r *reader) Close() error {
+	if closer, ok := r.underlying.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
@@ -0,0 +1,166 @@
+package delta
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"math/rand"
+	"testing"
+
+	"schneider.vip/hybridbuffer/middleware"
+)
+
+var _ middleware.Middleware = (*Middleware)(nil)
+
+// closeRecorder records whether Close was called
+type closeRecorder struct {
+	bytes.Buffer
+	closed bool
+}
+
+func (c *closeRecorder) Close() error {
+	c.closed = true
+	return nil
+}
+
+func randomData(seed int64, n int) []byte {
+	data := make([]byte, n)
+	rand.New(rand.NewSource(seed)).Read(data)
+	return data
+}
+
+// roundTrip encodes data in chunks of chunkSize and decodes it again
+func roundTrip(t *testing.T, m *Middleware, data []byte, chunkSize int) (encoded []byte) {
+	t.Helper()
+
+	out := &closeRecorder{}
+	w := m.Writer(out)
+	for p := data; len(p) > 0; {
+		n := min(chunkSize, len(p))
+		if _, err := w.Write(p[:n]); err != nil {
+			t.Fatalf("Write failed: %v", err)
+		}
+		p = p[n:]
+	}
+	if err := w.(io.Closer).Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if !out.closed {
+		t.Fatal("Expected Close to close the underlying writer")
+	}
+
+	encoded = bytes.Clone(out.Bytes())
+	got, err := io.ReadAll(m.Reader(out))
+	if err != nil {
+		t.Fatalf("ReadAll failed: %v", err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Fatalf("Round trip mismatch: expected %d bytes, got %d", len(data), len(got))
+	}
+	return encoded
+}
+
+func TestSmallInsertion(t *testing.T) {
+	base := randomData(1, 256<<10)
+	data := append(bytes.Clone(base[:100000]), "a small insertion"...)
+	data = append(data, base[100000:]...)
+
+	m := New(bytes.NewReader(base))
+	for _, chunkSize := range []int{1 << 20, 4096, 7} {
+		encoded := roundTrip(t, m, data, chunkSize)
+		if len(encoded) > 4*DefaultBlockSize {
+			t.Fatalf("Chunk size %d: expected a small delta, got %d bytes for %d bytes of data", chunkSize, len(encoded), len(data))
+		}
+	}
+}
+
+func TestUnrelatedData(t *testing.T) {
+	base := randomData(1, 64<<10)
+	data := randomData(2, 200<<10) // Larger than maxLiteral
+
+	encoded := roundTrip(t, New(bytes.NewReader(base)), data, 10000)
+	if len(encoded) < len(data) {
+		t.Fatalf("Expected literals only, got %d bytes for %d bytes of data", len(encoded), len(data))
+	}
+}
+
+func TestEdgeCases(t *testing.T) {
+	base := randomData(1, 10000)
+
+	tests := []struct {
+		name string
+		base []byte
+		data []byte
+	}{
+		{"empty stream", base, nil},
+		{"shorter than a block", base, base[:100]},
+		{"identical", base, base},
+		{"empty base", nil, base},
+		{"base shorter than a block", base[:100], base},
+		{"repeated blocks", base, bytes.Repeat(base[:2048], 5)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			roundTrip(t, New(bytes.NewReader(tt.base)), tt.data, 333)
+		})
+	}
+}
+
+func TestWithBlockSize(t *testing.T) {
+	base := randomData(1, 10000)
+	data := append(bytes.Clone(base[:5000]), 'x')
+	data = append(data, base[5000:]...)
+
+	small := roundTrip(t, New(bytes.NewReader(base), WithBlockSize(64)), data, 1000)
+	large := roundTrip(t, New(bytes.NewReader(base)), data, 1000)
+	if len(small) >= len(large) {
+		t.Fatalf("Expected smaller blocks to store less literal data, got %d and %d bytes", len(small), len(large))
+	}
+}
+
+func TestCorruptStream(t *testing.T) {
+	m := New(bytes.NewReader(randomData(1, 1000)))
+
+	tests := []struct {
+		name    string
+		stream  []byte
+		wantErr error
+	}{
+		{"unknown operation", []byte{'X'}, ErrCorrupt},
+		{"copy beyond the base", []byte{opCopy, 0x90, 0x08, 0x10}, ErrCorrupt},
+		{"truncated literal", []byte{opLiteral, 10, 'a'}, io.ErrUnexpectedEOF},
+		{"truncated operation", []byte{opCopy}, io.ErrUnexpectedEOF},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := io.ReadAll(m.Reader(bytes.NewReader(tt.stream)))
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Expected %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+// failingReaderAt fails every read
+type failingReaderAt struct{}
+
+func (failingReaderAt) ReadAt([]byte, int64) (int, error) { return 0, errors.New("base unavailable") }
+
+func TestBaseError(t *testing.T) {
+	out := &closeRecorder{}
+	w := New(failingReaderAt{}).Writer(out)
+	if _, err := w.Write([]byte("data")); err == nil {
+		t.Fatal("Expected an error when the base cannot be read")
+	}
+	if err := w.(io.Closer).Close(); err == nil || !out.closed {
+		t.Fatalf("Expected Close to report the error and close the writer, got %v", err)
+	}
+}
+
+func TestReaderClose(t *testing.T) {
+	in := &closeRecorder{}
+	r := New(bytes.NewReader(nil)).Reader(in)
+	if err := r.(io.Closer).Close(); err != nil || !in.closed {
+		t.Fatalf("Expected Close to close the underlying reader, got %v", err)
+	}
+}
@@ -0,0 +1,84 @@
+// Package base64 provides a base64 encoding middleware for HybridBuffer
+//
+// It lets binary data be spilled to storage backends that only accept ASCII text.
+// The middleware must be the outermost layer, i.e. the last one applied on write,
+// so that the stored bytes are valid base64.
+package base64
+
+import (
+	"encoding/base64"
+	"errors"
+	"io"
+)
+
+// Middleware encodes data as base64
+type Middleware struct {
+	encoding *base64.Encoding
+}
+
+// Option configures the base64 middleware
+type Option func(*Middleware)
+
+// WithEncoding sets the base64 variant, e.g. base64.URLEncoding or base64.RawStdEncoding
+// Default is base64.StdEncoding.
+func WithEncoding(encoding *base64.Encoding) Option {
+	return func(m *Middleware) {
+		if encoding != nil {
+			m.encoding = encoding
+		}
+	}
+}
+
+// New creates a base64 middleware
+func New(opts ...Option) *Middleware {
+	m := &Middleware{encoding: base64.StdEncoding}
+	for _, opt := range opts {
+		opt(m)
+	}
+	return m
+}
+
+// Stage returns 4, the value of hybridbuffer.StageEncoding, so that
+// hybridbuffer.WithPipeline orders the middleware into the encoding stage
+func (m *Middleware) Stage() int {
+	return 4
+}
+
+// Writer wraps w with a base64 encoder
+func (m *Middleware) Writer(w io.Writer) io.Writer {
+	return &writer{WriteCloser: base64.NewEncoder(m.encoding, w), underlying: w}
+}
+
+// Reader wraps r with a base64 decoder
+func (m *Middleware) Reader(r io.Reader) io.Reader {
+	return &reader{Reader: base64.NewDecoder(m.encoding, r), underlying: r}
+}
+
+// writer flushes the final partial group on Close
+type writer struct {
+	io.WriteCloser
+	underlying io.Writer
+}
+
+// Close flushes the final partial group and closes the underlying writer if it implements io.Closer
+func (w *writer) Close() error {
+	err := w.WriteCloser.Close()
+	if closer, ok := w.underlying.(io.Closer); ok {
+		err = errors.Join(err, closer.Close())
+	}
+	return err
+}
+
+// reader closes the underlying reader
+type reader struct {
+	io.Reader
+	underlying io.Reader
+}
+
+// Close closes the underlying reader if it implements io.Closer
+func (r *reader) Close() error {
+	if closer, ok := r.underlying.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+package base64
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io"
+	"testing"
+	"testing/iotest"
+
+	"schneider.vip/hybridbuffer/middleware"
+)
+
+var _ middleware.Middleware = (*Middleware)(nil)
+var _ interface{ Stage() int } = (*Middleware)(nil)
+
+// closeRecorder records whether Close was called
+type closeRecorder struct {
+	bytes.Buffer
+	closed bool
+}
+
+func (c *closeRecorder) Close() error {
+	c.closed = true
+	return nil
+}
+
+func encode(t *testing.T, m *Middleware, data []byte) *closeRecorder {
+	t.Helper()
+
+	out := &closeRecorder{}
+	w := m.Writer(out)
+	if _, err := w.Write(data); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	if err := w.(io.Closer).Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if !out.closed {
+		t.Fatal("Close was not propagated to the underlying writer")
+	}
+	return out
+}
+
+func TestRoundTrip(t *testing.T) {
+	data := make([]byte, 10_000)
+	for i := range data {
+		data[i] = byte(i)
+	}
+
+	m := New()
+	encoded := encode(t, m, data)
+	if want := base64.StdEncoding.EncodeToString(data); encoded.String() != want {
+		t.Fatal("Stored data is not standard base64")
+	}
+
+	got, err := io.ReadAll(m.Reader(iotest.HalfReader(bytes.NewReader(encoded.Bytes()))))
+	if err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Fatal("Data mismatch")
+	}
+}
+
+func TestPartialGroups(t *testing.T) {
+	encodings := map[string]*base64.Encoding{
+		"std":     base64.StdEncoding,
+		"url":     base64.URLEncoding,
+		"raw std": base64.RawStdEncoding,
+		"raw url": base64.RawURLEncoding,
+	}
+
+	for name, encoding := range encodings {
+		m := New(WithEncoding(encoding))
+		// Lengths 1, 2, 4 and 5 leave a partial group that only Close writes
+		for _, size := range []int{0, 1, 2, 3, 4, 5} {
+			data := bytes.Repeat([]byte{0xFF}, size)
+
+			encoded := encode(t, m, data)
+			if want := encoding.EncodeToString(data); encoded.String() != want {
+				t.Fatalf("%s, %d bytes: expected %q, got %q", name, size, want, encoded.String())
+			}
+
+			got, err := io.ReadAll(m.Reader(bytes.NewReader(encoded.Bytes())))
+			if err != nil {
+				t.Fatalf("%s, %d bytes: read failed: %v", name, size, err)
+			}
+			if !bytes.Equal(got, data) {
+				t.Fatalf("%s, %d bytes: data mismatch", name, size)
+			}
+		}
+	}
+}
+
+func TestInvalidInput(t *testing.T) {
+	if _, err := io.ReadAll(New().Reader(bytes.NewReader([]byte("not base64!")))); err == nil {
+		t.Fatal("Expected an error decoding invalid base64")
+	}
+}
+
+func TestReaderClosePropagates(t *testing.T) {
+	m := New()
+	encoded := encode(t, m, []byte("data"))
+
+	underlying := &closeRecorder{Buffer: *bytes.NewBuffer(encoded.Bytes())}
+	if err := m.Reader(underlying).(io.Closer).Close(); err != nil || !underlying.closed {
+		t.Fatal("Close was not propagated to the underlying reader")
+	}
+}
@@ -0,0 +1,127 @@
+// Package age provides an age encryption middleware for HybridBuffer
+//
+// Spilled data is written in the age file format (https://age-encryption.org),
+// so it can be decrypted with the age command line tool and other age implementations.
+package age
+
+import (
+	"errors"
+	"io"
+
+	"filippo.io/age"
+)
+
+// ErrNoIdentity is returned when reading from a middleware created without identities
+var ErrNoIdentity = errors.New("age: no identities configured for decryption")
+
+// ErrNoRecipient is returned when writing to a middleware created without recipients
+var ErrNoRecipient = errors.New("age: no recipients configured for encryption")
+
+// Middleware encrypts data to age recipients and decrypts it with age identities
+type Middleware struct {
+	recipients []age.Recipient
+	identities []age.Identity
+}
+
+// New creates a middleware encrypting to the given recipients
+// Use NewWithIdentities or WithIdentities to be able to read the data back.
+func New(recipients ...age.Recipient) *Middleware {
+	return &Middleware{recipients: recipients}
+}
+
+// NewWithIdentities creates a middleware decrypting with the given identities
+// X25519 identities also encrypt to their own recipient, so a middleware created
+// from them can both write and read.
+func NewWithIdentities(identities ...age.Identity) *Middleware {
+	m := &Middleware{}
+	return m.WithIdentities(identities...)
+}
+
+// WithIdentities adds identities for decryption and returns the middleware
+func (m *Middleware) WithIdentities(identities ...age.Identity) *Middleware {
+	m.identities = append(m.identities, identities...)
+	for _, identity := range identities {
+		if x, ok := identity.(*age.X25519Identity); ok {
+			m.recipients = append(m.recipients, x.Recipient())
+		}
+	}
+	return m
+}
+
+// Stage returns 3, the value of hybridbuffer.StageEncryption, so that
+// hybridbuffer.WithPipeline orders the middleware into the encryption stage
+func (m *Middleware) Stage() int {
+	return 3
+}
+
+// Writer wraps w with an age encryptor
+func (m *Middleware) Writer(w io.Writer) io.Writer {
+	if len(m.recipients) == 0 {
+		return &writer{err: ErrNoRecipient, underlying: w}
+	}
+	encrypted, err := age.Encrypt(w, m.recipients...)
+	return &writer{WriteCloser: encrypted, err: err, underlying: w}
+}
+
+// Reader wraps r with an age decryptor
+func (m *Middleware) Reader(r io.Reader) io.Reader {
+	return &reader{identities: m.identities, underlying: r}
+}
+
+// writer finalizes the age stream on Close
+type writer struct {
+	io.WriteCloser
+	err        error
+	underlying io.Writer
+}
+
+// Write implements io.Writer
+func (w *writer) Write(p []byte) (int, error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+	return w.WriteCloser.Write(p)
+}
+
+// Close writes the final chunk and closes the underlying writer if it implements io.Closer
+func (w *writer) Close() error {
+	err := w.err
+	if err == nil {
+		err = w.WriteCloser.Close()
+	}
+	if closer, ok := w.underlying.(io.Closer); ok {
+		err = errors.Join(err, closer.Close())
+	}
+	return err
+}
+
+// reader defers parsing the age header to the first Read
+type reader struct {
+	identities []age.Identity
+	underlying io.Reader
+	decrypted  io.Reader
+	err        error
+}
+
+// Read implements io.Reader
+func (r *reader) Read(p []byte) (int, error) {
+	if r.decrypted == nil && r.err == nil {
+		if len(r.identities) == 0 {
+			r.err = ErrNoIdentity
+		} else {
+			r.decrypted, r.err = age.Decrypt(r.underlying, r.identities...)
+		}
+	}
+	if r.err != nil {
+		return 0, r.err
+	}
+	return r.decrypted.Read(p)
+}
+
+// Close closes the underlying reader if it implements io.Closer
+func (r *reader) Close() error {
+	if closer, ok := r.underlying.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+package age
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+
+	"filippo.io/age"
+	"schneider.vip/hybridbuffer/middleware"
+)
+
+var _ middleware.Middleware = (*Middleware)(nil)
+var _ interface{ Stage() int } = (*Middleware)(nil)
+
+// closeRecorder records whether Close was called
+type closeRecorder struct {
+	bytes.Buffer
+	closed bool
+}
+
+func (c *closeRecorder) Close() error {
+	c.closed = true
+	return nil
+}
+
+func encrypt(t *testing.T, m *Middleware, data []byte) *closeRecorder {
+	t.Helper()
+
+	out := &closeRecorder{}
+	w := m.Writer(out)
+	if _, err := w.Write(data); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	if err := w.(io.Closer).Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if !out.closed {
+		t.Fatal("Close was not propagated to the underlying writer")
+	}
+	return out
+}
+
+func TestRoundTrip(t *testing.T) {
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := bytes.Repeat([]byte("age encrypted "), 10_000)
+
+	encrypted := encrypt(t, New(identity.Recipient()), data)
+	if bytes.Contains(encrypted.Bytes(), []byte("age encrypted")) {
+		t.Fatal("Plaintext found in encrypted data")
+	}
+
+	got, err := io.ReadAll(NewWithIdentities(identity).Reader(bytes.NewReader(encrypted.Bytes())))
+	if err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Fatal("Data mismatch")
+	}
+}
+
+func TestStandardFormat(t *testing.T) {
+	identity, _ := age.GenerateX25519Identity()
+	encrypted := encrypt(t, NewWithIdentities(identity), []byte("interoperable"))
+
+	// Data must be decryptable by plain age
+	r, err := age.Decrypt(bytes.NewReader(encrypted.Bytes()), identity)
+	if err != nil {
+		t.Fatalf("age.Decrypt failed: %v", err)
+	}
+	if got, _ := io.ReadAll(r); string(got) != "interoperable" {
+		t.Fatalf("Expected interoperable, got %q", got)
+	}
+}
+
+func TestWrongIdentity(t *testing.T) {
+	identity, _ := age.GenerateX25519Identity()
+	other, _ := age.GenerateX25519Identity()
+	encrypted := encrypt(t, New(identity.Recipient()), []byte("secret"))
+
+	if _, err := io.ReadAll(NewWithIdentities(other).Reader(bytes.NewReader(encrypted.Bytes()))); err == nil {
+		t.Fatal("Expected an error decrypting with the wrong identity")
+	}
+}
+
+func TestMissingKeys(t *testing.T) {
+	if _, err := New().Writer(io.Discard).Write([]byte("data")); !errors.Is(err, ErrNoRecipient) {
+		t.Fatalf("Expected ErrNoRecipient, got %v", err)
+	}
+
+	identity, _ := age.GenerateX25519Identity()
+	encrypted := encrypt(t, New(identity.Recipient()), []byte("data"))
+	if _, err := io.ReadAll(New(identity.Recipient()).Reader(bytes.NewReader(encrypted.Bytes()))); !errors.Is(err, ErrNoIdentity) {
+		t.Fatalf("Expected ErrNoIdentity, got %v", err)
+	}
+}
+
+func TestReaderClosePropagates(t *testing.T) {
+	identity, _ := age.GenerateX25519Identity()
+	underlying := &closeRecorder{}
+	if err := NewWithIdentities(identity).Reader(underlying).(io.Closer).Close(); err != nil || !underlying.closed {
+		t.Fatal("Close was not propagated to the underlying reader")
+	}
+}
@@ -0,0 +1,15 @@
+module schneider.vip/hybridbuffer/middleware/encryption/age
+
+go 1.23.0
+
+toolchain go1.24.0
+
+require (
+	filippo.io/age v1.2.1
+	schneider.vip/hybridbuffer/middleware v1.0.6
+)
+
+require (
+	golang.org/x/crypto v0.24.0 // indirect
+	golang.org/x/sys v0.21.0 // indirect
+)
@@ -0,0 +1,12 @@
+module schneider.vip/hybridbuffer/middleware/encryption/secretbox
+
+go 1.23.0
+
+toolchain go1.24.0
+
+require (
+	golang.org/x/crypto v0.36.0
+	schneider.vip/hybridbuffer/middleware v1.0.6
+)
+
+require golang.org/x/sys v0.31.0 // indirect
@@ -0,0 +1,248 @@
+// Package secretbox provides a NaCl secretbox encryption middleware for HybridBuffer
+//
+// secretbox (XSalsa20 and Poly1305) seals whole messages, so the stream is split
+// into frames of at most FrameSize bytes, each sealed and authenticated on its own.
+// Nonces consist of a random prefix per stream and a frame counter, and the last
+// frame is marked, so reordered, dropped or truncated frames are detected as well
+// as modified ones.
+package secretbox
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"golang.org/x/crypto/nacl/secretbox"
+)
+
+// ErrDecrypt is returned when a frame fails authentication or the stream was
+// truncated, e.g. because the data was tampered with or the key is wrong
+var ErrDecrypt = errors.New("secretbox: decryption failed")
+
+// FrameSize is the maximum number of plaintext bytes sealed per frame
+const FrameSize = 64 << 10
+
+// prefixSize is the size of the random nonce prefix written at the stream start
+const prefixSize = 16
+
+// maxFrames is the number of frames the 7-byte counter can address
+const maxFrames = 1 << 56
+
+// Middleware encrypts streams with NaCl secretbox
+//
+// Stream format: a random 16-byte nonce prefix, followed by frames of a 4-byte
+// big-endian length and the sealed box. The nonce of a frame is the prefix, the
+// frame index as a 7-byte big-endian number and a final-frame flag.
+type Middleware struct {
+	key [32]byte
+}
+
+// New creates a secretbox middleware with a 32-byte key
+// The key must be kept secret and should come from a secure random source.
+func New(key [32]byte) *Middleware {
+	return &Middleware{key: key}
+}
+
+// Stage returns 3, the value of hybridbuffer.StageEncryption, so that
+// hybridbuffer.WithPipeline orders the middleware into the encryption stage
+func (m *Middleware) Stage() int {
+	return 3
+}
+
+// Writer wraps w, sealing the data in frames
+func (m *Middleware) Writer(w io.Writer) io.Writer {
+	return &writer{m: m, underlying: w}
+}
+
+// Reader wraps r, opening and authenticating each frame
+func (m *Middleware) Reader(r io.Reader) io.Reader {
+	return &reader{m: m, underlying: r}
+}
+
+// nonce returns the nonce of frame index of a stream
+func nonce(prefix *[prefixSize]byte, index uint64, final bool) *[24]byte {
+	var n [24]byte
+	copy(n[:prefixSize], prefix[:])
+	var counter [8]byte
+	binary.BigEndian.PutUint64(counter[:], index)
+	copy(n[prefixSize:23], counter[1:])
+	if final {
+		n[23] = 1
+	}
+	return &n
+}
+
+// writer collects data into frames and seals each full frame
+type writer struct {
+	m          *Middleware
+	underlying io.Writer
+	prefix     *[prefixSize]byte // Set once the stream header was written
+	index      uint64
+	buf        []byte
+	sealed     []byte
+	err        error
+}
+
+// start writes the random nonce prefix
+func (w *writer) start() error {
+	var prefix [prefixSize]byte
+	if _, err := rand.Read(prefix[:]); err != nil {
+		return fmt.Errorf("secretbox: failed to generate nonce prefix: %w", err)
+	}
+	if _, err := w.underlying.Write(prefix[:]); err != nil {
+		return err
+	}
+	w.prefix = &prefix
+	w.buf = make([]byte, 0, FrameSize)
+	return nil
+}
+
+// seal writes the buffered data as one frame
+func (w *writer) seal(final bool) error {
+	if w.index >= maxFrames {
+		return errors.New("secretbox: stream too long")
+	}
+	w.sealed = binary.BigEndian.AppendUint32(w.sealed[:0], uint32(len(w.buf)+secretbox.Overhead))
+	w.sealed = secretbox.Seal(w.sealed, w.buf, nonce(w.prefix, w.index, final), &w.m.key)
+	w.index++
+	w.buf = w.buf[:0]
+	_, err := w.underlying.Write(w.sealed)
+	return err
+}
+
+// Write implements io.Writer
+func (w *writer) Write(p []byte) (n int, err error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+	if w.prefix == nil {
+		if w.err = w.start(); w.err != nil {
+			return 0, w.err
+		}
+	}
+
+	for len(p) > 0 {
+		// A full frame is only sealed once more data arrives, so the last frame
+		// sealed by Close is never empty unless the stream is
+		if len(w.buf) == FrameSize {
+			if w.err = w.seal(false); w.err != nil {
+				return n, w.err
+			}
+		}
+		m := copy(w.buf[len(w.buf):FrameSize], p)
+		w.buf = w.buf[:len(w.buf)+m]
+		n += m
+		p = p[m:]
+	}
+	return n, nil
+}
+
+// Close seals the final frame and closes the underlying writer if it implements io.Closer
+// An empty stream still gets a header and an empty final frame.
+func (w *writer) Close() error {
+	err := w.err
+	if err == nil && w.prefix == nil {
+		err = w.start()
+	}
+	if err == nil {
+		err = w.seal(true)
+	}
+	w.err = errors.New("secretbox: write to closed writer")
+
+	if closer, ok := w.underlying.(io.Closer); ok {
+		err = errors.Join(err, closer.Close())
+	}
+	return err
+}
+
+// reader opens one frame at a time
+type reader struct {
+	m          *Middleware
+	underlying io.Reader
+	prefix     *[prefixSize]byte
+	index      uint64
+	final      bool // The final frame was opened
+	sealed     []byte
+	plain      []byte
+	unread     []byte // Opened data not yet returned
+	err        error
+}
+
+// Read implements io.Reader
+func (r *reader) Read(p []byte) (int, error) {
+	for len(r.unread) == 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
+		r.err = r.next()
+	}
+	n := copy(p, r.unread)
+	r.unread = r.unread[n:]
+	return n, nil
+}
+
+// next opens the next frame
+func (r *reader) next() error {
+	if r.final {
+		// Data after the final frame was appended by someone without the key
+		var extra [1]byte
+		if n, _ := io.ReadFull(r.underlying, extra[:]); n > 0 {
+			return fmt.Errorf("%w: data after the final frame", ErrDecrypt)
+		}
+		return io.EOF
+	}
+
+	if r.prefix == nil {
+		var prefix [prefixSize]byte
+		if _, err := io.ReadFull(r.underlying, prefix[:]); err != nil {
+			return truncated(err)
+		}
+		r.prefix = &prefix
+	}
+
+	var length [4]byte
+	if _, err := io.ReadFull(r.underlying, length[:]); err != nil {
+		return truncated(err)
+	}
+	size := binary.BigEndian.Uint32(length[:])
+	if size < secretbox.Overhead || size > FrameSize+secretbox.Overhead {
+		return fmt.Errorf("%w: invalid frame length %d", ErrDecrypt, size)
+	}
+	if cap(r.sealed) < int(size) {
+		r.sealed = make([]byte, size)
+	}
+	r.sealed = r.sealed[:size]
+	if _, err := io.ReadFull(r.underlying, r.sealed); err != nil {
+		return truncated(err)
+	}
+
+	for _, final := range []bool{false, true} {
+		plain, ok := secretbox.Open(r.plain[:0], r.sealed, nonce(r.prefix, r.index, final), &r.m.key)
+		if ok {
+			r.plain = plain
+			r.unread = plain
+			r.final = final
+			r.index++
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: frame %d failed authentication", ErrDecrypt, r.index)
+}
+
+// truncated reports a stream that ended before its final frame
+func truncated(err error) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return fmt.Errorf("%w: truncated stream", ErrDecrypt)
+	}
+	return err
+}
+
+// Close closes the underlying reader if it implements io.Closer
+func (r *reader) Close() error {
+	if closer, ok := r.underlying.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
@@ -0,0 +1,154 @@
+package secretbox
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"io"
+	"testing"
+
+	"golang.org/x/crypto/nacl/secretbox"
+	"schneider.vip/hybridbuffer/middleware"
+)
+
+var _ middleware.Middleware = (*Middleware)(nil)
+var _ interface{ Stage() int } = (*Middleware)(nil)
+
+// closeRecorder records whether Close was called
+type closeRecorder struct {
+	bytes.Buffer
+	closed bool
+}
+
+func (c *closeRecorder) Close() error {
+	c.closed = true
+	return nil
+}
+
+func newKey(t *testing.T) [32]byte {
+	t.Helper()
+	var key [32]byte
+	if _, err := rand.Read(key[:]); err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+// seal encrypts data in chunks of chunkSize
+func seal(t *testing.T, m *Middleware, data []byte, chunkSize int) []byte {
+	t.Helper()
+
+	out := &closeRecorder{}
+	w := m.Writer(out)
+	for p := data; len(p) > 0; {
+		n := min(chunkSize, len(p))
+		if _, err := w.Write(p[:n]); err != nil {
+			t.Fatalf("Write failed: %v", err)
+		}
+		p = p[n:]
+	}
+	if err := w.(io.Closer).Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if !out.closed {
+		t.Fatal("Expected Close to close the underlying writer")
+	}
+	return out.Bytes()
+}
+
+func open(m *Middleware, sealed []byte) ([]byte, error) {
+	return io.ReadAll(m.Reader(bytes.NewReader(sealed)))
+}
+
+func TestRoundTrip(t *testing.T) {
+	m := New(newKey(t))
+
+	for _, size := range []int{0, 1, FrameSize - 1, FrameSize, FrameSize + 1, 3*FrameSize + 17} {
+		data := make([]byte, size)
+		rand.Read(data)
+
+		for _, chunkSize := range []int{1 << 20, 1000} {
+			sealed := seal(t, m, data, chunkSize)
+			frames := max(1, (size+FrameSize-1)/FrameSize)
+			if want := prefixSize + size + frames*(4+secretbox.Overhead); len(sealed) != want {
+				t.Fatalf("Size %d: expected %d sealed bytes, got %d", size, want, len(sealed))
+			}
+
+			got, err := open(m, sealed)
+			if err != nil {
+				t.Fatalf("Size %d: decryption failed: %v", size, err)
+			}
+			if !bytes.Equal(got, data) {
+				t.Fatalf("Size %d: round trip mismatch", size)
+			}
+		}
+	}
+}
+
+func TestRandomNoncePrefix(t *testing.T) {
+	m := New(newKey(t))
+	data := []byte("same data")
+	if bytes.Equal(seal(t, m, data, 100), seal(t, m, data, 100)) {
+		t.Fatal("Expected different ciphertexts for the same data")
+	}
+}
+
+func TestTampering(t *testing.T) {
+	m := New(newKey(t))
+	data := make([]byte, 3*FrameSize+100)
+	rand.Read(data)
+	sealed := seal(t, m, data, 1<<20)
+	frame := 4 + FrameSize + secretbox.Overhead
+
+	swapped := bytes.Clone(sealed)
+	copy(swapped[prefixSize:], sealed[prefixSize+frame:prefixSize+2*frame])
+	copy(swapped[prefixSize+frame:], sealed[prefixSize:prefixSize+frame])
+
+	tests := []struct {
+		name   string
+		sealed []byte
+	}{
+		{"modified frame", func() []byte { s := bytes.Clone(sealed); s[prefixSize+frame+100] ^= 1; return s }()},
+		{"modified prefix", func() []byte { s := bytes.Clone(sealed); s[0] ^= 1; return s }()},
+		{"reordered frames", swapped},
+		{"dropped final frame", sealed[:prefixSize+3*frame]},
+		{"truncated frame", sealed[:len(sealed)-10]},
+		{"trailing data", append(bytes.Clone(sealed), 0)},
+		{"invalid length", func() []byte { s := bytes.Clone(sealed); s[prefixSize] = 0xff; return s }()},
+		{"wrong key", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reader := m
+			if tt.sealed == nil {
+				tt.sealed, reader = sealed, New(newKey(t))
+			}
+			if _, err := open(reader, tt.sealed); !errors.Is(err, ErrDecrypt) {
+				t.Fatalf("Expected ErrDecrypt, got %v", err)
+			}
+		})
+	}
+}
+
+func TestEmptyInput(t *testing.T) {
+	m := New(newKey(t))
+	if _, err := open(m, nil); !errors.Is(err, ErrDecrypt) {
+		t.Fatalf("Expected ErrDecrypt for a stream without header, got %v", err)
+	}
+}
+
+func TestWriteAfterClose(t *testing.T) {
+	w := New(newKey(t)).Writer(&closeRecorder{})
+	w.(io.Closer).Close()
+	if _, err := w.Write([]byte("late")); err == nil {
+		t.Fatal("Expected an error writing after Close")
+	}
+}
+
+func TestReaderClose(t *testing.T) {
+	in := &closeRecorder{}
+	r := New(newKey(t)).Reader(in)
+	if err := r.(io.Closer).Close(); err != nil || !in.closed {
+		t.Fatalf("Expected Close to close the underlying reader, got %v", err)
+	}
+}
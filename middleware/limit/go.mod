@@ -0,0 +1,7 @@
+module schneider.vip/hybridbuffer/middleware/limit
+
+go 1.23.0
+
+toolchain go1.24.0
+
+require schneider.vip/hybridbuffer/middleware v1.0.6
@@ -0,0 +1,70 @@
+// Package limit provides a middleware wrapper for HybridBuffer that caps the amount of decoded data
+package limit
+
+import (
+	"errors"
+	"io"
+
+	"schneider.vip/hybridbuffer/middleware"
+)
+
+// ErrDecompressedLimit is returned when a reader produces more data than allowed
+var ErrDecompressedLimit = errors.New("limit: decompressed size limit exceeded")
+
+// Middleware wraps another middleware and limits the size of the data it decodes
+type Middleware struct {
+	middleware middleware.Middleware
+	max        int64
+}
+
+// Wrap returns a middleware that behaves like m, but whose readers fail with
+// ErrDecompressedLimit once they would produce more than max bytes
+// This guards decompression middlewares against zip bombs in untrusted storage.
+// Writers are passed through unchanged.
+func Wrap(m middleware.Middleware, max int64) *Middleware {
+	if max < 0 {
+		panic("limit: max must not be negative")
+	}
+	return &Middleware{middleware: m, max: max}
+}
+
+// Writer returns the writer of the wrapped middleware
+func (m *Middleware) Writer(w io.Writer) io.Writer {
+	return m.middleware.Writer(w)
+}
+
+// Reader returns the reader of the wrapped middleware with the size limit applied
+func (m *Middleware) Reader(r io.Reader) io.Reader {
+	return &reader{r: m.middleware.Reader(r), remaining: m.max}
+}
+
+// reader counts decoded bytes and aborts once the limit is exceeded
+type reader struct {
+	r         io.Reader
+	remaining int64
+}
+
+func (r *reader) Read(p []byte) (int, error) {
+	// Read one byte more than allowed to detect an exceeded limit
+	// Comparing without adding 1 avoids overflowing for a limit of math.MaxInt64.
+	if r.remaining < int64(len(p))-1 {
+		p = p[:r.remaining+1]
+	}
+
+	n, err := r.r.Read(p)
+	if int64(n) > r.remaining {
+		n = int(r.remaining)
+		r.remaining = 0
+		return n, ErrDecompressedLimit
+	}
+	r.remaining -= int64(n)
+	return n, err
+}
+
+// Close closes the underlying reader if it implements io.Closer
+func (r *reader) Close() error {
+	if closer, ok := r.r.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+package limit
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"math"
+	"testing"
+
+	"schneider.vip/hybridbuffer/middleware"
+)
+
+var _ middleware.Middleware = (*Middleware)(nil)
+
+// gzipMiddleware is a minimal decompression middleware for testing
+type gzipMiddleware struct{}
+
+func (gzipMiddleware) Writer(w io.Writer) io.Writer {
+	return gzip.NewWriter(w)
+}
+
+func (gzipMiddleware) Reader(r io.Reader) io.Reader {
+	zr, err := gzip.NewReader(r)
+	if err != nil {
+		return errReader{err}
+	}
+	return zr
+}
+
+type errReader struct{ err error }
+
+func (e errReader) Read([]byte) (int, error) { return 0, e.err }
+
+func compress(t *testing.T, m middleware.Middleware, data []byte) []byte {
+	t.Helper()
+	var out bytes.Buffer
+	w := m.Writer(&out)
+	if _, err := w.Write(data); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	if err := w.(io.Closer).Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	return out.Bytes()
+}
+
+func TestReaderStopsAtLimit(t *testing.T) {
+	const max = 64 << 10
+
+	// A highly repetitive payload compresses to a tiny object
+	payload := bytes.Repeat([]byte{0}, 16<<20)
+	m := Wrap(gzipMiddleware{}, max)
+	compressed := compress(t, m, payload)
+	if len(compressed) >= max {
+		t.Fatalf("Expected a small compressed object, got %d bytes", len(compressed))
+	}
+
+	got, err := io.ReadAll(m.Reader(bytes.NewReader(compressed)))
+	if !errors.Is(err, ErrDecompressedLimit) {
+		t.Fatalf("Expected ErrDecompressedLimit, got %v", err)
+	}
+	if len(got) != max {
+		t.Fatalf("Expected read to stop at %d bytes, got %d", max, len(got))
+	}
+}
+
+func TestReaderWithinLimit(t *testing.T) {
+	payload := bytes.Repeat([]byte("hybridbuffer"), 1000)
+
+	for _, max := range []int64{int64(len(payload)), int64(len(payload)) + 1} {
+		m := Wrap(gzipMiddleware{}, max)
+		got, err := io.ReadAll(m.Reader(bytes.NewReader(compress(t, m, payload))))
+		if err != nil {
+			t.Fatalf("Unexpected error with limit %d: %v", max, err)
+		}
+		if !bytes.Equal(got, payload) {
+			t.Fatalf("Data mismatch with limit %d", max)
+		}
+	}
+}
+
+func TestReaderOneByteOverLimit(t *testing.T) {
+	payload := []byte("0123456789")
+	m := Wrap(gzipMiddleware{}, int64(len(payload))-1)
+
+	got, err := io.ReadAll(m.Reader(bytes.NewReader(compress(t, m, payload))))
+	if !errors.Is(err, ErrDecompressedLimit) {
+		t.Fatalf("Expected ErrDecompressedLimit, got %v", err)
+	}
+	if string(got) != "012345678" {
+		t.Fatalf("Expected data up to the limit, got %q", got)
+	}
+}
+
+func TestReaderMaxInt64(t *testing.T) {
+	payload := bytes.Repeat([]byte("hybridbuffer"), 1000)
+	m := Wrap(gzipMiddleware{}, math.MaxInt64)
+
+	got, err := io.ReadAll(m.Reader(bytes.NewReader(compress(t, m, payload))))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !bytes.Equal(got, payload) {
+		t.Fatal("Data mismatch")
+	}
+}
@@ -0,0 +1,162 @@
+// Package padding provides a middleware for HybridBuffer that pads data to a multiple of a block size
+//
+// Padding hides the exact size of spilled objects, e.g. against traffic analysis.
+// Place it after compression and before encryption: compressing padded data would
+// shrink the padding again, and unencrypted padding is easy to strip.
+package padding
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// ErrInvalidPadding is returned when a stream does not end with valid padding
+var ErrInvalidPadding = errors.New("padding: invalid padding")
+
+// trailerSize is the size of the trailer recording the padding length
+const trailerSize = 8
+
+// Middleware pads streams to a multiple of its block size
+// The padding consists of zero bytes followed by an 8-byte big-endian trailer
+// holding the total padding length, trailer included.
+type Middleware struct {
+	blockSize int
+}
+
+// New creates a padding middleware for the given block size
+func New(blockSize int) *Middleware {
+	if blockSize <= 0 {
+		panic("padding: blockSize must be positive")
+	}
+	return &Middleware{blockSize: blockSize}
+}
+
+// Stage returns 2, the value of hybridbuffer.StagePadding, so that
+// hybridbuffer.WithPipeline orders the middleware into the padding stage
+func (m *Middleware) Stage() int {
+	return 2
+}
+
+// Writer wraps w, appending the padding on Close
+func (m *Middleware) Writer(w io.Writer) io.Writer {
+	return &writer{m: m, w: w}
+}
+
+// Reader wraps r, stripping the padding
+func (m *Middleware) Reader(r io.Reader) io.Reader {
+	return &reader{r: r, maxPadding: m.blockSize - 1 + trailerSize}
+}
+
+// paddingLength returns the padding needed after n bytes of data
+func (m *Middleware) paddingLength(n int64) int {
+	return trailerSize + int((int64(m.blockSize)-(n+trailerSize)%int64(m.blockSize))%int64(m.blockSize))
+}
+
+// writer counts the data and writes the padding on Close
+type writer struct {
+	m       *Middleware
+	w       io.Writer
+	written int64
+	closed  bool
+}
+
+// Write implements io.Writer
+func (w *writer) Write(p []byte) (int, error) {
+	if w.closed {
+		return 0, errors.New("padding: write after close")
+	}
+	n, err := w.w.Write(p)
+	w.written += int64(n)
+	return n, err
+}
+
+// Close writes the padding and closes the underlying writer if it implements io.Closer
+func (w *writer) Close() error {
+	var err error
+	if !w.closed {
+		w.closed = true
+
+		padding := make([]byte, w.m.paddingLength(w.written))
+		binary.BigEndian.PutUint64(padding[len(padding)-trailerSize:], uint64(len(padding)))
+		_, err = w.w.Write(padding)
+	}
+
+	if closer, ok := w.w.(io.Closer); ok {
+		err = errors.Join(err, closer.Close())
+	}
+	return err
+}
+
+// reader holds back the bytes that may belong to the padding until the end of the stream
+type reader struct {
+	r          io.Reader
+	maxPadding int
+	chunk      []byte
+	pending    []byte // Released data followed by the held back tail
+	held       int    // Length of the held back tail
+	ready      []byte // Released data not yet returned
+	err        error
+}
+
+// Read implements io.Reader
+func (r *reader) Read(p []byte) (int, error) {
+	for len(r.ready) == 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
+		r.fill()
+	}
+
+	n := copy(p, r.ready)
+	r.ready = r.ready[n:]
+	return n, nil
+}
+
+// fill reads the next chunk and releases everything that cannot be padding
+func (r *reader) fill() {
+	// Drop the data returned so far, keeping the held back tail
+	r.pending = append(r.pending[:0], r.pending[len(r.pending)-r.held:]...)
+
+	if r.chunk == nil {
+		r.chunk = make([]byte, 32<<10)
+	}
+	n, err := r.r.Read(r.chunk)
+	r.pending = append(r.pending, r.chunk[:n]...)
+
+	switch {
+	case err == io.EOF:
+		r.finish()
+	case err != nil:
+		r.err = err
+	default:
+		release := max(0, len(r.pending)-r.maxPadding)
+		r.ready = r.pending[:release]
+		r.held = len(r.pending) - release
+	}
+}
+
+// finish validates the padding at the end of the stream and releases the remaining data
+func (r *reader) finish() {
+	r.err = io.EOF
+	r.held = 0
+	if len(r.pending) < trailerSize {
+		r.err = ErrInvalidPadding
+		return
+	}
+
+	padding := binary.BigEndian.Uint64(r.pending[len(r.pending)-trailerSize:])
+	if padding < trailerSize || padding > uint64(r.maxPadding) || padding > uint64(len(r.pending)) {
+		r.err = ErrInvalidPadding
+		return
+	}
+	r.ready = r.pending[:len(r.pending)-int(padding)]
+}
+
+// Close closes the underlying reader if it implements io.Closer
+func (r *reader) Close() error {
+	if closer, ok := r.r.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
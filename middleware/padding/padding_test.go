@@ -0,0 +1,151 @@
+package padding
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"testing"
+	"testing/iotest"
+
+	"schneider.vip/hybridbuffer/middleware"
+)
+
+var _ middleware.Middleware = (*Middleware)(nil)
+var _ interface{ Stage() int } = (*Middleware)(nil)
+
+// closeRecorder records whether Close was called
+type closeRecorder struct {
+	bytes.Buffer
+	closed bool
+}
+
+func (c *closeRecorder) Close() error {
+	c.closed = true
+	return nil
+}
+
+func pad(t *testing.T, m *Middleware, data []byte) *closeRecorder {
+	t.Helper()
+
+	out := &closeRecorder{}
+	w := m.Writer(out)
+	if _, err := w.Write(data); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	if err := w.(io.Closer).Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if !out.closed {
+		t.Fatal("Close was not propagated to the underlying writer")
+	}
+	return out
+}
+
+func TestRoundTrip(t *testing.T) {
+	const blockSize = 16
+
+	tests := []struct {
+		name   string
+		size   int
+		padded int
+	}{
+		{"empty", 0, 16},
+		{"exact block boundary", 16, 32},
+		{"one byte over", 17, 32},
+		{"trailer fits", 8, 16},
+		{"trailer does not fit", 9, 32},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := New(blockSize)
+			data := bytes.Repeat([]byte{0xAB}, tt.size)
+
+			padded := pad(t, m, data)
+			if padded.Len() != tt.padded {
+				t.Fatalf("Expected %d padded bytes, got %d", tt.padded, padded.Len())
+			}
+
+			// One byte at a time exercises the held back tail
+			got, err := io.ReadAll(m.Reader(iotest.OneByteReader(bytes.NewReader(padded.Bytes()))))
+			if err != nil {
+				t.Fatalf("Read failed: %v", err)
+			}
+			if !bytes.Equal(got, data) {
+				t.Fatalf("Expected %d bytes, got %d", len(data), len(got))
+			}
+		})
+	}
+}
+
+func TestLargeData(t *testing.T) {
+	m := New(4096)
+	data := make([]byte, 100_001)
+	for i := range data {
+		data[i] = byte(i)
+	}
+
+	padded := pad(t, m, data)
+	if padded.Len()%4096 != 0 {
+		t.Fatalf("Expected a multiple of the block size, got %d bytes", padded.Len())
+	}
+
+	got, err := io.ReadAll(m.Reader(bytes.NewReader(padded.Bytes())))
+	if err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Fatal("Data mismatch")
+	}
+}
+
+func TestSmallBlockSize(t *testing.T) {
+	m := New(1)
+	padded := pad(t, m, []byte("abc"))
+	if padded.Len() != 3+trailerSize {
+		t.Fatalf("Expected only the trailer as padding, got %d bytes", padded.Len())
+	}
+
+	got, err := io.ReadAll(m.Reader(bytes.NewReader(padded.Bytes())))
+	if err != nil || string(got) != "abc" {
+		t.Fatalf("Expected abc, got %q, %v", got, err)
+	}
+}
+
+func TestInvalidPadding(t *testing.T) {
+	m := New(16)
+
+	tests := map[string][]byte{
+		"empty stream":      {},
+		"missing trailer":   []byte("short"),
+		"padding too long":  binary.BigEndian.AppendUint64(make([]byte, 32), 32),
+		"padding too short": binary.BigEndian.AppendUint64(make([]byte, 8), 4),
+	}
+
+	for name, stream := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := io.ReadAll(m.Reader(bytes.NewReader(stream))); err != ErrInvalidPadding {
+				t.Fatalf("Expected ErrInvalidPadding, got %v", err)
+			}
+		})
+	}
+}
+
+func TestReaderClosePropagates(t *testing.T) {
+	m := New(16)
+	padded := pad(t, m, []byte("data"))
+
+	underlying := &closeRecorder{Buffer: *bytes.NewBuffer(padded.Bytes())}
+	if err := m.Reader(underlying).(io.Closer).Close(); err != nil || !underlying.closed {
+		t.Fatal("Close was not propagated to the underlying reader")
+	}
+}
+
+func TestNewPanicsOnInvalidBlockSize(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatal("Expected a panic for a zero block size")
+		}
+	}()
+	New(0)
+}
@@ -0,0 +1,10 @@
+module schneider.vip/hybridbuffer/middleware/ratelimit
+
+go 1.23.0
+
+toolchain go1.24.0
+
+require (
+	golang.org/x/time v0.11.0
+	schneider.vip/hybridbuffer/middleware v1.0.6
+)
@@ -0,0 +1,121 @@
+// Package ratelimit provides a bandwidth-limiting middleware for HybridBuffer
+package ratelimit
+
+import (
+	"context"
+	"io"
+
+	"golang.org/x/time/rate"
+)
+
+// Middleware throttles the data flowing through it using a token bucket
+// All readers and writers created by one Middleware share the same bucket, so a
+// single instance used by several buffers limits their combined bandwidth.
+type Middleware struct {
+	limiter *rate.Limiter
+	burst   int
+}
+
+// Option configures the rate-limiting middleware
+type Option func(*Middleware)
+
+// WithBurst sets the maximum number of bytes that may pass at once
+// Default: bytesPerSec, i.e. one second worth of data
+func WithBurst(burst int) Option {
+	return func(m *Middleware) {
+		if burst > 0 {
+			m.burst = burst
+		}
+	}
+}
+
+// New creates a middleware limiting reads and writes to bytesPerSec bytes per second
+func New(bytesPerSec int, opts ...Option) *Middleware {
+	if bytesPerSec <= 0 {
+		panic("ratelimit: bytesPerSec must be positive")
+	}
+
+	m := &Middleware{burst: bytesPerSec}
+	for _, opt := range opts {
+		opt(m)
+	}
+	m.limiter = rate.NewLimiter(rate.Limit(bytesPerSec), m.burst)
+	return m
+}
+
+// Writer wraps w so that writes block until the limit allows them
+func (m *Middleware) Writer(w io.Writer) io.Writer {
+	return &writer{m: m, w: w}
+}
+
+// Reader wraps r so that reads block until the limit allows them
+func (m *Middleware) Reader(r io.Reader) io.Reader {
+	return &reader{m: m, r: r}
+}
+
+// wait blocks until n bytes may pass
+func (m *Middleware) wait(n int) error {
+	return m.limiter.WaitN(context.Background(), n)
+}
+
+// writer splits writes into chunks no larger than the burst
+type writer struct {
+	m *Middleware
+	w io.Writer
+}
+
+func (w *writer) Write(p []byte) (n int, err error) {
+	for len(p) > 0 {
+		chunk := p
+		if len(chunk) > w.m.burst {
+			chunk = chunk[:w.m.burst]
+		}
+		if err = w.m.wait(len(chunk)); err != nil {
+			return n, err
+		}
+
+		m, err := w.w.Write(chunk)
+		n += m
+		if err != nil {
+			return n, err
+		}
+		p = p[m:]
+	}
+	return n, nil
+}
+
+// Close closes the underlying writer if it implements io.Closer
+func (w *writer) Close() error {
+	if closer, ok := w.w.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// reader reads at most a burst at a time and pays for the bytes it got
+type reader struct {
+	m *Middleware
+	r io.Reader
+}
+
+func (r *reader) Read(p []byte) (int, error) {
+	if len(p) > r.m.burst {
+		p = p[:r.m.burst]
+	}
+
+	n, err := r.r.Read(p)
+	if n > 0 {
+		if werr := r.m.wait(n); werr != nil {
+			return n, werr
+		}
+	}
+	return n, err
+}
+
+// Close closes the underlying reader if it implements io.Closer
+func (r *reader) Close() error {
+	if closer, ok := r.r.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+package ratelimit
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+
+	"schneider.vip/hybridbuffer/middleware"
+)
+
+var _ middleware.Middleware = (*Middleware)(nil)
+
+func TestWriterThrottles(t *testing.T) {
+	const limit = 10000
+	const burst = 1000
+	data := bytes.Repeat([]byte("x"), 5000)
+
+	var out bytes.Buffer
+	w := New(limit, WithBurst(burst)).Writer(&out)
+
+	start := time.Now()
+	n, err := w.Write(data)
+	elapsed := time.Since(start)
+	if err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	if n != len(data) || !bytes.Equal(out.Bytes(), data) {
+		t.Fatal("Data was not written completely")
+	}
+
+	// The initial burst is free, the rest takes (N-burst)/L seconds
+	expected := time.Duration(len(data)-burst) * time.Second / limit
+	if elapsed < expected*3/4 || elapsed > expected*3 {
+		t.Fatalf("Expected writing to take about %v, took %v", expected, elapsed)
+	}
+}
+
+func TestReaderThrottles(t *testing.T) {
+	const limit = 10000
+	const burst = 1000
+	data := bytes.Repeat([]byte("y"), 5000)
+
+	r := New(limit, WithBurst(burst)).Reader(bytes.NewReader(data))
+
+	start := time.Now()
+	got, err := io.ReadAll(r)
+	elapsed := time.Since(start)
+	if err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Fatal("Data was not read completely")
+	}
+
+	expected := time.Duration(len(data)-burst) * time.Second / limit
+	if elapsed < expected*3/4 || elapsed > expected*3 {
+		t.Fatalf("Expected reading to take about %v, took %v", expected, elapsed)
+	}
+}
+
+type closeRecorder struct {
+	bytes.Buffer
+	closed bool
+}
+
+func (c *closeRecorder) Close() error {
+	c.closed = true
+	return nil
+}
+
+func TestClosePropagates(t *testing.T) {
+	m := New(1 << 20)
+
+	underlying := &closeRecorder{}
+	if err := m.Writer(underlying).(io.Closer).Close(); err != nil || !underlying.closed {
+		t.Fatal("Writer Close was not propagated")
+	}
+
+	underlying = &closeRecorder{}
+	if err := m.Reader(underlying).(io.Closer).Close(); err != nil || !underlying.closed {
+		t.Fatal("Reader Close was not propagated")
+	}
+}
+
+func TestNewPanicsOnInvalidLimit(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatal("Expected panic for non-positive limit")
+		}
+	}()
+	New(0)
+}
@@ -0,0 +1,118 @@
+// Package tee provides a middleware for HybridBuffer that mirrors the stored byte stream to a second writer
+//
+// The tee sees exactly the bytes that reach the storage backend, after all middlewares
+// applied before it, which makes it useful for audit logging or hashing the stored data.
+package tee
+
+import (
+	"io"
+)
+
+// Middleware copies data passing through it to a target writer
+type Middleware struct {
+	target       io.Writer
+	teeReads     bool
+	ignoreErrors bool
+}
+
+// Option configures the tee middleware
+type Option func(*Middleware)
+
+// WithIgnoreErrors makes errors writing to the target be ignored instead of failing the stream
+func WithIgnoreErrors() Option {
+	return func(m *Middleware) {
+		m.ignoreErrors = true
+	}
+}
+
+// WithTeeReads also copies data read back from storage to the target
+func WithTeeReads() Option {
+	return func(m *Middleware) {
+		m.teeReads = true
+	}
+}
+
+// New creates a tee middleware copying written data to target
+// The target is shared by all streams of the middleware and is never closed by it.
+func New(target io.Writer, opts ...Option) *Middleware {
+	if target == nil {
+		panic("tee: target must not be nil")
+	}
+	m := &Middleware{target: target}
+	for _, opt := range opts {
+		opt(m)
+	}
+	return m
+}
+
+// Writer wraps w, copying all written data to the target
+func (m *Middleware) Writer(w io.Writer) io.Writer {
+	return &writer{m: m, w: w}
+}
+
+// Reader wraps r, copying all read data to the target if WithTeeReads is set
+func (m *Middleware) Reader(r io.Reader) io.Reader {
+	return &reader{m: m, r: r}
+}
+
+// copy writes p to the target, reporting errors unless they are ignored
+func (m *Middleware) copy(p []byte) error {
+	n, err := m.target.Write(p)
+	if err == nil && n < len(p) {
+		err = io.ErrShortWrite
+	}
+	if m.ignoreErrors {
+		return nil
+	}
+	return err
+}
+
+// writer passes writes through and copies them to the target
+type writer struct {
+	m *Middleware
+	w io.Writer
+}
+
+// Write implements io.Writer
+func (w *writer) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	if n > 0 {
+		if terr := w.m.copy(p[:n]); terr != nil {
+			return n, terr
+		}
+	}
+	return n, err
+}
+
+// Close closes the underlying writer if it implements io.Closer
+func (w *writer) Close() error {
+	if closer, ok := w.w.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// reader passes reads through and optionally copies them to the target
+type reader struct {
+	m *Middleware
+	r io.Reader
+}
+
+// Read implements io.Reader
+func (r *reader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if n > 0 && r.m.teeReads {
+		if terr := r.m.copy(p[:n]); terr != nil {
+			return n, terr
+		}
+	}
+	return n, err
+}
+
+// Close closes the underlying reader if it implements io.Closer
+func (r *reader) Close() error {
+	if closer, ok := r.r.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
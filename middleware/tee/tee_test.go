@@ -0,0 +1,103 @@
+package tee
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+
+	"schneider.vip/hybridbuffer/middleware"
+)
+
+var _ middleware.Middleware = (*Middleware)(nil)
+
+// closeRecorder records whether Close was called
+type closeRecorder struct {
+	bytes.Buffer
+	closed bool
+}
+
+func (c *closeRecorder) Close() error {
+	c.closed = true
+	return nil
+}
+
+// failingWriter fails every write
+type failingWriter struct{}
+
+var errTarget = errors.New("target failed")
+
+func (failingWriter) Write(p []byte) (int, error) { return 0, errTarget }
+
+func TestWriterCopiesData(t *testing.T) {
+	var target bytes.Buffer
+	m := New(&target)
+
+	out := &closeRecorder{}
+	w := m.Writer(out)
+	w.Write([]byte("hello "))
+	w.Write([]byte("world"))
+	if err := w.(io.Closer).Close(); err != nil || !out.closed {
+		t.Fatal("Close was not propagated to the underlying writer")
+	}
+
+	if out.String() != "hello world" || target.String() != "hello world" {
+		t.Fatalf("Expected data in both writers, got %q and %q", out.String(), target.String())
+	}
+}
+
+func TestReaderTeesOnlyWhenEnabled(t *testing.T) {
+	var target bytes.Buffer
+	got, err := io.ReadAll(New(&target).Reader(bytes.NewReader([]byte("stored"))))
+	if err != nil || string(got) != "stored" {
+		t.Fatalf("Expected stored, got %q, %v", got, err)
+	}
+	if target.Len() != 0 {
+		t.Fatalf("Expected no copied reads by default, got %q", target.String())
+	}
+
+	got, err = io.ReadAll(New(&target, WithTeeReads()).Reader(bytes.NewReader([]byte("stored"))))
+	if err != nil || string(got) != "stored" {
+		t.Fatalf("Expected stored, got %q, %v", got, err)
+	}
+	if target.String() != "stored" {
+		t.Fatalf("Expected copied reads, got %q", target.String())
+	}
+}
+
+func TestTargetErrors(t *testing.T) {
+	var out bytes.Buffer
+	n, err := New(failingWriter{}).Writer(&out).Write([]byte("data"))
+	if !errors.Is(err, errTarget) {
+		t.Fatalf("Expected the target error, got %v", err)
+	}
+	if n != 4 || out.String() != "data" {
+		t.Fatalf("Expected the data to pass through, got %d bytes", n)
+	}
+
+	_, err = io.ReadAll(New(failingWriter{}, WithTeeReads()).Reader(bytes.NewReader([]byte("data"))))
+	if !errors.Is(err, errTarget) {
+		t.Fatalf("Expected the target error on read, got %v", err)
+	}
+}
+
+func TestWithIgnoreErrors(t *testing.T) {
+	m := New(failingWriter{}, WithIgnoreErrors(), WithTeeReads())
+
+	var out bytes.Buffer
+	if _, err := m.Writer(&out).Write([]byte("data")); err != nil {
+		t.Fatalf("Expected the target error to be ignored, got %v", err)
+	}
+
+	got, err := io.ReadAll(m.Reader(bytes.NewReader(out.Bytes())))
+	if err != nil || string(got) != "data" {
+		t.Fatalf("Expected data, got %q, %v", got, err)
+	}
+}
+
+func TestReaderClosePropagates(t *testing.T) {
+	underlying := &closeRecorder{}
+	if err := New(io.Discard).Reader(underlying).(io.Closer).Close(); err != nil || !underlying.closed {
+		t.Fatal("Close was not propagated to the underlying reader")
+	}
+}
@@ -1,20 +1,93 @@
 package hybridbuffer
 
 import (
+	"compress/gzip"
+	"context"
+	"fmt"
+	"hash"
+
 	"schneider.vip/hybridbuffer/middleware"
 	"schneider.vip/hybridbuffer/storage"
 )
 
 // Option defines functional options for buffer configuration
+// Invalid values are ignored by New and reported by NewWithError.
 type Option func(*hybridBuffer)
 
+// invalidOption records a configuration error for NewWithError
+func (b *hybridBuffer) invalidOption(format string, args ...any) {
+	b.optionErrs = append(b.optionErrs, fmt.Errorf("%w: "+format, append([]any{ErrInvalidOption}, args...)...))
+}
+
 // WithThreshold sets the memory threshold before switching to storage
 // Default: 2MB
 func WithThreshold(size int) Option {
 	return func(b *hybridBuffer) {
-		if size > 0 {
-			b.threshold = size
+		if size <= 0 {
+			b.invalidOption("threshold must be positive, got %d", size)
+			return
+		}
+		b.threshold = size
+	}
+}
+
+// WithThresholdFunc makes the spill threshold dynamic, e.g. lower under memory
+// pressure reported by runtime/metrics and higher when there is headroom
+// The function is called with the buffer locked on every write that may spill,
+// so it must be cheap and must not use the buffer. It replaces the threshold for
+// the spill decision only; WithMemoryOnly, WithMaxRetained and WithBackpressure
+// keep using the static threshold. Once spilled, the buffer stays in storage even
+// if the threshold rises again. A nil function restores the static threshold.
+func WithThresholdFunc(fn func() int) Option {
+	return func(b *hybridBuffer) {
+		b.thresholdFunc = fn
+	}
+}
+
+// WithMaxSize sets a hard cap on the total number of bytes the buffer accepts
+// Writes that would exceed it write up to the limit and return ErrMaxSizeExceeded.
+// Unlike WithThreshold, which only controls when data spills to storage,
+// this applies to memory and storage alike.
+// Default: unlimited
+func WithMaxSize(size int64) Option {
+	return func(b *hybridBuffer) {
+		if size < 0 {
+			b.invalidOption("max size must not be negative, got %d", size)
+			return
+		}
+		b.maxSize = size
+	}
+}
+
+// WithMaxRetained turns the buffer into a ring buffer holding the most recent n bytes
+// Once Len() would exceed n, the oldest unread bytes are dropped as if by TruncateFront.
+// The retained window always stays in memory and the buffer never spills to storage,
+// so n is capped to the threshold. Keep n well below the threshold: the memory buffer
+// is compacted whenever it would grow past the threshold.
+func WithMaxRetained(n int) Option {
+	return func(b *hybridBuffer) {
+		if n < 0 {
+			b.invalidOption("max retained must not be negative, got %d", n)
+			return
+		}
+		b.maxRetained = n
+	}
+}
+
+// WithBackpressure bounds the number of unread bytes to maxInFlight
+// Once Len() reaches the limit, Write blocks until a concurrent Read drains space,
+// turning the buffer into a bounded pipe. This only makes sense with a reader and
+// a writer running in separate goroutines; a single goroutine that writes more than
+// maxInFlight bytes before reading blocks forever. Close wakes blocked writers,
+// which then return ErrClosed.
+// The in-flight data always stays in memory, so maxInFlight is capped to the threshold.
+func WithBackpressure(maxInFlight int) Option {
+	return func(b *hybridBuffer) {
+		if maxInFlight < 0 {
+			b.invalidOption("max in flight must not be negative, got %d", maxInFlight)
+			return
 		}
+		b.maxInFlight = maxInFlight
 	}
 }
 
@@ -34,7 +107,7 @@ func WithMiddleware(middlewares ...middleware.Middleware) Option {
 }
 
 // WithStorage sets the storage backend provider function
-// If not specified, filesystem storage is used by default
+// If not specified or nil, filesystem storage is used by default
 //
 // Example usage:
 //
@@ -43,6 +116,10 @@ func WithMiddleware(middlewares ...middleware.Middleware) Option {
 //	WithStorage(redis.New(client))
 func WithStorage(provider func() storage.Backend) Option {
 	return func(b *hybridBuffer) {
+		if provider == nil {
+			b.invalidOption("storage provider must not be nil")
+			return
+		}
 		b.storageProvider = provider
 	}
 }
@@ -52,8 +129,297 @@ func WithStorage(provider func() storage.Backend) Option {
 // Default: threshold/2 (half of the memory threshold)
 func WithPreAlloc(size int) Option {
 	return func(b *hybridBuffer) {
-		if size > 0 {
-			b.preAllocSize = size
+		if size < 0 {
+			b.invalidOption("pre-allocation size must not be negative, got %d", size)
+			return
+		}
+		b.preAllocSize = size
+	}
+}
+
+// WithStorageFallback keeps the buffer in memory when the storage backend
+// fails to initialize or to accept the spilled data, instead of failing the write.
+// The optional onError callback receives the storage error.
+// The buffer then grows in memory beyond the threshold until Reset,
+// so this defeats the memory bound and must be opted into explicitly.
+func WithStorageFallback(onError func(error)) Option {
+	return func(b *hybridBuffer) {
+		b.storageFallback = true
+		b.onStorageError = onError
+	}
+}
+
+// WithErrorHandler sets a callback for errors that cannot be returned to the caller
+// This makes failed storage cleanups observable, e.g. when Reset (which has no
+// return value to stay compatible with bytes.Buffer) cannot remove a spilled
+// object, which would otherwise be orphaned silently.
+func WithErrorHandler(handler func(error)) Option {
+	return func(b *hybridBuffer) {
+		b.onError = handler
+	}
+}
+
+// WithOnSpill sets a callback invoked once each time the buffer spills to storage
+// It receives the number of bytes moved from memory to storage, which makes it
+// easy to emit spill metrics without depending on a metrics library.
+// Like all callbacks, it runs after the buffer's lock has been released.
+func WithOnSpill(hook func(size int)) Option {
+	return func(b *hybridBuffer) {
+		b.onSpill = hook
+	}
+}
+
+// WithOnRemove sets a callback invoked once each time a storage object has been
+// removed, e.g. by Reset, Close or Truncate replacing the object
+// Like all callbacks, it runs after the buffer's lock has been released.
+func WithOnRemove(hook func()) Option {
+	return func(b *hybridBuffer) {
+		b.onRemove = hook
+	}
+}
+
+// WithContext binds storage operations to ctx
+// Once ctx is cancelled, storage reads and writes fail with ctx.Err(), and so do
+// the Write and Read calls that need them. Backends implementing ContextBackend
+// also receive ctx in Create and Open, letting them abort hanging requests.
+// Removing storage on Reset or Close still happens after cancellation.
+// Data held in memory stays accessible.
+func WithContext(ctx context.Context) Option {
+	return func(b *hybridBuffer) {
+		b.ctx = ctx
+	}
+}
+
+// WithGzip compresses spilled data with gzip at the given level
+// Levels range from gzip.HuffmanOnly (-2) to gzip.BestCompression (9); invalid
+// levels fall back to gzip.DefaultCompression. Combined with WithEncryptionKey,
+// data is always compressed before it is encrypted, regardless of option order.
+// Both run after any middlewares added by WithMiddleware; with WithPipeline they
+// join its compression and encryption stages instead.
+func WithGzip(level int) Option {
+	return func(b *hybridBuffer) {
+		if level < gzip.HuffmanOnly || level > gzip.BestCompression {
+			b.invalidOption("gzip level %d out of range", level)
+			level = gzip.DefaultCompression
+		}
+		b.gzip = gzipMiddleware{level: level}
+	}
+}
+
+// WithEncryptionKey encrypts spilled data with AES-GCM using key
+// The key must be 16, 24 or 32 bytes long to select AES-128, AES-192 or AES-256;
+// with other lengths New panics and NewWithError returns an error. Combined with
+// WithGzip, data is compressed first, since encrypted data does not compress.
+func WithEncryptionKey(key []byte) Option {
+	aead, err := newAESGCMMiddleware(key)
+	return func(b *hybridBuffer) {
+		if err != nil {
+			b.invalidOption("%w: %v", errInvalidKey, err)
+			return
+		}
+		b.encryption = aead
+	}
+}
+
+// WithEncryptionKeyring encrypts spilled data with AES-GCM like WithEncryptionKey,
+// but supports key rotation
+// Data is written under keys[current] and tagged with its key ID, and read back
+// with whichever key of the keyring it was written under. To rotate, add the new
+// key and make it current; keep old keys as long as data written under them is
+// read. Every key must be 16, 24 or 32 bytes long and current must be in keys.
+// Data written by WithEncryptionKey carries no key ID and cannot be read with it.
+func WithEncryptionKeyring(current byte, keys map[byte][]byte) Option {
+	keyring, err := newKeyringMiddleware(current, keys)
+	return func(b *hybridBuffer) {
+		if err != nil {
+			b.invalidOption("%w: %v", errInvalidKey, err)
+			return
+		}
+		b.encryption = keyring
+	}
+}
+
+// WithKeyProvider encrypts spilled data with AES-GCM using envelope encryption
+// Every spill gets a fresh data key from provider, whose wrapped form is stored
+// with the data and unwrapped by provider when it is read back, so raw keys never
+// need to be configured and no KMS SDK is imported by this package. Provider calls
+// receive the context of WithContext, or context.Background().
+func WithKeyProvider(provider KeyProvider) Option {
+	return func(b *hybridBuffer) {
+		if provider == nil {
+			b.invalidOption("key provider must not be nil")
+			return
+		}
+		b.encryption = &envelopeMiddleware{provider: provider}
+	}
+}
+
+// WithDeterministicNonce makes WithEncryptionKey encrypt identical data to identical
+// ciphertext, so encrypted spills can be deduplicated by content-addressed storage
+// Nonces are derived from a keyed hash of each chunk (SIV-style) instead of being
+// random. This leaks whether two spills, or chunks at the same position, hold the
+// same plaintext; use it only when that is acceptable. Data must be read back with
+// the same setting. Without built-in encryption it has no effect.
+func WithDeterministicNonce() Option {
+	return func(b *hybridBuffer) {
+		b.deterministicNonce = true
+	}
+}
+
+// WithHash feeds all written data into a hash created by newHash
+// The digest is available through Sum without a second pass over the data,
+// e.g. WithHash(sha256.New) for checksums or WithHash(md5.New) for S3 ETags.
+func WithHash(newHash func() hash.Hash) Option {
+	return func(b *hybridBuffer) {
+		if newHash == nil {
+			b.invalidOption("hash constructor must not be nil")
+			return
+		}
+		b.hash = newHash()
+	}
+}
+
+// WithLogger sets a callback receiving diagnostic events, e.g. to correlate
+// latency spikes with unexpected spills
+// Events are "spill" (size, threshold), "storage_created", "read_stream_opened" (size),
+// "storage_removed", "remove_error" (error) and "close_error" (error); fields may be nil.
+// Buffers with an identifier from WithID add it to every event as "id".
+// Adapting it to slog or any other logging library is a one-liner.
+// Like all callbacks, it runs after the buffer's lock has been released.
+// Default: no logging
+func WithLogger(logger func(event string, fields map[string]any)) Option {
+	return func(b *hybridBuffer) {
+		b.logger = logger
+	}
+}
+
+// WithID tags the buffer with an identifier, e.g. a request ID, which Name returns
+// and the logger receives with every event as the "id" field, so events of many
+// buffers can be told apart in aggregated logs
+// Default: "", events carry no identifier
+func WithID(id string) Option {
+	return func(b *hybridBuffer) {
+		b.id = id
+	}
+}
+
+// WithTracer creates spans for storage operations: spilling to storage
+// ("hybridbuffer.spill"), creating and opening storage streams ("hybridbuffer.create",
+// "hybridbuffer.open") and removing stored data ("hybridbuffer.remove")
+// Spans are children of the context from WithContext, the stream created while
+// spilling is a child of the spill span. They record the backend type, the number
+// of bytes involved and the buffer's identifier from WithID, and end with the
+// operation's error. Use the tracing module for OpenTelemetry.
+// Default: no tracing
+func WithTracer(tracer Tracer) Option {
+	return func(b *hybridBuffer) {
+		b.tracer = tracer
+	}
+}
+
+// WithMemoryLimiter registers the buffer's in-memory data with limiter instead
+// of the global limiter, so that a group of buffers shares its own memory budget
+func WithMemoryLimiter(limiter *MemoryLimiter) Option {
+	return func(b *hybridBuffer) {
+		if limiter == nil {
+			b.invalidOption("memory limiter must not be nil")
+			return
+		}
+		b.limiter = limiter
+	}
+}
+
+// WithMemoryOnly keeps all data in memory and never spills to storage
+// Writes that would grow the buffer beyond the threshold write up to it and
+// return ErrThresholdExceeded, so callers fail fast where spilling to disk or
+// network is unacceptable. Consumed data is reclaimed before failing.
+// Middlewares are never applied, since they only process spilled data.
+func WithMemoryOnly() Option {
+	return func(b *hybridBuffer) {
+		b.memoryOnly = true
+	}
+}
+
+// WithReadOnly makes the buffer reject writes, e.g. to hand a shared or cached
+// buffer to code that must only read it
+// Write methods, Rollback and UnmarshalJSON return ErrReadOnly and Truncate panics
+// with it. Reading, including consuming reads, Reset and Close keep working.
+// NewFromBytes, NewFromString, NewFromReader and NewFromFile fill the buffer
+// before it becomes read-only.
+func WithReadOnly() Option {
+	return func(b *hybridBuffer) {
+		b.readOnly = true
+	}
+}
+
+// WithZeroOnReset makes Reset and Close overwrite the memory buffer with zeros,
+// e.g. for buffers holding credentials that are pooled across security contexts
+// The whole backing array is cleared, including data left beyond the contents by
+// spilling, truncation or compaction, and any storage object is removed as usual.
+// Clearing costs one pass over the capacity. Memory the buffer released earlier
+// by growing, or handed to WithAsyncSpill, is not covered; use WithPreAlloc to
+// avoid growing.
+func WithZeroOnReset() Option {
+	return func(b *hybridBuffer) {
+		b.zeroOnReset = true
+	}
+}
+
+// WithFormatHeader writes a small header in front of stored data and validates it
+// when the data is read back
+// The header holds a magic value, a format version and the names of the configured
+// middlewares, so reading data written with a different middleware configuration,
+// e.g. through AttachStorage, fails with ErrFormatMismatch instead of returning
+// garbage. Data written without the header cannot be read with it, and vice versa.
+// Default: disabled, stored data is exactly the middleware output
+func WithFormatHeader() Option {
+	return func(b *hybridBuffer) {
+		b.formatHeader = true
+	}
+}
+
+// WithAsyncSpill writes spilled data to storage in a background goroutine
+// When the threshold is crossed, the memory contents are handed over to the
+// goroutine and the caller continues without waiting for storage I/O; later
+// writes are queued the same way. Reading, and everything else needing the stored
+// data, waits until all queued data is written. Errors of background writes are
+// returned by a later Write or when the data is read, and do not trigger
+// WithStorageFallback. Queued data is held in memory in addition to the threshold.
+// Default: disabled
+func WithAsyncSpill() Option {
+	return func(b *hybridBuffer) {
+		b.asyncSpill = true
+	}
+}
+
+// WithReadCache keeps the decoded contents of spilled data of up to maxBytes in memory
+// The first reader from NewReader that reads the contents to the end fills the
+// cache; later readers are served from memory instead of running the middleware
+// pipeline (e.g. decryption and decompression) again. Larger contents are streamed
+// from storage every time. The cache is dropped on Reset and goes stale on writes.
+// Default: disabled
+func WithReadCache(maxBytes int) Option {
+	return func(b *hybridBuffer) {
+		if maxBytes < 0 {
+			b.invalidOption("read cache size must not be negative, got %d", maxBytes)
+			return
+		}
+		b.readCacheSize = maxBytes
+	}
+}
+
+// WithReadAhead reads up to n bytes ahead from storage in a background goroutine
+// Decrypting or decompressing spilled data then overlaps with the caller consuming
+// it, instead of alternating on a single goroutine. Read errors are returned by the
+// Read that reaches them. Only the buffer's own reads use it; the goroutine stops
+// when the read stream is closed, e.g. by Reset, Close or a Write after reading.
+// Default: disabled
+func WithReadAhead(n int) Option {
+	return func(b *hybridBuffer) {
+		if n < 0 {
+			b.invalidOption("read-ahead must not be negative, got %d", n)
+			return
 		}
+		b.readAhead = n
 	}
 }
@@ -0,0 +1,63 @@
+package hybridbuffer
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// DefaultSpillPrefix is the file prefix used by the filesystem backend unless
+// configured with filesystem.WithPrefix
+const DefaultSpillPrefix = "hybridbuffer"
+
+// SpillFilePattern returns the glob pattern of the spill files the filesystem
+// backend creates with the given prefix
+func SpillFilePattern(prefix string) string {
+	return prefix + "-*.tmp"
+}
+
+// CleanupOrphans removes spill files left behind in dir by crashed processes
+// It removes regular files matching SpillFilePattern(prefix) that were last
+// modified more than olderThan ago, and returns how many were removed. An empty
+// dir means os.TempDir(), an empty prefix means DefaultSpillPrefix. Choose
+// olderThan well above the lifetime of a buffer, since files of running buffers
+// match as well. Failures to remove single files are collected with errors.Join
+// and do not stop the cleanup.
+func CleanupOrphans(dir, prefix string, olderThan time.Duration) (removed int, err error) {
+	if dir == "" {
+		dir = os.TempDir()
+	}
+	if prefix == "" {
+		prefix = DefaultSpillPrefix
+	}
+
+	matches, err := filepath.Glob(filepath.Join(dir, SpillFilePattern(prefix)))
+	if err != nil {
+		return 0, err
+	}
+
+	cutoff := time.Now().Add(-olderThan)
+	var errs []error
+	for _, path := range matches {
+		info, err := os.Lstat(path)
+		if err != nil {
+			if !os.IsNotExist(err) {
+				errs = append(errs, err)
+			}
+			continue
+		}
+		if !info.Mode().IsRegular() || !info.ModTime().Before(cutoff) {
+			continue
+		}
+
+		if err := os.Remove(path); err != nil {
+			if !os.IsNotExist(err) {
+				errs = append(errs, err)
+			}
+			continue
+		}
+		removed++
+	}
+	return removed, errors.Join(errs...)
+}
@@ -0,0 +1,60 @@
+package hybridbuffer
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"schneider.vip/hybridbuffer/storage/filesystem"
+)
+
+func TestCleanupOrphans(t *testing.T) {
+	dir := t.TempDir()
+	old := time.Now().Add(-2 * time.Hour)
+
+	create := func(name string, modTime time.Time) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte("spilled"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	stale := create("hybridbuffer-123.tmp", old)
+	fresh := create("hybridbuffer-456.tmp", time.Now())
+	otherPrefix := create("other-789.tmp", old)
+	otherFile := create("hybridbuffer.log", old)
+
+	removed, err := CleanupOrphans(dir, "", time.Hour)
+	if err != nil {
+		t.Fatalf("CleanupOrphans failed: %v", err)
+	}
+	if removed != 1 {
+		t.Fatalf("Expected 1 removed file, got %d", removed)
+	}
+	if _, err := os.Stat(stale); !os.IsNotExist(err) {
+		t.Fatal("Expected the stale spill file to be removed")
+	}
+	for _, path := range []string{fresh, otherPrefix, otherFile} {
+		if _, err := os.Stat(path); err != nil {
+			t.Fatalf("Expected %s to be kept: %v", filepath.Base(path), err)
+		}
+	}
+}
+
+func TestCleanupOrphans_MatchesFilesystemBackend(t *testing.T) {
+	dir := t.TempDir()
+	buf := New(WithThreshold(4), WithStorage(filesystem.New(filesystem.WithTempDir(dir), filesystem.WithPrefix("job"))))
+	defer buf.Close()
+	buf.WriteString("spilled to a file")
+
+	// A crashed process leaves the file behind; olderThan 0 matches it right away
+	removed, err := CleanupOrphans(dir, "job", 0)
+	if err != nil || removed != 1 {
+		t.Fatalf("Expected the backend's spill file to be removed, got %d, %v", removed, err)
+	}
+}
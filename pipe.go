@@ -0,0 +1,123 @@
+package hybridbuffer
+
+import "io"
+
+// NewPipe creates a synchronous in-process pipe backed by a hybrid buffer
+//
+// Unlike io.Pipe, writes do not wait for the reader: data is buffered in memory
+// and spills to storage once the threshold is exceeded. Reads block until data
+// is available and return io.EOF after the writer has been closed and all data
+// has been consumed.
+//
+// Once the data has spilled to storage, the reader waits until the writer is
+// closed, because storage streams (and middleware such as encryption) can only
+// be read after they have been finalized. Combine with WithBackpressure to keep
+// the pipe in memory and bound its size instead.
+//
+// Closing the reader removes any storage and makes further writes fail with
+// io.ErrClosedPipe. With WithReadOnly, writes fail with ErrReadOnly like those
+// of a Buffer.
+func NewPipe(opts ...Option) (io.WriteCloser, io.ReadCloser) {
+	p := &pipe{buf: New(opts...).(*hybridBuffer)}
+	return &pipeWriter{p}, &pipeReader{p}
+}
+
+// pipe holds the state shared by both ends of a pipe
+type pipe struct {
+	buf          *hybridBuffer
+	writerClosed bool
+}
+
+type pipeWriter struct {
+	*pipe
+}
+
+// Write implements io.Writer
+func (w *pipeWriter) Write(data []byte) (n int, err error) {
+	b := w.buf
+	b.mu.Lock()
+	defer b.unlock()
+
+	if w.writerClosed {
+		return 0, io.ErrClosedPipe
+	}
+	if err := b.checkWritable(); err != nil {
+		if err == ErrClosed {
+			err = io.ErrClosedPipe
+		}
+		return 0, err
+	}
+
+	if b.maxInFlight > 0 {
+		n, err = b.writeBlocking(data)
+		if err == ErrClosed {
+			err = io.ErrClosedPipe
+		}
+	} else {
+		// Reclaim what the reader consumed, so a reader keeping up never spills
+		if b.memoryBuffer.Len()+len(data) > b.threshold {
+			b.compactMemory()
+		}
+		n, err = b.write(data)
+	}
+
+	// Wake up a waiting reader
+	b.cond.Broadcast()
+	return n, err
+}
+
+// Close implements io.Closer
+// It flushes the storage write stream so the reader sees the final bytes.
+func (w *pipeWriter) Close() error {
+	b := w.buf
+	b.mu.Lock()
+	defer b.unlock()
+
+	if w.writerClosed {
+		return nil
+	}
+	w.writerClosed = true
+	b.cond.Broadcast()
+
+	if b.writeStream != nil {
+		err := b.writeStream.Close()
+		b.writeStream = nil
+		return err
+	}
+	return nil
+}
+
+type pipeReader struct {
+	*pipe
+}
+
+// Read implements io.Reader
+func (r *pipeReader) Read(data []byte) (int, error) {
+	b := r.buf
+	b.mu.Lock()
+	defer b.unlock()
+
+	for {
+		if b.closed {
+			return 0, io.ErrClosedPipe
+		}
+
+		// Spilled data can only be read after the writer finalized the stream
+		readable := b.unread() > 0 && (!b.usingStorage || r.writerClosed)
+		if readable {
+			return b.read(data)
+		}
+		if r.writerClosed {
+			return 0, io.EOF
+		}
+		if len(data) == 0 {
+			return 0, nil
+		}
+		b.cond.Wait()
+	}
+}
+
+// Close implements io.Closer
+func (r *pipeReader) Close() error {
+	return r.buf.Close()
+}
@@ -0,0 +1,138 @@
+package hybridbuffer
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestPipe_StreamsInMemory(t *testing.T) {
+	w, r := NewPipe()
+	defer r.Close()
+
+	if _, err := w.Write([]byte("hello")); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+
+	// Data written so far is readable before the writer is closed
+	data := make([]byte, 10)
+	n, err := r.Read(data)
+	if err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+	if string(data[:n]) != "hello" {
+		t.Fatalf("Expected %q, got %q", "hello", string(data[:n]))
+	}
+
+	// The reader blocks until more data arrives
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		w.Write([]byte(" world"))
+		w.Close()
+	}()
+
+	rest, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("ReadAll failed: %v", err)
+	}
+	if string(rest) != " world" {
+		t.Fatalf("Expected %q, got %q", " world", string(rest))
+	}
+}
+
+func TestPipe_SpillsToStorage(t *testing.T) {
+	w, r := NewPipe(WithThreshold(1024))
+	defer r.Close()
+
+	data := make([]byte, 100000)
+	for i := range data {
+		data[i] = byte(i % 251)
+	}
+
+	go func() {
+		for i := 0; i < len(data); i += 1000 {
+			w.Write(data[i : i+1000])
+		}
+		w.Close()
+	}()
+
+	received, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("ReadAll failed: %v", err)
+	}
+	if !bytes.Equal(received, data) {
+		t.Fatalf("Data mismatch: got %d bytes, expected %d", len(received), len(data))
+	}
+}
+
+func TestPipe_WriteAfterReaderClosed(t *testing.T) {
+	w, r := NewPipe()
+	r.Close()
+
+	if _, err := w.Write([]byte("data")); err != io.ErrClosedPipe {
+		t.Fatalf("Expected io.ErrClosedPipe, got %v", err)
+	}
+}
+
+func TestPipe_WriteAfterWriterClosed(t *testing.T) {
+	w, r := NewPipe()
+	defer r.Close()
+	w.Close()
+
+	if _, err := w.Write([]byte("data")); err != io.ErrClosedPipe {
+		t.Fatalf("Expected io.ErrClosedPipe, got %v", err)
+	}
+	if _, err := r.Read(make([]byte, 1)); err != io.EOF {
+		t.Fatalf("Expected io.EOF, got %v", err)
+	}
+}
+
+func TestPipe_WriteReadOnly(t *testing.T) {
+	w, r := NewPipe(WithReadOnly())
+	defer r.Close()
+
+	if _, err := w.Write([]byte("data")); err != ErrReadOnly {
+		t.Fatalf("Expected ErrReadOnly, got %v", err)
+	}
+	w.Close()
+	if _, err := r.Read(make([]byte, 1)); err != io.EOF {
+		t.Fatalf("Expected io.EOF, got %v", err)
+	}
+}
+
+func TestPipe_ReaderKeepingUpStaysInMemory(t *testing.T) {
+	w, r := NewPipe(WithThreshold(16))
+	defer r.Close()
+
+	chunk := []byte("0123456789")
+	p := make([]byte, len(chunk))
+	for i := 0; i < 10; i++ {
+		if _, err := w.Write(chunk); err != nil {
+			t.Fatalf("Write %d failed: %v", i, err)
+		}
+		// A spilled pipe would block here until the writer is closed
+		if _, err := io.ReadFull(r, p); err != nil {
+			t.Fatalf("Read %d failed: %v", i, err)
+		}
+	}
+	if r.(*pipeReader).buf.usingStorage {
+		t.Fatal("Expected the pipe to stay in memory")
+	}
+	if size := r.(*pipeReader).buf.Size(); size != 100 {
+		t.Fatalf("Expected Size 100 to include the compacted data, got %d", size)
+	}
+}
+
+func TestPipe_ZeroLengthRead(t *testing.T) {
+	w, r := NewPipe()
+	defer r.Close()
+
+	if n, err := r.Read(nil); n != 0 || err != nil {
+		t.Fatalf("Expected 0, nil on an open empty pipe, got %d, %v", n, err)
+	}
+	w.Close()
+	if _, err := r.Read(nil); err != io.EOF {
+		t.Fatalf("Expected io.EOF once the writer is closed, got %v", err)
+	}
+}
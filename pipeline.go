@@ -0,0 +1,159 @@
+package hybridbuffer
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"schneider.vip/hybridbuffer/middleware"
+)
+
+// Stage classifies a middleware for ordering by WithPipeline
+// The values are stable, so middlewares that cannot import this package can
+// declare their stage as an int, see Staged.
+type Stage int
+
+const (
+	// StageTransform covers middlewares that neither compress nor encrypt
+	StageTransform Stage = iota
+	// StageCompression covers compressing middlewares
+	StageCompression
+	// StagePadding covers middlewares hiding the data size, which must see compressed
+	// data so the padding is not compressed away, and must be encrypted afterwards
+	StagePadding
+	// StageEncryption covers encrypting middlewares
+	StageEncryption
+	// StageEncoding covers middlewares that encode the stored bytes, e.g. as base64 text,
+	// which must be the outermost layer
+	StageEncoding
+)
+
+// Staged is an optional interface for middlewares to declare their stage
+// Middlewares in modules that cannot import this package may instead implement
+// Stage() int, returning the value of the stage constant, as the middleware
+// modules of this repository do. Use AtStage for middlewares declaring neither.
+type Staged interface {
+	Stage() Stage
+}
+
+// AtStage assigns a stage to a middleware that does not declare one, e.g. a
+// third-party compression or encryption middleware passed to WithPipeline
+// Middlewares reports the name of the wrapped middleware.
+func AtStage(stage Stage, m middleware.Middleware) middleware.Middleware {
+	return &stagedMiddleware{Middleware: m, stage: stage}
+}
+
+// stagedMiddleware wraps a middleware with the stage assigned by AtStage
+type stagedMiddleware struct {
+	middleware.Middleware
+	stage Stage
+}
+
+func (s *stagedMiddleware) Stage() Stage { return s.stage }
+func (s *stagedMiddleware) Name() string { return middlewareName(s.Middleware) }
+
+// Named is an optional interface for middlewares to provide the name reported by Middlewares
+type Named interface {
+	Name() string
+}
+
+// WithPipeline adds middlewares in the order that keeps them effective:
+// transforms first, then compression, then padding, then encryption, since
+// ciphertext does not compress, and text encodings last. Middlewares of the same stage keep their relative order.
+//
+// The stage is taken from the Staged interface; middlewares without it are
+// transforms. Wrap them with AtStage to place them in another stage.
+// The middlewares of WithGzip and the encryption options join the compression and
+// encryption stages of the last WithPipeline, so e.g. padding is applied after gzip
+// and an encoding after encryption.
+// Use WithMiddleware to add middlewares in exactly the given order instead.
+func WithPipeline(middlewares ...middleware.Middleware) Option {
+	sorted := slices.Clone(middlewares)
+	slices.SortStableFunc(sorted, func(a, b middleware.Middleware) int {
+		return int(stageOf(a)) - int(stageOf(b))
+	})
+	return func(b *hybridBuffer) {
+		b.pipelined = true
+		b.pipelineStart = len(b.middlewares)
+		b.middlewares = append(b.middlewares, sorted...)
+		b.pipelineEnd = len(b.middlewares)
+	}
+}
+
+// withBuiltins returns the configured middlewares with the middlewares of WithGzip
+// and the encryption options added, compression first
+// Without WithPipeline they run last; otherwise they are placed in their stage
+// within the pipeline, after the middlewares of the same stage.
+func (b *hybridBuffer) withBuiltins(configured []middleware.Middleware) []middleware.Middleware {
+	middlewares := slices.Clone(configured)
+	end := b.pipelineEnd
+	for _, m := range []middleware.Middleware{b.gzip, b.encryption} {
+		if m == nil {
+			continue
+		}
+		if !b.pipelined {
+			middlewares = append(middlewares, m)
+			continue
+		}
+		i := b.pipelineStart
+		for i < end && stageOf(middlewares[i]) <= stageOf(m) {
+			i++
+		}
+		middlewares = slices.Insert(middlewares, i, m)
+		end++
+	}
+	return middlewares
+}
+
+// stageOf determines the stage of a middleware
+func stageOf(m middleware.Middleware) Stage {
+	switch s := m.(type) {
+	case Staged:
+		return s.Stage()
+	case interface{ Stage() int }:
+		return Stage(s.Stage())
+	}
+	return StageTransform
+}
+
+// middlewareName returns the name of a middleware for Middlewares
+func middlewareName(m middleware.Middleware) string {
+	if n, ok := m.(Named); ok {
+		return n.Name()
+	}
+	return strings.TrimPrefix(fmt.Sprintf("%T", m), "*")
+}
+
+// Middlewares returns the names of the configured middlewares in the order
+// data passes them when written to storage
+func (b *hybridBuffer) Middlewares() []string {
+	b.mu.Lock()
+	defer b.unlock()
+
+	names := make([]string, len(b.middlewares))
+	for i, m := range b.middlewares {
+		names[i] = middlewareName(m)
+	}
+	return names
+}
+
+// AddMiddleware appends middlewares to the pipeline, like a WithMiddleware passed
+// as the last option: they run before the middlewares added by WithGzip and the
+// encryption options, unless these joined the stages of WithPipeline. The pipeline
+// must not change once data passed it, so AddMiddleware returns ErrBufferDirty
+// after the first write until the buffer is reset.
+func (b *hybridBuffer) AddMiddleware(m ...middleware.Middleware) error {
+	b.mu.Lock()
+	defer b.unlock()
+
+	if b.closed {
+		return ErrClosed
+	}
+	if b.size > 0 || b.usingStorage {
+		return ErrBufferDirty
+	}
+
+	b.configured = append(b.configured, m...)
+	b.middlewares = b.withBuiltins(b.configured)
+	return nil
+}
@@ -0,0 +1,52 @@
+package hybridbuffer
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+)
+
+// memoryPool holds the memory of buffers returned by PutBuffer
+var memoryPool sync.Pool // *[]byte
+
+// GetBuffer returns an empty buffer configured with opts, reusing memory of
+// buffers returned by PutBuffer
+// It behaves exactly like New, but avoids allocating the memory buffer in hot paths.
+func GetBuffer(opts ...Option) Buffer {
+	mem, ok := memoryPool.Get().(*[]byte)
+	if !ok {
+		return New(opts...)
+	}
+	return newBuffer(*bytes.NewBuffer((*mem)[:0]), opts).requireKey()
+}
+
+// PutBuffer releases buf and returns its memory to the pool used by GetBuffer
+// Any storage object is removed first, and the memory is zeroed so no data
+// leaks into the next buffer. buf is closed and must not be used afterwards.
+// Buffers not created by this package are just closed.
+func PutBuffer(buf Buffer) {
+	b, ok := buf.(*hybridBuffer)
+	if !ok {
+		buf.Close()
+		return
+	}
+
+	var mem []byte
+	b.closeOnce.Do(func() {
+		b.mu.Lock()
+		defer b.unlock()
+
+		// The memory buffer is never read from, so its data starts at the backing array
+		b.zeroMemory()
+		mem = b.memoryBuffer.Bytes()[:0]
+
+		if err := b.close(); err != nil && b.onError != nil {
+			err = fmt.Errorf("failed to release buffer: %w", err)
+			b.queueHook(func() { b.onError(err) })
+		}
+	})
+
+	if cap(mem) > 0 {
+		memoryPool.Put(&mem)
+	}
+}
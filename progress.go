@@ -0,0 +1,68 @@
+package hybridbuffer
+
+import "io"
+
+// progressChunkSize is the amount of data copied between progress callbacks
+const progressChunkSize = 32 << 10
+
+// WriteToWithProgress writes the remaining data to w like WriteTo, calling progress
+// with the cumulative number of bytes written after each chunk
+// The buffer is not locked while progress runs, so it may call back into the buffer.
+// Works the same in memory and storage mode.
+func (b *hybridBuffer) WriteToWithProgress(w io.Writer, progress func(written int64)) (n int64, err error) {
+	chunk := make([]byte, progressChunkSize)
+	for {
+		m, rErr := b.Read(chunk)
+		if m > 0 {
+			wN, wErr := w.Write(chunk[:m])
+			n += int64(wN)
+			if wErr != nil {
+				return n, wErr
+			}
+			if wN != m {
+				return n, io.ErrShortWrite
+			}
+			if progress != nil {
+				progress(n)
+			}
+		}
+
+		if rErr == io.EOF {
+			return n, nil
+		}
+		if rErr != nil {
+			return n, rErr
+		}
+	}
+}
+
+// ReadFromWithProgress reads from r until EOF like ReadFrom, calling progress
+// with the cumulative number of bytes read after each chunk
+// The buffer is not locked while progress runs, so it may call back into the buffer.
+func (b *hybridBuffer) ReadFromWithProgress(r io.Reader, progress func(read int64)) (n int64, err error) {
+	if err := b.writable(); err != nil {
+		return 0, err
+	}
+
+	chunk := make([]byte, progressChunkSize)
+	for {
+		rN, rErr := r.Read(chunk)
+		if rN > 0 {
+			wN, wErr := b.Write(chunk[:rN])
+			n += int64(wN)
+			if wErr != nil {
+				return n, wErr
+			}
+			if progress != nil {
+				progress(n)
+			}
+		}
+
+		if rErr == io.EOF {
+			return n, nil
+		}
+		if rErr != nil {
+			return n, rErr
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package hybridbuffer
+
+import "io"
+
+// readAheadChunkSize is the largest chunk the read-ahead goroutine reads at once
+const readAheadChunkSize = 32 << 10
+
+// readAhead reads from a storage stream in a background goroutine, so that
+// decoding by middlewares overlaps with the caller consuming the data
+type readAhead struct {
+	src    io.ReadCloser
+	chunks chan readAheadChunk // Filled chunks in stream order
+	free   chan []byte         // Chunk buffers available for filling
+	done   chan struct{}       // Closed to stop the goroutine
+	exited chan struct{}       // Closed when the goroutine stopped
+	cur    []byte              // Unread part of the current chunk
+	curBuf []byte              // Current chunk buffer, recycled once consumed
+	err    error
+	closed bool
+}
+
+type readAheadChunk struct {
+	data []byte
+	err  error
+}
+
+// newReadAhead starts reading up to size bytes ahead of the caller from src
+func newReadAhead(src io.ReadCloser, size int) *readAhead {
+	chunkSize := min(size, readAheadChunkSize)
+	count := max(size/chunkSize, 1)
+
+	r := &readAhead{
+		src:    src,
+		chunks: make(chan readAheadChunk, count),
+		free:   make(chan []byte, count+2),
+		done:   make(chan struct{}),
+		exited: make(chan struct{}),
+	}
+	// One buffer per queued chunk, plus the one being filled and the one being consumed
+	for i := 0; i < count+2; i++ {
+		r.free <- make([]byte, chunkSize)
+	}
+
+	go r.fill()
+	return r
+}
+
+// fill reads chunks from src until an error occurs or the reader is closed
+func (r *readAhead) fill() {
+	defer close(r.exited)
+
+	for {
+		var buf []byte
+		select {
+		case buf = <-r.free:
+		case <-r.done:
+			return
+		}
+
+		n, err := r.src.Read(buf)
+		select {
+		case r.chunks <- readAheadChunk{data: buf[:n], err: err}:
+		case <-r.done:
+			return
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// Read implements io.Reader
+func (r *readAhead) Read(p []byte) (int, error) {
+	for len(r.cur) == 0 {
+		if r.curBuf != nil {
+			r.free <- r.curBuf[:cap(r.curBuf)]
+			r.curBuf = nil
+		}
+		if r.err != nil {
+			return 0, r.err
+		}
+
+		chunk := <-r.chunks
+		r.cur, r.curBuf, r.err = chunk.data, chunk.data, chunk.err
+	}
+
+	n := copy(p, r.cur)
+	r.cur = r.cur[n:]
+	return n, nil
+}
+
+// Close stops the goroutine and closes the underlying stream
+func (r *readAhead) Close() error {
+	if r.closed {
+		return nil
+	}
+	r.closed = true
+
+	close(r.done)
+	<-r.exited
+	return r.src.Close()
+}
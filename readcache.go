@@ -0,0 +1,74 @@
+package hybridbuffer
+
+import (
+	"bytes"
+	"io"
+)
+
+// readCache holds the decoded contents of spilled data, see WithReadCache
+// It is valid for the contents it was read from, identified by the generation and
+// the number of bytes spilled; later writes or a Reset make it stale.
+type readCache struct {
+	data       []byte
+	generation uint64
+	spilled    int64
+}
+
+// cachedReader returns a reader over the full contents from the read cache
+// It returns nil if the cache is disabled, empty or stale. The caller must hold the lock.
+func (b *hybridBuffer) cachedReader() io.ReadCloser {
+	c := b.readCache.Load()
+	if c == nil || c.generation != b.generation.Load() || c.spilled != b.spilled || len(c.data) != b.size {
+		return nil
+	}
+	return io.NopCloser(bytes.NewReader(c.data))
+}
+
+// cacheReads wraps a fresh read stream over the full contents so that reading it
+// to the end fills the read cache
+// Streams over more than the cache size are returned unchanged. The caller must hold the lock.
+func (b *hybridBuffer) cacheReads(r io.ReadCloser) io.ReadCloser {
+	if b.readCacheSize == 0 || b.size > b.readCacheSize {
+		return r
+	}
+	return &cachingReader{
+		ReadCloser: r,
+		buf:        b,
+		seen:       b.readCache.Load(),
+		key:        readCache{generation: b.generation.Load(), spilled: b.spilled},
+		data:       make([]byte, 0, b.size),
+		size:       b.size,
+	}
+}
+
+// cachingReader records the data read from a storage stream and stores it in the
+// read cache once the stream reaches EOF
+type cachingReader struct {
+	io.ReadCloser
+	buf  *hybridBuffer
+	seen *readCache // Cache entry when the stream was opened, replaced only if unchanged
+	key  readCache
+	data []byte
+	size int
+}
+
+func (r *cachingReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	if r.data == nil {
+		return n, err
+	}
+
+	r.data = append(r.data, p[:n]...)
+	switch {
+	case len(r.data) > r.size:
+		r.data = nil // More data than expected, do not cache
+	case err == io.EOF && len(r.data) == r.size:
+		c := r.key
+		c.data = r.data
+		r.buf.readCache.CompareAndSwap(r.seen, &c)
+		r.data = nil
+	case err != nil && err != io.EOF:
+		r.data = nil
+	}
+	return n, err
+}
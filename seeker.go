@@ -0,0 +1,180 @@
+package hybridbuffer
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// OffsetOpener is an optional interface for storage backends that can open the
+// stored object at an offset, e.g. a file through Seek or an object store
+// through a range request
+// Buffers without middlewares use it to start read streams at the read position
+// or a seek target, instead of reading and discarding the data before it.
+type OffsetOpener interface {
+	OpenAt(off int64) (io.ReadCloser, error)
+}
+
+// rawStorage reports whether the stored data is exactly the buffer's contents
+func (b *hybridBuffer) rawStorage() bool {
+	return len(b.middlewares) == 0 && !b.formatHeader
+}
+
+// newReadStreamAt opens a read stream with the middleware pipeline applied,
+// positioned at the logical offset off
+// Raw storage on an OffsetOpener backend is opened at the offset, and raw storage
+// whose read stream can seek, such as an *os.File, is seeked to it. Otherwise the
+// stream starts at the beginning and the data before off is discarded.
+func (b *hybridBuffer) newReadStreamAt(off int64) (io.ReadCloser, error) {
+	if opener, ok := b.storageBackend.(OffsetOpener); ok && off > 0 && b.rawStorage() {
+		if b.ctx != nil {
+			if err := b.ctx.Err(); err != nil {
+				return nil, err
+			}
+		}
+		var end func(error)
+		if b.tracer != nil {
+			end = b.startSpan(spanOpen, b.storageBackend, int64(b.size)-off)
+		}
+		readStream, err := opener.OpenAt(off)
+		if end != nil {
+			end(err)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to open storage read stream: %w", err)
+		}
+		b.log("read_stream_opened", map[string]any{"size": b.size, "offset": off})
+		if b.ctx != nil {
+			return &contextReader{ctx: b.ctx, ReadCloser: readStream}, nil
+		}
+		return readStream, nil
+	}
+
+	readStream, err := b.newReadStream()
+	if err != nil {
+		return nil, err
+	}
+	if off > 0 {
+		if seeker := rawSeeker(readStream); seeker != nil && b.rawStorage() {
+			if _, err = seeker.Seek(off, io.SeekStart); err != nil {
+				readStream.Close()
+				return nil, fmt.Errorf("failed to seek storage read stream: %w", err)
+			}
+			return readStream, nil
+		}
+		if _, err = io.CopyN(io.Discard, readStream, off); err != nil {
+			readStream.Close()
+			return nil, fmt.Errorf("failed to seek storage read stream: %w", err)
+		}
+	}
+	return readStream, nil
+}
+
+// rawSeeker returns the storage stream below a context reader if it can seek
+func rawSeeker(r io.Reader) io.Seeker {
+	if cr, ok := r.(*contextReader); ok {
+		r = cr.ReadCloser
+	}
+	seeker, _ := r.(io.Seeker)
+	return seeker
+}
+
+// nopSeekCloser adds a no-op Close to an io.ReadSeeker
+type nopSeekCloser struct {
+	io.ReadSeeker
+}
+
+func (nopSeekCloser) Close() error {
+	return nil
+}
+
+// streamSeeker provides seeking over storage streams that cannot seek themselves
+// (e.g. because of middleware) by reopening the stream at the requested position
+// Moving forward within an open stream discards the data in between.
+type streamSeeker struct {
+	open      func(off int64) (io.ReadCloser, error)
+	size      int64
+	pos       int64 // Logical position
+	stream    io.ReadCloser
+	streamPos int64 // Position of stream
+}
+
+// Read implements io.Reader
+func (s *streamSeeker) Read(p []byte) (int, error) {
+	if s.pos >= s.size {
+		return 0, io.EOF
+	}
+
+	if err := s.sync(); err != nil {
+		return 0, err
+	}
+
+	if remaining := s.size - s.pos; int64(len(p)) > remaining {
+		p = p[:remaining]
+	}
+	n, err := s.stream.Read(p)
+	s.pos += int64(n)
+	s.streamPos += int64(n)
+	if err == io.EOF && s.pos < s.size {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
+// sync positions the underlying stream at the logical position
+func (s *streamSeeker) sync() error {
+	if s.stream != nil && s.streamPos > s.pos {
+		// Streams can only move forward, start over
+		s.stream.Close()
+		s.stream = nil
+	}
+
+	if s.stream == nil {
+		stream, err := s.open(s.pos)
+		if err != nil {
+			return err
+		}
+		s.stream = stream
+		s.streamPos = s.pos
+	}
+
+	if skip := s.pos - s.streamPos; skip > 0 {
+		n, err := io.CopyN(io.Discard, s.stream, skip)
+		s.streamPos += n
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Seek implements io.Seeker
+func (s *streamSeeker) Seek(offset int64, whence int) (int64, error) {
+	var abs int64
+	switch whence {
+	case io.SeekStart:
+		abs = offset
+	case io.SeekCurrent:
+		abs = s.pos + offset
+	case io.SeekEnd:
+		abs = s.size + offset
+	default:
+		return 0, errors.New("hybridbuffer: invalid whence")
+	}
+	if abs < 0 {
+		return 0, errors.New("hybridbuffer: negative position")
+	}
+
+	s.pos = abs
+	return abs, nil
+}
+
+// Close implements io.Closer
+func (s *streamSeeker) Close() error {
+	if s.stream == nil {
+		return nil
+	}
+	err := s.stream.Close()
+	s.stream = nil
+	return err
+}
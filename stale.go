@@ -0,0 +1,69 @@
+package hybridbuffer
+
+import (
+	"bytes"
+	"io"
+)
+
+// staleGuard detects that the buffer a reader was created from discarded its contents
+type staleGuard struct {
+	buf        *hybridBuffer
+	generation uint64
+}
+
+// staleGuard returns a guard for the current contents
+// The caller must hold the lock.
+func (b *hybridBuffer) staleGuard() staleGuard {
+	return staleGuard{buf: b, generation: b.generation.Load()}
+}
+
+// check returns ErrStale if the contents have been discarded since the guard was created
+func (g staleGuard) check() error {
+	if g.buf.generation.Load() != g.generation {
+		return ErrStale
+	}
+	return nil
+}
+
+// memorySnapshot returns a copy of the memory data from off to the end of the contents
+// Readers used without the lock read such a copy rather than a view, because
+// compaction, WithZeroOnReset and WriteAt modify the memory buffer in place.
+// The caller must hold the lock.
+func (b *hybridBuffer) memorySnapshot(off int) []byte {
+	return bytes.Clone(b.memoryBuffer.Bytes()[off:b.size])
+}
+
+// staleReader fails reads once its buffer's contents are discarded
+// The check is not atomic with the read, so the wrapped reader must not share
+// memory with the buffer; see memorySnapshot.
+type staleReader struct {
+	io.ReadCloser
+	staleGuard
+}
+
+func (r *staleReader) Read(p []byte) (int, error) {
+	if err := r.check(); err != nil {
+		return 0, err
+	}
+	return r.ReadCloser.Read(p)
+}
+
+// staleReadSeeker fails reads and seeks once its buffer's contents are discarded
+type staleReadSeeker struct {
+	io.ReadSeekCloser
+	staleGuard
+}
+
+func (r *staleReadSeeker) Read(p []byte) (int, error) {
+	if err := r.check(); err != nil {
+		return 0, err
+	}
+	return r.ReadSeekCloser.Read(p)
+}
+
+func (r *staleReadSeeker) Seek(offset int64, whence int) (int64, error) {
+	if err := r.check(); err != nil {
+		return 0, err
+	}
+	return r.ReadSeekCloser.Seek(offset, whence)
+}
@@ -0,0 +1,10 @@
+module schneider.vip/hybridbuffer/storage/memcached
+
+go 1.23.0
+
+toolchain go1.24.0
+
+require (
+	github.com/bradfitz/gomemcache v0.0.0-20260422231931-4d751bb6e37c
+	schneider.vip/hybridbuffer/storage v1.0.6
+)
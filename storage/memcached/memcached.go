@@ -0,0 +1,250 @@
+// Package memcached provides a memcached storage backend for HybridBuffer
+package memcached
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/bradfitz/gomemcache/memcache"
+	"schneider.vip/hybridbuffer/storage"
+)
+
+// DefaultChunkSize is the default number of bytes stored per item
+// It leaves headroom below memcached's default 1MB item limit for the key and
+// item overhead.
+const DefaultChunkSize = 1000 << 10
+
+// Client is the subset of *memcache.Client used by the backend
+type Client interface {
+	Set(item *memcache.Item) error
+	Get(key string) (*memcache.Item, error)
+	Delete(key string) error
+}
+
+// Backend stores data in memcached, split into items of at most chunkSize bytes
+type Backend struct {
+	client     Client
+	keyPrefix  string
+	expiration int32
+	chunkSize  int
+	key        string
+	chunks     int
+	size       int64
+}
+
+// Option configures the memcached backend
+type Option func(*Backend)
+
+// WithKeyPrefix sets the prefix of generated item keys
+// Default: "hybridbuffer-"
+func WithKeyPrefix(prefix string) Option {
+	return func(b *Backend) {
+		b.keyPrefix = prefix
+	}
+}
+
+// WithExpiration sets how long stored items live, so data of crashed processes
+// expires on its own; memcached rounds it to whole seconds
+// Default: no expiration
+func WithExpiration(d time.Duration) Option {
+	return func(b *Backend) {
+		if d >= 0 {
+			b.expiration = int32(d / time.Second)
+		}
+	}
+}
+
+// WithChunkSize sets the maximum number of bytes stored per item
+// Raise it only if the server's item size limit (-I) was raised as well.
+// Default: DefaultChunkSize
+func WithChunkSize(size int) Option {
+	return func(b *Backend) {
+		if size > 0 {
+			b.chunkSize = size
+		}
+	}
+}
+
+// chunkKey returns the item key of chunk i
+func (b *Backend) chunkKey(i int) string {
+	return b.key + "." + strconv.Itoa(i)
+}
+
+// Create implements storage.Backend
+func (b *Backend) Create() (io.WriteCloser, error) {
+	// Replace data of a previous Create
+	if err := b.Remove(); err != nil {
+		return nil, err
+	}
+
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return nil, fmt.Errorf("failed to generate key: %w", err)
+	}
+	b.key = b.keyPrefix + hex.EncodeToString(id)
+	return &writer{backend: b, buf: make([]byte, 0, b.chunkSize)}, nil
+}
+
+// Open implements storage.Backend
+func (b *Backend) Open() (io.ReadCloser, error) {
+	if b.key == "" {
+		return nil, errors.New("no data created yet")
+	}
+	return &reader{backend: b}, nil
+}
+
+// OpenAt opens the data starting at off, fetching only the chunks from there on
+// It implements hybridbuffer.OffsetOpener.
+func (b *Backend) OpenAt(off int64) (io.ReadCloser, error) {
+	if b.key == "" {
+		return nil, errors.New("no data created yet")
+	}
+	if off < 0 {
+		return nil, fmt.Errorf("negative offset %d", off)
+	}
+	chunkSize := int64(b.chunkSize)
+	return &reader{backend: b, next: int(off / chunkSize), skip: off % chunkSize}, nil
+}
+
+// Remove implements storage.Backend
+// Chunks that were already evicted are ignored.
+func (b *Backend) Remove() error {
+	var errs []error
+	for i := range b.chunks {
+		if err := b.client.Delete(b.chunkKey(i)); err != nil && !errors.Is(err, memcache.ErrCacheMiss) {
+			errs = append(errs, err)
+		}
+	}
+	b.key = ""
+	b.chunks = 0
+	b.size = 0
+	return errors.Join(errs...)
+}
+
+// Size returns the number of bytes stored
+func (b *Backend) Size() (int64, error) {
+	if b.key == "" {
+		return 0, errors.New("no data created yet")
+	}
+	return b.size, nil
+}
+
+// Key returns the key prefix of the stored items, "" if no data was created yet
+// The items are stored under Key()+".0", Key()+".1", and so on.
+func (b *Backend) Key() string {
+	return b.key
+}
+
+// writer collects data into chunks and stores each full chunk as an item
+type writer struct {
+	backend *Backend
+	buf     []byte
+	closed  bool
+}
+
+// flush stores the pending chunk
+func (w *writer) flush() error {
+	b := w.backend
+	item := &memcache.Item{Key: b.chunkKey(b.chunks), Value: w.buf, Expiration: b.expiration}
+	if err := b.client.Set(item); err != nil {
+		return fmt.Errorf("failed to store chunk %d: %w", b.chunks, err)
+	}
+	b.chunks++
+	b.size += int64(len(w.buf))
+	w.buf = make([]byte, 0, b.chunkSize)
+	return nil
+}
+
+// Write implements io.Writer
+func (w *writer) Write(p []byte) (n int, err error) {
+	if w.closed {
+		return 0, errors.New("write to closed writer")
+	}
+	for len(p) > 0 {
+		m := copy(w.buf[len(w.buf):cap(w.buf)], p)
+		w.buf = w.buf[:len(w.buf)+m]
+		n += m
+		p = p[m:]
+
+		if len(w.buf) == cap(w.buf) {
+			if err = w.flush(); err != nil {
+				return n, err
+			}
+		}
+	}
+	return n, nil
+}
+
+// Close implements io.Closer and stores the last partial chunk
+func (w *writer) Close() error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	if len(w.buf) == 0 {
+		return nil
+	}
+	return w.flush()
+}
+
+// reader fetches and concatenates the chunks one at a time
+type reader struct {
+	backend *Backend
+	next    int
+	skip    int64 // Bytes to skip in the next chunk, set by OpenAt
+	chunk   bytes.Reader
+}
+
+// Read implements io.Reader
+func (r *reader) Read(p []byte) (int, error) {
+	b := r.backend
+	for r.chunk.Len() == 0 {
+		if r.next >= b.chunks {
+			return 0, io.EOF
+		}
+		item, err := b.client.Get(b.chunkKey(r.next))
+		if errors.Is(err, memcache.ErrCacheMiss) {
+			return 0, fmt.Errorf("chunk %d was evicted: %w", r.next, err)
+		}
+		if err != nil {
+			return 0, fmt.Errorf("failed to fetch chunk %d: %w", r.next, err)
+		}
+		r.chunk.Reset(item.Value)
+		r.chunk.Seek(r.skip, io.SeekStart)
+		r.skip = 0
+		r.next++
+	}
+	return r.chunk.Read(p)
+}
+
+// Close implements io.Closer
+func (r *reader) Close() error {
+	return nil
+}
+
+// New creates a memcached storage backend provider function
+// Each buffer spilling to it stores its data under its own generated key.
+//
+// Example usage:
+//
+//	memcached.New(memcache.New("127.0.0.1:11211"))
+//	memcached.New(client, memcached.WithKeyPrefix("spill-"), memcached.WithExpiration(time.Hour))
+func New(client Client, opts ...Option) func() storage.Backend {
+	return func() storage.Backend {
+		b := &Backend{
+			client:    client,
+			keyPrefix: "hybridbuffer-",
+			chunkSize: DefaultChunkSize,
+		}
+		for _, opt := range opts {
+			opt(b)
+		}
+		return b
+	}
+}
@@ -0,0 +1,220 @@
+package memcached_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bradfitz/gomemcache/memcache"
+	"schneider.vip/hybridbuffer/storage"
+	"schneider.vip/hybridbuffer/storage/memcached"
+)
+
+var _ memcached.Client = (*memcache.Client)(nil)
+
+// mockClient keeps items in a map, enforcing an item size limit like memcached
+type mockClient struct {
+	items   map[string]*memcache.Item
+	maxSize int
+	failSet error
+	gets    []string
+}
+
+func newMockClient(maxSize int) *mockClient {
+	return &mockClient{items: make(map[string]*memcache.Item), maxSize: maxSize}
+}
+
+func (c *mockClient) Set(item *memcache.Item) error {
+	if c.failSet != nil {
+		return c.failSet
+	}
+	if len(item.Value) > c.maxSize {
+		return errors.New("SERVER_ERROR object too large for cache")
+	}
+	stored := *item
+	stored.Value = bytes.Clone(item.Value)
+	c.items[item.Key] = &stored
+	return nil
+}
+
+func (c *mockClient) Get(key string) (*memcache.Item, error) {
+	c.gets = append(c.gets, key)
+	item, ok := c.items[key]
+	if !ok {
+		return nil, memcache.ErrCacheMiss
+	}
+	return item, nil
+}
+
+func (c *mockClient) Delete(key string) error {
+	if _, ok := c.items[key]; !ok {
+		return memcache.ErrCacheMiss
+	}
+	delete(c.items, key)
+	return nil
+}
+
+func write(t *testing.T, backend storage.Backend, data []byte) {
+	t.Helper()
+
+	w, err := backend.Create()
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	if _, err := w.Write(data); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+}
+
+func read(backend storage.Backend) ([]byte, error) {
+	r, err := backend.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
+
+func TestChunkedRoundTrip(t *testing.T) {
+	client := newMockClient(100)
+	backend := memcached.New(client, memcached.WithChunkSize(100), memcached.WithKeyPrefix("spill-"), memcached.WithExpiration(time.Minute))().(*memcached.Backend)
+
+	data := bytes.Repeat([]byte("0123456789"), 25)
+	write(t, backend, data)
+
+	if len(client.items) != 3 {
+		t.Fatalf("Expected 3 chunks, got %d", len(client.items))
+	}
+	for i, size := range []int{100, 100, 50} {
+		item, ok := client.items[backend.Key()+"."+strconv.Itoa(i)]
+		if !ok || len(item.Value) != size {
+			t.Fatalf("Chunk %d missing or of wrong size", i)
+		}
+		if item.Expiration != 60 {
+			t.Fatalf("Expected expiration 60, got %d", item.Expiration)
+		}
+	}
+	if !strings.HasPrefix(backend.Key(), "spill-") {
+		t.Fatalf("Expected key prefix spill-, got %q", backend.Key())
+	}
+
+	got, err := read(backend)
+	if err != nil || !bytes.Equal(got, data) {
+		t.Fatalf("Read failed: %v", err)
+	}
+	if size, _ := backend.Size(); size != int64(len(data)) {
+		t.Fatalf("Expected size %d, got %d", len(data), size)
+	}
+
+	if err := backend.Remove(); err != nil {
+		t.Fatalf("Remove failed: %v", err)
+	}
+	if len(client.items) != 0 {
+		t.Fatalf("Expected all chunks removed, %d left", len(client.items))
+	}
+}
+
+func TestOpenAt(t *testing.T) {
+	client := newMockClient(100)
+	backend := memcached.New(client, memcached.WithChunkSize(100))().(*memcached.Backend)
+
+	data := bytes.Repeat([]byte("0123456789"), 25)
+	write(t, backend, data)
+
+	for _, off := range []int64{0, 42, 100, 205, 250, 300} {
+		client.gets = nil
+		r, err := backend.OpenAt(off)
+		if err != nil {
+			t.Fatalf("OpenAt(%d) failed: %v", off, err)
+		}
+		got, err := io.ReadAll(r)
+		r.Close()
+		if err != nil || !bytes.Equal(got, data[min(off, int64(len(data))):]) {
+			t.Fatalf("OpenAt(%d): expected the data from the offset, got %d bytes, %v", off, len(got), err)
+		}
+		// Only the chunks from the offset on are fetched
+		var want []string
+		for i := int(off / 100); i < 3; i++ {
+			want = append(want, backend.Key()+"."+strconv.Itoa(i))
+		}
+		if !slices.Equal(client.gets, want) {
+			t.Fatalf("OpenAt(%d): expected to fetch %v, got %v", off, want, client.gets)
+		}
+	}
+
+	if _, err := backend.OpenAt(-1); err == nil {
+		t.Fatal("Expected an error for a negative offset")
+	}
+}
+
+func TestCreateReplacesPreviousData(t *testing.T) {
+	client := newMockClient(memcached.DefaultChunkSize)
+	backend := memcached.New(client)()
+
+	write(t, backend, []byte("first"))
+	write(t, backend, []byte("second"))
+	if len(client.items) != 1 {
+		t.Fatalf("Expected 1 item, got %d", len(client.items))
+	}
+	if got, _ := read(backend); string(got) != "second" {
+		t.Fatalf("Expected second, got %q", got)
+	}
+}
+
+func TestEmptyData(t *testing.T) {
+	client := newMockClient(memcached.DefaultChunkSize)
+	backend := memcached.New(client)()
+
+	write(t, backend, nil)
+	got, err := read(backend)
+	if err != nil || len(got) != 0 {
+		t.Fatalf("Expected empty data, got %q, %v", got, err)
+	}
+}
+
+func TestEvictedChunk(t *testing.T) {
+	client := newMockClient(10)
+	backend := memcached.New(client, memcached.WithChunkSize(10))().(*memcached.Backend)
+
+	write(t, backend, bytes.Repeat([]byte("x"), 25))
+	delete(client.items, backend.Key()+".1")
+
+	if _, err := read(backend); !errors.Is(err, memcache.ErrCacheMiss) {
+		t.Fatalf("Expected ErrCacheMiss, got %v", err)
+	}
+
+	// Removing ignores the evicted chunk
+	if err := backend.Remove(); err != nil {
+		t.Fatalf("Remove failed: %v", err)
+	}
+	if len(client.items) != 0 {
+		t.Fatalf("Expected all chunks removed, %d left", len(client.items))
+	}
+}
+
+func TestSetError(t *testing.T) {
+	client := newMockClient(10)
+	backend := memcached.New(client, memcached.WithChunkSize(10))()
+
+	w, _ := backend.Create()
+	w.Write(bytes.Repeat([]byte("x"), 15))
+	client.failSet = errors.New("connection refused")
+	if _, err := w.Write(bytes.Repeat([]byte("x"), 10)); !errors.Is(err, client.failSet) {
+		t.Fatalf("Expected the Set error, got %v", err)
+	}
+
+	// Chunks stored before the failure are removed
+	client.failSet = nil
+	backend.Remove()
+	if len(client.items) != 0 {
+		t.Fatalf("Expected all chunks removed, %d left", len(client.items))
+	}
+}
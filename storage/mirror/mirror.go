@@ -0,0 +1,197 @@
+// Package mirror provides a storage backend for HybridBuffer that writes every spill to two backends
+package mirror
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"schneider.vip/hybridbuffer/internal/storagewrap"
+	"schneider.vip/hybridbuffer/storage"
+)
+
+// Backend writes to a primary and a secondary backend and reads from the primary,
+// falling back to the secondary if the primary fails
+// Only primary failures are returned to the caller; secondary failures are
+// reported to the error handler and leave the data on the primary only.
+type Backend struct {
+	primary   storage.Backend
+	secondary storage.Backend
+	onError   func(error)
+
+	// secondaryCreated is set while the secondary may hold data to remove,
+	// secondaryOK once it holds a complete copy
+	secondaryCreated bool
+	secondaryOK      bool
+}
+
+// Option configures the mirroring backend
+type Option func(*Backend)
+
+// WithErrorHandler sets a callback receiving failures of the secondary backend,
+// which are not returned to the caller
+// Default: failures are ignored
+func WithErrorHandler(handler func(error)) Option {
+	return func(b *Backend) {
+		b.onError = handler
+	}
+}
+
+// secondaryFailed reports a failure of the secondary backend
+func (b *Backend) secondaryFailed(op string, err error) {
+	b.secondaryOK = false
+	if b.onError != nil {
+		b.onError(fmt.Errorf("secondary %s failed: %w", op, err))
+	}
+}
+
+// Create implements storage.Backend
+func (b *Backend) Create() (io.WriteCloser, error) {
+	b.secondaryOK = false
+
+	pw, err := b.primary.Create()
+	if err != nil {
+		return nil, err
+	}
+
+	sw, err := b.secondary.Create()
+	if err != nil {
+		b.secondaryFailed("create", err)
+		sw = nil
+	} else {
+		b.secondaryCreated = true
+	}
+	return &writer{backend: b, primary: pw, secondary: sw}, nil
+}
+
+// Open implements storage.Backend
+// If the primary cannot be opened, or fails while reading, the secondary serves
+// the data, provided it holds a complete copy.
+func (b *Backend) Open() (io.ReadCloser, error) {
+	return b.OpenAt(0)
+}
+
+// OpenAt opens the stored object at off like Open, through the backends' OpenAt
+// if they have one, otherwise by seeking or skipping the data before off
+func (b *Backend) OpenAt(off int64) (io.ReadCloser, error) {
+	r, err := storagewrap.OpenAt(b.primary, off)
+	if err != nil {
+		if !b.secondaryOK {
+			return nil, err
+		}
+		return storagewrap.OpenAt(b.secondary, off)
+	}
+	return &reader{backend: b, r: r, pos: off}, nil
+}
+
+// Remove implements storage.Backend
+// Failures to remove the secondary copy are reported to the error handler.
+func (b *Backend) Remove() error {
+	if b.secondaryCreated {
+		if err := b.secondary.Remove(); err != nil {
+			b.secondaryFailed("remove", err)
+		}
+	}
+	b.secondaryCreated = false
+	b.secondaryOK = false
+	return b.primary.Remove()
+}
+
+// writer writes to both backends, dropping the secondary once it fails
+type writer struct {
+	backend   *Backend
+	primary   io.WriteCloser
+	secondary io.WriteCloser
+}
+
+// Write implements io.Writer
+func (w *writer) Write(p []byte) (int, error) {
+	n, err := w.primary.Write(p)
+	if err != nil {
+		return n, err
+	}
+
+	if w.secondary != nil {
+		if _, err := w.secondary.Write(p); err != nil {
+			w.backend.secondaryFailed("write", err)
+			w.secondary.Close()
+			w.secondary = nil
+		}
+	}
+	return n, nil
+}
+
+// Close implements io.Closer
+func (w *writer) Close() error {
+	if w.secondary != nil {
+		if err := w.secondary.Close(); err != nil {
+			w.backend.secondaryFailed("close", err)
+		} else {
+			w.backend.secondaryOK = true
+		}
+		w.secondary = nil
+	}
+	return w.primary.Close()
+}
+
+// reader reads from the primary and switches to the secondary on a read error,
+// skipping the bytes already delivered
+type reader struct {
+	backend  *Backend
+	r        io.ReadCloser
+	pos      int64 // Position in the stored object
+	switched bool
+}
+
+// Read implements io.Reader
+func (r *reader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.pos += int64(n)
+	if err == nil || err == io.EOF || r.switched || !r.backend.secondaryOK {
+		return n, err
+	}
+
+	if serr := r.switchToSecondary(); serr != nil {
+		return n, errors.Join(err, serr)
+	}
+	return n, nil
+}
+
+// switchToSecondary continues reading from the secondary at the current position
+func (r *reader) switchToSecondary() error {
+	sr, err := storagewrap.OpenAt(r.backend.secondary, r.pos)
+	if err != nil {
+		return fmt.Errorf("secondary open failed: %w", err)
+	}
+
+	r.r.Close()
+	r.r = sr
+	r.switched = true
+	return nil
+}
+
+// Close implements io.Closer
+func (r *reader) Close() error {
+	return r.r.Close()
+}
+
+// New creates a mirroring storage backend provider function
+// Every Create writes to a backend of both providers. Writes fail only if the
+// primary fails; a failing secondary is dropped for the rest of the stream.
+//
+// Example usage:
+//
+//	mirror.New(filesystem.New(), s3.New(client, bucket))
+//	mirror.New(filesystem.New(), s3.New(client, bucket), mirror.WithErrorHandler(logError))
+func New(primary, secondary func() storage.Backend, opts ...Option) func() storage.Backend {
+	return func() storage.Backend {
+		b := &Backend{
+			primary:   primary(),
+			secondary: secondary(),
+		}
+		for _, opt := range opts {
+			opt(b)
+		}
+		return b
+	}
+}
@@ -0,0 +1,216 @@
+package mirror_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+
+	"schneider.vip/hybridbuffer/storage"
+	"schneider.vip/hybridbuffer/storage/mirror"
+)
+
+// memoryBackend keeps data in memory and fails operations on request
+type memoryBackend struct {
+	data      bytes.Buffer
+	removed   bool
+	createErr error
+	writeErr  error
+	openErr   error
+	readErr   error // Returned after the first read
+}
+
+func (m *memoryBackend) Create() (io.WriteCloser, error) {
+	if m.createErr != nil {
+		return nil, m.createErr
+	}
+	m.data.Reset()
+	return &memoryWriter{m}, nil
+}
+
+func (m *memoryBackend) Open() (io.ReadCloser, error) {
+	if m.openErr != nil {
+		return nil, m.openErr
+	}
+	return &memoryReader{backend: m, r: bytes.NewReader(m.data.Bytes())}, nil
+}
+
+func (m *memoryBackend) Remove() error {
+	m.removed = true
+	m.data.Reset()
+	return nil
+}
+
+type memoryWriter struct {
+	backend *memoryBackend
+}
+
+func (w *memoryWriter) Write(p []byte) (int, error) {
+	if w.backend.writeErr != nil {
+		return 0, w.backend.writeErr
+	}
+	return w.backend.data.Write(p)
+}
+
+func (w *memoryWriter) Close() error { return nil }
+
+type memoryReader struct {
+	backend *memoryBackend
+	r       *bytes.Reader
+	reads   int
+}
+
+func (r *memoryReader) Read(p []byte) (int, error) {
+	if r.reads > 0 && r.backend.readErr != nil {
+		return 0, r.backend.readErr
+	}
+	r.reads++
+	return r.r.Read(p)
+}
+
+func (r *memoryReader) Close() error { return nil }
+
+func newMirror(opts ...mirror.Option) (*memoryBackend, *memoryBackend, storage.Backend) {
+	primary, secondary := &memoryBackend{}, &memoryBackend{}
+	backend := mirror.New(
+		func() storage.Backend { return primary },
+		func() storage.Backend { return secondary },
+		opts...,
+	)()
+	return primary, secondary, backend
+}
+
+func write(t *testing.T, backend storage.Backend, data []byte) {
+	t.Helper()
+
+	w, err := backend.Create()
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	if _, err := w.Write(data); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+}
+
+func read(backend storage.Backend) ([]byte, error) {
+	r, err := backend.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	// Small reads, so that a read error can occur midway
+	var out bytes.Buffer
+	_, err = io.CopyBuffer(&out, struct{ io.Reader }{r}, make([]byte, 4))
+	return out.Bytes(), err
+}
+
+func TestWritesBoth(t *testing.T) {
+	primary, secondary, backend := newMirror()
+	write(t, backend, []byte("mirrored data"))
+
+	if primary.data.String() != "mirrored data" || secondary.data.String() != "mirrored data" {
+		t.Fatalf("Expected data in both backends, got %q and %q", primary.data.String(), secondary.data.String())
+	}
+
+	if err := backend.Remove(); err != nil {
+		t.Fatalf("Remove failed: %v", err)
+	}
+	if !primary.removed || !secondary.removed {
+		t.Fatal("Expected both backends to be removed")
+	}
+}
+
+func TestSecondaryServesFailedPrimary(t *testing.T) {
+	primary, _, backend := newMirror()
+	data := []byte("data served by the secondary")
+	write(t, backend, data)
+
+	primary.openErr = errors.New("primary unavailable")
+	got, err := read(backend)
+	if err != nil || !bytes.Equal(got, data) {
+		t.Fatalf("Expected the secondary to serve the data, got %q, %v", got, err)
+	}
+}
+
+func TestSecondaryResumesFailedRead(t *testing.T) {
+	primary, _, backend := newMirror()
+	data := []byte("read resumes on the secondary")
+	write(t, backend, data)
+
+	primary.readErr = errors.New("connection reset")
+	got, err := read(backend)
+	if err != nil || !bytes.Equal(got, data) {
+		t.Fatalf("Expected the read to resume on the secondary, got %q, %v", got, err)
+	}
+}
+
+func TestSecondaryFailuresGoToHandler(t *testing.T) {
+	var reported []error
+	primary, secondary, backend := newMirror(mirror.WithErrorHandler(func(err error) {
+		reported = append(reported, err)
+	}))
+
+	secondary.writeErr = errors.New("secondary full")
+	write(t, backend, []byte("primary only"))
+	if primary.data.String() != "primary only" {
+		t.Fatalf("Expected the data in the primary, got %q", primary.data.String())
+	}
+	if len(reported) != 1 || !errors.Is(reported[0], secondary.writeErr) {
+		t.Fatalf("Expected the secondary error to be reported once, got %v", reported)
+	}
+
+	// An incomplete secondary is not used for reading
+	primary.openErr = errors.New("primary unavailable")
+	if _, err := read(backend); !errors.Is(err, primary.openErr) {
+		t.Fatalf("Expected the primary error, got %v", err)
+	}
+}
+
+func TestPrimaryFailuresAreReturned(t *testing.T) {
+	primary, _, backend := newMirror()
+
+	primary.createErr = errors.New("primary create failed")
+	if _, err := backend.Create(); !errors.Is(err, primary.createErr) {
+		t.Fatalf("Expected the primary create error, got %v", err)
+	}
+
+	primary.createErr = nil
+	primary.writeErr = errors.New("primary write failed")
+	w, _ := backend.Create()
+	if _, err := w.Write([]byte("data")); !errors.Is(err, primary.writeErr) {
+		t.Fatalf("Expected the primary write error, got %v", err)
+	}
+}
+
+func TestOpenAt(t *testing.T) {
+	primary, _, backend := newMirror()
+	data := []byte("opened at an offset")
+	write(t, backend, data)
+
+	r, err := backend.(*mirror.Backend).OpenAt(10)
+	if err != nil {
+		t.Fatalf("OpenAt failed: %v", err)
+	}
+	if got, _ := io.ReadAll(r); string(got) != "an offset" {
+		t.Fatalf("Expected %q, got %q", "an offset", got)
+	}
+
+	// A failed read resumes on the secondary at the position reached
+	primary.readErr = errors.New("connection reset")
+	r, _ = backend.(*mirror.Backend).OpenAt(7)
+	var out bytes.Buffer
+	if _, err := io.CopyBuffer(&out, struct{ io.Reader }{r}, make([]byte, 4)); err != nil || out.String() != "at an offset" {
+		t.Fatalf("Expected %q, got %q, %v", "at an offset", out.String(), err)
+	}
+
+	// The secondary serves a failed primary at the offset
+	primary.openErr = errors.New("primary unavailable")
+	r, _ = backend.(*mirror.Backend).OpenAt(13)
+	if got, _ := io.ReadAll(r); string(got) != "offset" {
+		t.Fatalf("Expected %q, got %q", "offset", got)
+	}
+}
@@ -0,0 +1,268 @@
+// Package retry provides a storage backend wrapper for HybridBuffer that retries transient failures
+package retry
+
+import (
+	"io"
+	"time"
+
+	"schneider.vip/hybridbuffer/internal/storagewrap"
+	"schneider.vip/hybridbuffer/storage"
+)
+
+// Backend wraps another storage backend and retries its operations with backoff
+type Backend struct {
+	backend    storage.Backend
+	maxRetries int
+	backoff    func(attempt int) time.Duration
+	file       string // Name of the file written by the wrapped backend, if any
+}
+
+// Option configures the retrying backend
+type Option func(*Backend)
+
+// WithMaxRetries sets how often a failed operation is retried
+// Default: 3
+func WithMaxRetries(n int) Option {
+	return func(b *Backend) {
+		if n >= 0 {
+			b.maxRetries = n
+		}
+	}
+}
+
+// WithBackoff sets the function computing the delay before a retry
+// The attempt number starts at 0 for the first retry.
+// Default: exponential backoff starting at 50ms
+func WithBackoff(backoff func(attempt int) time.Duration) Option {
+	return func(b *Backend) {
+		if backoff != nil {
+			b.backoff = backoff
+		}
+	}
+}
+
+// defaultBackoff doubles the delay for every attempt, starting at 50ms
+func defaultBackoff(attempt int) time.Duration {
+	return 50 * time.Millisecond << attempt
+}
+
+// retry runs op until it succeeds or the retry budget is exhausted
+func (b *Backend) retry(op func() error) error {
+	var err error
+	for attempt := 0; ; attempt++ {
+		if err = op(); err == nil {
+			return nil
+		}
+		if attempt >= b.maxRetries {
+			return err
+		}
+		time.Sleep(b.backoff(attempt))
+	}
+}
+
+// create calls Create on the wrapped backend with retries
+func (b *Backend) create() (io.WriteCloser, error) {
+	var w io.WriteCloser
+	err := b.retry(func() error {
+		var err error
+		w, err = b.backend.Create()
+		return err
+	})
+	b.file = storagewrap.FileName(w)
+	return w, err
+}
+
+// open opens the wrapped backend at off with retries
+func (b *Backend) open(off int64) (io.ReadCloser, error) {
+	var r io.ReadCloser
+	err := b.retry(func() error {
+		var err error
+		r, err = storagewrap.OpenAt(b.backend, off)
+		return err
+	})
+	return r, err
+}
+
+// Create implements storage.Backend
+// Writes to the returned stream are only retried until data was written,
+// which in practice means only the first write is retried.
+func (b *Backend) Create() (io.WriteCloser, error) {
+	w, err := b.create()
+	if err != nil {
+		return nil, err
+	}
+	return &writer{backend: b, w: w}, nil
+}
+
+// Open implements storage.Backend
+func (b *Backend) Open() (io.ReadCloser, error) {
+	return b.OpenAt(0)
+}
+
+// OpenAt opens the stored object at off, through the wrapped backend's OpenAt if
+// it has one, otherwise by seeking or skipping the data before off
+func (b *Backend) OpenAt(off int64) (io.ReadCloser, error) {
+	r, err := b.open(off)
+	if err != nil {
+		return nil, err
+	}
+	return &reader{backend: b, r: r, pos: off}, nil
+}
+
+// Remove implements storage.Backend
+func (b *Backend) Remove() error {
+	return b.retry(b.backend.Remove)
+}
+
+// Size returns the stored size if the wrapped backend can report it, or if it
+// wrote to a local file, such as the filesystem backend
+// It returns errors.ErrUnsupported otherwise.
+func (b *Backend) Size() (int64, error) {
+	sizer, ok := b.backend.(interface{ Size() (int64, error) })
+	if !ok {
+		return storagewrap.Size(b.backend, b.file)
+	}
+
+	var size int64
+	err := b.retry(func() error {
+		var err error
+		size, err = sizer.Size()
+		return err
+	})
+	return size, err
+}
+
+// Path returns the file path if the wrapped backend keeps the data in a local file
+// It returns "" if the wrapped backend has no Path method and did not write to an
+// *os.File.
+func (b *Backend) Path() string {
+	return storagewrap.Path(b.backend, b.file)
+}
+
+// writer retries a failed write only while nothing has been written yet,
+// which in practice means only the first write of a stream is retried.
+// Once data reached the wrapped stream, a retry would have to replay it,
+// which would require buffering the whole stream, so later failures are
+// returned to the caller unchanged.
+type writer struct {
+	backend *Backend
+	w       io.WriteCloser
+	written int64
+	err     error // Failed re-creation, w is closed and later calls return it
+}
+
+// Write implements io.Writer
+func (w *writer) Write(p []byte) (int, error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+
+	n, err := w.w.Write(p)
+	w.written += int64(n)
+	if err == nil || w.written > 0 {
+		return n, err
+	}
+
+	// Nothing was written yet, so restart from the beginning with a fresh stream
+	for attempt := 0; attempt < w.backend.maxRetries; attempt++ {
+		time.Sleep(w.backend.backoff(attempt))
+
+		w.w.Close()
+		w.backend.backend.Remove()
+		stream, createErr := w.backend.create()
+		if createErr != nil {
+			w.w = nil
+			w.err = createErr
+			return 0, createErr
+		}
+		w.w = stream
+
+		n, err = w.w.Write(p)
+		w.written += int64(n)
+		if err == nil || w.written > 0 {
+			return n, err
+		}
+	}
+	return n, err
+}
+
+// Close implements io.Closer
+// After a failed re-creation it returns the Create error.
+func (w *writer) Close() error {
+	if w.err != nil {
+		return w.err
+	}
+	return w.w.Close()
+}
+
+// reader reopens the wrapped stream after a read failure at the position
+// of the bytes already delivered, so reads resume where they stopped.
+type reader struct {
+	backend *Backend
+	r       io.ReadCloser
+	pos     int64 // Position in the stored object
+	broken  bool
+}
+
+// Read implements io.Reader
+func (r *reader) Read(p []byte) (int, error) {
+	for attempt := 0; ; attempt++ {
+		if r.broken {
+			if err := r.reopen(); err != nil {
+				return 0, err
+			}
+		}
+
+		n, err := r.r.Read(p)
+		r.pos += int64(n)
+		if err == nil || err == io.EOF {
+			return n, err
+		}
+
+		r.broken = true
+		if n > 0 {
+			// Deliver what we got, the stream is reopened on the next call
+			return n, nil
+		}
+		if attempt >= r.backend.maxRetries {
+			return 0, err
+		}
+		time.Sleep(r.backend.backoff(attempt))
+	}
+}
+
+// reopen replaces the broken stream with a fresh one positioned at r.pos
+func (r *reader) reopen() error {
+	r.r.Close()
+	stream, err := r.backend.open(r.pos)
+	if err != nil {
+		return err
+	}
+	r.r = stream
+	r.broken = false
+	return nil
+}
+
+// Close implements io.Closer
+func (r *reader) Close() error {
+	return r.r.Close()
+}
+
+// Wrap wraps a storage provider so that every backend it creates retries
+// transient failures of Create, Open, Remove and of the returned streams
+func Wrap(provider func() storage.Backend, opts ...Option) func() storage.Backend {
+	return func() storage.Backend {
+		b := &Backend{
+			backend:    provider(),
+			maxRetries: 3,
+			backoff:    defaultBackoff,
+		}
+
+		// Apply options
+		for _, opt := range opts {
+			opt(b)
+		}
+
+		return b
+	}
+}
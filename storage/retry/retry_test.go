@@ -0,0 +1,364 @@
+package retry_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"slices"
+	"testing"
+	"time"
+
+	"schneider.vip/hybridbuffer/storage"
+	"schneider.vip/hybridbuffer/storage/retry"
+)
+
+var errTransient = errors.New("transient failure")
+
+// flakyBackend keeps data in memory and fails a configurable number of operations
+type flakyBackend struct {
+	data         []byte
+	createFails  int
+	openFails    int
+	removeFails  int
+	writeFails   int
+	readFails    int
+	createCalled int
+	openCalled   int
+	removeCalled int
+	closeCalled  int
+}
+
+func (f *flakyBackend) Create() (io.WriteCloser, error) {
+	f.createCalled++
+	if f.createFails > 0 {
+		f.createFails--
+		return nil, errTransient
+	}
+	f.data = nil
+	return &flakyWriter{backend: f}, nil
+}
+
+func (f *flakyBackend) Open() (io.ReadCloser, error) {
+	f.openCalled++
+	if f.openFails > 0 {
+		f.openFails--
+		return nil, errTransient
+	}
+	return &flakyReader{backend: f, r: bytes.NewReader(f.data)}, nil
+}
+
+func (f *flakyBackend) Remove() error {
+	f.removeCalled++
+	if f.removeFails > 0 {
+		f.removeFails--
+		return errTransient
+	}
+	f.data = nil
+	return nil
+}
+
+type flakyWriter struct {
+	backend *flakyBackend
+}
+
+func (w *flakyWriter) Write(p []byte) (int, error) {
+	if w.backend.writeFails > 0 {
+		w.backend.writeFails--
+		return 0, errTransient
+	}
+	w.backend.data = append(w.backend.data, p...)
+	return len(p), nil
+}
+
+func (w *flakyWriter) Close() error {
+	w.backend.closeCalled++
+	return nil
+}
+
+type flakyReader struct {
+	backend *flakyBackend
+	r       *bytes.Reader
+}
+
+func (r *flakyReader) Read(p []byte) (int, error) {
+	// Fail after the first byte so resuming has to skip already delivered data
+	if r.backend.readFails > 0 && r.r.Len() < len(r.backend.data) {
+		r.backend.readFails--
+		return 0, errTransient
+	}
+	if len(p) > 1 {
+		p = p[:1]
+	}
+	return r.r.Read(p)
+}
+
+func (r *flakyReader) Close() error { return nil }
+
+func noBackoff(int) time.Duration { return 0 }
+
+func wrap(f *flakyBackend, opts ...retry.Option) storage.Backend {
+	opts = append([]retry.Option{retry.WithBackoff(noBackoff)}, opts...)
+	return retry.Wrap(func() storage.Backend { return f }, opts...)()
+}
+
+func TestBackend_RetriesCreateOpenRemove(t *testing.T) {
+	flaky := &flakyBackend{createFails: 2, openFails: 2, removeFails: 2}
+	backend := wrap(flaky)
+
+	w, err := backend.Create()
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	w.Write([]byte("hello"))
+	w.Close()
+
+	r, err := backend.Open()
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("ReadAll failed: %v", err)
+	}
+	r.Close()
+	if string(data) != "hello" {
+		t.Fatalf("Expected %q, got %q", "hello", string(data))
+	}
+
+	if err := backend.Remove(); err != nil {
+		t.Fatalf("Remove failed: %v", err)
+	}
+	if flaky.createCalled != 3 || flaky.openCalled != 3 || flaky.removeCalled != 3 {
+		t.Fatalf("Unexpected call counts: create=%d open=%d remove=%d",
+			flaky.createCalled, flaky.openCalled, flaky.removeCalled)
+	}
+}
+
+func TestBackend_GivesUpAfterMaxRetries(t *testing.T) {
+	flaky := &flakyBackend{createFails: 5}
+	backend := wrap(flaky, retry.WithMaxRetries(2))
+
+	if _, err := backend.Create(); !errors.Is(err, errTransient) {
+		t.Fatalf("Expected transient error, got %v", err)
+	}
+	if flaky.createCalled != 3 {
+		t.Fatalf("Expected 3 Create calls, got %d", flaky.createCalled)
+	}
+}
+
+func TestBackend_RetriesFirstWrite(t *testing.T) {
+	flaky := &flakyBackend{writeFails: 1}
+	backend := wrap(flaky)
+
+	w, err := backend.Create()
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	if _, err := w.Write([]byte("data")); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	w.Close()
+
+	if string(flaky.data) != "data" {
+		t.Fatalf("Expected %q, got %q", "data", string(flaky.data))
+	}
+	if flaky.createCalled != 2 {
+		t.Fatalf("Expected Create to be re-invoked, got %d calls", flaky.createCalled)
+	}
+}
+
+func TestBackend_DoesNotRetryPartialWrite(t *testing.T) {
+	flaky := &flakyBackend{}
+	backend := wrap(flaky)
+
+	w, err := backend.Create()
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	w.Write([]byte("first"))
+
+	flaky.writeFails = 1
+	if _, err := w.Write([]byte("second")); !errors.Is(err, errTransient) {
+		t.Fatalf("Expected transient error, got %v", err)
+	}
+	if string(flaky.data) != "first" {
+		t.Fatalf("Expected no duplicated data, got %q", string(flaky.data))
+	}
+}
+
+func TestBackend_FailedRecreateIsSticky(t *testing.T) {
+	flaky := &flakyBackend{}
+	backend := wrap(flaky, retry.WithMaxRetries(1))
+
+	w, err := backend.Create()
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+
+	// The first write fails and so does creating the replacement stream
+	flaky.writeFails = 1
+	flaky.createFails = 2
+	_, writeErr := w.Write([]byte("data"))
+	if !errors.Is(writeErr, errTransient) {
+		t.Fatalf("Expected transient error, got %v", writeErr)
+	}
+	if _, err := w.Write([]byte("more")); err != writeErr {
+		t.Fatalf("Expected later writes to return %v, got %v", writeErr, err)
+	}
+	if err := w.Close(); err != writeErr {
+		t.Fatalf("Expected Close to return %v, got %v", writeErr, err)
+	}
+	if flaky.closeCalled != 1 {
+		t.Fatalf("Expected the failed stream to be closed once, got %d", flaky.closeCalled)
+	}
+}
+
+func TestBackend_ResumesReadAfterFailure(t *testing.T) {
+	flaky := &flakyBackend{}
+	backend := wrap(flaky)
+
+	w, _ := backend.Create()
+	w.Write([]byte("0123456789"))
+	w.Close()
+
+	flaky.readFails = 3
+	r, err := backend.Open()
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer r.Close()
+
+	data, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("ReadAll failed: %v", err)
+	}
+	if string(data) != "0123456789" {
+		t.Fatalf("Expected %q, got %q", "0123456789", string(data))
+	}
+}
+
+// sizedBackend is a flakyBackend that reports its size, failing once
+type sizedBackend struct {
+	flakyBackend
+	sizeFails int
+}
+
+func (s *sizedBackend) Size() (int64, error) {
+	if s.sizeFails > 0 {
+		s.sizeFails--
+		return 0, errTransient
+	}
+	return int64(len(s.data)), nil
+}
+
+func TestBackend_Size(t *testing.T) {
+	sized := &sizedBackend{flakyBackend: flakyBackend{data: []byte("stored")}, sizeFails: 1}
+	backend := retry.Wrap(func() storage.Backend { return sized }, retry.WithBackoff(noBackoff))().(*retry.Backend)
+
+	if size, err := backend.Size(); err != nil || size != 6 {
+		t.Fatalf("Expected size 6 after retry, got %d, %v", size, err)
+	}
+
+	plain := wrap(&flakyBackend{}).(*retry.Backend)
+	if _, err := plain.Size(); !errors.Is(err, errors.ErrUnsupported) {
+		t.Fatalf("Expected ErrUnsupported, got %v", err)
+	}
+}
+
+// pathBackend is a flakyBackend that reports a file path
+type pathBackend struct {
+	flakyBackend
+}
+
+func (p *pathBackend) Path() string {
+	return "/tmp/spill"
+}
+
+func TestBackend_Path(t *testing.T) {
+	withPath := retry.Wrap(func() storage.Backend { return &pathBackend{} })().(*retry.Backend)
+	if path := withPath.Path(); path != "/tmp/spill" {
+		t.Fatalf("Expected /tmp/spill, got %q", path)
+	}
+	if path := wrap(&flakyBackend{}).(*retry.Backend).Path(); path != "" {
+		t.Fatalf("Expected no path, got %q", path)
+	}
+}
+
+// fileBackend writes to a local file but has no Size or Path method
+type fileBackend struct {
+	dir  string
+	name string
+}
+
+func (f *fileBackend) Create() (io.WriteCloser, error) {
+	file, err := os.CreateTemp(f.dir, "spill-*")
+	if err != nil {
+		return nil, err
+	}
+	f.name = file.Name()
+	return file, nil
+}
+
+func (f *fileBackend) Open() (io.ReadCloser, error) { return os.Open(f.name) }
+func (f *fileBackend) Remove() error                { return os.Remove(f.name) }
+
+func TestBackend_FileSizeAndPath(t *testing.T) {
+	file := &fileBackend{dir: t.TempDir()}
+	backend := retry.Wrap(func() storage.Backend { return file })().(*retry.Backend)
+
+	w, err := backend.Create()
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	w.Write([]byte("stored"))
+	w.Close()
+
+	if size, err := backend.Size(); err != nil || size != 6 {
+		t.Fatalf("Expected size 6 from the file, got %d, %v", size, err)
+	}
+	if path := backend.Path(); path != file.name {
+		t.Fatalf("Expected %q, got %q", file.name, path)
+	}
+}
+
+// offsetBackend is a flakyBackend that opens its data at an offset
+type offsetBackend struct {
+	flakyBackend
+	offsets []int64
+}
+
+func (o *offsetBackend) OpenAt(off int64) (io.ReadCloser, error) {
+	o.offsets = append(o.offsets, off)
+	return &flakyReader{backend: &o.flakyBackend, r: bytes.NewReader(o.data[off:])}, nil
+}
+
+func TestBackend_OpenAt(t *testing.T) {
+	offset := &offsetBackend{flakyBackend: flakyBackend{data: []byte("0123456789")}}
+	backend := retry.Wrap(func() storage.Backend { return offset }, retry.WithBackoff(noBackoff))().(*retry.Backend)
+
+	r, err := backend.OpenAt(3)
+	if err != nil {
+		t.Fatalf("OpenAt failed: %v", err)
+	}
+	defer r.Close()
+
+	// A failed read reopens the stream at the position reached
+	first := make([]byte, 1)
+	r.Read(first)
+	offset.readFails = 1
+	rest, err := io.ReadAll(r)
+	if data := string(first) + string(rest); err != nil || data != "3456789" {
+		t.Fatalf("Expected %q, got %q, %v", "3456789", data, err)
+	}
+	if want := []int64{3, 4}; !slices.Equal(offset.offsets, want) {
+		t.Fatalf("Expected OpenAt at %v, got %v", want, offset.offsets)
+	}
+
+	// Without OpenAt the data before the offset is skipped
+	plain := wrap(&flakyBackend{data: []byte("0123456789")}).(*retry.Backend)
+	r, _ = plain.OpenAt(7)
+	if data, _ := io.ReadAll(r); string(data) != "789" {
+		t.Fatalf("Expected %q, got %q", "789", data)
+	}
+}
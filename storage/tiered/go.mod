@@ -0,0 +1,12 @@
+module schneider.vip/hybridbuffer/storage/tiered
+
+go 1.23.0
+
+toolchain go1.24.0
+
+require (
+	schneider.vip/hybridbuffer/internal/storagewrap v0.0.0-00010101000000-000000000000
+	schneider.vip/hybridbuffer/storage v1.0.6
+)
+
+replace schneider.vip/hybridbuffer/internal/storagewrap => ../../internal/storagewrap
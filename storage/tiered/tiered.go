@@ -0,0 +1,208 @@
+// Package tiered provides a storage backend for HybridBuffer that moves data through tiers by size
+package tiered
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"schneider.vip/hybridbuffer/internal/storagewrap"
+	"schneider.vip/hybridbuffer/storage"
+)
+
+// Tier describes one storage level of a tiered backend
+type Tier struct {
+	// Provider creates the backend for this tier
+	Provider func() storage.Backend
+
+	// MaxSize is the number of bytes this tier may hold before data moves
+	// to the next tier. Zero means unlimited.
+	MaxSize int64
+}
+
+// Backend writes to the first tier and migrates to the next tier whenever
+// the current one would exceed its MaxSize
+type Backend struct {
+	tiers  []Tier
+	level  int
+	active storage.Backend
+	file   string // Name of the file written by the active tier, if any
+}
+
+// Create implements storage.Backend
+func (b *Backend) Create() (io.WriteCloser, error) {
+	if len(b.tiers) == 0 {
+		return nil, errors.New("no tiers configured")
+	}
+
+	// Start over in the first tier
+	if err := b.Remove(); err != nil {
+		return nil, err
+	}
+
+	active := b.tiers[0].Provider()
+	w, err := active.Create()
+	if err != nil {
+		return nil, err
+	}
+
+	b.level = 0
+	b.active = active
+	b.file = storagewrap.FileName(w)
+	return &writer{backend: b, w: w}, nil
+}
+
+// Open implements storage.Backend
+func (b *Backend) Open() (io.ReadCloser, error) {
+	if b.active == nil {
+		return nil, errors.New("no data created yet")
+	}
+	return b.active.Open()
+}
+
+// OpenAt opens the active tier at off, through its OpenAt if it has one,
+// otherwise by seeking or skipping the data before off
+func (b *Backend) OpenAt(off int64) (io.ReadCloser, error) {
+	if b.active == nil {
+		return nil, errors.New("no data created yet")
+	}
+	return storagewrap.OpenAt(b.active, off)
+}
+
+// Remove implements storage.Backend
+func (b *Backend) Remove() error {
+	if b.active == nil {
+		return nil
+	}
+	err := b.active.Remove()
+	b.active = nil
+	b.file = ""
+	return err
+}
+
+// Size returns the stored size if the active tier can report it, or if it wrote
+// to a local file, such as the filesystem backend
+// It returns errors.ErrUnsupported otherwise.
+func (b *Backend) Size() (int64, error) {
+	if b.active == nil {
+		return 0, errors.New("no data created yet")
+	}
+	return storagewrap.Size(b.active, b.file)
+}
+
+// Path returns the file path of the active tier if it keeps the data in a local file
+// It returns "" if no data was created yet or the active tier has no Path method
+// and did not write to an *os.File.
+func (b *Backend) Path() string {
+	if b.active == nil {
+		return ""
+	}
+	return storagewrap.Path(b.active, b.file)
+}
+
+// Level returns the index of the tier currently holding the data
+func (b *Backend) Level() int {
+	return b.level
+}
+
+// fits reports whether n bytes fit into the active tier
+func (b *Backend) fits(n int64) bool {
+	maxSize := b.tiers[b.level].MaxSize
+	return maxSize <= 0 || n <= maxSize || b.level == len(b.tiers)-1
+}
+
+// migrate copies the data of the active tier into the next tier
+// and removes it from the active one
+func (b *Backend) migrate(w io.WriteCloser) (io.WriteCloser, error) {
+	if err := w.Close(); err != nil {
+		return nil, fmt.Errorf("failed to close tier %d: %w", b.level, err)
+	}
+
+	next := b.tiers[b.level+1].Provider()
+	nw, err := next.Create()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create tier %d: %w", b.level+1, err)
+	}
+
+	r, err := b.active.Open()
+	if err != nil {
+		nw.Close()
+		next.Remove()
+		return nil, fmt.Errorf("failed to open tier %d: %w", b.level, err)
+	}
+	_, err = io.Copy(nw, r)
+	r.Close()
+	if err != nil {
+		nw.Close()
+		next.Remove()
+		return nil, fmt.Errorf("failed to migrate tier %d: %w", b.level, err)
+	}
+
+	if err := b.active.Remove(); err != nil {
+		// Keep the data in the active tier, where Remove can clean it up later
+		nw.Close()
+		next.Remove()
+		return nil, fmt.Errorf("failed to remove tier %d: %w", b.level, err)
+	}
+	b.active = next
+	b.file = storagewrap.FileName(nw)
+	b.level++
+	return nw, nil
+}
+
+// writer tracks the written size and migrates between tiers transparently
+type writer struct {
+	backend *Backend
+	w       io.WriteCloser
+	written int64
+	err     error // Failed migration, w is closed and later calls return it
+}
+
+// Write implements io.Writer
+func (w *writer) Write(p []byte) (int, error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+	for !w.backend.fits(w.written + int64(len(p))) {
+		nw, err := w.backend.migrate(w.w)
+		if err != nil {
+			// migrate closed the current writer before failing
+			w.w = nil
+			w.err = err
+			return 0, err
+		}
+		w.w = nw
+	}
+
+	n, err := w.w.Write(p)
+	w.written += int64(n)
+	return n, err
+}
+
+// Close implements io.Closer
+// After a failed migration it returns the migration error.
+func (w *writer) Close() error {
+	if w.err != nil {
+		return w.err
+	}
+	return w.w.Close()
+}
+
+// New creates a tiered storage backend provider function
+// Tiers are used in the given order; the last tier receives everything
+// that does not fit into the previous ones, regardless of its MaxSize.
+//
+// Example usage:
+//
+//	tiered.New(
+//		tiered.Tier{Provider: memcached.New(memcache.New("127.0.0.1:11211")), MaxSize: 1 << 20},
+//		tiered.Tier{Provider: filesystem.New(), MaxSize: 1 << 30},
+//		tiered.Tier{Provider: s3.New(client, bucket)},
+//	)
+func New(tiers ...Tier) func() storage.Backend {
+	return func() storage.Backend {
+		return &Backend{
+			tiers: tiers,
+		}
+	}
+}
@@ -0,0 +1,373 @@
+package tiered_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"testing"
+
+	"schneider.vip/hybridbuffer/storage"
+	"schneider.vip/hybridbuffer/storage/tiered"
+)
+
+// memoryBackend keeps data in memory and records whether it holds data
+type memoryBackend struct {
+	data    *bytes.Buffer
+	created bool
+	removed bool
+}
+
+func (m *memoryBackend) Create() (io.WriteCloser, error) {
+	m.created = true
+	m.data = &bytes.Buffer{}
+	return nopWriteCloser{m.data}, nil
+}
+
+func (m *memoryBackend) Open() (io.ReadCloser, error) {
+	return io.NopCloser(bytes.NewReader(m.data.Bytes())), nil
+}
+
+func (m *memoryBackend) Remove() error {
+	m.removed = true
+	m.data = nil
+	return nil
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
+
+func newTiers() ([]*memoryBackend, func() storage.Backend) {
+	backends := []*memoryBackend{{}, {}, {}}
+	provider := tiered.New(
+		tiered.Tier{Provider: func() storage.Backend { return backends[0] }, MaxSize: 10},
+		tiered.Tier{Provider: func() storage.Backend { return backends[1] }, MaxSize: 100},
+		tiered.Tier{Provider: func() storage.Backend { return backends[2] }},
+	)
+	return backends, provider
+}
+
+func writeAndRead(t *testing.T, backend storage.Backend, chunks ...[]byte) []byte {
+	t.Helper()
+
+	w, err := backend.Create()
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	for _, chunk := range chunks {
+		if _, err := w.Write(chunk); err != nil {
+			t.Fatalf("Write failed: %v", err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	r, err := backend.Open()
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer r.Close()
+
+	data, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("ReadAll failed: %v", err)
+	}
+	return data
+}
+
+func TestBackend_SmallDataStaysInFirstTier(t *testing.T) {
+	backends, provider := newTiers()
+	backend := provider()
+
+	data := writeAndRead(t, backend, []byte("small"))
+	if string(data) != "small" {
+		t.Fatalf("Expected %q, got %q", "small", string(data))
+	}
+	if level := backend.(*tiered.Backend).Level(); level != 0 {
+		t.Fatalf("Expected tier 0, got %d", level)
+	}
+	if backends[1].created || backends[2].created {
+		t.Fatal("Later tiers should not be used for small data")
+	}
+
+	backend.Remove()
+	if !backends[0].removed {
+		t.Fatal("Remove should target the first tier")
+	}
+}
+
+func TestBackend_MigratesThroughTiers(t *testing.T) {
+	backends, provider := newTiers()
+	backend := provider()
+
+	chunk := bytes.Repeat([]byte("0123456789"), 3)
+	var expected []byte
+	var chunks [][]byte
+	for i := 0; i < 5; i++ {
+		chunks = append(chunks, chunk)
+		expected = append(expected, chunk...)
+	}
+
+	data := writeAndRead(t, backend, chunks...)
+	if !bytes.Equal(data, expected) {
+		t.Fatalf("Data mismatch after migration: got %d bytes, expected %d", len(data), len(expected))
+	}
+	if level := backend.(*tiered.Backend).Level(); level != 2 {
+		t.Fatalf("Expected tier 2, got %d", level)
+	}
+	if !backends[0].removed || !backends[1].removed {
+		t.Fatal("Migrated tiers should be removed")
+	}
+
+	backend.Remove()
+	if !backends[2].removed {
+		t.Fatal("Remove should target the last tier")
+	}
+}
+
+func TestBackend_OpenBeforeCreate(t *testing.T) {
+	_, provider := newTiers()
+	if _, err := provider().Open(); err == nil {
+		t.Fatal("Expected error when opening before Create")
+	}
+}
+
+// sizedBackend is a memoryBackend that reports its size
+type sizedBackend struct {
+	memoryBackend
+}
+
+func (s *sizedBackend) Size() (int64, error) {
+	return int64(s.data.Len()), nil
+}
+
+func TestBackend_Size(t *testing.T) {
+	sized := &sizedBackend{}
+	backend := tiered.New(
+		tiered.Tier{Provider: func() storage.Backend { return &memoryBackend{} }, MaxSize: 10},
+		tiered.Tier{Provider: func() storage.Backend { return sized }},
+	)().(*tiered.Backend)
+
+	if _, err := backend.Size(); err == nil {
+		t.Fatal("Expected error before Create")
+	}
+
+	w, _ := backend.Create()
+	w.Write([]byte("small"))
+	if _, err := backend.Size(); !errors.Is(err, errors.ErrUnsupported) {
+		t.Fatalf("Expected ErrUnsupported for a tier without Size, got %v", err)
+	}
+
+	w.Write([]byte("moves to the sized tier"))
+	w.Close()
+	if size, err := backend.Size(); err != nil || size != 28 {
+		t.Fatalf("Expected size 28, got %d, %v", size, err)
+	}
+}
+
+// pathBackend is a memoryBackend that reports a file path
+type pathBackend struct {
+	memoryBackend
+}
+
+func (p *pathBackend) Path() string {
+	return "/tmp/tier"
+}
+
+func TestBackend_Path(t *testing.T) {
+	backend := tiered.New(
+		tiered.Tier{Provider: func() storage.Backend { return &memoryBackend{} }, MaxSize: 10},
+		tiered.Tier{Provider: func() storage.Backend { return &pathBackend{} }},
+	)().(*tiered.Backend)
+
+	if path := backend.Path(); path != "" {
+		t.Fatalf("Expected no path before Create, got %q", path)
+	}
+
+	w, _ := backend.Create()
+	w.Write([]byte("small"))
+	if path := backend.Path(); path != "" {
+		t.Fatalf("Expected no path for a tier without Path, got %q", path)
+	}
+
+	w.Write([]byte("moves to the file tier"))
+	w.Close()
+	if path := backend.Path(); path != "/tmp/tier" {
+		t.Fatalf("Expected /tmp/tier, got %q", path)
+	}
+}
+
+// fileBackend writes to a local file but has no Size or Path method
+type fileBackend struct {
+	dir  string
+	name string
+}
+
+func (f *fileBackend) Create() (io.WriteCloser, error) {
+	file, err := os.CreateTemp(f.dir, "tier-*")
+	if err != nil {
+		return nil, err
+	}
+	f.name = file.Name()
+	return file, nil
+}
+
+func (f *fileBackend) Open() (io.ReadCloser, error) { return os.Open(f.name) }
+func (f *fileBackend) Remove() error                { return os.Remove(f.name) }
+
+func TestBackend_FileTier(t *testing.T) {
+	file := &fileBackend{dir: t.TempDir()}
+	backend := tiered.New(
+		tiered.Tier{Provider: func() storage.Backend { return &memoryBackend{} }, MaxSize: 10},
+		tiered.Tier{Provider: func() storage.Backend { return file }},
+	)().(*tiered.Backend)
+
+	w, _ := backend.Create()
+	w.Write([]byte("moves to the file tier"))
+	w.Close()
+
+	if size, err := backend.Size(); err != nil || size != 22 {
+		t.Fatalf("Expected size 22 from the file, got %d, %v", size, err)
+	}
+	if path := backend.Path(); path != file.name {
+		t.Fatalf("Expected %q, got %q", file.name, path)
+	}
+}
+
+// offsetBackend is a memoryBackend that opens its data at an offset
+type offsetBackend struct {
+	memoryBackend
+	offsets []int64
+}
+
+func (o *offsetBackend) OpenAt(off int64) (io.ReadCloser, error) {
+	o.offsets = append(o.offsets, off)
+	return io.NopCloser(bytes.NewReader(o.data.Bytes()[off:])), nil
+}
+
+func TestBackend_OpenAt(t *testing.T) {
+	offset := &offsetBackend{}
+	backend := tiered.New(
+		tiered.Tier{Provider: func() storage.Backend { return &memoryBackend{} }, MaxSize: 10},
+		tiered.Tier{Provider: func() storage.Backend { return offset }},
+	)().(*tiered.Backend)
+
+	if _, err := backend.OpenAt(0); err == nil {
+		t.Fatal("Expected error before Create")
+	}
+
+	// The first tier has no OpenAt, the data before the offset is skipped
+	w, _ := backend.Create()
+	w.Write([]byte("small"))
+	r, _ := backend.OpenAt(2)
+	if data, _ := io.ReadAll(r); string(data) != "all" {
+		t.Fatalf("Expected %q, got %q", "all", data)
+	}
+
+	w.Write([]byte(" moves on"))
+	w.Close()
+	r, _ = backend.OpenAt(6)
+	if data, _ := io.ReadAll(r); string(data) != "moves on" {
+		t.Fatalf("Expected %q, got %q", "moves on", data)
+	}
+	if len(offset.offsets) != 1 || offset.offsets[0] != 6 {
+		t.Fatalf("Expected OpenAt of the active tier at 6, got %v", offset.offsets)
+	}
+}
+
+// countingBackend counts how often its writer is closed
+type countingBackend struct {
+	memoryBackend
+	closes int
+}
+
+func (c *countingBackend) Create() (io.WriteCloser, error) {
+	w, err := c.memoryBackend.Create()
+	return &countingWriter{WriteCloser: w, closes: &c.closes}, err
+}
+
+type countingWriter struct {
+	io.WriteCloser
+	closes *int
+}
+
+func (c *countingWriter) Close() error {
+	*c.closes++
+	return c.WriteCloser.Close()
+}
+
+// failingBackend cannot create objects
+type failingBackend struct {
+	memoryBackend
+}
+
+func (f *failingBackend) Create() (io.WriteCloser, error) {
+	return nil, errors.New("tier unavailable")
+}
+
+func TestBackend_FailedMigrationIsSticky(t *testing.T) {
+	first := &countingBackend{}
+	backend := tiered.New(
+		tiered.Tier{Provider: func() storage.Backend { return first }, MaxSize: 10},
+		tiered.Tier{Provider: func() storage.Backend { return &failingBackend{} }},
+	)()
+
+	w, err := backend.Create()
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	if _, err := w.Write([]byte("small")); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+
+	_, migrateErr := w.Write([]byte("does not fit"))
+	if migrateErr == nil {
+		t.Fatal("Expected the migration to fail")
+	}
+	if _, err := w.Write([]byte("x")); err != migrateErr {
+		t.Fatalf("Expected later writes to return %v, got %v", migrateErr, err)
+	}
+	if err := w.Close(); err != migrateErr {
+		t.Fatalf("Expected Close to return %v, got %v", migrateErr, err)
+	}
+	if first.closes != 1 {
+		t.Fatalf("Expected the first tier's writer to be closed once, got %d", first.closes)
+	}
+}
+
+// stuckBackend keeps data in memory but fails to remove it
+type stuckBackend struct {
+	memoryBackend
+}
+
+func (s *stuckBackend) Remove() error {
+	return errors.New("remove failed")
+}
+
+func TestBackend_FailedRemoveFailsMigration(t *testing.T) {
+	first := &stuckBackend{}
+	second := &memoryBackend{}
+	backend := tiered.New(
+		tiered.Tier{Provider: func() storage.Backend { return first }, MaxSize: 10},
+		tiered.Tier{Provider: func() storage.Backend { return second }},
+	)()
+
+	w, err := backend.Create()
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	w.Write([]byte("small"))
+	if _, err := w.Write([]byte("does not fit")); err == nil {
+		t.Fatal("Expected the failed removal to be reported")
+	}
+	if !second.removed {
+		t.Fatal("Expected the copy in the next tier to be removed")
+	}
+	if level := backend.(*tiered.Backend).Level(); level != 0 {
+		t.Fatalf("Expected the data to stay in tier 0, got %d", level)
+	}
+}
@@ -0,0 +1,73 @@
+package hybridbuffer
+
+import (
+	"fmt"
+	"io"
+)
+
+// Syncer is an optional interface for storage write streams that can commit
+// written data to durable storage without being closed, like *os.File
+type Syncer interface {
+	Sync() error
+}
+
+// flusher is implemented by middleware writers that can emit buffered data early
+type flusher interface {
+	Flush() error
+}
+
+// syncWriter is a storage write stream with its middleware pipeline applied
+// It keeps the middleware writers, so that Sync can flush them in order.
+type syncWriter struct {
+	io.WriteCloser
+	layers  []io.Writer // Middleware writers, first middleware first
+	storage io.Writer   // Storage write stream below the middlewares
+}
+
+// Sync flushes the middleware writers and syncs the storage stream
+func (w *syncWriter) Sync() error {
+	for _, layer := range w.layers {
+		if f, ok := layer.(flusher); ok {
+			if err := f.Flush(); err != nil {
+				return err
+			}
+		}
+	}
+	if syncer, ok := w.storage.(Syncer); ok {
+		return syncer.Sync()
+	}
+	return nil
+}
+
+// Sync commits the data written so far to durable storage while writing continues
+// In storage mode, queued asynchronous writes are completed, middlewares with a
+// Flush method (e.g. gzip) flush their buffered data, and the storage write stream
+// is synced if it implements Syncer, as files of the filesystem backend do.
+// Data held back by middlewares that cannot flush, such as the built-in encryption
+// sealing whole chunks, is not covered. In memory mode and once the write stream
+// was finalized by reading, Sync does nothing.
+func (b *hybridBuffer) Sync() error {
+	b.mu.Lock()
+	defer b.unlock()
+
+	if b.closed {
+		return ErrClosed
+	}
+	if !b.usingStorage || b.writeStream == nil {
+		return nil
+	}
+
+	writeStream := io.Writer(b.writeStream)
+	if async, ok := writeStream.(*asyncWriter); ok {
+		if err := async.wait(); err != nil {
+			return err
+		}
+		writeStream = async.dst
+	}
+	if syncer, ok := writeStream.(Syncer); ok {
+		if err := syncer.Sync(); err != nil {
+			return fmt.Errorf("failed to sync storage: %w", err)
+		}
+	}
+	return nil
+}
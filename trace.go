@@ -0,0 +1,62 @@
+package hybridbuffer
+
+import (
+	"context"
+	"fmt"
+
+	"schneider.vip/hybridbuffer/storage"
+)
+
+// Tracer creates spans for the storage operations of a buffer, see WithTracer
+// The core package does not depend on a tracing library; the tracing module adapts
+// an OpenTelemetry tracer to this interface.
+type Tracer interface {
+	// Start starts a span named name as a child of ctx. It returns a context
+	// carrying the span, which is the parent of spans started during the operation,
+	// and a function that ends the span, recording err unless it is nil.
+	// Attribute values are strings or int64s.
+	Start(ctx context.Context, name string, attrs map[string]any) (context.Context, func(err error))
+}
+
+// Span names of the storage operations traced with WithTracer
+const (
+	spanSpill  = "hybridbuffer.spill"
+	spanCreate = "hybridbuffer.create"
+	spanOpen   = "hybridbuffer.open"
+	spanRemove = "hybridbuffer.remove"
+)
+
+// startSpan starts a span for a storage operation on backend, recording the number
+// of bytes involved unless negative, and returns the function that ends it
+// The span is a child of the span in progress, or else of the buffer's context.
+// Until it ends, spans started by nested operations, such as the stream created
+// while spilling, become its children.
+// It must only be called with a tracer set and the lock held.
+func (b *hybridBuffer) startSpan(name string, backend storage.Backend, bytes int64) func(err error) {
+	attrs := map[string]any{"hybridbuffer.backend": fmt.Sprintf("%T", backend)}
+	if bytes >= 0 {
+		attrs["hybridbuffer.bytes"] = bytes
+	}
+	if b.id != "" {
+		attrs["hybridbuffer.id"] = b.id
+	}
+
+	parent := b.spanCtx
+	ctx, end := b.tracer.Start(b.spanContext(), name, attrs)
+	b.spanCtx = ctx
+	return func(err error) {
+		b.spanCtx = parent
+		end(err)
+	}
+}
+
+// spanContext returns the context of the span in progress, or else the buffer's context
+func (b *hybridBuffer) spanContext() context.Context {
+	if b.spanCtx != nil {
+		return b.spanCtx
+	}
+	if b.ctx != nil {
+		return b.ctx
+	}
+	return context.Background()
+}
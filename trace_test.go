@@ -0,0 +1,127 @@
+package hybridbuffer
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"schneider.vip/hybridbuffer/storage"
+)
+
+// recordingTracer records the spans it starts
+type recordingTracer struct {
+	spans []*recordingSpan
+}
+
+type spanKey struct{}
+
+func (t *recordingTracer) Start(ctx context.Context, name string, attrs map[string]any) (context.Context, func(error)) {
+	span := &recordingSpan{name: name, parent: ctx, attrs: attrs}
+	t.spans = append(t.spans, span)
+	return context.WithValue(ctx, spanKey{}, span), func(err error) {
+		span.err = err
+		span.ended = true
+	}
+}
+
+func (t *recordingTracer) names() []string {
+	var names []string
+	for _, span := range t.spans {
+		names = append(names, span.name)
+	}
+	return names
+}
+
+type recordingSpan struct {
+	name   string
+	parent context.Context
+	attrs  map[string]any
+	err    error
+	ended  bool
+}
+
+// parentSpan returns the span the span was started in, nil for a root span
+func (s *recordingSpan) parentSpan() *recordingSpan {
+	parent, _ := s.parent.Value(spanKey{}).(*recordingSpan)
+	return parent
+}
+
+type ctxKey struct{}
+
+func TestWithTracer(t *testing.T) {
+	tracer := &recordingTracer{}
+	ctx := context.WithValue(context.Background(), ctxKey{}, "parent")
+	buf := New(
+		WithThreshold(8),
+		WithTracer(tracer),
+		WithContext(ctx),
+		WithID("traced"),
+		WithStorage(func() storage.Backend { return &mockStorageBackend{} }),
+	)
+
+	buf.WriteString("12345")
+	if len(tracer.spans) != 0 {
+		t.Fatalf("Expected no spans in memory mode, got %v", tracer.names())
+	}
+	buf.WriteString("6789")
+	_ = buf.String()
+	buf.Close()
+
+	want := []string{spanSpill, spanCreate, spanOpen, spanRemove}
+	if got := tracer.names(); !slices.Equal(got, want) {
+		t.Fatalf("Expected spans %v, got %v", want, got)
+	}
+	for _, span := range tracer.spans {
+		if !span.ended || span.err != nil {
+			t.Fatalf("Span %s: expected ended without error", span.name)
+		}
+		if span.parent.Value(ctxKey{}) != "parent" {
+			t.Fatalf("Span %s: expected the buffer's context as parent", span.name)
+		}
+		if backend := span.attrs["hybridbuffer.backend"]; backend != "*hybridbuffer.mockStorageBackend" {
+			t.Fatalf("Span %s: unexpected backend %v", span.name, backend)
+		}
+		if id := span.attrs["hybridbuffer.id"]; id != "traced" {
+			t.Fatalf("Span %s: expected id traced, got %v", span.name, id)
+		}
+	}
+	if n := tracer.spans[0].attrs["hybridbuffer.bytes"]; n != int64(5) {
+		t.Fatalf("Expected 5 spilled bytes, got %v", n)
+	}
+	if n := tracer.spans[2].attrs["hybridbuffer.bytes"]; n != int64(9) {
+		t.Fatalf("Expected 9 bytes to read, got %v", n)
+	}
+
+	// Only the stream created while spilling is nested
+	spill := tracer.spans[0]
+	for _, span := range tracer.spans {
+		want := (*recordingSpan)(nil)
+		if span.name == spanCreate {
+			want = spill
+		}
+		if parent := span.parentSpan(); parent != want {
+			t.Fatalf("Span %s: expected parent span %v, got %v", span.name, want, parent)
+		}
+	}
+}
+
+func TestWithTracer_Error(t *testing.T) {
+	tracer := &recordingTracer{}
+	buf := New(
+		WithThreshold(4),
+		WithTracer(tracer),
+		WithStorage(func() storage.Backend { return &failingStorageBackend{createErr: errors.New("create failed")} }),
+	)
+	defer buf.Close()
+
+	if _, err := buf.WriteString("spill fails"); err == nil {
+		t.Fatal("Expected the spill to fail")
+	}
+	for _, name := range []string{spanSpill, spanCreate} {
+		i := slices.Index(tracer.names(), name)
+		if i < 0 || tracer.spans[i].err == nil || !tracer.spans[i].ended {
+			t.Fatalf("Expected an ended %s span with error, got %v", name, tracer.names())
+		}
+	}
+}
@@ -0,0 +1,10 @@
+module schneider.vip/hybridbuffer/tracing
+
+go 1.23.0
+
+toolchain go1.24.0
+
+require (
+	go.opentelemetry.io/otel v1.37.0
+	go.opentelemetry.io/otel/trace v1.37.0
+)
@@ -0,0 +1,54 @@
+// Package tracing provides OpenTelemetry spans for HybridBuffer
+//
+// The core package does not depend on OpenTelemetry. Buffers report their storage
+// operations through the hybridbuffer.Tracer hook, which the Tracer of this package
+// implements, so only programs that opt in pull in the OpenTelemetry API.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Tracer creates OpenTelemetry spans for the storage operations of buffers
+// Pass it to hybridbuffer.WithTracer.
+type Tracer struct {
+	tracer trace.Tracer
+}
+
+// New creates a Tracer starting its spans with tracer
+func New(tracer trace.Tracer) *Tracer {
+	return &Tracer{tracer: tracer}
+}
+
+// Start implements hybridbuffer.Tracer
+// The attributes are recorded on the span; a non-nil error passed to the returned
+// function is recorded and sets the span status to error.
+func (t *Tracer) Start(ctx context.Context, name string, attrs map[string]any) (context.Context, func(err error)) {
+	kvs := make([]attribute.KeyValue, 0, len(attrs))
+	for _, key := range slices.Sorted(maps.Keys(attrs)) {
+		switch value := attrs[key].(type) {
+		case string:
+			kvs = append(kvs, attribute.String(key, value))
+		case int64:
+			kvs = append(kvs, attribute.Int64(key, value))
+		default:
+			kvs = append(kvs, attribute.String(key, fmt.Sprint(value)))
+		}
+	}
+
+	ctx, span := t.tracer.Start(ctx, name, trace.WithAttributes(kvs...))
+	return ctx, func(err error) {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}
+}
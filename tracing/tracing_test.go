@@ -0,0 +1,75 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+// hook mirrors hybridbuffer.Tracer, which this package must implement
+type hook interface {
+	Start(ctx context.Context, name string, attrs map[string]any) (context.Context, func(err error))
+}
+
+var _ hook = (*Tracer)(nil)
+
+// recordingTracer records the spans it starts
+type recordingTracer struct {
+	noop.Tracer
+	spans []*recordingSpan
+}
+
+func (t *recordingTracer) Start(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	config := trace.NewSpanStartConfig(opts...)
+	span := &recordingSpan{name: name, attrs: config.Attributes()}
+	t.spans = append(t.spans, span)
+	return trace.ContextWithSpan(ctx, span), span
+}
+
+type recordingSpan struct {
+	noop.Span
+	name   string
+	attrs  []attribute.KeyValue
+	errs   []error
+	status codes.Code
+	ended  bool
+}
+
+func (s *recordingSpan) RecordError(err error, _ ...trace.EventOption) { s.errs = append(s.errs, err) }
+func (s *recordingSpan) SetStatus(code codes.Code, _ string)           { s.status = code }
+func (s *recordingSpan) End(...trace.SpanEndOption)                    { s.ended = true }
+
+func TestTracer(t *testing.T) {
+	recorder := &recordingTracer{}
+	tracer := New(recorder)
+
+	ctx, end := tracer.Start(context.Background(), "hybridbuffer.spill", map[string]any{
+		"hybridbuffer.id":    "traced",
+		"hybridbuffer.bytes": int64(5),
+	})
+	if trace.SpanFromContext(ctx) != recorder.spans[0] {
+		t.Fatal("Expected the returned context to carry the span")
+	}
+
+	// Nested spans are started from the returned context
+	_, endNested := tracer.Start(ctx, "hybridbuffer.create", nil)
+	endNested(errors.New("create failed"))
+	end(nil)
+
+	spill, create := recorder.spans[0], recorder.spans[1]
+	want := []attribute.KeyValue{attribute.Int64("hybridbuffer.bytes", 5), attribute.String("hybridbuffer.id", "traced")}
+	if len(spill.attrs) != len(want) || spill.attrs[0] != want[0] || spill.attrs[1] != want[1] {
+		t.Fatalf("Expected attributes %v, got %v", want, spill.attrs)
+	}
+	if !spill.ended || spill.status != codes.Unset || len(spill.errs) != 0 {
+		t.Fatalf("Expected the spill span ended without error, got status %v, errors %v", spill.status, spill.errs)
+	}
+	if !create.ended || create.status != codes.Error || len(create.errs) != 1 {
+		t.Fatalf("Expected the create span ended with error, got status %v, errors %v", create.status, create.errs)
+	}
+}
@@ -0,0 +1,96 @@
+package hybridbuffer
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// errWriteAtUnsupported is returned by WriteAt for spilled data it cannot patch
+var errWriteAtUnsupported = fmt.Errorf("hybridbuffer: WriteAt on spilled data requires a storage stream implementing io.WriterAt and no middlewares: %w", errors.ErrUnsupported)
+
+// WriteAt implements io.WriterAt, e.g. to patch a header after writing the payload
+// Offsets are positions in the contents as seen by NewReader: 0 is the first byte
+// written since the buffer was created or reset, until compaction drops read data.
+// Bytes below Size() are overwritten in place; bytes beyond it are appended like
+// Write, with a gap filled with zeros. The read position is not changed, and the
+// digest of WithHash covers the data as originally written.
+//
+// Spilled data can only be overwritten if the buffer has no middlewares and the
+// storage write stream implements io.WriterAt, like the *os.File of the filesystem
+// backend, and only while the write stream is open, which reading keeps only for
+// such files (see Write); otherwise an error wrapping errors.ErrUnsupported is returned.
+func (b *hybridBuffer) WriteAt(p []byte, off int64) (n int, err error) {
+	b.mu.Lock()
+	defer b.unlock()
+
+	if b.closed {
+		return 0, ErrClosed
+	}
+	if b.readOnly {
+		return 0, ErrReadOnly
+	}
+	if off < 0 {
+		return 0, errors.New("hybridbuffer: negative offset")
+	}
+
+	// Overwrite the part within the current contents
+	if off < int64(b.size) {
+		inPlace := p[:min(int64(len(p)), int64(b.size)-off)]
+		if n, err = b.overwrite(inPlace, off); err != nil {
+			return n, err
+		}
+		p = p[n:]
+		off += int64(n)
+	}
+	if len(p) == 0 {
+		return n, nil
+	}
+
+	// Extend the contents, zero-filling any gap
+	if gap := off - int64(b.size); gap > 0 {
+		if _, err = b.writeLimited(make([]byte, gap)); err != nil {
+			return n, err
+		}
+	}
+	m, err := b.writeLimited(p)
+	return n + m, err
+}
+
+// overwrite replaces the bytes at off, which lie within the current contents
+func (b *hybridBuffer) overwrite(p []byte, off int64) (int, error) {
+	if !b.usingStorage {
+		return copy(b.memoryBuffer.Bytes()[off:], p), nil
+	}
+	if len(b.middlewares) > 0 || b.writeStream == nil {
+		return 0, errWriteAtUnsupported
+	}
+
+	writeStream := io.Writer(b.writeStream)
+	if async, ok := writeStream.(*asyncWriter); ok {
+		// Queued data must reach storage before it is overwritten
+		if err := async.wait(); err != nil {
+			return 0, err
+		}
+		writeStream = async.dst
+	}
+	sw, ok := writeStream.(*syncWriter)
+	if !ok {
+		return 0, errWriteAtUnsupported
+	}
+	wa, ok := sw.storage.(io.WriterAt)
+	if !ok {
+		return 0, errWriteAtUnsupported
+	}
+	b.readCache.Store(nil)
+	n, err := wa.WriteAt(p, off+b.formatHeaderLen())
+	if err != nil {
+		return n, fmt.Errorf("failed to write to storage: %w", storageError(err))
+	}
+	if pr, ok := b.readStream.(*pushbackReader); ok && len(pr.pending) > 0 {
+		// Pushed back bytes may predate the patch, reading resumes from storage
+		b.readStream.Close()
+		b.readStream = nil
+	}
+	return n, nil
+}